@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/backup"
+	"qcc_plus/internal/store"
+)
+
+const backupUsage = `usage:
+  cccli backup export [-dsn DSN] [-format json|yaml] [-o FILE] [-passphrase-file FILE]
+  cccli backup import -i FILE [-dsn DSN] [-mode merge|replace] [-dry-run] [-passphrase-file FILE]
+
+DSN 默认读取 PROXY_STORE_DSN / PROXY_MYSQL_DSN；加密口令可通过 BACKUP_PASSPHRASE 环境变量提供。
+直接导入数据库后需要重启服务才能生效；在线导入请使用 POST /admin/api/backup/import。`
+
+// runBackup 处理 cccli backup 子命令，直接读写数据库完成配置备份与恢复。
+func runBackup(args []string) error {
+	if len(args) == 0 {
+		return errors.New(backupUsage)
+	}
+	fs := flag.NewFlagSet("backup "+args[0], flag.ContinueOnError)
+	dsn := fs.String("dsn", firstNonEmpty(os.Getenv("PROXY_STORE_DSN"), os.Getenv("PROXY_MYSQL_DSN")), "store DSN")
+	passFile := fs.String("passphrase-file", "", "file containing the encryption passphrase")
+	format := fs.String("format", "json", "export format: json|yaml")
+	output := fs.String("o", "-", "export output file, - for stdout")
+	input := fs.String("i", "", "bundle file to import, - for stdin")
+	mode := fs.String("mode", string(backup.ModeMerge), "import mode: merge|replace")
+	dryRun := fs.Bool("dry-run", false, "only print the import plan")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dsn == "" {
+		return errors.New("missing -dsn (or PROXY_STORE_DSN)")
+	}
+	passphrase := os.Getenv("BACKUP_PASSPHRASE")
+	if *passFile != "" {
+		b, err := os.ReadFile(*passFile)
+		if err != nil {
+			return err
+		}
+		passphrase = strings.TrimSpace(string(b))
+	}
+
+	st, err := store.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "export":
+		encoding, err := backup.ParseEncoding(*format)
+		if err != nil {
+			return err
+		}
+		bundle, err := backup.Export(ctx, st)
+		if err != nil {
+			return err
+		}
+		data, err := backup.Encode(bundle, encoding, passphrase)
+		if err != nil {
+			return err
+		}
+		if *output == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		return os.WriteFile(*output, data, 0o600)
+	case "import":
+		m, err := backup.ParseMode(*mode)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		switch *input {
+		case "":
+			return errors.New("missing -i FILE")
+		case "-":
+			data, err = io.ReadAll(os.Stdin)
+		default:
+			data, err = os.ReadFile(*input)
+		}
+		if err != nil {
+			return err
+		}
+		bundle, err := backup.Decode(data, passphrase)
+		if err != nil {
+			return err
+		}
+		plan, err := backup.Import(ctx, st, bundle, m, *dryRun)
+		if err != nil {
+			return err
+		}
+		printPlan(os.Stdout, plan, *dryRun)
+		return nil
+	default:
+		return errors.New(backupUsage)
+	}
+}
+
+func printPlan(w io.Writer, plan *backup.Plan, dryRun bool) {
+	for _, c := range plan.Changes {
+		sign := map[string]string{backup.ActionCreate: "+", backup.ActionUpdate: "~", backup.ActionDelete: "-"}[c.Action]
+		fmt.Fprintf(w, "%s %s %s\n", sign, c.Kind, c.Key)
+	}
+	verb := "applied"
+	if dryRun {
+		verb = "planned (dry run)"
+	}
+	fmt.Fprintf(w, "%d changes %s, %d unchanged, mode=%s\n", len(plan.Changes), verb, plan.Unchanged, plan.Mode)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"qcc_plus/internal/client"
@@ -44,6 +46,53 @@ func buildLocalURL(listenAddr string) string {
 	return host
 }
 
+// serveUntilSignal 运行代理直到收到退出信号。
+// SIGINT/SIGTERM 优雅关闭；SIGHUP 先把监听 socket 交给新进程，成功后再排空退出，失败则继续服务。
+// 排空等待时间由 SHUTDOWN_TIMEOUT 控制（默认 30s）。
+func serveUntilSignal(srv *proxy.Server) error {
+	shutdownTimeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			shutdownTimeout = d
+		} else {
+			log.Printf("invalid SHUTDOWN_TIMEOUT=%s, fallback to %v", v, shutdownTimeout)
+		}
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Start() }()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				log.Printf("received SIGHUP, handing off listener to new process")
+				if err := srv.Handoff(); err != nil {
+					log.Printf("handoff failed, keep serving: %v", err)
+					continue
+				}
+			}
+			log.Printf("received %s, shutting down (timeout %v)", sig, shutdownTimeout)
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			err := srv.Shutdown(ctx)
+			cancel()
+			if startErr := <-errCh; startErr != nil {
+				return startErr
+			}
+			if err != nil {
+				log.Printf("shutdown: %v", err)
+			}
+			return nil
+		}
+	}
+}
+
 func main() {
 	if len(os.Args) > 1 && os.Args[1] == "proxy" {
 		info := version.GetVersionInfo()
@@ -79,7 +128,8 @@ func main() {
 				log.Printf("invalid PROXY_HEALTH_CHECK_ALL_INTERVAL=%s, fallback to %v", v, healthAllInterval)
 			}
 		}
-		mysqlDSN := os.Getenv("PROXY_MYSQL_DSN")
+		// PROXY_STORE_DSN 优先；sqlite:// 前缀启用内嵌 SQLite，其余按 MySQL DSN 处理。
+		storeDSN := firstNonEmpty(os.Getenv("PROXY_STORE_DSN"), os.Getenv("PROXY_MYSQL_DSN"))
 		adminKey := os.Getenv("ADMIN_API_KEY")
 		if adminKey == "" {
 			adminKey = "admin"
@@ -102,9 +152,11 @@ func main() {
 			WithFailLimit(failLimit).
 			WithHealthEvery(healthEvery).
 			WithHealthAllInterval(healthAllInterval).
-			WithStoreDSN(mysqlDSN).
+			WithStoreDSN(storeDSN).
 			WithAdminKey(adminKey).
 			WithDefaultAccount(defaultAccountName, defaultProxyKey).
+			WithTLS(os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")).
+			WithClientCA(os.Getenv("TLS_CLIENT_CA_FILE"), os.Getenv("TLS_CLIENT_AUTH")).
 			WithTransport(nil).
 			WithEnv().
 			Build()
@@ -134,7 +186,14 @@ func main() {
 			}
 		}
 
-		if err := srv.Start(); err != nil {
+		if err := serveUntilSignal(srv); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		if err := runBackup(os.Args[2:]); err != nil {
 			log.Fatal(err)
 		}
 		return
@@ -23,6 +23,7 @@ export default function NodeCard({ node, historyRefreshKey, healthEvent, shareTo
   const healthStatus = rawHealthStatus === 'up' ? 'up' : 'down'
   const checkMethod = (node.health?.check_method || 'api').toUpperCase()
   const lastPing = Number(node.health?.last_ping_ms ?? 0)
+  const passiveScore = node.passive?.score
   const lastCheckShort = node.health?.last_check_at
     ? node.health.last_check_at.replace(/^\d{4}年\d{2}月\d{2}日\s*/, '')
     : '--'
@@ -55,6 +56,12 @@ export default function NodeCard({ node, historyRefreshKey, healthEvent, shareTo
             <span className="sep">|</span>
             <span className="metric">请求 <strong>{totalReq.toLocaleString()}</strong></span>
             <span className="metric secondary">/失败 <strong className={failedReq > 0 ? 'danger' : ''}>{failedReq.toLocaleString()}</strong></span>
+            {passiveScore != null && (
+              <>
+                <span className="sep">|</span>
+                <span className="metric">评分 <strong className={passiveScore < 70 ? 'danger' : ''}>{passiveScore.toFixed(0)}</strong></span>
+              </>
+            )}
           </div>
         )}
         {preference.showHealth && (
@@ -82,6 +89,8 @@ export default function NodeCard({ node, historyRefreshKey, healthEvent, shareTo
       <div className="node-card__footer">
         <div className="node-card__badges">
           {node.disabled && <span className="badge badge-muted">已停用</span>}
+          {node.passive?.ejected_until && <span className="badge badge-muted">已摘除至 {node.passive.ejected_until}</span>}
+          {!node.passive?.ejected_until && node.passive?.demoted && <span className="badge badge-muted">已降权</span>}
         </div>
       </div>
     </div>
@@ -4,16 +4,27 @@ import Card from '../components/Card'
 import Toast from '../components/Toast'
 import useDialog from '../hooks/useDialog'
 import api from '../services/api'
-import type { EventType, NotificationChannel, NotificationSubscription } from '../types'
+import type { EventType, NotificationChannel, NotificationSubscription, SubscriptionRules } from '../types'
 import { formatBeijingTime } from '../utils/date'
 import './Notifications.css'
 
 const channelTypes = [
   { value: 'wechat_work', label: '企业微信' },
-  { value: 'dingtalk', label: '钉钉（待支持）' },
-  { value: 'email', label: '邮件（待支持）' },
+  { value: 'dingtalk', label: '钉钉' },
+  { value: 'slack', label: 'Slack' },
+  { value: 'webhook', label: '通用 Webhook' },
+  { value: 'email', label: '邮件（SMTP）' },
 ]
 
+// 各渠道附加配置示例，与 Webhook URL 合并后提交。
+const extraConfigHints: Record<string, string> = {
+  dingtalk: '{"secret": "SEC..."}',
+  slack: '{"channel": "#ops"}',
+  webhook: '{"secret": "...", "headers": {"Authorization": "Bearer ..."}}',
+  email:
+    '{"host": "smtp.example.com", "port": 587, "username": "bot", "password": "...", "from": "bot@example.com", "to": ["ops@example.com"]}',
+}
+
 const eventCategories: Record<string, string> = {
   node: '节点相关',
   request: '请求相关',
@@ -29,6 +40,7 @@ export default function Notifications() {
   const [name, setName] = useState('')
   const [channelType, setChannelType] = useState(channelTypes[0]?.value || 'wechat_work')
   const [webhook, setWebhook] = useState('')
+  const [extraConfig, setExtraConfig] = useState('')
   const [enabled, setEnabled] = useState('true')
 
   const [eventTypes, setEventTypes] = useState<EventType[]>([])
@@ -37,6 +49,7 @@ export default function Notifications() {
   const [selectedEvents, setSelectedEvents] = useState<Set<string>>(new Set())
   const [selectedChannelId, setSelectedChannelId] = useState('')
   const [savingSubs, setSavingSubs] = useState(false)
+  const [rulesText, setRulesText] = useState('')
 
   const [testChannelId, setTestChannelId] = useState('')
   const [testTitle, setTestTitle] = useState('')
@@ -59,9 +72,12 @@ export default function Notifications() {
     setName('')
     setChannelType(channelTypes[0]?.value || 'wechat_work')
     setWebhook('')
+    setExtraConfig('')
     setEnabled('true')
   }
 
+  const needsWebhook = channelType !== 'email'
+
   const scrollToForm = () => {
     if (formRef.current) {
       formRef.current.scrollIntoView({ behavior: 'smooth', block: 'start' })
@@ -120,6 +136,8 @@ export default function Notifications() {
       const safeList = Array.isArray(list) ? list : []
       setSubscriptions(safeList)
       setSelectedEvents(new Set(safeList.filter((s) => s.enabled).map((s) => s.event_type)))
+      const withRules = safeList.find((s) => s.rules)
+      setRulesText(withRules?.rules ? JSON.stringify(withRules.rules, null, 2) : '')
     } catch (err) {
       console.error('Failed to load notification subscriptions:', err)
       setSubscriptions([])
@@ -150,21 +168,38 @@ export default function Notifications() {
       showToast('请输入渠道名称', 'error')
       return
     }
-    if (!editingId && !webhook.trim()) {
+    if (!editingId && needsWebhook && !webhook.trim()) {
       showToast('Webhook URL 必填', 'error')
       return
     }
+    let extra: Record<string, unknown> = {}
+    if (extraConfig.trim()) {
+      try {
+        extra = JSON.parse(extraConfig)
+      } catch {
+        showToast('附加配置不是合法的 JSON', 'error')
+        return
+      }
+    }
+    if (!editingId && !needsWebhook && Object.keys(extra).length === 0) {
+      showToast('请填写邮件 SMTP 配置', 'error')
+      return
+    }
+    const config: Record<string, unknown> = { ...extra }
+    if (needsWebhook && webhook.trim()) {
+      config.webhook_url = webhook.trim()
+    }
 
     setChannelSaving(true)
     try {
       if (editingId) {
-        const payload: Partial<{ name: string; channel_type: string; enabled: boolean; config: { webhook_url?: string } }> = {
+        const payload: Partial<{ name: string; channel_type: string; enabled: boolean; config: Record<string, unknown> }> = {
           name: name.trim(),
           channel_type: channelType,
           enabled: enabled === 'true',
         }
-        if (webhook.trim()) {
-          payload.config = { webhook_url: webhook.trim() }
+        if (Object.keys(config).length > 0) {
+          payload.config = config
         }
         await api.updateNotificationChannel(editingId, payload)
         showToast('渠道已更新')
@@ -173,7 +208,7 @@ export default function Notifications() {
           name: name.trim(),
           channel_type: channelType,
           enabled: enabled === 'true',
-          config: { webhook_url: webhook.trim() },
+          config,
         })
         showToast('渠道已创建')
       }
@@ -192,6 +227,7 @@ export default function Notifications() {
     setChannelType(ch.channel_type)
     setEnabled(ch.enabled ? 'true' : 'false')
     setWebhook('')
+    setExtraConfig('')
     scrollToForm()
   }
 
@@ -244,8 +280,17 @@ export default function Notifications() {
     const enabledSet = new Set(selectedEvents)
     const currentMap = new Map(subscriptions.map((s) => [s.event_type, s]))
     const toCreate = Array.from(enabledSet).filter((et) => !currentMap.has(et))
-    const toEnable = subscriptions.filter((s) => enabledSet.has(s.event_type) && !s.enabled)
     const toDisable = subscriptions.filter((s) => !enabledSet.has(s.event_type) && s.enabled)
+    const toKeep = subscriptions.filter((s) => enabledSet.has(s.event_type))
+    let rules: SubscriptionRules | null = null
+    if (rulesText.trim()) {
+      try {
+        rules = JSON.parse(rulesText)
+      } catch {
+        showToast('订阅规则不是合法的 JSON', 'error')
+        return
+      }
+    }
 
     setSavingSubs(true)
     try {
@@ -254,10 +299,12 @@ export default function Notifications() {
           channel_id: selectedChannelId,
           event_types: toCreate,
           enabled: true,
+          rules,
         })
       }
-      if (toEnable.length) {
-        await Promise.all(toEnable.map((s) => api.updateNotificationSubscription(s.id, true)))
+      // 规则作用于该渠道所有已勾选的订阅
+      if (toKeep.length) {
+        await Promise.all(toKeep.map((s) => api.updateNotificationSubscription(s.id, true, rules)))
       }
       if (toDisable.length) {
         await Promise.all(toDisable.map((s) => api.updateNotificationSubscription(s.id, false)))
@@ -324,16 +371,30 @@ export default function Notifications() {
               ))}
             </select>
           </label>
-          <label>
-            Webhook URL {editingId ? <span className="muted">（留空则不修改）</span> : null}
-            <input
-              value={webhook}
-              onChange={(e) => setWebhook(e.target.value)}
-              placeholder={editingId ? '留空保持不变' : 'https://example.com/webhook'}
-              type="url"
-              required={!editingId}
-            />
-          </label>
+          {needsWebhook ? (
+            <label>
+              Webhook URL {editingId ? <span className="muted">（留空则不修改）</span> : null}
+              <input
+                value={webhook}
+                onChange={(e) => setWebhook(e.target.value)}
+                placeholder={editingId ? '留空保持不变' : 'https://example.com/webhook'}
+                type="url"
+                required={!editingId}
+              />
+            </label>
+          ) : null}
+          {extraConfigHints[channelType] ? (
+            <label>
+              {needsWebhook ? '附加配置（JSON，可选）' : 'SMTP 配置（JSON）'}
+              {editingId ? <span className="muted">（留空则不修改）</span> : null}
+              <textarea
+                value={extraConfig}
+                onChange={(e) => setExtraConfig(e.target.value)}
+                placeholder={extraConfigHints[channelType]}
+                rows={3}
+              />
+            </label>
+          ) : null}
           <label>
             启用状态
             <select value={enabled} onChange={(e) => setEnabled(e.target.value)}>
@@ -514,7 +575,10 @@ export default function Notifications() {
                               />
                               <div>
                                 <div className="event-type">{evt.type}</div>
-                                <div className="event-desc">{evt.description}</div>
+                                <div className="event-desc">
+                                  {evt.description}
+                                  {evt.severity ? <span className="muted"> · {evt.severity}</span> : null}
+                                </div>
                                 <div className="event-meta muted">
                                   {sub
                                     ? `创建：${formatBeijingTime(sub.created_at)}${sub.updated_at ? ` · 更新：${formatBeijingTime(sub.updated_at)}` : ''}`
@@ -531,6 +595,17 @@ export default function Notifications() {
               })}
             </div>
           )}
+          {selectedChannelId ? (
+            <label style={{ display: 'block', marginTop: 16 }}>
+              订阅规则（JSON，可选，作用于已勾选事件）
+              <textarea
+                value={rulesText}
+                onChange={(e) => setRulesText(e.target.value)}
+                placeholder='{"node_ids": ["node-1"], "min_severity": "warning", "group": {"window_sec": 120, "resolved": true}, "quiet_hours": {"start": "23:00", "end": "07:00", "allow_critical": true}, "language": "en"}'
+                rows={3}
+              />
+            </label>
+          ) : null}
           <div className="form-actions" style={{ marginTop: 16 }}>
             <button className="btn primary" type="button" onClick={handleSaveSubscriptions} disabled={!selectedChannelId || savingSubs}>
               保存订阅
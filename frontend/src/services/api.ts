@@ -1,6 +1,7 @@
 import type {
   Account,
   Node,
+  HealthProbe,
   Config,
   TunnelState,
   VersionInfo,
@@ -8,6 +9,7 @@ import type {
   CreateChannelRequest,
   NotificationSubscription,
   CreateSubscriptionsRequest,
+  SubscriptionRules,
   EventType,
   TestNotificationRequest,
   MonitorDashboard,
@@ -65,7 +67,14 @@ async function login(username: string, password: string): Promise<void> {
     redirect: 'follow',
   })
   if (!res.ok) {
-    throw new Error('登录失败')
+    let message = '登录失败'
+    try {
+      const data = await res.json()
+      if (data?.error) message = data.error
+    } catch {
+      // ignore non-json body
+    }
+    throw new Error(message)
   }
   // validate session by requesting an authenticated endpoint
   try {
@@ -135,6 +144,10 @@ async function createNode(payload: {
 	weight?: number
 	health_check_method?: Node['health_check_method']
 	health_check_model?: string
+	supported_models?: string[]
+	model_map?: Record<string, string>
+	health_probes?: HealthProbe[]
+	price_multiplier?: number
 }, accountId?: string): Promise<string> {
 	const data = await request<{ id: string }>(withAccount('/admin/api/nodes', accountId), {
 		method: 'POST',
@@ -144,7 +157,7 @@ async function createNode(payload: {
 	return data.id
 }
 
-async function updateNode(id: string, payload: Partial<Pick<Node, 'name' | 'base_url' | 'weight' | 'health_check_method' | 'health_check_model'>> & { api_key?: string }): Promise<void> {
+async function updateNode(id: string, payload: Partial<Pick<Node, 'name' | 'base_url' | 'weight' | 'health_check_method' | 'health_check_model' | 'supported_models' | 'model_map' | 'health_probes' | 'price_multiplier'>> & { api_key?: string }): Promise<void> {
 	await request(`/admin/api/nodes?id=${encodeURIComponent(id)}`, {
 		method: 'PUT',
 		headers: defaultHeaders,
@@ -368,11 +381,15 @@ async function createNotificationSubscriptions(data: CreateSubscriptionsRequest)
   })
 }
 
-async function updateNotificationSubscription(id: string, enabled: boolean): Promise<void> {
+async function updateNotificationSubscription(
+  id: string,
+  enabled: boolean,
+  rules?: SubscriptionRules | null,
+): Promise<void> {
   await request(`/api/notification/subscriptions/${encodeURIComponent(id)}`, {
     method: 'PUT',
     headers: defaultHeaders,
-    body: JSON.stringify({ enabled }),
+    body: JSON.stringify(rules === undefined ? { enabled } : { enabled, rules }),
   })
 }
 
@@ -5,13 +5,31 @@ export interface Account {
   is_admin: boolean;
 }
 
+export interface HealthProbe {
+  type: string;
+  model?: string;
+  timeout_sec?: number;
+  interval_sec?: number;
+  method?: string;
+  url?: string;
+  headers?: Record<string, string>;
+  body?: string;
+  expect_status?: number;
+  expect_body?: string;
+}
+
 export interface Node {
   id: string;
   name: string;
   base_url: string;
   weight: number;
-  health_check_method?: 'api' | 'head' | 'cli';
+  health_check_method?: 'api' | 'head' | 'cli' | 'stream' | 'count_tokens' | 'tool_use' | 'http';
   health_check_model?: string;
+  supported_models?: string[] | null;
+  model_map?: Record<string, string> | null;
+  health_probes?: HealthProbe[] | null;
+  price_multiplier?: number;
+  health_score?: PassiveHealth;
   has_api_key?: boolean;
   active: boolean;
   failed: boolean;
@@ -72,6 +90,9 @@ export interface NotificationChannel {
   name: string;
   channel_type: string; // wechat_work, email, dingtalk, etc.
   enabled: boolean;
+  language?: string; // zh / en，空表示默认中文
+  title_template?: string;
+  content_template?: string;
   created_at: string;
   updated_at?: string;
 }
@@ -86,11 +107,22 @@ export interface CreateChannelRequest {
   enabled: boolean;
 }
 
+export interface SubscriptionRules {
+  node_ids?: string[];
+  min_severity?: string; // info / warning / critical
+  quiet_hours?: { start: string; end: string; allow_critical?: boolean };
+  group?: { window_sec: number; resolved?: boolean };
+  language?: string;
+  title_template?: string;
+  content_template?: string;
+}
+
 export interface NotificationSubscription {
   id: string;
   channel_id: string;
   event_type: string;
   enabled: boolean;
+  rules?: SubscriptionRules | null;
   created_at: string;
   updated_at?: string;
 }
@@ -99,12 +131,14 @@ export interface CreateSubscriptionsRequest {
   channel_id: string;
   event_types: string[];
   enabled: boolean;
+  rules?: SubscriptionRules | null;
 }
 
 export interface EventType {
   type: string;
   category: string; // node, request, account, system
   description: string;
+  severity?: string; // 默认严重级别
 }
 
 export interface TestNotificationRequest {
@@ -164,13 +198,29 @@ export interface MonitorNode {
   last_error?: string;
   traffic: ProxySummary;
   health: HealthSummary;
+  passive?: PassiveHealth;
   trend_24h?: TrendPoint[];
+  cost_today_usd?: number;
+}
+
+export interface PassiveHealth {
+  score: number | null;
+  samples: number;
+  success_rate: number;
+  p95_latency_ms: number;
+  avg_first_byte_ms: number;
+  rate_limit_rate: number;
+  timeout_rate: number;
+  effective_weight: number;
+  demoted: boolean;
+  ejected_until?: string;
 }
 
 export interface MonitorDashboard {
   account_id: string;
   account_name: string;
   nodes: MonitorNode[];
+  cost_today_usd?: number;
   updated_at: string;
 }
 
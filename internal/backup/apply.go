@@ -0,0 +1,386 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// Mode 导入模式。
+type Mode string
+
+const (
+	// ModeMerge 新增或覆盖备份包中的条目，保留目标实例中备份包没有的条目。
+	ModeMerge Mode = "merge"
+	// ModeReplace 在 merge 基础上删除目标实例中备份包没有的条目（默认账号与隧道配置除外）。
+	ModeReplace Mode = "replace"
+)
+
+// ParseMode 解析导入模式，默认 merge。
+func ParseMode(v string) (Mode, error) {
+	switch Mode(v) {
+	case "", ModeMerge:
+		return ModeMerge, nil
+	case ModeReplace:
+		return ModeReplace, nil
+	default:
+		return "", fmt.Errorf("mode must be merge|replace")
+	}
+}
+
+// 变更类型。
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// 条目类型，同时决定导入时的执行顺序。
+const (
+	KindAccount      = "account"
+	KindNode         = "node"
+	KindUser         = "user"
+	KindAPIKey       = "api_key"
+	KindChannel      = "notification_channel"
+	KindSubscription = "notification_subscription"
+	KindQuota        = "quota"
+	KindMonitorShare = "monitor_share"
+	KindSetting      = "setting"
+	KindTunnel       = "tunnel"
+)
+
+var kindOrder = []string{KindAccount, KindUser, KindAPIKey, KindNode, KindChannel, KindSubscription, KindQuota, KindMonitorShare, KindSetting, KindTunnel}
+
+// Change 单个条目的变更。
+type Change struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// Plan 导入计划（dry-run 的输出，也是实际导入的执行清单）。
+type Plan struct {
+	Mode      Mode                      `json:"mode"`
+	Changes   []Change                  `json:"changes"`
+	Summary   map[string]map[string]int `json:"summary"` // kind -> action -> 数量
+	Unchanged int                       `json:"unchanged"`
+}
+
+// entry 比对用的条目：key 为主键，value 为导入时使用的原始结构。
+type entry struct {
+	key   string
+	value any
+}
+
+func (b *Bundle) entries(kind string) []entry {
+	var out []entry
+	switch kind {
+	case KindAccount:
+		for _, v := range b.Accounts {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindUser:
+		for _, v := range b.Users {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindAPIKey:
+		for _, v := range b.APIKeys {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindNode:
+		for _, v := range b.Nodes {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindChannel:
+		for _, v := range b.NotificationChannels {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindSubscription:
+		for _, v := range b.NotificationSubscriptions {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindQuota:
+		for _, v := range b.Quotas {
+			out = append(out, entry{v.AccountID, v})
+		}
+	case KindMonitorShare:
+		for _, v := range b.MonitorShares {
+			out = append(out, entry{v.ID, v})
+		}
+	case KindSetting:
+		for _, v := range b.Settings {
+			out = append(out, entry{settingKey(v), v})
+		}
+	case KindTunnel:
+		if b.Tunnel != nil {
+			out = append(out, entry{KindTunnel, *b.Tunnel})
+		}
+	}
+	return out
+}
+
+// settingKey 设置项主键：scope/account_id/key。
+func settingKey(s Setting) string {
+	acc := ""
+	if s.AccountID != nil {
+		acc = *s.AccountID
+	}
+	return s.Scope + "/" + acc + "/" + s.Key
+}
+
+// sort 按主键排序各列表，保证导出结果稳定。
+func (b *Bundle) sort() {
+	sort.Slice(b.Accounts, func(i, j int) bool { return b.Accounts[i].ID < b.Accounts[j].ID })
+	sort.Slice(b.Users, func(i, j int) bool { return b.Users[i].ID < b.Users[j].ID })
+	sort.Slice(b.APIKeys, func(i, j int) bool { return b.APIKeys[i].ID < b.APIKeys[j].ID })
+	sort.Slice(b.Nodes, func(i, j int) bool { return b.Nodes[i].ID < b.Nodes[j].ID })
+	sort.Slice(b.Settings, func(i, j int) bool { return settingKey(b.Settings[i]) < settingKey(b.Settings[j]) })
+	sort.Slice(b.NotificationChannels, func(i, j int) bool { return b.NotificationChannels[i].ID < b.NotificationChannels[j].ID })
+	sort.Slice(b.NotificationSubscriptions, func(i, j int) bool {
+		return b.NotificationSubscriptions[i].ID < b.NotificationSubscriptions[j].ID
+	})
+	sort.Slice(b.Quotas, func(i, j int) bool { return b.Quotas[i].AccountID < b.Quotas[j].AccountID })
+	sort.Slice(b.MonitorShares, func(i, j int) bool { return b.MonitorShares[i].ID < b.MonitorShares[j].ID })
+}
+
+// Diff 计算把 current 变为 incoming 所需的变更。replace 模式下不会删除默认账号及其配额。
+func Diff(current, incoming *Bundle, mode Mode) *Plan {
+	plan := &Plan{Mode: mode, Changes: []Change{}, Summary: map[string]map[string]int{}}
+	add := func(kind, key, action string) {
+		plan.Changes = append(plan.Changes, Change{Kind: kind, Key: key, Action: action})
+		if plan.Summary[kind] == nil {
+			plan.Summary[kind] = map[string]int{}
+		}
+		plan.Summary[kind][action]++
+	}
+	for _, kind := range kindOrder {
+		if (kind == KindUser || kind == KindAPIKey) && incoming.Version < 2 {
+			continue
+		}
+		existing := make(map[string]any)
+		for _, e := range current.entries(kind) {
+			existing[e.key] = e.value
+		}
+		wanted := make(map[string]bool)
+		for _, e := range incoming.entries(kind) {
+			wanted[e.key] = true
+			old, ok := existing[e.key]
+			switch {
+			case !ok:
+				add(kind, e.key, ActionCreate)
+			case !sameJSON(old, e.value):
+				add(kind, e.key, ActionUpdate)
+			default:
+				plan.Unchanged++
+			}
+		}
+		if mode != ModeReplace || kind == KindTunnel {
+			continue
+		}
+		for _, e := range current.entries(kind) {
+			if wanted[e.key] || ((kind == KindAccount || kind == KindQuota) && e.key == store.DefaultAccountID) {
+				continue
+			}
+			add(kind, e.key, ActionDelete)
+		}
+	}
+	return plan
+}
+
+func sameJSON(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// Import 按 mode 将备份包导入存储；dryRun 时只返回计划不做修改。
+// 已有节点的请求计数等运行状态在更新时保留。
+func Import(ctx context.Context, st store.Store, incoming *Bundle, mode Mode, dryRun bool) (*Plan, error) {
+	if err := incoming.Validate(); err != nil {
+		return nil, err
+	}
+	current, err := Export(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+	plan := Diff(current, incoming, mode)
+	if dryRun {
+		return plan, nil
+	}
+
+	index := func(b *Bundle, kind string) map[string]any {
+		m := make(map[string]any)
+		for _, e := range b.entries(kind) {
+			m[e.key] = e.value
+		}
+		return m
+	}
+	// 存储层没有跨表事务：先完成全部写入再删除，任一步失败立即停止，
+	// 避免 replace 模式在导入中途失败时已删掉现有配置。
+	var deletes, upserts []Change
+	for _, c := range plan.Changes {
+		if c.Action == ActionDelete {
+			deletes = append(deletes, c)
+		} else {
+			upserts = append(upserts, c)
+		}
+	}
+	existingNodes := make(map[string]store.NodeRecord)
+	for _, a := range current.Accounts {
+		recs, err := st.GetNodesByAccount(ctx, a.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			existingNodes[r.ID] = r
+		}
+	}
+	for _, c := range upserts {
+		if err := applyUpsert(ctx, st, c, index(incoming, c.Kind)[c.Key], index(current, c.Kind)[c.Key], existingNodes); err != nil {
+			return nil, fmt.Errorf("%s %s %s: %w", c.Action, c.Kind, c.Key, err)
+		}
+	}
+	// 活动节点最后设置，确保引用的节点已经导入。
+	for _, a := range incoming.Accounts {
+		cfg := store.Config{Retries: a.Retries, FailLimit: a.FailLimit, HealthEvery: time.Duration(a.HealthEveryMs) * time.Millisecond}
+		if err := st.UpdateConfig(ctx, a.ID, cfg, a.ActiveNodeID); err != nil {
+			return nil, fmt.Errorf("update config of account %s: %w", a.ID, err)
+		}
+	}
+	// 删除按依赖倒序执行，先删订阅再删渠道、先删节点再删账号。
+	for i := len(deletes) - 1; i >= 0; i-- {
+		c := deletes[i]
+		if err := applyDelete(ctx, st, c, index(current, c.Kind)[c.Key]); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("delete %s %s: %w", c.Kind, c.Key, err)
+		}
+	}
+	return plan, nil
+}
+
+func applyDelete(ctx context.Context, st store.Store, c Change, old any) error {
+	switch c.Kind {
+	case KindAccount:
+		return st.DeleteAccount(ctx, c.Key)
+	case KindUser:
+		return st.DeleteUser(ctx, c.Key)
+	case KindAPIKey:
+		return st.DeleteAPIKey(ctx, c.Key)
+	case KindNode:
+		return st.DeleteNode(ctx, c.Key)
+	case KindChannel:
+		return st.DeleteNotificationChannel(ctx, c.Key)
+	case KindSubscription:
+		return st.DeleteNotificationSubscription(ctx, c.Key)
+	case KindQuota:
+		return st.DeleteAccountQuota(ctx, c.Key)
+	case KindMonitorShare:
+		return st.DeleteMonitorShare(ctx, c.Key)
+	case KindSetting:
+		s := old.(Setting)
+		acc := ""
+		if s.AccountID != nil {
+			acc = *s.AccountID
+		}
+		return st.DeleteSetting(s.Key, s.Scope, acc)
+	}
+	return nil
+}
+
+func applyUpsert(ctx context.Context, st store.Store, c Change, v, old any, existingNodes map[string]store.NodeRecord) error {
+	switch c.Kind {
+	case KindAccount:
+		a := v.(Account)
+		rec := store.AccountRecord{ID: a.ID, Name: a.Name, Password: a.PasswordHash, ProxyAPIKey: a.ProxyAPIKey, IsAdmin: a.IsAdmin}
+		if c.Action == ActionCreate {
+			return st.CreateAccount(ctx, rec)
+		}
+		return st.UpdateAccount(ctx, rec)
+	case KindUser:
+		u := v.(User)
+		rec := store.UserRecord{ID: u.ID, AccountID: u.AccountID, Username: u.Username, Password: u.PasswordHash,
+			Role: u.Role, Disabled: u.Disabled, CreatedAt: u.CreatedAt}
+		if c.Action == ActionUpdate {
+			// UpdateUser 只更新密码、角色与禁用状态，用户名或所属账号变化时需要重建。
+			if prev, ok := old.(User); !ok || prev.Username != u.Username || prev.AccountID != u.AccountID {
+				if err := st.DeleteUser(ctx, u.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+					return err
+				}
+				return st.CreateUser(ctx, rec)
+			}
+			return st.UpdateUser(ctx, rec)
+		}
+		return st.CreateUser(ctx, rec)
+	case KindAPIKey:
+		k := v.(APIKey)
+		rec := store.APIKeyRecord{ID: k.ID, AccountID: k.AccountID, Name: k.Name, KeyHash: k.KeyHash, KeyPrefix: k.KeyPrefix,
+			AllowedModels: k.AllowedModels, CreatedAt: k.CreatedAt, ExpiresAt: k.ExpiresAt, Revoked: k.Revoked, RevokedAt: k.RevokedAt}
+		if c.Action == ActionUpdate {
+			return st.UpdateAPIKey(ctx, rec)
+		}
+		if err := st.CreateAPIKey(ctx, rec); err != nil {
+			return err
+		}
+		if k.Revoked {
+			return st.UpdateAPIKey(ctx, rec)
+		}
+		return nil
+	case KindNode:
+		n := v.(Node)
+		rec := existingNodes[n.ID]
+		rec.ID, rec.AccountID, rec.Name, rec.BaseURL, rec.APIKey = n.ID, n.AccountID, n.Name, n.BaseURL, n.APIKey
+		rec.HealthCheckMethod, rec.HealthCheckModel, rec.Weight, rec.Disabled = n.HealthCheckMethod, n.HealthCheckModel, n.Weight, n.Disabled
+		rec.SupportedModels, rec.ModelMap, rec.HealthProbes, rec.PriceMultiplier = n.SupportedModels, n.ModelMap, n.HealthProbes, n.PriceMultiplier
+		return st.UpsertNode(ctx, rec)
+	case KindChannel:
+		ch := v.(NotificationChannel)
+		rec := store.NotificationChannelRecord{ID: ch.ID, AccountID: ch.AccountID, ChannelType: ch.ChannelType, Name: ch.Name, Config: ch.Config, Enabled: ch.Enabled}
+		if c.Action == ActionCreate {
+			return st.CreateNotificationChannel(ctx, rec)
+		}
+		return st.UpdateNotificationChannel(ctx, rec)
+	case KindSubscription:
+		s := v.(NotificationSubscription)
+		if c.Action == ActionUpdate {
+			// 订阅的 upsert 只更新 enabled/rules，渠道或事件变化时需要重建。
+			if err := st.DeleteNotificationSubscription(ctx, s.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		return st.UpsertNotificationSubscription(ctx, store.NotificationSubscriptionRecord{
+			ID: s.ID, AccountID: s.AccountID, ChannelID: s.ChannelID, EventType: s.EventType, Enabled: s.Enabled, Rules: s.Rules,
+		})
+	case KindQuota:
+		q := v.(Quota)
+		return st.UpsertAccountQuota(ctx, store.AccountQuotaRecord{AccountID: q.AccountID, RPM: q.RPM, MaxConcurrency: q.MaxConcurrency,
+			DailyTokens: q.DailyTokens, MonthlyTokens: q.MonthlyTokens, WarnThresholds: q.WarnThresholds})
+	case KindMonitorShare:
+		s := v.(MonitorShare)
+		if c.Action == ActionUpdate {
+			if err := st.DeleteMonitorShare(ctx, s.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		rec := store.MonitorShareRecord{ID: s.ID, AccountID: s.AccountID, Token: s.Token, CreatedBy: s.CreatedBy,
+			CreatedAt: s.CreatedAt, Revoked: s.Revoked, RevokedAt: s.RevokedAt}
+		if s.ExpireAt != nil {
+			rec.ExpireAt = *s.ExpireAt
+		}
+		return st.CreateMonitorShare(ctx, rec)
+	case KindSetting:
+		s := v.(Setting)
+		return st.UpsertSetting(&store.Setting{Key: s.Key, Scope: s.Scope, AccountID: s.AccountID, Value: s.Value,
+			DataType: s.DataType, Category: s.Category, Description: s.Description, IsSecret: s.IsSecret, UpdatedBy: strPtr("backup-import")})
+	case KindTunnel:
+		t := v.(Tunnel)
+		return st.SaveTunnelConfig(ctx, store.TunnelConfig{ID: t.ID, APIToken: t.APIToken, Subdomain: t.Subdomain, Zone: t.Zone, Enabled: t.Enabled})
+	}
+	return nil
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,364 @@
+// Package backup 实现实例配置的整体导出与导入（备份 / 迁移）。
+//
+// 备份包（Bundle）包含账号、账号成员、API Key（仅哈希）、节点（含上游密钥）、系统设置、通知渠道与订阅、
+// 配额、隧道配置和监控分享，不包含监控数据、健康检查历史、请求日志与登录会话等运行数据。
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	// FormatName 标识备份包格式。
+	FormatName = "qcc_plus-backup"
+	// CurrentVersion 当前备份包版本；导入时拒绝更高版本。
+	// 版本 2 起包含账号成员与 API Key，导入版本 1 的备份包时不改动这两类数据。
+	CurrentVersion = 2
+)
+
+// Bundle 备份包，各列表按主键排序，便于比对与版本管理。
+type Bundle struct {
+	Format                    string                     `json:"format"`
+	Version                   int                        `json:"version"`
+	ExportedAt                time.Time                  `json:"exported_at"`
+	Accounts                  []Account                  `json:"accounts"`
+	Users                     []User                     `json:"users"`
+	APIKeys                   []APIKey                   `json:"api_keys"`
+	Nodes                     []Node                     `json:"nodes"`
+	Settings                  []Setting                  `json:"settings"`
+	NotificationChannels      []NotificationChannel      `json:"notification_channels"`
+	NotificationSubscriptions []NotificationSubscription `json:"notification_subscriptions"`
+	Quotas                    []Quota                    `json:"quotas"`
+	MonitorShares             []MonitorShare             `json:"monitor_shares"`
+	Tunnel                    *Tunnel                    `json:"tunnel,omitempty"`
+}
+
+// Account 账号及其运行配置。
+type Account struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	PasswordHash  string `json:"password_hash,omitempty"`
+	ProxyAPIKey   string `json:"proxy_api_key,omitempty"`
+	IsAdmin       bool   `json:"is_admin"`
+	ActiveNodeID  string `json:"active_node_id,omitempty"`
+	Retries       int    `json:"retries"`
+	FailLimit     int    `json:"fail_limit"`
+	HealthEveryMs int64  `json:"health_every_ms"`
+}
+
+// User 账号成员，密码只导出哈希。
+type User struct {
+	ID           string    `json:"id"`
+	AccountID    string    `json:"account_id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Role         string    `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// APIKey 代理 API Key，只导出哈希与前缀（明文不落库），不含用量计数。
+type APIKey struct {
+	ID            string     `json:"id"`
+	AccountID     string     `json:"account_id"`
+	Name          string     `json:"name"`
+	KeyHash       string     `json:"key_hash"`
+	KeyPrefix     string     `json:"key_prefix"`
+	AllowedModels []string   `json:"allowed_models,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	Revoked       bool       `json:"revoked"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Node 节点配置，不含请求计数等运行状态。
+type Node struct {
+	ID                string            `json:"id"`
+	AccountID         string            `json:"account_id"`
+	Name              string            `json:"name"`
+	BaseURL           string            `json:"base_url"`
+	APIKey            string            `json:"api_key,omitempty"`
+	HealthCheckMethod string            `json:"health_check_method"`
+	HealthCheckModel  string            `json:"health_check_model"`
+	Weight            int               `json:"weight"`
+	Disabled          bool              `json:"disabled"`
+	SupportedModels   []string          `json:"supported_models,omitempty"`
+	ModelMap          map[string]string `json:"model_map,omitempty"`
+	HealthProbes      json.RawMessage   `json:"health_probes,omitempty"`
+	PriceMultiplier   float64           `json:"price_multiplier"`
+}
+
+// Setting 系统 / 账号级配置项。
+type Setting struct {
+	Key         string  `json:"key"`
+	Scope       string  `json:"scope"`
+	AccountID   *string `json:"account_id,omitempty"`
+	Value       any     `json:"value"`
+	DataType    string  `json:"data_type"`
+	Category    string  `json:"category"`
+	Description *string `json:"description,omitempty"`
+	IsSecret    bool    `json:"is_secret"`
+}
+
+// NotificationChannel 通知渠道（Config 含 webhook 地址、密钥等）。
+type NotificationChannel struct {
+	ID          string          `json:"id"`
+	AccountID   string          `json:"account_id"`
+	ChannelType string          `json:"channel_type"`
+	Name        string          `json:"name"`
+	Config      json.RawMessage `json:"config"`
+	Enabled     bool            `json:"enabled"`
+}
+
+// NotificationSubscription 通知订阅。
+type NotificationSubscription struct {
+	ID        string          `json:"id"`
+	AccountID string          `json:"account_id"`
+	ChannelID string          `json:"channel_id"`
+	EventType string          `json:"event_type"`
+	Enabled   bool            `json:"enabled"`
+	Rules     json.RawMessage `json:"rules,omitempty"`
+}
+
+// Quota 账号配额。
+type Quota struct {
+	AccountID      string `json:"account_id"`
+	RPM            int    `json:"rpm"`
+	MaxConcurrency int    `json:"max_concurrency"`
+	DailyTokens    int64  `json:"daily_tokens"`
+	MonthlyTokens  int64  `json:"monthly_tokens"`
+	WarnThresholds []int  `json:"warn_thresholds,omitempty"`
+}
+
+// MonitorShare 监控分享链接。
+type MonitorShare struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"account_id"`
+	Token     string     `json:"token"`
+	ExpireAt  *time.Time `json:"expire_at,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	Revoked   bool       `json:"revoked"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Tunnel Cloudflare 隧道配置（不含运行状态）。
+type Tunnel struct {
+	ID        string `json:"id"`
+	APIToken  string `json:"api_token"`
+	Subdomain string `json:"subdomain"`
+	Zone      string `json:"zone"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// Export 从存储读取当前实例的全部配置。
+func Export(ctx context.Context, st store.Store) (*Bundle, error) {
+	b := &Bundle{Format: FormatName, Version: CurrentVersion, ExportedAt: time.Now().UTC(),
+		Accounts: []Account{}, Users: []User{}, APIKeys: []APIKey{}, Nodes: []Node{}, Settings: []Setting{}, NotificationChannels: []NotificationChannel{},
+		NotificationSubscriptions: []NotificationSubscription{}, Quotas: []Quota{}, MonitorShares: []MonitorShare{}}
+
+	accounts, err := st.ListAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list accounts: %w", err)
+	}
+	for _, a := range accounts {
+		recs, cfg, active, err := st.LoadAllByAccount(ctx, a.ID)
+		if err != nil {
+			return nil, fmt.Errorf("load account %s: %w", a.ID, err)
+		}
+		b.Accounts = append(b.Accounts, Account{
+			ID: a.ID, Name: a.Name, PasswordHash: a.Password, ProxyAPIKey: a.ProxyAPIKey, IsAdmin: a.IsAdmin,
+			ActiveNodeID: active, Retries: cfg.Retries, FailLimit: cfg.FailLimit, HealthEveryMs: cfg.HealthEvery.Milliseconds(),
+		})
+		for _, r := range recs {
+			b.Nodes = append(b.Nodes, nodeFromRecord(r))
+		}
+
+		channels, err := st.ListNotificationChannels(ctx, a.ID)
+		if err != nil {
+			return nil, fmt.Errorf("list notification channels: %w", err)
+		}
+		for _, c := range channels {
+			b.NotificationChannels = append(b.NotificationChannels, NotificationChannel{
+				ID: c.ID, AccountID: c.AccountID, ChannelType: c.ChannelType, Name: c.Name, Config: c.Config, Enabled: c.Enabled,
+			})
+		}
+		subs, err := st.ListNotificationSubscriptions(ctx, a.ID, "")
+		if err != nil {
+			return nil, fmt.Errorf("list notification subscriptions: %w", err)
+		}
+		for _, s := range subs {
+			b.NotificationSubscriptions = append(b.NotificationSubscriptions, NotificationSubscription{
+				ID: s.ID, AccountID: s.AccountID, ChannelID: s.ChannelID, EventType: s.EventType, Enabled: s.Enabled, Rules: s.Rules,
+			})
+		}
+	}
+
+	users, err := st.ListUsers(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	for _, u := range users {
+		b.Users = append(b.Users, User{ID: u.ID, AccountID: u.AccountID, Username: u.Username, PasswordHash: u.Password,
+			Role: u.Role, Disabled: u.Disabled, CreatedAt: u.CreatedAt.UTC()})
+	}
+	keys, err := st.ListAPIKeys(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	for _, k := range keys {
+		b.APIKeys = append(b.APIKeys, APIKey{ID: k.ID, AccountID: k.AccountID, Name: k.Name, KeyHash: k.KeyHash, KeyPrefix: k.KeyPrefix,
+			AllowedModels: k.AllowedModels, CreatedAt: k.CreatedAt.UTC(), ExpiresAt: utcPtr(k.ExpiresAt), Revoked: k.Revoked, RevokedAt: utcPtr(k.RevokedAt)})
+	}
+
+	settings, err := st.ListSettings("", "", "")
+	if err != nil {
+		return nil, fmt.Errorf("list settings: %w", err)
+	}
+	for _, s := range settings {
+		b.Settings = append(b.Settings, Setting{
+			Key: s.Key, Scope: s.Scope, AccountID: s.AccountID, Value: s.Value, DataType: s.DataType,
+			Category: s.Category, Description: s.Description, IsSecret: s.IsSecret,
+		})
+	}
+
+	quotas, err := st.ListAccountQuotas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list quotas: %w", err)
+	}
+	for _, q := range quotas {
+		b.Quotas = append(b.Quotas, Quota{
+			AccountID: q.AccountID, RPM: q.RPM, MaxConcurrency: q.MaxConcurrency,
+			DailyTokens: q.DailyTokens, MonthlyTokens: q.MonthlyTokens, WarnThresholds: q.WarnThresholds,
+		})
+	}
+
+	shares, err := st.ListMonitorShares(ctx, store.QueryMonitorSharesParams{IncludeRevoked: true})
+	if err != nil {
+		return nil, fmt.Errorf("list monitor shares: %w", err)
+	}
+	for _, s := range shares {
+		share := MonitorShare{ID: s.ID, AccountID: s.AccountID, Token: s.Token, CreatedBy: s.CreatedBy,
+			CreatedAt: s.CreatedAt.UTC(), Revoked: s.Revoked}
+		if !s.ExpireAt.IsZero() {
+			t := s.ExpireAt.UTC()
+			share.ExpireAt = &t
+		}
+		if s.RevokedAt != nil {
+			t := s.RevokedAt.UTC()
+			share.RevokedAt = &t
+		}
+		b.MonitorShares = append(b.MonitorShares, share)
+	}
+
+	tunnel, err := st.GetTunnelConfig(ctx)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("get tunnel config: %w", err)
+	}
+	if tunnel != nil {
+		b.Tunnel = &Tunnel{ID: tunnel.ID, APIToken: tunnel.APIToken, Subdomain: tunnel.Subdomain, Zone: tunnel.Zone, Enabled: tunnel.Enabled}
+	}
+	b.sort()
+	return b, nil
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func nodeFromRecord(r store.NodeRecord) Node {
+	return Node{
+		ID: r.ID, AccountID: r.AccountID, Name: r.Name, BaseURL: r.BaseURL, APIKey: r.APIKey,
+		HealthCheckMethod: r.HealthCheckMethod, HealthCheckModel: r.HealthCheckModel, Weight: r.Weight, Disabled: r.Disabled,
+		SupportedModels: r.SupportedModels, ModelMap: r.ModelMap, HealthProbes: r.HealthProbes, PriceMultiplier: r.PriceMultiplier,
+	}
+}
+
+// Validate 检查备份包格式、版本与引用完整性。
+func (b *Bundle) Validate() error {
+	if b.Format != FormatName {
+		return fmt.Errorf("not a %s bundle", FormatName)
+	}
+	if b.Version <= 0 || b.Version > CurrentVersion {
+		return fmt.Errorf("unsupported bundle version %d (supported: 1..%d)", b.Version, CurrentVersion)
+	}
+	accounts := make(map[string]bool, len(b.Accounts))
+	for _, a := range b.Accounts {
+		if a.ID == "" {
+			return errors.New("account id required")
+		}
+		if accounts[a.ID] {
+			return fmt.Errorf("duplicate account %s", a.ID)
+		}
+		accounts[a.ID] = true
+	}
+	seen := make(map[string]bool)
+	for _, u := range b.Users {
+		if u.ID == "" || u.Username == "" {
+			return errors.New("user id and username required")
+		}
+		if !accounts[u.AccountID] {
+			return fmt.Errorf("user %s references unknown account %s", u.ID, u.AccountID)
+		}
+		if seen["user/"+u.ID] || seen["username/"+u.Username] {
+			return fmt.Errorf("duplicate user %s", u.ID)
+		}
+		seen["user/"+u.ID], seen["username/"+u.Username] = true, true
+	}
+	for _, k := range b.APIKeys {
+		if k.ID == "" || k.KeyHash == "" {
+			return errors.New("api key id and key_hash required")
+		}
+		if !accounts[k.AccountID] {
+			return fmt.Errorf("api key %s references unknown account %s", k.ID, k.AccountID)
+		}
+		if seen["api_key/"+k.ID] || seen["key_hash/"+k.KeyHash] {
+			return fmt.Errorf("duplicate api key %s", k.ID)
+		}
+		seen["api_key/"+k.ID], seen["key_hash/"+k.KeyHash] = true, true
+	}
+	for _, n := range b.Nodes {
+		if n.ID == "" || n.BaseURL == "" {
+			return errors.New("node id and base_url required")
+		}
+		if !accounts[n.AccountID] {
+			return fmt.Errorf("node %s references unknown account %s", n.ID, n.AccountID)
+		}
+		if seen["node/"+n.ID] {
+			return fmt.Errorf("duplicate node %s", n.ID)
+		}
+		seen["node/"+n.ID] = true
+	}
+	for _, c := range b.NotificationChannels {
+		if !accounts[c.AccountID] {
+			return fmt.Errorf("notification channel %s references unknown account %s", c.ID, c.AccountID)
+		}
+		seen["channel/"+c.ID] = true
+	}
+	for _, s := range b.NotificationSubscriptions {
+		if !seen["channel/"+s.ChannelID] {
+			return fmt.Errorf("notification subscription %s references unknown channel %s", s.ID, s.ChannelID)
+		}
+	}
+	for _, q := range b.Quotas {
+		if !accounts[q.AccountID] {
+			return fmt.Errorf("quota references unknown account %s", q.AccountID)
+		}
+	}
+	for _, s := range b.MonitorShares {
+		if !accounts[s.AccountID] {
+			return fmt.Errorf("monitor share %s references unknown account %s", s.ID, s.AccountID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+func openStore(t *testing.T) store.Store {
+	t.Helper()
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestYAMLRoundTripAndHandWritten(t *testing.T) {
+	b := &Bundle{Format: FormatName, Version: CurrentVersion,
+		Accounts: []Account{{ID: "default", Name: "x: y # z"}, {ID: "true", Name: "多行\n文本"}},
+		Nodes:    []Node{{ID: "n1", AccountID: "default", BaseURL: "https://relay.example.com", ModelMap: map[string]string{"claude-*": "relay"}, PriceMultiplier: 1.5}},
+	}
+	data, err := Encode(b, EncodingYAML, "")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	back, err := Decode(data, "")
+	if err != nil {
+		t.Fatalf("decode emitted yaml: %v\n%s", err, data)
+	}
+	if !sameJSON(b, back) {
+		t.Fatalf("round trip mismatch:\n%s", data)
+	}
+
+	doc := `# comment
+format: qcc_plus-backup
+version: 1
+accounts:
+- id: default   # 行尾注释
+  name: 'it''s'
+  is_admin: false
+nodes: []
+settings:
+  - key: "billing.model_prices"
+    scope: system
+    value: {"claude-*": {"input": 3}}
+`
+	got, err := Decode([]byte(doc), "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(got.Accounts) != 1 || got.Accounts[0].Name != "it's" || len(got.Settings) != 1 || !sameJSON(got.Settings[0].Value, map[string]any{"claude-*": map[string]any{"input": 3}}) {
+		t.Fatalf("unexpected bundle: %+v", got)
+	}
+	if _, err := Decode([]byte("format: x\n   b: 2\n"), ""); err == nil {
+		t.Fatal("bad indentation should fail")
+	}
+}
+
+func seedSource(t *testing.T, st store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(st.CreateAccount(ctx, store.AccountRecord{ID: store.DefaultAccountID, Name: "default", Password: "hash-1", ProxyAPIKey: "pk-default"}))
+	must(st.CreateAccount(ctx, store.AccountRecord{ID: "team", Name: "team", Password: "hash-2", ProxyAPIKey: "pk-team", IsAdmin: true}))
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	must(st.CreateUser(ctx, store.UserRecord{ID: "u1", AccountID: "team", Username: "alice", Password: "bcrypt-alice", Role: "operator", CreatedAt: created}))
+	must(st.CreateAPIKey(ctx, store.APIKeyRecord{ID: "k1", AccountID: "team", Name: "ci", KeyHash: "hash-k1", KeyPrefix: "qcc-ab",
+		AllowedModels: []string{"claude-*"}, CreatedAt: created}))
+	must(st.CreateAPIKey(ctx, store.APIKeyRecord{ID: "k2", AccountID: "team", Name: "old", KeyHash: "hash-k2", KeyPrefix: "qcc-cd", CreatedAt: created}))
+	must(st.RevokeAPIKey(ctx, "k2", created.Add(time.Hour)))
+	must(st.UpsertNode(ctx, store.NodeRecord{ID: "n1", Name: "relay", BaseURL: "https://relay.example.com", APIKey: "sk-1", AccountID: "team",
+		Weight: 2, ModelMap: map[string]string{"claude-*": "relay"}, HealthProbes: json.RawMessage(`[{"type":"http"}]`), PriceMultiplier: 1.5}))
+	must(st.UpdateConfig(ctx, "team", store.Config{Retries: 5, FailLimit: 2, HealthEvery: time.Minute}, "n1"))
+	must(st.CreateNotificationChannel(ctx, store.NotificationChannelRecord{ID: "ch1", AccountID: "team", ChannelType: "webhook", Name: "hook",
+		Config: json.RawMessage(`{"url":"https://hook.example.com"}`), Enabled: true}))
+	must(st.UpsertNotificationSubscription(ctx, store.NotificationSubscriptionRecord{ID: "sub1", AccountID: "team", ChannelID: "ch1", EventType: "node.down", Enabled: true}))
+	must(st.UpsertAccountQuota(ctx, store.AccountQuotaRecord{AccountID: "team", RPM: 60, DailyTokens: 1000, WarnThresholds: []int{80}}))
+	must(st.CreateMonitorShare(ctx, store.MonitorShareRecord{ID: "sh1", AccountID: "team", Token: "tok", CreatedBy: "team",
+		ExpireAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}))
+	must(st.SaveTunnelConfig(ctx, store.TunnelConfig{ID: "default", APIToken: "cf-token", Subdomain: "qcc", Zone: "example.com", Enabled: true}))
+	must(st.UpsertSetting(&store.Setting{Key: "custom.flag", Scope: "system", Value: true, DataType: "boolean", Category: "monitor"}))
+}
+
+func TestExportImportReplaceWithDryRun(t *testing.T) {
+	ctx := context.Background()
+	src := openStore(t)
+	seedSource(t, src)
+	bundle, err := Export(ctx, src)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	data, err := Encode(bundle, EncodingYAML, "s3cret")
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if strings.Contains(string(data), "sk-1") || strings.Contains(string(data), "cf-token") {
+		t.Fatal("encrypted bundle leaks secrets")
+	}
+	if _, err := Decode(data, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Fatalf("expected passphrase error, got %v", err)
+	}
+	if _, err := Decode(data, "wrong"); err == nil {
+		t.Fatal("wrong passphrase should fail")
+	}
+	decoded, err := Decode(data, "s3cret")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	dst := openStore(t)
+	if err := dst.CreateAccount(ctx, store.AccountRecord{ID: store.DefaultAccountID, Name: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.CreateAccount(ctx, store.AccountRecord{ID: "stale", Name: "stale"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.UpsertNode(ctx, store.NodeRecord{ID: "old", Name: "old", BaseURL: "https://old.example.com", AccountID: "stale", Requests: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.CreateUser(ctx, store.UserRecord{ID: "u-stale", AccountID: "stale", Username: "mallory", Password: "x", Role: "viewer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.CreateAPIKey(ctx, store.APIKeyRecord{ID: "k-stale", AccountID: "stale", Name: "stale", KeyHash: "hash-stale", KeyPrefix: "qcc-ef"}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Import(ctx, dst, decoded, ModeReplace, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if plan.Summary[KindAccount][ActionCreate] != 1 || plan.Summary[KindAccount][ActionUpdate] != 1 ||
+		plan.Summary[KindAccount][ActionDelete] != 1 || plan.Summary[KindNode][ActionDelete] != 1 || plan.Summary[KindTunnel][ActionCreate] != 1 ||
+		plan.Summary[KindUser][ActionCreate] != 1 || plan.Summary[KindUser][ActionDelete] != 1 ||
+		plan.Summary[KindAPIKey][ActionCreate] != 2 || plan.Summary[KindAPIKey][ActionDelete] != 1 {
+		t.Fatalf("unexpected plan: %+v", plan.Summary)
+	}
+	if accs, _ := dst.ListAccounts(ctx); len(accs) != 2 {
+		t.Fatalf("dry run must not modify the store: %+v", accs)
+	}
+
+	if _, err := Import(ctx, dst, decoded, ModeReplace, false); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	after, err := Export(ctx, dst)
+	if err != nil {
+		t.Fatalf("export target: %v", err)
+	}
+	after.ExportedAt = bundle.ExportedAt
+	if !sameJSON(after, bundle) {
+		a, _ := json.MarshalIndent(after, "", " ")
+		b, _ := json.MarshalIndent(bundle, "", " ")
+		t.Fatalf("target differs from source:\n%s\nvs\n%s", a, b)
+	}
+	if plan := Diff(after, decoded, ModeReplace); len(plan.Changes) != 0 {
+		t.Fatalf("second import should be a no-op: %+v", plan.Changes)
+	}
+	if len(after.APIKeys) != 2 || !after.APIKeys[1].Revoked || after.Users[0].PasswordHash != "bcrypt-alice" {
+		t.Fatalf("keys and members not restored: %+v %+v", after.APIKeys, after.Users)
+	}
+}
+
+func TestImportReplaceLegacyBundleKeepsKeysAndMembers(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	seedSource(t, st)
+	current, err := Export(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := *current
+	legacy.Version, legacy.Users, legacy.APIKeys = 1, nil, nil
+	if plan := Diff(current, &legacy, ModeReplace); len(plan.Changes) != 0 {
+		t.Fatalf("v1 bundle must not touch keys or members: %+v", plan.Changes)
+	}
+
+	renamed := *current
+	renamed.Users = []User{current.Users[0]}
+	renamed.Users[0].Username, renamed.Users[0].Role = "alice2", "viewer"
+	if _, err := Import(ctx, st, &renamed, ModeReplace, false); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	u, err := st.GetUserByID(ctx, "u1")
+	if err != nil || u.Username != "alice2" || u.Role != "viewer" || u.Password != "bcrypt-alice" {
+		t.Fatalf("user not replaced: %+v %v", u, err)
+	}
+}
+
+func TestImportMergeKeepsExtraEntriesAndNodeCounters(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	seedSource(t, st)
+	if err := st.UpsertNode(ctx, store.NodeRecord{ID: "extra", Name: "extra", BaseURL: "https://extra.example.com", AccountID: "team"}); err != nil {
+		t.Fatal(err)
+	}
+	nodes, _ := st.GetNodesByAccount(ctx, "team")
+	for _, n := range nodes {
+		if n.ID == "n1" {
+			n.Requests = 42
+			_ = st.UpsertNode(ctx, n)
+		}
+	}
+
+	b := &Bundle{Format: FormatName, Version: CurrentVersion,
+		Accounts: []Account{{ID: "team", Name: "team-renamed", ProxyAPIKey: "pk-team", Retries: 3, FailLimit: 3, HealthEveryMs: 30000}},
+		Nodes:    []Node{{ID: "n1", AccountID: "team", Name: "relay-2", BaseURL: "https://relay2.example.com", Weight: 1, PriceMultiplier: 1}},
+	}
+	plan, err := Import(ctx, st, b, ModeMerge, false)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	for _, c := range plan.Changes {
+		if c.Action == ActionDelete {
+			t.Fatalf("merge must not delete: %+v", c)
+		}
+	}
+	nodes, _ = st.GetNodesByAccount(ctx, "team")
+	if len(nodes) != 2 {
+		t.Fatalf("extra node should be kept: %+v", nodes)
+	}
+	for _, n := range nodes {
+		if n.ID == "n1" && (n.Name != "relay-2" || n.Requests != 42) {
+			t.Fatalf("node config should change while counters stay: %+v", n)
+		}
+	}
+
+	b.Version = CurrentVersion + 1
+	if _, err := Import(ctx, st, b, ModeMerge, true); err == nil {
+		t.Fatal("newer bundle version should be rejected")
+	}
+}
+
+func TestImportReplaceStopsBeforeDeletesOnError(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	if err := st.CreateAccount(ctx, store.AccountRecord{ID: store.DefaultAccountID, Name: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CreateAccount(ctx, store.AccountRecord{ID: "stale", Name: "stale", ProxyAPIKey: "pk-shared"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UpsertNode(ctx, store.NodeRecord{ID: "old", Name: "old", BaseURL: "https://old.example.com", AccountID: "stale"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新账号与待删除账号的 proxy_api_key 冲突，写入失败时不应已删除现有配置。
+	b := &Bundle{Format: FormatName, Version: CurrentVersion,
+		Accounts: []Account{{ID: store.DefaultAccountID, Name: "default"}, {ID: "team", Name: "team", ProxyAPIKey: "pk-shared"}},
+	}
+	if _, err := Import(ctx, st, b, ModeReplace, false); err == nil {
+		t.Fatal("conflicting import should fail")
+	}
+	if accs, _ := st.ListAccounts(ctx); len(accs) != 2 {
+		t.Fatalf("existing accounts must be kept: %+v", accs)
+	}
+	if nodes, _ := st.GetNodesByAccount(ctx, "stale"); len(nodes) != 1 {
+		t.Fatalf("existing nodes must be kept: %+v", nodes)
+	}
+}
@@ -0,0 +1,218 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// 输出格式。
+const (
+	EncodingJSON = "json"
+	EncodingYAML = "yaml"
+)
+
+// ErrPassphraseRequired 备份包已加密但未提供口令。
+var ErrPassphraseRequired = errors.New("bundle is encrypted, passphrase required")
+
+// scrypt 参数（约 100ms / 32MB），口令派生 AES-256-GCM 密钥。
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// sealedBundle 加密后的外层结构，明文为 Bundle 的 JSON。
+type sealedBundle struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Encrypted  bool   `json:"encrypted"`
+	KDF        string `json:"kdf"`
+	Cipher     string `json:"cipher"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ParseEncoding 解析输出格式，默认 json。
+func ParseEncoding(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", EncodingJSON:
+		return EncodingJSON, nil
+	case EncodingYAML, "yml":
+		return EncodingYAML, nil
+	default:
+		return "", fmt.Errorf("format must be json|yaml")
+	}
+}
+
+// Encode 把备份包编码为 JSON 或 YAML；passphrase 非空时整体加密后再按 encoding 输出外层结构。
+func Encode(b *Bundle, encoding, passphrase string) ([]byte, error) {
+	var v any = b
+	if passphrase != "" {
+		plain, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := seal(plain, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		v = sealed
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if encoding != EncodingYAML {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	}
+	tree, err := decodeJSONTree(raw)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(yamlNumbers(tree))
+}
+
+// Decode 解析 JSON 或 YAML 备份包（按首个非空字符识别），必要时用 passphrase 解密并校验。
+func Decode(data []byte, passphrase string) (*Bundle, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty bundle")
+	}
+	raw := trimmed
+	if trimmed[0] != '{' {
+		var tree any
+		err := yaml.Unmarshal(trimmed, &tree)
+		if err != nil {
+			return nil, fmt.Errorf("parse yaml: %w", err)
+		}
+		if raw, err = json.Marshal(tree); err != nil {
+			return nil, err
+		}
+	}
+	var head struct {
+		Encrypted bool `json:"encrypted"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if head.Encrypted {
+		var sealed sealedBundle
+		if err := json.Unmarshal(raw, &sealed); err != nil {
+			return nil, fmt.Errorf("parse encrypted bundle: %w", err)
+		}
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		plain, err := open(&sealed, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		raw = plain
+	}
+	var b Bundle
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func deriveKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(plain []byte, passphrase string) (*sealedBundle, error) {
+	s := &sealedBundle{Format: FormatName, Version: CurrentVersion, Encrypted: true, KDF: "scrypt", Cipher: "aes-256-gcm",
+		Salt: make([]byte, saltLen)}
+	if _, err := rand.Read(s.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveKey(passphrase, s.Salt)
+	if err != nil {
+		return nil, err
+	}
+	s.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return nil, err
+	}
+	s.Ciphertext = aead.Seal(nil, s.Nonce, plain, []byte(FormatName))
+	return s, nil
+}
+
+func open(s *sealedBundle, passphrase string) ([]byte, error) {
+	if s.KDF != "scrypt" || s.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported encryption %s/%s", s.KDF, s.Cipher)
+	}
+	aead, err := deriveKey(passphrase, s.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Ciphertext, []byte(FormatName))
+	if err != nil {
+		return nil, errors.New("decrypt bundle failed: wrong passphrase or corrupted data")
+	}
+	return plain, nil
+}
+
+// yamlNumbers 把 json.Number 转为 int64 / float64，否则 YAML 会把它当作字符串输出。
+func yamlNumbers(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			val[k] = yamlNumbers(item)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = yamlNumbers(item)
+		}
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+// decodeJSONTree 把 JSON 解析为通用结构，数字保留原文。
+func decodeJSONTree(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -14,6 +14,7 @@ type NotificationMessage struct {
 	EventType  string
 	Title      string
 	Content    string
+	Language   string // 渠道包装文案（事件类型、时间）使用的语言，空值为中文
 	OccurredAt time.Time
 }
 
@@ -27,6 +28,14 @@ func buildChannel(rec store.NotificationChannelRecord) (NotificationChannel, err
 	switch rec.ChannelType {
 	case ChannelWechatWork, ChannelWechatPersonal:
 		return newWechatChannel(rec)
+	case ChannelDingTalk:
+		return newDingTalkChannel(rec)
+	case ChannelSlack:
+		return newSlackChannel(rec)
+	case ChannelWebhook:
+		return newWebhookChannel(rec)
+	case ChannelEmail:
+		return newEmailChannel(rec)
 	default:
 		return nil, fmt.Errorf("unsupported channel type: %s", rec.ChannelType)
 	}
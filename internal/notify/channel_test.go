@@ -0,0 +1,340 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+var testMessage = NotificationMessage{
+	AccountID:  "acc-1",
+	EventType:  EventNodeFailed,
+	Title:      "节点故障",
+	Content:    "节点 relay-1 连续失败 3 次",
+	OccurredAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func mustBuild(t *testing.T, channelType string, cfg any) NotificationChannel {
+	t.Helper()
+	raw, _ := json.Marshal(cfg)
+	ch, err := BuildChannel(store.NotificationChannelRecord{ChannelType: channelType, Name: "test", Config: raw})
+	if err != nil {
+		t.Fatalf("build %s: %v", channelType, err)
+	}
+	return ch
+}
+
+// captureServer 记录最后一次请求并按 respond 返回。
+func captureServer(t *testing.T, respond func(w http.ResponseWriter)) (*httptest.Server, func() (*http.Request, []byte)) {
+	t.Helper()
+	var mu sync.Mutex
+	var lastReq *http.Request
+	var lastBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lastReq, lastBody = r, body
+		mu.Unlock()
+		respond(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() (*http.Request, []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastReq, lastBody
+	}
+}
+
+func TestDingTalkChannelSignsRequest(t *testing.T) {
+	srv, last := captureServer(t, func(w http.ResponseWriter) { w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`)) })
+	ch := mustBuild(t, ChannelDingTalk, map[string]string{"webhook_url": srv.URL + "/robot/send?access_token=abc", "secret": "SECxyz"})
+	ding := ch.(*dingtalkChannel)
+	ding.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	if err := ch.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req, body := last()
+	q := req.URL.Query()
+	if q.Get("access_token") != "abc" || q.Get("timestamp") != "1700000000000" || q.Get("sign") != dingtalkSign("1700000000000", "SECxyz") {
+		t.Fatalf("unexpected query: %s", req.URL.RawQuery)
+	}
+	var payload struct {
+		MsgType  string `json:"msgtype"`
+		Markdown struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"markdown"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.MsgType != "markdown" || payload.Markdown.Title != "节点故障" ||
+		!strings.Contains(payload.Markdown.Text, "relay-1") {
+		t.Fatalf("unexpected payload: %s (%v)", body, err)
+	}
+
+	errSrv, _ := captureServer(t, func(w http.ResponseWriter) { w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`)) })
+	bad := mustBuild(t, ChannelDingTalk, map[string]string{"webhook_url": errSrv.URL})
+	if err := bad.Send(context.Background(), testMessage); err == nil || !strings.Contains(err.Error(), "sign not match") {
+		t.Fatalf("expected dingtalk error, got %v", err)
+	}
+}
+
+func TestSlackChannelSendsBlocks(t *testing.T) {
+	srv, last := captureServer(t, func(w http.ResponseWriter) { w.Write([]byte("ok")) })
+	ch := mustBuild(t, ChannelSlack, map[string]string{"webhook_url": srv.URL, "channel": "#ops"})
+	if err := ch.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	_, body := last()
+	var payload struct {
+		Text    string `json:"text"`
+		Channel string `json:"channel"`
+		Blocks  []struct {
+			Type string `json:"type"`
+			Text struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if payload.Text != "节点故障" || payload.Channel != "#ops" || len(payload.Blocks) != 3 ||
+		payload.Blocks[0].Type != "header" || payload.Blocks[1].Text.Type != "mrkdwn" || !strings.Contains(payload.Blocks[1].Text.Text, "relay-1") {
+		t.Fatalf("unexpected payload: %s", body)
+	}
+
+	errSrv, _ := captureServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid_blocks"))
+	})
+	bad := mustBuild(t, ChannelSlack, map[string]string{"webhook_url": errSrv.URL})
+	if err := bad.Send(context.Background(), testMessage); err == nil || !strings.Contains(err.Error(), "invalid_blocks") {
+		t.Fatalf("expected slack error, got %v", err)
+	}
+}
+
+func TestWebhookChannelHeadersAndSignature(t *testing.T) {
+	srv, last := captureServer(t, func(w http.ResponseWriter) { w.WriteHeader(http.StatusAccepted) })
+	ch := mustBuild(t, ChannelWebhook, map[string]any{
+		"webhook_url": srv.URL,
+		"method":      "put",
+		"headers":     map[string]string{"Authorization": "Bearer t0k"},
+		"secret":      "s3cret",
+	})
+	if err := ch.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req, body := last()
+	if req.Method != http.MethodPut || req.Header.Get("Authorization") != "Bearer t0k" {
+		t.Fatalf("unexpected request: %s %v", req.Method, req.Header)
+	}
+	ts := req.Header.Get(webhookTimestampHeader)
+	if ts == "" || req.Header.Get(webhookSignatureHeader) != SignWebhookBody("s3cret", ts, body) {
+		t.Fatalf("signature mismatch: ts=%s sig=%s", ts, req.Header.Get(webhookSignatureHeader))
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.EventType != EventNodeFailed ||
+		payload.AccountID != "acc-1" || payload.OccurredAt != "2025-01-02T03:04:05Z" {
+		t.Fatalf("unexpected payload: %s (%v)", body, err)
+	}
+
+	errSrv, _ := captureServer(t, func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) })
+	bad := mustBuild(t, ChannelWebhook, map[string]string{"webhook_url": errSrv.URL})
+	if err := bad.Send(context.Background(), testMessage); err == nil {
+		t.Fatalf("expected error on 500")
+	}
+}
+
+func TestChannelConfigValidation(t *testing.T) {
+	cases := []struct {
+		channelType string
+		cfg         string
+	}{
+		{ChannelDingTalk, `{}`},
+		{ChannelSlack, `{"webhook_url":"ftp://example.com"}`},
+		{ChannelWebhook, `{"webhook_url":"https://example.com","method":"GET"}`},
+		{ChannelWebhook, `{"webhook_url":"https://example.com","headers":{"bad header":"x"}}`},
+		{ChannelEmail, `{"host":"smtp.example.com","from":"a@example.com"}`},
+		{ChannelEmail, `{"host":"smtp.example.com","from":"not-an-address","to":["b@example.com"]}`},
+		{ChannelEmail, `{"host":"smtp.example.com","from":"a@example.com","to":["b@example.com"],"tls_mode":"ssl3"}`},
+		{"pager", `{}`},
+	}
+	for _, tc := range cases {
+		if _, err := BuildChannel(store.NotificationChannelRecord{ChannelType: tc.channelType, Config: json.RawMessage(tc.cfg)}); err == nil {
+			t.Errorf("%s %s: expected validation error", tc.channelType, tc.cfg)
+		}
+	}
+}
+
+// fakeSMTP 最小 SMTP 服务端，支持 STARTTLS 与 AUTH PLAIN，记录收到的信封与正文。
+type fakeSMTP struct {
+	ln       net.Listener
+	tlsCfg   *tls.Config
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	data     string
+	auth     string
+	usedTLS  bool
+	startTLS bool
+}
+
+func newFakeSMTP(t *testing.T, startTLS bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// 借用 httptest 的自签名证书
+	tlsSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	tlsSrv.Close()
+	s := &fakeSMTP{ln: ln, tlsCfg: &tls.Config{Certificates: tlsSrv.TLS.Certificates}, startTLS: startTLS}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	reply := func(line string) {
+		w.WriteString(line + "\r\n")
+		w.Flush()
+	}
+	reply("220 fake ESMTP")
+	secure := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			w.WriteString("250-fake\r\n")
+			if s.startTLS && !secure {
+				w.WriteString("250-STARTTLS\r\n")
+			}
+			reply("250 AUTH PLAIN")
+		case cmd == "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsCfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			r, w = bufio.NewReader(conn), bufio.NewWriter(conn)
+		case strings.HasPrefix(cmd, "AUTH PLAIN"):
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(line[len("AUTH PLAIN"):]))
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from, s.usedTLS = strings.Trim(line[len("MAIL FROM:"):], "<> "), secure
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var sb strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				sb.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = sb.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTP) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+func TestEmailChannelSTARTTLS(t *testing.T) {
+	smtpSrv := newFakeSMTP(t, true)
+	ch := mustBuild(t, ChannelEmail, map[string]any{
+		"host":                 "127.0.0.1",
+		"port":                 smtpSrv.port(),
+		"username":             "bot",
+		"password":             "pw",
+		"from":                 "QCC <bot@example.com>",
+		"to":                   []string{"ops@example.com", "Oncall <oncall@example.com>"},
+		"insecure_skip_verify": true,
+	})
+	if err := ch.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	smtpSrv.mu.Lock()
+	defer smtpSrv.mu.Unlock()
+	if !smtpSrv.usedTLS || smtpSrv.from != "bot@example.com" || strings.Join(smtpSrv.rcpts, ",") != "ops@example.com,oncall@example.com" {
+		t.Fatalf("unexpected envelope: tls=%v from=%s rcpts=%v", smtpSrv.usedTLS, smtpSrv.from, smtpSrv.rcpts)
+	}
+	if smtpSrv.auth != "\x00bot\x00pw" {
+		t.Fatalf("unexpected auth: %q", smtpSrv.auth)
+	}
+	if !strings.Contains(smtpSrv.data, "Subject: =?UTF-8?b?") || !strings.Contains(smtpSrv.data, "Content-Transfer-Encoding: base64") {
+		t.Fatalf("unexpected headers: %s", smtpSrv.data)
+	}
+	parts := strings.SplitN(smtpSrv.data, "\r\n\r\n", 2)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(parts[1], "\r\n", ""))
+	if err != nil || !strings.Contains(string(decoded), "relay-1") {
+		t.Fatalf("unexpected body: %q (%v)", decoded, err)
+	}
+}
+
+func TestEmailChannelRequiresSTARTTLS(t *testing.T) {
+	smtpSrv := newFakeSMTP(t, false)
+	ch := mustBuild(t, ChannelEmail, map[string]any{
+		"host": "127.0.0.1", "port": smtpSrv.port(), "from": "bot@example.com", "to": []string{"ops@example.com"},
+	})
+	if err := ch.Send(context.Background(), testMessage); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+
+	plain := mustBuild(t, ChannelEmail, map[string]any{
+		"host": "127.0.0.1", "port": smtpSrv.port(), "from": "bot@example.com", "to": []string{"ops@example.com"}, "tls_mode": "none",
+	})
+	if err := plain.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("plain relay send: %v", err)
+	}
+}
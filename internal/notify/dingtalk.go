@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+type dingtalkConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	Secret     string `json:"secret,omitempty"` // 机器人“加签”密钥，未开启加签时留空
+}
+
+type dingtalkChannel struct {
+	cfg    dingtalkConfig
+	client *http.Client
+	name   string
+	now    func() time.Time
+}
+
+func newDingTalkChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+	var cfg dingtalkConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse dingtalk config: %w", err)
+		}
+	}
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("dingtalk webhook_url required")
+	}
+	if err := validateHTTPURL(cfg.WebhookURL); err != nil {
+		return nil, err
+	}
+	return &dingtalkChannel{
+		cfg:    cfg,
+		name:   rec.Name,
+		client: &http.Client{Timeout: 5 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+// signedURL 按钉钉加签规则在 webhook 上追加 timestamp 与 sign 参数。
+func (d *dingtalkChannel) signedURL() (string, error) {
+	if d.cfg.Secret == "" {
+		return d.cfg.WebhookURL, nil
+	}
+	u, err := url.Parse(d.cfg.WebhookURL)
+	if err != nil {
+		return "", err
+	}
+	ts := strconv.FormatInt(d.now().UnixMilli(), 10)
+	q := u.Query()
+	q.Set("timestamp", ts)
+	q.Set("sign", dingtalkSign(ts, d.cfg.Secret))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func dingtalkSign(timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (d *dingtalkChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	title := msg.Title
+	if title == "" {
+		title = msg.EventType
+	}
+	body := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": title,
+			"text":  formatDingTalkMarkdown(msg),
+		},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	target, err := d.signedURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dingtalk webhook status %d", resp.StatusCode)
+	}
+	var res struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err == nil && res.ErrCode != 0 {
+		return fmt.Errorf("dingtalk webhook error: %s", res.ErrMsg)
+	}
+	return nil
+}
+
+func formatDingTalkMarkdown(msg NotificationMessage) string {
+	l := labelsFor(msg.Language)
+	content := msg.Content
+	if content == "" {
+		content = "_" + l.NoContent + "_"
+	}
+	title := msg.Title
+	if title == "" {
+		title = msg.EventType
+	}
+	return fmt.Sprintf("#### %s\n> %s：%s\n>\n> %s：%s\n\n%s", title, l.EventType, msg.EventType, l.Time, formatTime(msg.OccurredAt, msg.Language), content)
+}
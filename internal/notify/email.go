@@ -0,0 +1,193 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// SMTP 连接加密方式。
+const (
+	emailTLSStartTLS = "starttls" // 明文连接后升级（默认，端口 587）
+	emailTLSImplicit = "tls"      // 直接 TLS 连接（端口 465）
+	emailTLSNone     = "none"     // 不加密，仅用于内网中继
+)
+
+type emailConfig struct {
+	Host               string   `json:"host"`
+	Port               int      `json:"port,omitempty"`
+	Username           string   `json:"username,omitempty"`
+	Password           string   `json:"password,omitempty"`
+	From               string   `json:"from"`
+	To                 []string `json:"to"`
+	TLSMode            string   `json:"tls_mode,omitempty"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+}
+
+type emailChannel struct {
+	cfg     emailConfig
+	name    string
+	timeout time.Duration
+}
+
+func newEmailChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+	var cfg emailConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse email config: %w", err)
+		}
+	}
+	cfg.Host = strings.TrimSpace(cfg.Host)
+	if cfg.Host == "" {
+		return nil, errors.New("email host required")
+	}
+	cfg.TLSMode = strings.ToLower(strings.TrimSpace(cfg.TLSMode))
+	switch cfg.TLSMode {
+	case "":
+		cfg.TLSMode = emailTLSStartTLS
+	case emailTLSStartTLS, emailTLSImplicit, emailTLSNone:
+	default:
+		return nil, fmt.Errorf("email tls_mode must be one of starttls, tls, none")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLSMode == emailTLSImplicit {
+			cfg.Port = 465
+		}
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return nil, errors.New("email port invalid")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("email from invalid: %w", err)
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("email to required")
+	}
+	for _, addr := range cfg.To {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return nil, fmt.Errorf("email recipient %q invalid: %w", addr, err)
+		}
+	}
+	if cfg.Password != "" && cfg.Username == "" {
+		return nil, errors.New("email username required when password is set")
+	}
+	return &emailChannel{cfg: cfg, name: rec.Name, timeout: 10 * time.Second}, nil
+}
+
+func (e *emailChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	tlsCfg := &tls.Config{ServerName: e.cfg.Host, InsecureSkipVerify: e.cfg.InsecureSkipVerify}
+
+	dialer := &net.Dialer{Timeout: e.timeout}
+	var conn net.Conn
+	var err error
+	if e.cfg.TLSMode == emailTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsCfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(e.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if e.cfg.TLSMode == emailTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsCfg); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	from, _ := mail.ParseAddress(e.cfg.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.cfg.To {
+		rcpt, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildEmailMessage(e.cfg, msg)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage 构造 UTF-8 纯文本邮件，主题使用 RFC 2047 编码，正文 base64 编码。
+func buildEmailMessage(cfg emailConfig, msg NotificationMessage) []byte {
+	title := msg.Title
+	if title == "" {
+		title = msg.EventType
+	}
+	l := labelsFor(msg.Language)
+	content := msg.Content
+	if content == "" {
+		content = l.NoContent
+	}
+	occurred := msg.OccurredAt
+	if occurred.IsZero() {
+		occurred = time.Now()
+	}
+	text := fmt.Sprintf("%s\n\n%s：%s\n%s：%s\n\n%s\n", title, l.EventType, msg.EventType, l.Time, formatTime(occurred, msg.Language), content)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", "[qcc_plus] "+title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", occurred.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(text))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
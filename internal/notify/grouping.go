@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// maxGroupLines 汇总消息最多列出的明细条数。
+const maxGroupLines = 20
+
+// eventGroup 聚合窗口内同一订阅收到的事件。
+type eventGroup struct {
+	sub    store.SubscriptionWithChannel
+	rules  SubscriptionRules
+	events []Event
+	timer  *time.Timer
+}
+
+// incident 聚合模式下尚未恢复的故障；open 为仍处于故障状态的对象（node_id → 名称）。
+type incident struct {
+	sub      store.SubscriptionWithChannel
+	rules    SubscriptionRules
+	first    Event
+	open     map[string]string
+	subjects []string // 涉及对象，按首次出现排序
+	alerts   int
+}
+
+// resolvedBy 恢复事件 → 可被其关闭的故障事件类型，按 node_id 匹配（无 node_id 的事件视为同一对象）。
+var resolvedBy = map[string][]string{
+	EventNodeRecovered:       {EventNodeFailed, EventNodeHealthCheckError},
+	EventNodeDeleted:         {EventNodeFailed, EventNodeHealthCheckError},
+	EventSystemTunnelStarted: {EventSystemTunnelError},
+}
+
+func resolvable(eventType string) bool {
+	for _, types := range resolvedBy {
+		if containsString(types, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// addToGroup 将事件放入订阅的聚合组，首个事件到达时开始计时，窗口到期后统一发送。
+func (m *Manager) addToGroup(sub store.SubscriptionWithChannel, rules SubscriptionRules, evt Event) {
+	m.groupMu.Lock()
+	defer m.groupMu.Unlock()
+	if rules.Group.Resolved && resolvable(evt.EventType) {
+		m.trackIncidentLocked(sub, rules, evt)
+	}
+	id := sub.Subscription.ID
+	if g, ok := m.groups[id]; ok {
+		g.events = append(g.events, evt)
+		return
+	}
+	g := &eventGroup{sub: sub, rules: rules, events: []Event{evt}}
+	m.groupWG.Add(1)
+	g.timer = time.AfterFunc(rules.Group.Window(), func() { m.flushGroup(id, g) })
+	m.groups[id] = g
+}
+
+// flushGroup 取出并发送订阅的聚合组；want 非空时仅当当前组为 want 才发送，避免过期计时器提前发送新组。
+func (m *Manager) flushGroup(id string, want *eventGroup) {
+	m.groupMu.Lock()
+	g := m.groups[id]
+	if g == nil || (want != nil && g != want) {
+		m.groupMu.Unlock()
+		return
+	}
+	delete(m.groups, id)
+	g.timer.Stop()
+	m.groupMu.Unlock()
+	defer m.groupWG.Done()
+
+	first := g.events[0]
+	title, content, lang := m.render(g.sub, g.rules, first)
+	if len(g.events) > 1 {
+		title, content = summarizeGroup(title, lang, g.events, g.rules.Group.Window())
+	}
+	m.deliver(context.Background(), g.sub.Channel, NotificationMessage{
+		AccountID:  first.AccountID,
+		EventType:  first.EventType,
+		Title:      title,
+		Content:    content,
+		Language:   lang,
+		OccurredAt: first.OccurredAt,
+	})
+}
+
+// flushAllGroups 立即发送所有聚合中的事件并等待完成，用于停止管理器。
+func (m *Manager) flushAllGroups() {
+	m.groupMu.Lock()
+	ids := make([]string, 0, len(m.groups))
+	for id := range m.groups {
+		ids = append(ids, id)
+	}
+	m.groupMu.Unlock()
+	for _, id := range ids {
+		m.flushGroup(id, nil)
+	}
+	m.groupWG.Wait()
+}
+
+func (m *Manager) trackIncidentLocked(sub store.SubscriptionWithChannel, rules SubscriptionRules, evt Event) {
+	id := sub.Subscription.ID
+	inc := m.incidents[id]
+	if inc == nil {
+		inc = &incident{first: evt, open: make(map[string]string)}
+		m.incidents[id] = inc
+	}
+	// 使用最新的订阅与渠道配置发送恢复消息
+	inc.sub, inc.rules = sub, rules
+	subject := eventSubject(evt)
+	inc.open[incidentMember(evt)] = subject
+	if subject != "" && !containsString(inc.subjects, subject) {
+		inc.subjects = append(inc.subjects, subject)
+	}
+	inc.alerts++
+}
+
+// resolveIncidents 处理恢复事件：故障对象全部恢复后先发送未到期的汇总，再发送"已恢复"消息。
+func (m *Manager) resolveIncidents(evt Event) {
+	types := resolvedBy[evt.EventType]
+	if len(types) == 0 {
+		return
+	}
+	member := incidentMember(evt)
+	resolved := make(map[string]*incident)
+	m.groupMu.Lock()
+	for id, inc := range m.incidents {
+		if inc.first.AccountID != evt.AccountID || !containsString(types, inc.first.EventType) {
+			continue
+		}
+		if _, ok := inc.open[member]; !ok {
+			continue
+		}
+		delete(inc.open, member)
+		if len(inc.open) == 0 {
+			delete(m.incidents, id)
+			resolved[id] = inc
+		}
+	}
+	m.groupMu.Unlock()
+
+	for id, inc := range resolved {
+		m.flushGroup(id, nil)
+		m.sendResolved(inc, evt.OccurredAt)
+	}
+}
+
+func (m *Manager) sendResolved(inc *incident, at time.Time) {
+	label, _, lang := m.render(inc.sub, inc.rules, inc.first)
+	subjects := "-"
+	var title, content string
+	if lang == LangEN {
+		if len(inc.subjects) > 0 {
+			subjects = strings.Join(inc.subjects, ", ")
+		}
+		title = "[Resolved] " + label
+		content = fmt.Sprintf("**Duration**: %s\n**Affected**: %s\n**Alerts**: %d\n**Resolved at**: %s",
+			humanDuration(at.Sub(inc.first.OccurredAt), lang), subjects, inc.alerts, formatTime(at, lang))
+	} else {
+		if len(inc.subjects) > 0 {
+			subjects = strings.Join(inc.subjects, "、")
+		}
+		title = "【已恢复】" + label
+		content = fmt.Sprintf("**持续时间**: %s\n**涉及对象**: %s\n**告警次数**: %d\n**恢复时间**: %s",
+			humanDuration(at.Sub(inc.first.OccurredAt), lang), subjects, inc.alerts, formatTime(at, lang))
+	}
+	m.deliver(context.Background(), inc.sub.Channel, NotificationMessage{
+		AccountID:  inc.first.AccountID,
+		EventType:  inc.first.EventType,
+		Title:      title,
+		Content:    content,
+		Language:   lang,
+		OccurredAt: at,
+	})
+}
+
+// summarizeGroup 生成聚合汇总消息，label 为首个事件渲染出的标题。
+func summarizeGroup(label, lang string, events []Event, window time.Duration) (string, string) {
+	var subjects, lines []string
+	for i, evt := range events {
+		subject := eventSubject(evt)
+		if subject != "" && !containsString(subjects, subject) {
+			subjects = append(subjects, subject)
+		}
+		if i >= maxGroupLines {
+			continue
+		}
+		line := "- " + timeutil.ToBeijingTime(evt.OccurredAt).Format("15:04:05") + " " + chooseString(subject, evt.EventType)
+		if detail := eventDetail(evt); detail != "" {
+			line += ": " + detail
+		}
+		lines = append(lines, line)
+	}
+	more := len(events) - maxGroupLines
+	if lang == LangEN {
+		if more > 0 {
+			lines = append(lines, fmt.Sprintf("- ... and %d more", more))
+		}
+		title := fmt.Sprintf("%s: %d events in %s", label, len(events), humanDuration(window, lang))
+		content := fmt.Sprintf("**Events**: %d\n**Affected**: %s\n%s", len(events), chooseString(strings.Join(subjects, ", "), "-"), strings.Join(lines, "\n"))
+		return title, content
+	}
+	if more > 0 {
+		lines = append(lines, fmt.Sprintf("- …… 另有 %d 条", more))
+	}
+	title := fmt.Sprintf("%s：%s内 %d 条", label, humanDuration(window, lang), len(events))
+	content := fmt.Sprintf("**事件数**: %d\n**涉及对象**: %s\n%s", len(events), chooseString(strings.Join(subjects, "、"), "-"), strings.Join(lines, "\n"))
+	return title, content
+}
+
+// incidentMember 故障对象标识，取 node_id。
+func incidentMember(evt Event) string {
+	id, _ := evt.Data["node_id"].(string)
+	return id
+}
+
+// eventSubject 事件涉及的对象名称，用于汇总与恢复消息。
+func eventSubject(evt Event) string {
+	for _, k := range []string{"node_name", "account_name", "username", "subdomain", "url"} {
+		if v, ok := evt.Data[k]; ok && v != nil && fmt.Sprint(v) != "" && fmt.Sprint(v) != "-" {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+func eventDetail(evt Event) string {
+	for _, k := range []string{"error", "reason"} {
+		if v, ok := evt.Data[k]; ok && v != nil && fmt.Sprint(v) != "" {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// humanDuration 将时长格式化为"1分钟30秒" / "1m30s"，精确到秒。
+func humanDuration(d time.Duration, lang string) string {
+	d = d.Round(time.Second)
+	if d < 0 {
+		d = 0
+	}
+	units := []string{"小时", "分钟", "秒"}
+	if lang == LangEN {
+		units = []string{"h", "m", "s"}
+	}
+	parts := []int{int(d / time.Hour), int(d % time.Hour / time.Minute), int(d % time.Minute / time.Second)}
+	var b strings.Builder
+	for i, n := range parts {
+		if n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, units[i])
+		}
+	}
+	if b.Len() == 0 {
+		return "0" + units[2]
+	}
+	return b.String()
+}
+
+func chooseString(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// collectServer 记录所有 webhook 请求体。
+func collectServer(t *testing.T) (*httptest.Server, func() []webhookPayload) {
+	t.Helper()
+	var mu sync.Mutex
+	var payloads []webhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p webhookPayload
+		_ = json.Unmarshal(body, &p)
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []webhookPayload {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]webhookPayload(nil), payloads...)
+	}
+}
+
+func nodeEvent(eventType, id, name string, at time.Time) Event {
+	return Event{
+		AccountID:  "acc-1",
+		EventType:  eventType,
+		Data:       map[string]any{"node_id": id, "node_name": name, "error": "timeout"},
+		DedupKey:   id,
+		OccurredAt: at,
+	}
+}
+
+func TestGroupedAlertsAndResolvedMessage(t *testing.T) {
+	srv, payloads := collectServer(t)
+	st := setupOutboxTest(t, srv)
+	if err := st.UpsertNotificationSubscription(context.Background(), store.NotificationSubscriptionRecord{
+		ID: "sub-1", AccountID: "acc-1", ChannelID: "chn-1", EventType: EventNodeFailed, Enabled: true,
+		Rules: json.RawMessage(`{"group":{"window_sec":120,"resolved":true}}`),
+	}); err != nil {
+		t.Fatalf("update subscription: %v", err)
+	}
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}), WithWorkerCount(1))
+
+	start := time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC)
+	for i, name := range []string{"relay-1", "relay-2", "relay-3"} {
+		m.Publish(nodeEvent(EventNodeFailed, "n"+name[len(name)-1:], name, start.Add(time.Duration(i)*time.Second)))
+	}
+	m.Publish(nodeEvent(EventNodeRecovered, "n1", "relay-1", start.Add(time.Minute)))
+	m.Publish(nodeEvent(EventNodeRecovered, "n2", "relay-2", start.Add(2*time.Minute)))
+	time.Sleep(100 * time.Millisecond)
+	if got := payloads(); len(got) != 0 {
+		t.Fatalf("nothing should be sent before window ends or incident resolves: %+v", got)
+	}
+
+	// 最后一个节点恢复：先发送聚合汇总，再发送恢复消息
+	m.Publish(nodeEvent(EventNodeRecovered, "n3", "relay-3", start.Add(3*time.Minute)))
+	m.Stop()
+
+	got := payloads()
+	if len(got) != 2 {
+		t.Fatalf("expected summary and resolved messages, got %+v", got)
+	}
+	if got[0].Title != "节点故障告警：2分钟内 3 条" || !strings.Contains(got[0].Content, "relay-1、relay-2、relay-3") ||
+		!strings.Contains(got[0].Content, "- 12:00:01 relay-2: timeout") {
+		t.Fatalf("unexpected summary: %+v", got[0])
+	}
+	if got[1].Title != "【已恢复】节点故障告警" || !strings.Contains(got[1].Content, "**持续时间**: 3分钟") ||
+		!strings.Contains(got[1].Content, "**告警次数**: 3") {
+		t.Fatalf("unexpected resolved message: %+v", got[1])
+	}
+}
+
+func TestGroupWindowFlushesSingleEvent(t *testing.T) {
+	srv, payloads := collectServer(t)
+	st := setupOutboxTest(t, srv)
+	if err := st.UpsertNotificationSubscription(context.Background(), store.NotificationSubscriptionRecord{
+		ID: "sub-1", AccountID: "acc-1", ChannelID: "chn-1", EventType: EventNodeFailed, Enabled: true,
+		Rules: json.RawMessage(`{"group":{"window_sec":1}}`),
+	}); err != nil {
+		t.Fatalf("update subscription: %v", err)
+	}
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}))
+	defer m.Stop()
+
+	m.Publish(nodeEvent(EventNodeFailed, "n1", "relay-1", time.Now()))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(payloads()) == 0 {
+		time.Sleep(20 * time.Millisecond)
+	}
+	got := payloads()
+	if len(got) != 1 || got[0].Title != "节点故障告警" {
+		t.Fatalf("single grouped event should use the regular template: %+v", got)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		lang string
+		want string
+	}{
+		{0, LangZH, "0秒"},
+		{90 * time.Second, LangZH, "1分钟30秒"},
+		{2*time.Hour + 1500*time.Millisecond, LangEN, "2h2s"},
+		{5 * time.Minute, LangEN, "5m"},
+	}
+	for _, c := range cases {
+		if got := humanDuration(c.d, c.lang); got != c.want {
+			t.Fatalf("humanDuration(%v, %s) = %q, want %q", c.d, c.lang, got, c.want)
+		}
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	from := time.Date(2025, 1, 1, 16, 0, 0, 0, time.UTC)
+	evt := Event{EventType: EventAccountDigestDaily, Data: map[string]any{
+		"period": "day", "from": from, "to": from.Add(24 * time.Hour),
+		"requests": int64(10), "success": int64(9), "failed": int64(1), "success_rate": 90.0,
+		"avg_latency_ms": int64(120), "input_tokens": int64(100), "output_tokens": int64(50),
+		"nodes_total": 2, "nodes_healthy": 1, "unhealthy_nodes": []string{"relay-2"},
+		"nodes": []map[string]any{{"name": "relay-1", "requests": int64(10), "failed": int64(1), "avg_latency_ms": int64(120)}},
+	}}
+	title, content, _, err := RenderMessage(evt)
+	if err != nil || title != "每日运行摘要" {
+		t.Fatalf("unexpected digest title %q: %v", title, err)
+	}
+	for _, want := range []string{"**成功率**: 90.00%", "**节点健康**: 1/2（异常：relay-2）", "- relay-1: 10 次请求，失败 1，平均 120 ms"} {
+		if !strings.Contains(content, want) {
+			t.Fatalf("digest content missing %q:\n%s", want, content)
+		}
+	}
+	if _, err := ParseSubscriptionRules(json.RawMessage(`{"group":{"window_sec":7200}}`)); err == nil {
+		t.Fatal("expected window_sec upper bound error")
+	}
+}
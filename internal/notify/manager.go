@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"qcc_plus/internal/store"
@@ -16,6 +18,12 @@ const (
 	historyStatusFailed = "failed"
 )
 
+// ErrOutboxAlreadySent 表示发件箱记录已投递成功，无需重发。
+var ErrOutboxAlreadySent = errors.New("outbox item already sent")
+
+// ErrOutboxInProgress 表示发件箱记录正由其他投递（本实例或共享数据库的其他实例）发送中。
+var ErrOutboxInProgress = errors.New("outbox item is being delivered")
+
 // Manager 负责异步派发通知。
 type Manager struct {
 	store      Store
@@ -23,9 +31,20 @@ type Manager struct {
 	queue      chan Event
 	wg         sync.WaitGroup
 	stopOnce   sync.Once
+	closeMu    sync.RWMutex // 保护 closed，避免 Stop 关闭队列后 Publish 向已关闭通道发送
+	closed     bool
+	quit       chan struct{}
 	stopped    chan struct{}
 	dedupMu    sync.Mutex
 	lastNotify map[string]time.Time
+
+	groupMu   sync.Mutex
+	groups    map[string]*eventGroup // 按订阅 ID 聚合中的事件
+	incidents map[string]*incident   // 按订阅 ID 记录未恢复的故障
+	groupWG   sync.WaitGroup         // 等待聚合窗口到期后的发送完成
+
+	dropped    uint64 // 队列满被丢弃的事件数
+	deadLetter uint64 // 超过最大重试次数进入死信的通知数
 }
 
 // Option 自定义管理器配置。
@@ -76,14 +95,42 @@ func WithSendTimeout(d time.Duration) Option {
 	}
 }
 
+// WithRetryPolicy 设置失败重试策略：最大尝试次数（含首次发送）与指数退避的初始/最大间隔。
+func WithRetryPolicy(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *ManagerConfig) {
+		if maxAttempts > 0 {
+			c.MaxAttempts = maxAttempts
+		}
+		if baseDelay > 0 {
+			c.RetryBaseDelay = baseDelay
+		}
+		if maxDelay > 0 {
+			c.RetryMaxDelay = maxDelay
+		}
+	}
+}
+
+// WithRetryInterval 设置发件箱轮询间隔。
+func WithRetryInterval(d time.Duration) Option {
+	return func(c *ManagerConfig) {
+		if d > 0 {
+			c.RetryInterval = d
+		}
+	}
+}
+
 // NewManager 创建并启动通知管理器。
 func NewManager(store Store, opts ...Option) *Manager {
 	cfg := ManagerConfig{
-		QueueSize:   128,
-		WorkerCount: 2,
-		DedupWindow: 5 * time.Minute,
-		Logger:      log.Default(),
-		SendTimeout: 8 * time.Second,
+		QueueSize:      128,
+		WorkerCount:    2,
+		DedupWindow:    5 * time.Minute,
+		Logger:         log.Default(),
+		SendTimeout:    8 * time.Second,
+		MaxAttempts:    5,
+		RetryBaseDelay: 30 * time.Second,
+		RetryMaxDelay:  30 * time.Minute,
+		RetryInterval:  15 * time.Second,
 	}
 	for _, opt := range opts {
 		opt(&cfg)
@@ -95,13 +142,18 @@ func NewManager(store Store, opts ...Option) *Manager {
 		store:      store,
 		cfg:        cfg,
 		queue:      make(chan Event, cfg.QueueSize),
+		quit:       make(chan struct{}),
 		stopped:    make(chan struct{}),
 		lastNotify: make(map[string]time.Time),
+		groups:     make(map[string]*eventGroup),
+		incidents:  make(map[string]*incident),
 	}
 	for i := 0; i < cfg.WorkerCount; i++ {
 		m.wg.Add(1)
 		go m.worker()
 	}
+	m.wg.Add(1)
+	go m.retryLoop()
 	return m
 }
 
@@ -113,21 +165,57 @@ func (m *Manager) Publish(evt Event) {
 	if evt.OccurredAt.IsZero() {
 		evt.OccurredAt = time.Now()
 	}
+	m.closeMu.RLock()
+	defer m.closeMu.RUnlock()
+	if m.closed {
+		m.logf("notify manager stopped, drop event %s for account %s", evt.EventType, evt.AccountID)
+		return
+	}
 	select {
 	case m.queue <- evt:
 	default:
-		m.logf("notify queue full, drop event %s for account %s", evt.EventType, evt.AccountID)
+		n := atomic.AddUint64(&m.dropped, 1)
+		m.logf("notify queue full, drop event %s for account %s (dropped total %d)", evt.EventType, evt.AccountID, n)
+	}
+}
+
+// DroppedCount 返回因队列已满被丢弃的事件总数。
+func (m *Manager) DroppedCount() uint64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// DeadLetterCount 返回本进程内重试耗尽、进入死信状态的通知总数。
+func (m *Manager) DeadLetterCount() uint64 {
+	if m == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&m.deadLetter)
+}
+
+// QueueDepth 返回队列中待处理事件数与队列容量。
+func (m *Manager) QueueDepth() (int, int) {
+	if m == nil {
+		return 0, 0
 	}
+	return len(m.queue), cap(m.queue)
 }
 
-// Stop 停止后台 worker。
+// Stop 停止后台 worker，并立即发送尚在聚合窗口内的事件。
 func (m *Manager) Stop() {
 	if m == nil {
 		return
 	}
 	m.stopOnce.Do(func() {
+		m.closeMu.Lock()
+		m.closed = true
+		close(m.quit)
 		close(m.queue)
+		m.closeMu.Unlock()
 		m.wg.Wait()
+		m.flushAllGroups()
 		close(m.stopped)
 	})
 }
@@ -141,10 +229,11 @@ func (m *Manager) worker() {
 }
 
 func (m *Manager) handleEvent(evt Event) {
-	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.SendTimeout)
-	defer cancel()
+	m.resolveIncidents(evt)
 
+	ctx, cancel := storeContext(context.Background())
 	subs, err := m.store.ListEnabledSubscriptionsForEvent(ctx, evt.AccountID, evt.EventType)
+	cancel()
 	if err != nil {
 		m.logf("list subscriptions failed: %v", err)
 		return
@@ -152,51 +241,98 @@ func (m *Manager) handleEvent(evt Event) {
 	if len(subs) == 0 {
 		return
 	}
+	now := time.Now()
 	for _, sub := range subs {
+		rules, err := ParseSubscriptionRules(sub.Subscription.Rules)
+		if err != nil {
+			m.logf("subscription %s rules invalid, ignored: %v", sub.Subscription.ID, err)
+		}
+		if ok, _ := rules.Match(evt, now); !ok {
+			continue
+		}
 		key := m.composeDedupKey(evt, sub)
 		if !m.shouldSend(key) {
 			continue
 		}
-		ch, err := buildChannel(sub.Channel)
-		if err != nil {
-			m.logf("build channel %s failed: %v", sub.Channel.ID, err)
+		if rules.Group.Window() > 0 {
+			m.addToGroup(sub, rules, evt)
 			continue
 		}
-		msg := NotificationMessage{
+		title, content, lang := m.render(sub, rules, evt)
+		m.deliver(context.Background(), sub.Channel, NotificationMessage{
 			AccountID:  evt.AccountID,
 			EventType:  evt.EventType,
-			Title:      evt.Title,
-			Content:    evt.Content,
+			Title:      title,
+			Content:    content,
+			Language:   lang,
 			OccurredAt: evt.OccurredAt,
-		}
-		sendErr := ch.Send(ctx, msg)
-		status := historyStatusSent
-		errText := ""
-		var sentAt *time.Time
-		if sendErr != nil {
-			status = historyStatusFailed
-			errText = sendErr.Error()
-		} else {
-			now := time.Now()
-			sentAt = &now
-		}
-		if err := m.store.InsertNotificationHistory(ctx, store.NotificationHistoryRecord{
-			ID:        randomID(),
-			AccountID: evt.AccountID,
-			ChannelID: sub.Channel.ID,
-			EventType: evt.EventType,
-			Title:     evt.Title,
-			Content:   evt.Content,
-			Status:    status,
-			Error:     errText,
-			SentAt:    sentAt,
-			CreatedAt: time.Now(),
-		}); err != nil {
-			m.logf("insert notification history failed: %v", err)
-		}
-		if sendErr != nil {
-			m.logf("send notification via %s failed: %v", sub.Channel.ChannelType, sendErr)
-		}
+		})
+	}
+}
+
+// render 按订阅模板 > 渠道模板 > 内置模板渲染单条事件。
+func (m *Manager) render(sub store.SubscriptionWithChannel, rules SubscriptionRules, evt Event) (title, content, lang string) {
+	chTpl, err := ParseMessageTemplate(sub.Channel.Config)
+	if err != nil {
+		m.logf("channel %s template invalid, ignored: %v", sub.Channel.ID, err)
+	}
+	title, content, lang, err = RenderMessage(evt, rules.MessageTemplate, chTpl)
+	if err != nil {
+		m.logf("render template for subscription %s failed, fallback to builtin: %v", sub.Subscription.ID, err)
+	}
+	return title, content, lang
+}
+
+// storeTimeout 写入发送历史与发件箱的超时，独立于发送超时。
+const storeTimeout = 5 * time.Second
+
+// storeContext 返回用于存储读写的 ctx：不继承 parent 的取消与截止时间，
+// 发送超时后仍要能写入历史并入队重试。
+func storeContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(parent), storeTimeout)
+}
+
+// deliver 通过渠道发送消息并记录历史，失败时写入发件箱等待重试。
+// 每次发送使用独立的 SendTimeout，历史与发件箱写入使用新的存储 ctx。
+func (m *Manager) deliver(parent context.Context, chRec store.NotificationChannelRecord, msg NotificationMessage) {
+	ch, err := buildChannel(chRec)
+	if err != nil {
+		m.logf("build channel %s failed: %v", chRec.ID, err)
+		return
+	}
+	sendCtx, cancelSend := context.WithTimeout(parent, m.cfg.SendTimeout)
+	sendErr := ch.Send(sendCtx, msg)
+	cancelSend()
+
+	ctx, cancel := storeContext(parent)
+	defer cancel()
+	status := historyStatusSent
+	errText := ""
+	var sentAt *time.Time
+	if sendErr != nil {
+		status = historyStatusFailed
+		errText = sendErr.Error()
+	} else {
+		now := time.Now()
+		sentAt = &now
+	}
+	if err := m.store.InsertNotificationHistory(ctx, store.NotificationHistoryRecord{
+		ID:        randomID(),
+		AccountID: msg.AccountID,
+		ChannelID: chRec.ID,
+		EventType: msg.EventType,
+		Title:     msg.Title,
+		Content:   msg.Content,
+		Status:    status,
+		Error:     errText,
+		SentAt:    sentAt,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		m.logf("insert notification history failed: %v", err)
+	}
+	if sendErr != nil {
+		m.logf("send notification via %s failed: %v", chRec.ChannelType, sendErr)
+		m.enqueueRetry(ctx, msg, chRec.ID, sendErr)
 	}
 }
 
@@ -40,4 +40,24 @@ const (
 		KEY idx_history_account_event (account_id, event_type),
         KEY idx_history_channel (channel_id)
 	)`
+
+	DDLNotificationOutbox = `CREATE TABLE IF NOT EXISTS notification_outbox (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		channel_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(128) NOT NULL,
+		title VARCHAR(255),
+		content TEXT,
+		language VARCHAR(8) NOT NULL DEFAULT '',
+		occurred_at DATETIME NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		max_attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		KEY idx_outbox_status_next (status, next_attempt_at),
+		KEY idx_outbox_account_created (account_id, created_at)
+	)`
 )
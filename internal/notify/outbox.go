@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// outboxBatchSize 每轮轮询最多处理的到期记录数。
+const outboxBatchSize = 50
+
+// outboxLockMargin 认领锁在发送超时之外的余量，覆盖状态回写的耗时；进程在投递中退出时，锁过期后由其他实例接手。
+const outboxLockMargin = 30 * time.Second
+
+// retryDelay 返回第 attempts 次失败后的退避间隔：base*2^(attempts-1)，不超过 max。
+func (c ManagerConfig) retryDelay(attempts int) time.Duration {
+	d := c.RetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= c.RetryMaxDelay || d <= 0 {
+			return c.RetryMaxDelay
+		}
+	}
+	if d > c.RetryMaxDelay {
+		return c.RetryMaxDelay
+	}
+	return d
+}
+
+// enqueueRetry 将首次发送失败的通知（已渲染）写入发件箱，等待后台重试。
+func (m *Manager) enqueueRetry(ctx context.Context, msg NotificationMessage, channelID string, sendErr error) {
+	now := time.Now()
+	rec := store.NotificationOutboxRecord{
+		ID:            randomID(),
+		AccountID:     msg.AccountID,
+		ChannelID:     channelID,
+		EventType:     msg.EventType,
+		Title:         msg.Title,
+		Content:       msg.Content,
+		Language:      msg.Language,
+		OccurredAt:    msg.OccurredAt,
+		Status:        store.OutboxStatusPending,
+		Attempts:      1,
+		MaxAttempts:   m.cfg.MaxAttempts,
+		NextAttemptAt: now.Add(m.cfg.retryDelay(1)),
+		LastError:     sendErr.Error(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if rec.Attempts >= rec.MaxAttempts {
+		rec.Status = store.OutboxStatusDead
+		atomic.AddUint64(&m.deadLetter, 1)
+	}
+	if err := m.store.InsertNotificationOutbox(ctx, rec); err != nil {
+		m.logf("insert notification outbox failed: %v", err)
+	}
+}
+
+// retryLoop 定期投递发件箱中已到期的通知。
+func (m *Manager) retryLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+			m.retryDue()
+		}
+	}
+}
+
+// retryDue 处理一批到期的 pending 记录。
+func (m *Manager) retryDue() {
+	ctx, cancel := storeContext(context.Background())
+	items, err := m.store.ListDueNotificationOutbox(ctx, time.Now(), outboxBatchSize)
+	cancel()
+	if err != nil {
+		m.logf("list notification outbox failed: %v", err)
+		return
+	}
+	for i := range items {
+		select {
+		case <-m.quit:
+			return
+		default:
+		}
+		if err := m.deliverOutbox(&items[i], false); err != nil && !errors.Is(err, ErrOutboxInProgress) {
+			m.logf("deliver notification outbox %s failed: %v", items[i].ID, err)
+		}
+	}
+}
+
+// Resend 立即重发一条发件箱记录（pending 或 dead），返回更新后的记录；
+// 发送失败不视为错误，失败原因见返回记录的 LastError。
+func (m *Manager) Resend(ctx context.Context, id string) (*store.NotificationOutboxRecord, error) {
+	if m == nil {
+		return nil, errors.New("notification manager not enabled")
+	}
+	rec, err := m.store.GetNotificationOutbox(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status == store.OutboxStatusSent {
+		return rec, ErrOutboxAlreadySent
+	}
+	if err := m.deliverOutbox(rec, true); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// deliverOutbox 在存储中认领记录后投递并回写状态。自动重试失败时按退避规则安排下次重试，
+// 达到最大次数转为死信；手动重发失败不改变原有状态，仅更新尝试次数与错误信息。
+// 记录已被其他投递认领时返回 ErrOutboxInProgress。
+func (m *Manager) deliverOutbox(rec *store.NotificationOutboxRecord, manual bool) error {
+	prevStatus := rec.Status
+	if prevStatus == store.OutboxStatusSending {
+		// 认领已过期（上次投递的进程退出），按待重试处理。
+		prevStatus = store.OutboxStatusPending
+	}
+	claimCtx, cancelClaim := storeContext(context.Background())
+	now := time.Now()
+	claimed, err := m.store.ClaimNotificationOutbox(claimCtx, rec.ID, rec.Status, now, now.Add(m.cfg.SendTimeout+outboxLockMargin))
+	cancelClaim()
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrOutboxInProgress
+	}
+
+	sendCtx, cancelSend := context.WithTimeout(context.Background(), m.cfg.SendTimeout)
+	permanent, sendErr := m.sendOutbox(sendCtx, rec)
+	cancelSend()
+
+	// 回写状态使用新的存储 ctx，避免发送超时后状态无法更新。
+	ctx, cancel := storeContext(context.Background())
+	defer cancel()
+	now = time.Now()
+	rec.Attempts++
+	rec.UpdatedAt = now
+	rec.Status = prevStatus
+	switch {
+	case sendErr == nil:
+		rec.Status = store.OutboxStatusSent
+		rec.LastError = ""
+	case manual:
+		rec.LastError = sendErr.Error()
+	case permanent || rec.Attempts >= rec.MaxAttempts:
+		rec.Status = store.OutboxStatusDead
+		rec.LastError = sendErr.Error()
+		atomic.AddUint64(&m.deadLetter, 1)
+		m.logf("notification %s to channel %s moved to dead letter after %d attempts: %v", rec.ID, rec.ChannelID, rec.Attempts, sendErr)
+	default:
+		rec.LastError = sendErr.Error()
+		rec.NextAttemptAt = now.Add(m.cfg.retryDelay(rec.Attempts))
+	}
+	if err := m.store.UpdateNotificationOutbox(ctx, *rec); err != nil {
+		m.logf("update notification outbox %s failed: %v", rec.ID, err)
+	}
+	if rec.Status == store.OutboxStatusSent {
+		sentAt := now
+		if err := m.store.InsertNotificationHistory(ctx, store.NotificationHistoryRecord{
+			ID:        randomID(),
+			AccountID: rec.AccountID,
+			ChannelID: rec.ChannelID,
+			EventType: rec.EventType,
+			Title:     rec.Title,
+			Content:   rec.Content,
+			Status:    historyStatusSent,
+			SentAt:    &sentAt,
+			CreatedAt: now,
+		}); err != nil {
+			m.logf("insert notification history failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// sendOutbox 按当前渠道配置发送；渠道被删除、停用或配置无效时返回 permanent=true，不再自动重试。
+func (m *Manager) sendOutbox(ctx context.Context, rec *store.NotificationOutboxRecord) (permanent bool, err error) {
+	chRec, err := m.store.GetNotificationChannel(ctx, rec.ChannelID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return true, errors.New("channel deleted")
+		}
+		return false, err
+	}
+	if !chRec.Enabled {
+		return true, errors.New("channel disabled")
+	}
+	ch, err := buildChannel(*chRec)
+	if err != nil {
+		return true, fmt.Errorf("build channel: %w", err)
+	}
+	return false, ch.Send(ctx, NotificationMessage{
+		AccountID:  rec.AccountID,
+		EventType:  rec.EventType,
+		Title:      rec.Title,
+		Content:    rec.Content,
+		Language:   rec.Language,
+		OccurredAt: rec.OccurredAt,
+	})
+}
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// setupOutboxTest 创建 SQLite 存储、指向 srv 的 webhook 渠道及 node.failed 订阅。
+func setupOutboxTest(t *testing.T, srv *httptest.Server) store.Store {
+	t.Helper()
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "notify.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ctx := context.Background()
+	cfg, _ := json.Marshal(map[string]string{"webhook_url": srv.URL})
+	if err := st.CreateNotificationChannel(ctx, store.NotificationChannelRecord{
+		ID: "chn-1", AccountID: "acc-1", ChannelType: ChannelWebhook, Name: "hook", Config: cfg, Enabled: true,
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	if err := st.UpsertNotificationSubscription(ctx, store.NotificationSubscriptionRecord{
+		ID: "sub-1", AccountID: "acc-1", ChannelID: "chn-1", EventType: EventNodeFailed, Enabled: true,
+	}); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return st
+}
+
+// flakyServer 前 failures 次请求返回 500，之后返回 200。
+func flakyServer(t *testing.T, failures int64) (*httptest.Server, *int64) {
+	t.Helper()
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) <= atomic.LoadInt64(&failures) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func waitOutbox(t *testing.T, st store.Store, status string) store.NotificationOutboxRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		items, _, err := st.QueryNotificationOutbox(context.Background(), store.NotificationOutboxQuery{Status: status})
+		if err != nil {
+			t.Fatalf("query outbox: %v", err)
+		}
+		if len(items) > 0 {
+			return items[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for outbox item with status %s", status)
+	return store.NotificationOutboxRecord{}
+}
+
+func TestOutboxRetriesUntilSent(t *testing.T) {
+	srv, calls := flakyServer(t, 2)
+	st := setupOutboxTest(t, srv)
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}),
+		WithRetryPolicy(5, 5*time.Millisecond, 20*time.Millisecond), WithRetryInterval(5*time.Millisecond))
+	defer m.Stop()
+
+	m.Publish(Event{AccountID: "acc-1", EventType: EventNodeFailed, Data: map[string]any{"node_name": "relay-1", "error": "timeout"}})
+	rec := waitOutbox(t, st, store.OutboxStatusSent)
+	if rec.Attempts != 3 || rec.LastError != "" || rec.Title != "节点故障告警" || !strings.Contains(rec.Content, "relay-1") {
+		t.Fatalf("unexpected outbox record: %+v", rec)
+	}
+	if got := atomic.LoadInt64(calls); got != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", got)
+	}
+}
+
+func TestOutboxDeadLetterAndResend(t *testing.T) {
+	var failures int64 = 1 << 30
+	var calls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) <= atomic.LoadInt64(&failures) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	st := setupOutboxTest(t, srv)
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}),
+		WithRetryPolicy(2, 5*time.Millisecond, 5*time.Millisecond), WithRetryInterval(5*time.Millisecond))
+	defer m.Stop()
+
+	m.Publish(Event{AccountID: "acc-1", EventType: EventNodeFailed, Title: "节点故障"})
+	dead := waitOutbox(t, st, store.OutboxStatusDead)
+	if dead.Attempts != 2 || dead.LastError != "webhook status 502" {
+		t.Fatalf("unexpected dead record: %+v", dead)
+	}
+	if m.DeadLetterCount() != 1 {
+		t.Fatalf("expected dead letter count 1, got %d", m.DeadLetterCount())
+	}
+
+	// 手动重发失败不改变死信状态
+	rec, err := m.Resend(context.Background(), dead.ID)
+	if err != nil || rec.Status != store.OutboxStatusDead || rec.Attempts != 3 {
+		t.Fatalf("failed resend should keep dead status: %+v err=%v", rec, err)
+	}
+
+	atomic.StoreInt64(&failures, 0)
+	rec, err = m.Resend(context.Background(), dead.ID)
+	if err != nil || rec.Status != store.OutboxStatusSent || rec.LastError != "" {
+		t.Fatalf("resend should succeed: %+v err=%v", rec, err)
+	}
+	if _, err := m.Resend(context.Background(), dead.ID); !errors.Is(err, ErrOutboxAlreadySent) {
+		t.Fatalf("expected ErrOutboxAlreadySent, got %v", err)
+	}
+	if _, err := m.Resend(context.Background(), "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// TestSendTimeoutStillEnqueuesRetry 渠道阻塞超过 SendTimeout 时仍写入发件箱，且不影响同一事件的其他订阅。
+func TestSendTimeoutStillEnqueuesRetry(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast, fastCalls := flakyServer(t, 0)
+	st := setupOutboxTest(t, slow)
+	ctx := context.Background()
+	cfg, _ := json.Marshal(map[string]string{"webhook_url": fast.URL})
+	if err := st.CreateNotificationChannel(ctx, store.NotificationChannelRecord{
+		ID: "chn-2", AccountID: "acc-1", ChannelType: ChannelWebhook, Name: "fast", Config: cfg, Enabled: true,
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	if err := st.UpsertNotificationSubscription(ctx, store.NotificationSubscriptionRecord{
+		ID: "sub-2", AccountID: "acc-1", ChannelID: "chn-2", EventType: EventNodeFailed, Enabled: true,
+	}); err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}), WithSendTimeout(50*time.Millisecond),
+		WithRetryPolicy(5, time.Hour, time.Hour), WithRetryInterval(time.Hour))
+	defer m.Stop()
+
+	m.Publish(Event{AccountID: "acc-1", EventType: EventNodeFailed, Data: map[string]any{"node_name": "relay-1"}})
+	rec := waitOutbox(t, st, store.OutboxStatusPending)
+	if rec.ChannelID != "chn-1" || rec.LastError == "" {
+		t.Fatalf("unexpected outbox record: %+v", rec)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(fastCalls) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt64(fastCalls) != 1 {
+		t.Fatalf("second subscription should still be delivered")
+	}
+}
+
+func TestOutboxChannelDisabledIsDeadImmediately(t *testing.T) {
+	srv, _ := flakyServer(t, 1)
+	st := setupOutboxTest(t, srv)
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}),
+		WithRetryPolicy(5, time.Hour, time.Hour), WithRetryInterval(time.Hour))
+	defer m.Stop()
+
+	m.Publish(Event{AccountID: "acc-1", EventType: EventNodeFailed})
+	rec := waitOutbox(t, st, store.OutboxStatusPending)
+	ch, _ := st.GetNotificationChannel(context.Background(), "chn-1")
+	ch.Enabled = false
+	if err := st.UpdateNotificationChannel(context.Background(), *ch); err != nil {
+		t.Fatalf("disable channel: %v", err)
+	}
+	m.deliverOutbox(&rec, false)
+	if rec.Status != store.OutboxStatusDead || rec.LastError != "channel disabled" {
+		t.Fatalf("disabled channel should dead-letter at once: %+v", rec)
+	}
+}
+
+func TestPublishCountsDroppedEvents(t *testing.T) {
+	m := &Manager{queue: make(chan Event, 1)}
+	m.Publish(Event{EventType: EventNodeFailed})
+	m.Publish(Event{EventType: EventNodeFailed})
+	m.Publish(Event{EventType: EventNodeFailed})
+	if got := m.DroppedCount(); got != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", got)
+	}
+	if depth, capacity := m.QueueDepth(); depth != 1 || capacity != 1 {
+		t.Fatalf("unexpected queue depth %d/%d", depth, capacity)
+	}
+}
+
+func TestRetryDelayBackoff(t *testing.T) {
+	cfg := ManagerConfig{RetryBaseDelay: time.Second, RetryMaxDelay: 5 * time.Second}
+	cases := map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 80: 5 * time.Second}
+	for attempts, want := range cases {
+		if got := cfg.retryDelay(attempts); got != want {
+			t.Fatalf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...interface{}) {}
+
+// TestOutboxClaimedElsewhereIsSkipped 记录已被其他实例认领时，重试与手动重发都不会重复发送。
+func TestOutboxClaimedElsewhereIsSkipped(t *testing.T) {
+	srv, calls := flakyServer(t, 0)
+	st := setupOutboxTest(t, srv)
+	ctx := context.Background()
+	now := time.Now()
+	if err := st.InsertNotificationOutbox(ctx, store.NotificationOutboxRecord{ID: "ob-1", AccountID: "acc-1", ChannelID: "chn-1",
+		EventType: EventNodeFailed, Title: "节点故障", Attempts: 1, MaxAttempts: 5, NextAttemptAt: now.Add(-time.Second)}); err != nil {
+		t.Fatalf("insert outbox: %v", err)
+	}
+	if ok, err := st.ClaimNotificationOutbox(ctx, "ob-1", store.OutboxStatusPending, now, now.Add(time.Hour)); err != nil || !ok {
+		t.Fatalf("claim: ok=%v err=%v", ok, err)
+	}
+
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}), WithRetryInterval(time.Hour))
+	defer m.Stop()
+	m.retryDue()
+	if _, err := m.Resend(ctx, "ob-1"); !errors.Is(err, ErrOutboxInProgress) {
+		t.Fatalf("expected ErrOutboxInProgress, got %v", err)
+	}
+	if n := atomic.LoadInt64(calls); n != 0 {
+		t.Fatalf("claimed item must not be sent again, got %d calls", n)
+	}
+	if rec, err := st.GetNotificationOutbox(ctx, "ob-1"); err != nil || rec.Status != store.OutboxStatusSending || rec.Attempts != 1 {
+		t.Fatalf("claimed item changed: %+v err=%v", rec, err)
+	}
+}
@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// 事件严重级别，由低到高。
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{SeverityInfo: 1, SeverityWarning: 2, SeverityCritical: 3}
+
+// ValidSeverity 判断严重级别是否合法。
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// DefaultSeverity 返回事件类型的默认严重级别，Event.Severity 为空时使用。
+func DefaultSeverity(eventType string) string {
+	switch eventType {
+	case EventNodeFailed, EventNodeHealthCheckError, EventSystemTunnelError, EventSystemError:
+		return SeverityCritical
+	case EventNodeSwitched, EventRequestFailed, EventRequestUpstreamErr, EventRequestProxyError,
+		EventAccountQuotaWarning, EventAccountAuthFailed:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// QuietHours 静默时段（北京时间，HH:MM），Start 晚于 End 表示跨午夜，如 23:00-07:00。
+type QuietHours struct {
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	AllowCritical bool   `json:"allow_critical,omitempty"` // 静默期间仍发送 critical 级别事件
+}
+
+// maxGroupWindow 聚合窗口上限，避免告警被长时间压住。
+const maxGroupWindow = time.Hour
+
+// GroupRule 告警聚合：首个事件到达后开始计时，窗口内的同类事件合并为一条汇总消息。
+type GroupRule struct {
+	WindowSec int  `json:"window_sec"`
+	Resolved  bool `json:"resolved,omitempty"` // 故障对象全部恢复后发送"已恢复"消息
+}
+
+// Window 返回聚合窗口时长。
+func (g *GroupRule) Window() time.Duration {
+	if g == nil || g.WindowSec <= 0 {
+		return 0
+	}
+	return time.Duration(g.WindowSec) * time.Second
+}
+
+// SubscriptionRules 订阅级规则：过滤条件、静默时段、告警聚合与消息模板。零值表示不过滤、逐条发送、使用渠道或内置模板。
+type SubscriptionRules struct {
+	NodeIDs     []string    `json:"node_ids,omitempty"`     // 仅对携带 node_id 的事件生效
+	MinSeverity string      `json:"min_severity,omitempty"` // 低于该级别的事件不发送
+	QuietHours  *QuietHours `json:"quiet_hours,omitempty"`
+	Group       *GroupRule  `json:"group,omitempty"`
+	MessageTemplate
+}
+
+// ParseSubscriptionRules 解析并校验订阅规则；空值返回零值规则。
+func ParseSubscriptionRules(raw json.RawMessage) (SubscriptionRules, error) {
+	var r SubscriptionRules
+	if len(raw) == 0 || string(raw) == "null" {
+		return r, nil
+	}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return r, fmt.Errorf("parse subscription rules: %w", err)
+	}
+	if r.MinSeverity != "" && !ValidSeverity(r.MinSeverity) {
+		return r, fmt.Errorf("min_severity must be one of %s, %s, %s", SeverityInfo, SeverityWarning, SeverityCritical)
+	}
+	for i, id := range r.NodeIDs {
+		r.NodeIDs[i] = strings.TrimSpace(id)
+		if r.NodeIDs[i] == "" {
+			return r, errors.New("node_ids must not contain empty values")
+		}
+	}
+	if q := r.QuietHours; q != nil {
+		if _, err := parseClock(q.Start); err != nil {
+			return r, fmt.Errorf("quiet_hours.start: %w", err)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return r, fmt.Errorf("quiet_hours.end: %w", err)
+		}
+		if q.Start == q.End {
+			return r, errors.New("quiet_hours start and end must differ")
+		}
+	}
+	if g := r.Group; g != nil && (g.WindowSec <= 0 || g.Window() > maxGroupWindow) {
+		return r, fmt.Errorf("group.window_sec must be between 1 and %d", int(maxGroupWindow/time.Second))
+	}
+	return r, r.MessageTemplate.validate()
+}
+
+// Match 判断事件是否应发送给该订阅；不发送时返回原因，便于记录日志。
+func (r SubscriptionRules) Match(evt Event, now time.Time) (bool, string) {
+	sev := evt.severity()
+	if r.MinSeverity != "" && severityRank[sev] < severityRank[r.MinSeverity] {
+		return false, "below min_severity"
+	}
+	if len(r.NodeIDs) > 0 {
+		if nodeID, ok := evt.Data["node_id"].(string); ok && nodeID != "" && !containsString(r.NodeIDs, nodeID) {
+			return false, "node not selected"
+		}
+	}
+	if q := r.QuietHours; q != nil && q.active(now) {
+		if !(q.AllowCritical && sev == SeverityCritical) {
+			return false, "quiet hours"
+		}
+	}
+	return true, ""
+}
+
+// active 判断 now（按北京时间）是否落在静默时段内，区间为 [Start, End)。
+func (q QuietHours) active(now time.Time) bool {
+	start, err1 := parseClock(q.Start)
+	end, err2 := parseClock(q.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	bj := timeutil.ToBeijingTime(now)
+	cur := bj.Hour()*60 + bj.Minute()
+	if start < end {
+		return cur >= start && cur < end
+	}
+	return cur >= start || cur < end
+}
+
+// parseClock 解析 HH:MM，返回当天的分钟数。
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// Slack Block Kit 限制：header 文本最多 150 字符，section 文本最多 3000 字符。
+const (
+	slackHeaderMax  = 150
+	slackSectionMax = 3000
+)
+
+type slackConfig struct {
+	WebhookURL string `json:"webhook_url"`
+	Channel    string `json:"channel,omitempty"`  // 覆盖 webhook 默认频道（仅旧版 webhook 生效）
+	Username   string `json:"username,omitempty"` // 覆盖显示名（仅旧版 webhook 生效）
+}
+
+type slackChannel struct {
+	cfg    slackConfig
+	client *http.Client
+	name   string
+}
+
+func newSlackChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+	var cfg slackConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse slack config: %w", err)
+		}
+	}
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("slack webhook_url required")
+	}
+	if err := validateHTTPURL(cfg.WebhookURL); err != nil {
+		return nil, err
+	}
+	return &slackChannel{
+		cfg:    cfg,
+		name:   rec.Name,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// buildSlackPayload 构造 Block Kit 消息：标题、正文、事件类型与时间。
+func buildSlackPayload(msg NotificationMessage, cfg slackConfig) map[string]any {
+	title := msg.Title
+	if title == "" {
+		title = msg.EventType
+	}
+	l := labelsFor(msg.Language)
+	content := msg.Content
+	if content == "" {
+		content = "_" + l.NoContent + "_"
+	}
+	payload := map[string]any{
+		"text": title,
+		"blocks": []any{
+			map[string]any{
+				"type": "header",
+				"text": map[string]any{"type": "plain_text", "text": truncateRunes(title, slackHeaderMax), "emoji": true},
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": truncateRunes(content, slackSectionMax)},
+			},
+			map[string]any{
+				"type": "context",
+				"elements": []any{
+					map[string]any{"type": "mrkdwn", "text": fmt.Sprintf("%s：`%s` | %s：%s", l.EventType, msg.EventType, l.Time, formatTime(msg.OccurredAt, msg.Language))},
+				},
+			},
+		},
+	}
+	if cfg.Channel != "" {
+		payload["channel"] = cfg.Channel
+	}
+	if cfg.Username != "" {
+		payload["username"] = cfg.Username
+	}
+	return payload
+}
+
+func (s *slackChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	data, err := json.Marshal(buildSlackPayload(msg, s.cfg))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Slack 以纯文本返回错误原因，例如 invalid_blocks、channel_not_found
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("slack webhook status %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+	}
+	return nil
+}
+
+// truncateRunes 按字符截断，超出时以省略号结尾。
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
@@ -2,6 +2,7 @@ package notify
 
 import (
 	"context"
+	"time"
 
 	"qcc_plus/internal/store"
 )
@@ -10,14 +11,20 @@ import (
 type Store interface {
 	ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]store.SubscriptionWithChannel, error)
 	InsertNotificationHistory(ctx context.Context, rec store.NotificationHistoryRecord) error
+	GetNotificationChannel(ctx context.Context, id string) (*store.NotificationChannelRecord, error)
+	InsertNotificationOutbox(ctx context.Context, rec store.NotificationOutboxRecord) error
+	UpdateNotificationOutbox(ctx context.Context, rec store.NotificationOutboxRecord) error
+	ClaimNotificationOutbox(ctx context.Context, id, status string, now, lockUntil time.Time) (bool, error)
+	GetNotificationOutbox(ctx context.Context, id string) (*store.NotificationOutboxRecord, error)
+	ListDueNotificationOutbox(ctx context.Context, now time.Time, limit int) ([]store.NotificationOutboxRecord, error)
 }
 
-// StoreAdapter 将 *store.Store 适配为通知模块使用的接口。
+// StoreAdapter 将 store.Store 适配为通知模块使用的接口。
 type StoreAdapter struct {
-	core *store.Store
+	core store.Store
 }
 
-func NewStoreAdapter(core *store.Store) *StoreAdapter {
+func NewStoreAdapter(core store.Store) *StoreAdapter {
 	return &StoreAdapter{core: core}
 }
 
@@ -28,3 +35,27 @@ func (s *StoreAdapter) ListEnabledSubscriptionsForEvent(ctx context.Context, acc
 func (s *StoreAdapter) InsertNotificationHistory(ctx context.Context, rec store.NotificationHistoryRecord) error {
 	return s.core.InsertNotificationHistory(ctx, rec)
 }
+
+func (s *StoreAdapter) GetNotificationChannel(ctx context.Context, id string) (*store.NotificationChannelRecord, error) {
+	return s.core.GetNotificationChannel(ctx, id)
+}
+
+func (s *StoreAdapter) InsertNotificationOutbox(ctx context.Context, rec store.NotificationOutboxRecord) error {
+	return s.core.InsertNotificationOutbox(ctx, rec)
+}
+
+func (s *StoreAdapter) UpdateNotificationOutbox(ctx context.Context, rec store.NotificationOutboxRecord) error {
+	return s.core.UpdateNotificationOutbox(ctx, rec)
+}
+
+func (s *StoreAdapter) ClaimNotificationOutbox(ctx context.Context, id, status string, now, lockUntil time.Time) (bool, error) {
+	return s.core.ClaimNotificationOutbox(ctx, id, status, now, lockUntil)
+}
+
+func (s *StoreAdapter) GetNotificationOutbox(ctx context.Context, id string) (*store.NotificationOutboxRecord, error) {
+	return s.core.GetNotificationOutbox(ctx, id)
+}
+
+func (s *StoreAdapter) ListDueNotificationOutbox(ctx context.Context, now time.Time, limit int) ([]store.NotificationOutboxRecord, error) {
+	return s.core.ListDueNotificationOutbox(ctx, now, limit)
+}
@@ -0,0 +1,396 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// 通知语言。
+const (
+	LangZH = "zh"
+	LangEN = "en"
+)
+
+// MessageTemplate 自定义消息模板与语言，可配置在渠道 config 或订阅 rules 中，订阅优先于渠道。
+// 模板使用 Go text/template 语法，上下文为 MessageContext。
+type MessageTemplate struct {
+	Language        string `json:"language,omitempty"`
+	TitleTemplate   string `json:"title_template,omitempty"`
+	ContentTemplate string `json:"content_template,omitempty"`
+}
+
+// MessageContext 模板渲染上下文，例如 {{.Data.node_name}}、{{time .OccurredAt}}。
+type MessageContext struct {
+	AccountID  string
+	EventType  string
+	Severity   string
+	Language   string
+	OccurredAt time.Time
+	Data       map[string]any
+}
+
+// ParseMessageTemplate 从渠道配置中解析模板字段并校验语法；未配置时返回零值。
+func ParseMessageTemplate(raw json.RawMessage) (MessageTemplate, error) {
+	var t MessageTemplate
+	if len(raw) == 0 {
+		return t, nil
+	}
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return t, fmt.Errorf("parse message template: %w", err)
+	}
+	return t, t.validate()
+}
+
+func (t MessageTemplate) validate() error {
+	switch t.Language {
+	case "", LangZH, LangEN:
+	default:
+		return fmt.Errorf("language must be %s or %s", LangZH, LangEN)
+	}
+	if t.TitleTemplate != "" {
+		if _, err := newTemplate("title").Parse(t.TitleTemplate); err != nil {
+			return fmt.Errorf("title_template invalid: %w", err)
+		}
+	}
+	if t.ContentTemplate != "" {
+		if _, err := newTemplate("content").Parse(t.ContentTemplate); err != nil {
+			return fmt.Errorf("content_template invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(templateFuncs)
+}
+
+var templateFuncs = template.FuncMap{
+	// time 按上下文语言格式化北京时间：{{time .OccurredAt}}
+	"time": func(t time.Time, lang ...string) string {
+		l := LangZH
+		if len(lang) > 0 {
+			l = lang[0]
+		}
+		return formatTime(t, l)
+	},
+	// str 将任意值转为字符串，缺失字段返回空串，便于 eq 比较：{{if eq (str .Data.source) "health_check"}}
+	"str": func(v any) string {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	},
+	// default 在值为空时返回兜底值：{{default "-" .Data.from_node}}
+	"default": func(fallback string, v any) any {
+		if v == nil || v == "" {
+			return fallback
+		}
+		return v
+	},
+	"upper": strings.ToUpper,
+	// join 拼接字符串列表：{{join .Data.unhealthy_nodes ", "}}
+	"join": strings.Join,
+}
+
+// formatTime 中文使用 FormatBeijingTime，英文使用 ISO 风格并附带时区偏移。
+func formatTime(t time.Time, lang string) string {
+	if lang == LangEN {
+		if t.IsZero() {
+			return "--"
+		}
+		return timeutil.ToBeijingTime(t).Format("2006-01-02 15:04:05 -07:00")
+	}
+	return timeutil.FormatBeijingTime(t)
+}
+
+// messageLabels 渠道包装消息时使用的固定文案。
+type messageLabels struct {
+	EventType string
+	Time      string
+	NoContent string
+}
+
+func labelsFor(lang string) messageLabels {
+	if lang == LangEN {
+		return messageLabels{EventType: "Event", Time: "Time", NoContent: "No details"}
+	}
+	return messageLabels{EventType: "事件类型", Time: "时间", NoContent: "无详细内容"}
+}
+
+type builtinTemplate struct {
+	title   *template.Template
+	content *template.Template
+}
+
+// builtinTemplates 内置模板：事件类型 -> 语言 -> 模板；字段含义见 docs/notification-system.md。
+var builtinTemplates = map[string]map[string]builtinTemplate{
+	EventNodeFailed: {
+		LangZH: mustBuiltin(`{{if eq (str .Data.source) "health_check"}}节点健康检查失败{{else}}节点故障告警{{end}}`,
+			`**节点名称**: {{.Data.node_name}}
+**错误信息**: {{.Data.error}}
+{{- if .Data.fail_streak}}
+**失败次数**: {{.Data.fail_streak}}{{end}}
+**{{if eq (str .Data.source) "health_check"}}检测{{end}}时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`{{if eq (str .Data.source) "health_check"}}Node health check failed{{else}}Node failure{{end}}`,
+			`**Node**: {{.Data.node_name}}
+**Error**: {{.Data.error}}
+{{- if .Data.fail_streak}}
+**Failures**: {{.Data.fail_streak}}{{end}}
+**Time**: {{time .OccurredAt "en"}}`),
+	},
+	EventNodeRecovered: {
+		LangZH: mustBuiltin(`节点已恢复`, `**节点名称**: {{.Data.node_name}}
+**恢复时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`Node recovered`, `**Node**: {{.Data.node_name}}
+**Recovered at**: {{time .OccurredAt "en"}}`),
+	},
+	EventNodeSwitched: {
+		LangZH: mustBuiltin(`节点自动切换`, `**从节点**: {{default "-" .Data.from_node}}
+**到节点**: {{.Data.to_node}} (权重: {{.Data.weight}})
+**切换原因**: {{.Data.reason}}`),
+		LangEN: mustBuiltin(`Active node switched`, `**From**: {{default "-" .Data.from_node}}
+**To**: {{.Data.to_node}} (weight: {{.Data.weight}})
+**Reason**: {{.Data.reason}}`),
+	},
+	EventNodeAdded: {
+		LangZH: mustBuiltin(`节点新增`, `**节点名称**: {{.Data.node_name}}
+**地址**: {{.Data.url}}
+**权重**: {{.Data.weight}}
+**时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`Node added`, `**Node**: {{.Data.node_name}}
+**URL**: {{.Data.url}}
+**Weight**: {{.Data.weight}}
+**Time**: {{time .OccurredAt "en"}}`),
+	},
+	EventNodeUpdated: {
+		LangZH: mustBuiltin(`节点已更新`, `**节点名称**: {{.Data.node_name}}
+**地址**: {{.Data.url}}
+**权重**: {{.Data.weight}}`),
+		LangEN: mustBuiltin(`Node updated`, `**Node**: {{.Data.node_name}}
+**URL**: {{.Data.url}}
+**Weight**: {{.Data.weight}}`),
+	},
+	EventNodeDeleted: {
+		LangZH: mustBuiltin(`节点已删除`, `**节点名称**: {{.Data.node_name}}
+**地址**: {{.Data.url}}`),
+		LangEN: mustBuiltin(`Node deleted`, `**Node**: {{.Data.node_name}}
+**URL**: {{.Data.url}}`),
+	},
+	EventNodeEnabled: {
+		LangZH: mustBuiltin(`节点已启用`, `**节点名称**: {{.Data.node_name}}
+**权重**: {{.Data.weight}}`),
+		LangEN: mustBuiltin(`Node enabled`, `**Node**: {{.Data.node_name}}
+**Weight**: {{.Data.weight}}`),
+	},
+	EventNodeDisabled: {
+		LangZH: mustBuiltin(`节点已禁用`, `**节点名称**: {{.Data.node_name}}
+**操作**: 手动禁用`),
+		LangEN: mustBuiltin(`Node disabled`, `**Node**: {{.Data.node_name}}
+**Action**: disabled manually`),
+	},
+	EventRequestFailed: {
+		LangZH: mustBuiltin(`请求失败告警`, `**请求**: {{.Data.method}} {{.Data.url}}
+**节点**: {{default "-" .Data.node_name}}
+**重试次数**: {{.Data.attempts}}
+**错误信息**: {{.Data.error}}`),
+		LangEN: mustBuiltin(`Request failed`, `**Request**: {{.Data.method}} {{.Data.url}}
+**Node**: {{default "-" .Data.node_name}}
+**Attempts**: {{.Data.attempts}}
+**Error**: {{.Data.error}}`),
+	},
+	EventRequestProxyError: {
+		LangZH: mustBuiltin(`代理错误告警`, `**请求**: {{.Data.method}} {{.Data.url}}
+**节点**: {{default "-" .Data.node_name}}
+**错误信息**: {{.Data.error}}`),
+		LangEN: mustBuiltin(`Proxy error`, `**Request**: {{.Data.method}} {{.Data.url}}
+**Node**: {{default "-" .Data.node_name}}
+**Error**: {{.Data.error}}`),
+	},
+	EventAccountQuotaWarning: {
+		LangZH: mustBuiltin(`账号配额告警`, `**账号**: {{.Data.account_name}}
+**周期**: {{if eq (str .Data.period) "month"}}本月{{else}}今日{{end}}（{{.Data.period_key}}）
+**已用**: {{.Data.used}} / {{.Data.limit}} tokens
+**阈值**: {{.Data.threshold}}%
+**时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`Account quota warning`, `**Account**: {{.Data.account_name}}
+**Period**: {{if eq (str .Data.period) "month"}}this month{{else}}today{{end}} ({{.Data.period_key}})
+**Used**: {{.Data.used}} / {{.Data.limit}} tokens
+**Threshold**: {{.Data.threshold}}%
+**Time**: {{time .OccurredAt "en"}}`),
+	},
+	EventAccountAuthFailed: {
+		LangZH: mustBuiltin(`登录失败次数过多`, `**账号名称**: {{.Data.username}}
+**来源 IP**: {{.Data.ip}}
+**锁定对象**: {{if eq (str .Data.lock_target) "account"}}账号{{else}}IP{{end}}
+**连续失败**: {{.Data.failures}} 次
+**锁定时长**: {{.Data.lockout}}
+**时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`Too many failed logins`, `**Username**: {{.Data.username}}
+**Source IP**: {{.Data.ip}}
+**Locked**: {{if eq (str .Data.lock_target) "account"}}account{{else}}IP{{end}}
+**Consecutive failures**: {{.Data.failures}}
+**Lockout**: {{.Data.lockout}}
+**Time**: {{time .OccurredAt "en"}}`),
+	},
+	EventAccountDigestHourly: digestTemplates,
+	EventAccountDigestDaily:  digestTemplates,
+	EventSystemTunnelStarted: {
+		LangZH: mustBuiltin(`隧道已启动`, `**子域名**: {{.Data.subdomain}}
+**公网地址**: {{.Data.public_url}}`),
+		LangEN: mustBuiltin(`Tunnel started`, `**Subdomain**: {{.Data.subdomain}}
+**Public URL**: {{.Data.public_url}}`),
+	},
+	EventSystemTunnelStopped: {
+		LangZH: mustBuiltin(`隧道已停止`, `**状态**: {{default "正常停止" .Data.error}}`),
+		LangEN: mustBuiltin(`Tunnel stopped`, `**Status**: {{default "stopped normally" .Data.error}}`),
+	},
+	EventSystemTunnelError: {
+		LangZH: mustBuiltin(`隧道启动失败`, `**错误**: {{.Data.error}}`),
+		LangEN: mustBuiltin(`Tunnel failed to start`, `**Error**: {{.Data.error}}`),
+	},
+	EventSecurityAudit: {
+		LangZH: mustBuiltin(`管理操作审计`, `**操作**: {{.Data.action}}
+**对象**: {{.Data.target_type}} {{.Data.target_id}}
+**操作人**: {{.Data.actor}}{{if .Data.actor_user_id}}（成员 {{.Data.actor_user_id}}）{{end}}
+**变更字段**: {{default "-" .Data.changed_fields}}
+**来源 IP**: {{.Data.ip}}
+**时间**: {{time .OccurredAt}}`),
+		LangEN: mustBuiltin(`Admin audit`, `**Action**: {{.Data.action}}
+**Target**: {{.Data.target_type}} {{.Data.target_id}}
+**Actor**: {{.Data.actor}}{{if .Data.actor_user_id}} (member {{.Data.actor_user_id}}){{end}}
+**Changed fields**: {{default "-" .Data.changed_fields}}
+**Source IP**: {{.Data.ip}}
+**Time**: {{time .OccurredAt "en"}}`),
+	},
+}
+
+// digestTemplates 周期摘要，字段由 proxy 根据监控数据汇总生成。
+var digestTemplates = map[string]builtinTemplate{
+	LangZH: mustBuiltin(`{{if eq (str .Data.period) "day"}}每日{{else}}每小时{{end}}运行摘要`, `**统计区间**: {{time .Data.from}} ~ {{time .Data.to}}
+**请求数**: {{.Data.requests}}（成功 {{.Data.success}} / 失败 {{.Data.failed}}）
+**成功率**: {{printf "%.2f" .Data.success_rate}}%
+**平均耗时**: {{.Data.avg_latency_ms}} ms
+**Token**: 输入 {{.Data.input_tokens}} / 输出 {{.Data.output_tokens}}
+**节点健康**: {{.Data.nodes_healthy}}/{{.Data.nodes_total}}{{with .Data.unhealthy_nodes}}（异常：{{join . "、"}}）{{end}}
+{{- range .Data.nodes}}
+- {{.name}}: {{.requests}} 次请求，失败 {{.failed}}，平均 {{.avg_latency_ms}} ms
+{{- end}}`),
+	LangEN: mustBuiltin(`{{if eq (str .Data.period) "day"}}Daily{{else}}Hourly{{end}} digest`, `**Period**: {{time .Data.from "en"}} ~ {{time .Data.to "en"}}
+**Requests**: {{.Data.requests}} ({{.Data.success}} ok / {{.Data.failed}} failed)
+**Success rate**: {{printf "%.2f" .Data.success_rate}}%
+**Avg latency**: {{.Data.avg_latency_ms}} ms
+**Tokens**: {{.Data.input_tokens}} in / {{.Data.output_tokens}} out
+**Healthy nodes**: {{.Data.nodes_healthy}}/{{.Data.nodes_total}}{{with .Data.unhealthy_nodes}} (unhealthy: {{join . ", "}}){{end}}
+{{- range .Data.nodes}}
+- {{.name}}: {{.requests}} requests, {{.failed}} failed, avg {{.avg_latency_ms}} ms
+{{- end}}`),
+}
+
+func mustBuiltin(title, content string) builtinTemplate {
+	return builtinTemplate{
+		title:   template.Must(newTemplate("title").Parse(title)),
+		content: template.Must(newTemplate("content").Parse(content)),
+	}
+}
+
+// RenderMessage 渲染事件的标题与正文。模板优先级：custom 中靠前者 > 内置模板 > 事件自带 Title/Content；
+// 语言取 custom 中第一个非空 Language，默认中文。自定义模板执行失败时回退到内置模板并返回错误供记录。
+func RenderMessage(evt Event, custom ...MessageTemplate) (title, content, lang string, err error) {
+	lang = LangZH
+	for _, c := range custom {
+		if c.Language != "" {
+			lang = c.Language
+			break
+		}
+	}
+	var titleTpl, contentTpl string
+	for _, c := range custom {
+		if titleTpl == "" {
+			titleTpl = c.TitleTemplate
+		}
+		if contentTpl == "" {
+			contentTpl = c.ContentTemplate
+		}
+	}
+	ctx := MessageContext{
+		AccountID:  evt.AccountID,
+		EventType:  evt.EventType,
+		Severity:   evt.severity(),
+		Language:   lang,
+		OccurredAt: evt.OccurredAt,
+		Data:       evt.Data,
+	}
+	if ctx.Data == nil {
+		ctx.Data = map[string]any{}
+	}
+	builtin, hasBuiltin := builtinTemplates[evt.EventType][lang]
+
+	var errs []error
+	title, err = renderOne("title", titleTpl, ctx)
+	if err != nil || titleTpl == "" {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		title = evt.Title
+		if hasBuiltin {
+			title, _ = execTemplate(builtin.title, ctx)
+		}
+	}
+	content, err = renderOne("content", contentTpl, ctx)
+	if err != nil || contentTpl == "" {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		content = evt.Content
+		if hasBuiltin {
+			content, _ = execTemplate(builtin.content, ctx)
+		} else if content == "" {
+			content = formatDataFields(ctx.Data)
+		}
+	}
+	if title == "" {
+		title = evt.EventType
+	}
+	return title, content, lang, errors.Join(errs...)
+}
+
+func renderOne(name, text string, ctx MessageContext) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tpl, err := newTemplate(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return execTemplate(tpl, ctx)
+}
+
+func execTemplate(tpl *template.Template, ctx MessageContext) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// formatDataFields 无内置模板且事件未带正文时，按字段名排序输出结构化数据。
+func formatDataFields(data map[string]any) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("**%s**: %v", k, data[k]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+var failedEvent = Event{
+	AccountID:  "acc-1",
+	EventType:  EventNodeFailed,
+	Data:       map[string]any{"node_id": "n1", "node_name": "relay-1", "error": "timeout", "fail_streak": 3, "source": "request"},
+	OccurredAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestRenderBuiltinTemplates(t *testing.T) {
+	title, content, lang, err := RenderMessage(failedEvent)
+	if err != nil || lang != LangZH || title != "节点故障告警" {
+		t.Fatalf("unexpected zh render: %q %q %v", title, lang, err)
+	}
+	want := "**节点名称**: relay-1\n**错误信息**: timeout\n**失败次数**: 3\n**时间**: 2025年01月02日 11时04分05秒"
+	if content != want {
+		t.Fatalf("zh content mismatch:\n%s\nwant:\n%s", content, want)
+	}
+
+	hc := failedEvent
+	hc.Data = map[string]any{"node_name": "relay-1", "error": "dial tcp", "source": "health_check"}
+	title, content, _, _ = RenderMessage(hc)
+	if title != "节点健康检查失败" || strings.Contains(content, "失败次数") || !strings.Contains(content, "**检测时间**") {
+		t.Fatalf("unexpected health check render: %q %q", title, content)
+	}
+
+	title, content, lang, err = RenderMessage(failedEvent, MessageTemplate{}, MessageTemplate{Language: LangEN})
+	if err != nil || lang != LangEN || title != "Node failure" || !strings.Contains(content, "**Time**: 2025-01-02 11:04:05 +08:00") {
+		t.Fatalf("unexpected en render: %q %q %q %v", title, content, lang, err)
+	}
+}
+
+func TestRenderCustomTemplatePriority(t *testing.T) {
+	sub := MessageTemplate{TitleTemplate: `[{{upper .Severity}}] {{.Data.node_name}}`}
+	channel := MessageTemplate{Language: LangEN, TitleTemplate: "ignored", ContentTemplate: `{{.Data.node_name}} failed: {{.Data.error}}`}
+	title, content, lang, err := RenderMessage(failedEvent, sub, channel)
+	if err != nil || title != "[CRITICAL] relay-1" || content != "relay-1 failed: timeout" || lang != LangEN {
+		t.Fatalf("unexpected custom render: %q %q %q %v", title, content, lang, err)
+	}
+
+	// 执行失败回退内置模板并返回错误
+	broken := MessageTemplate{ContentTemplate: `{{index .Data.node_name 50}}`}
+	_, content, _, err = RenderMessage(failedEvent, broken)
+	if err == nil || !strings.HasPrefix(content, "**节点名称**: relay-1") {
+		t.Fatalf("expected builtin fallback with error, got %q %v", content, err)
+	}
+
+	// 无内置模板的事件使用 Title 与结构化字段
+	title, content, _, _ = RenderMessage(Event{EventType: "custom.event", Title: "自定义", Data: map[string]any{"b": 2, "a": 1}})
+	if title != "自定义" || content != "**a**: 1\n**b**: 2" {
+		t.Fatalf("unexpected generic render: %q %q", title, content)
+	}
+}
+
+func TestParseMessageTemplateValidation(t *testing.T) {
+	if _, err := ParseMessageTemplate(json.RawMessage(`{"webhook_url":"x","language":"fr"}`)); err == nil {
+		t.Fatal("expected invalid language error")
+	}
+	if _, err := ParseMessageTemplate(json.RawMessage(`{"content_template":"{{.Data.x"}`)); err == nil {
+		t.Fatal("expected template syntax error")
+	}
+	tpl, err := ParseMessageTemplate(json.RawMessage(`{"webhook_url":"x","language":"en"}`))
+	if err != nil || tpl.Language != LangEN {
+		t.Fatalf("unexpected template: %+v %v", tpl, err)
+	}
+}
+
+func TestSubscriptionRulesMatch(t *testing.T) {
+	rules, err := ParseSubscriptionRules(json.RawMessage(`{"node_ids":["n2"],"min_severity":"warning"}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	noon := time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC) // 北京时间 12:00
+	if ok, reason := rules.Match(failedEvent, noon); ok || reason != "node not selected" {
+		t.Fatalf("node filter should reject n1: %v %s", ok, reason)
+	}
+	added := Event{EventType: EventNodeAdded, Data: map[string]any{"node_id": "n2"}}
+	if ok, reason := rules.Match(added, noon); ok || reason != "below min_severity" {
+		t.Fatalf("info event should be below warning: %v %s", ok, reason)
+	}
+	quota := Event{EventType: EventAccountQuotaWarning}
+	if ok, _ := rules.Match(quota, noon); !ok {
+		t.Fatal("events without node_id should pass node filter")
+	}
+
+	quiet, err := ParseSubscriptionRules(json.RawMessage(`{"quiet_hours":{"start":"23:00","end":"07:00","allow_critical":true}}`))
+	if err != nil {
+		t.Fatalf("parse quiet: %v", err)
+	}
+	night := time.Date(2025, 1, 2, 17, 30, 0, 0, time.UTC) // 北京时间 01:30
+	if ok, reason := quiet.Match(quota, night); ok || reason != "quiet hours" {
+		t.Fatalf("warning should be silenced at night: %v %s", ok, reason)
+	}
+	if ok, _ := quiet.Match(failedEvent, night); !ok {
+		t.Fatal("critical should pass when allow_critical")
+	}
+	if ok, _ := quiet.Match(quota, noon); !ok {
+		t.Fatal("quiet hours should not apply at noon")
+	}
+
+	for _, raw := range []string{
+		`{"min_severity":"fatal"}`,
+		`{"node_ids":[" "]}`,
+		`{"quiet_hours":{"start":"25:00","end":"07:00"}}`,
+		`{"quiet_hours":{"start":"07:00","end":"07:00"}}`,
+		`{"title_template":"{{"}`,
+	} {
+		if _, err := ParseSubscriptionRules(json.RawMessage(raw)); err == nil {
+			t.Fatalf("expected error for %s", raw)
+		}
+	}
+}
+
+func TestManagerAppliesRulesAndTemplates(t *testing.T) {
+	var hits int64
+	srv, last := captureServer(t, func(w http.ResponseWriter) {
+		atomic.AddInt64(&hits, 1)
+		w.WriteHeader(http.StatusOK)
+	})
+	st := setupOutboxTest(t, srv)
+	ctx := context.Background()
+	if err := st.UpsertNotificationSubscription(ctx, store.NotificationSubscriptionRecord{
+		ID: "sub-1", AccountID: "acc-1", ChannelID: "chn-1", EventType: EventNodeFailed, Enabled: true,
+		Rules: json.RawMessage(`{"node_ids":["n2"],"language":"en","title_template":"{{.Data.node_name}} down"}`),
+	}); err != nil {
+		t.Fatalf("update subscription: %v", err)
+	}
+	m := NewManager(NewStoreAdapter(st), WithLogger(discardLogger{}))
+
+	m.Publish(failedEvent) // n1 被过滤
+	second := failedEvent
+	second.Data = map[string]any{"node_id": "n2", "node_name": "relay-2", "error": "502"}
+	m.Publish(second)
+	m.Stop()
+
+	if got := atomic.LoadInt64(&hits); got != 1 {
+		t.Fatalf("expected 1 delivery, got %d", got)
+	}
+	_, body := last()
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Title != "relay-2 down" || !strings.Contains(payload.Content, "**Error**: 502") {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+}
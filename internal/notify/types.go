@@ -24,12 +24,17 @@ const (
 	// 账号相关
 	EventAccountQuotaWarning = "account.quota_warning"
 	EventAccountAuthFailed   = "account.auth_failed"
+	EventAccountDigestHourly = "account.digest_hourly" // 每小时运行摘要
+	EventAccountDigestDaily  = "account.digest_daily"  // 每日运行摘要
 
 	// 系统相关
 	EventSystemTunnelStarted = "system.tunnel_started"
 	EventSystemTunnelStopped = "system.tunnel_stopped"
 	EventSystemTunnelError   = "system.tunnel_error"
 	EventSystemError         = "system.error"
+
+	// 安全相关
+	EventSecurityAudit = "security.audit" // 管理操作审计，见 audit_events
 )
 
 // 渠道类型。
@@ -39,18 +44,29 @@ const (
 	ChannelEmail          = "email"
 	ChannelDingTalk       = "dingtalk"
 	ChannelSlack          = "slack"
+	ChannelWebhook        = "webhook"
 )
 
 // Event 表示一条需要发送的通知事件。
+// 消息正文由模板根据 Data 渲染（见 RenderMessage），Title/Content 仅在事件类型没有内置模板时使用。
 type Event struct {
 	AccountID  string
 	EventType  string
+	Severity   string         // 为空时取 DefaultSeverity(EventType)
+	Data       map[string]any // 结构化负载，如 node_id、node_name、error，供模板与订阅过滤使用
 	Title      string
 	Content    string
 	DedupKey   string
 	OccurredAt time.Time
 }
 
+func (e Event) severity() string {
+	if e.Severity != "" {
+		return e.Severity
+	}
+	return DefaultSeverity(e.EventType)
+}
+
 // ManagerConfig 控制通知管理器的运行参数。
 type ManagerConfig struct {
 	QueueSize   int
@@ -58,6 +74,13 @@ type ManagerConfig struct {
 	DedupWindow time.Duration
 	Logger      Logger
 	SendTimeout time.Duration
+
+	// 发送失败后写入发件箱，按 RetryBaseDelay*2^(n-1) 退避重试，最多 RetryMaxDelay；
+	// 累计尝试 MaxAttempts 次（含首次发送）仍失败则标记为死信。
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	RetryInterval  time.Duration // 发件箱轮询间隔
 }
 
 // Logger 抽象日志接口，兼容标准 log.Logger。
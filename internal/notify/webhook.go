@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// 通用 webhook 签名头：X-QCC-Signature = "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))。
+const (
+	webhookSignatureHeader = "X-QCC-Signature"
+	webhookTimestampHeader = "X-QCC-Timestamp"
+)
+
+type webhookConfig struct {
+	WebhookURL string            `json:"webhook_url"`
+	Method     string            `json:"method,omitempty"`  // 默认 POST
+	Headers    map[string]string `json:"headers,omitempty"` // 自定义请求头，如鉴权 token
+	Secret     string            `json:"secret,omitempty"`  // 非空时对请求体签名
+}
+
+type webhookChannel struct {
+	cfg    webhookConfig
+	client *http.Client
+	name   string
+	now    func() time.Time
+}
+
+// webhookPayload 通用 webhook 推送的 JSON 结构。
+type webhookPayload struct {
+	AccountID  string `json:"account_id"`
+	EventType  string `json:"event_type"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	OccurredAt string `json:"occurred_at"`
+	Channel    string `json:"channel"`
+}
+
+func newWebhookChannel(rec store.NotificationChannelRecord) (NotificationChannel, error) {
+	var cfg webhookConfig
+	if len(rec.Config) > 0 {
+		if err := json.Unmarshal(rec.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("parse webhook config: %w", err)
+		}
+	}
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("webhook_url required")
+	}
+	if err := validateHTTPURL(cfg.WebhookURL); err != nil {
+		return nil, err
+	}
+	cfg.Method = strings.ToUpper(strings.TrimSpace(cfg.Method))
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodPost
+	case http.MethodPost, http.MethodPut:
+	default:
+		return nil, fmt.Errorf("webhook method must be POST or PUT")
+	}
+	for k := range cfg.Headers {
+		if strings.TrimSpace(k) == "" || strings.ContainsAny(k, " :\r\n") {
+			return nil, fmt.Errorf("invalid webhook header name %q", k)
+		}
+	}
+	return &webhookChannel{
+		cfg:    cfg,
+		name:   rec.Name,
+		client: &http.Client{Timeout: 5 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+// SignWebhookBody 计算通用 webhook 签名，供接收方校验使用。
+func SignWebhookBody(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *webhookChannel) Send(ctx context.Context, msg NotificationMessage) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	occurred := msg.OccurredAt
+	if occurred.IsZero() {
+		occurred = h.now()
+	}
+	data, err := json.Marshal(webhookPayload{
+		AccountID:  msg.AccountID,
+		EventType:  msg.EventType,
+		Title:      msg.Title,
+		Content:    msg.Content,
+		OccurredAt: occurred.UTC().Format(time.RFC3339),
+		Channel:    h.name,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, h.cfg.Method, h.cfg.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.cfg.Secret != "" {
+		ts := strconv.FormatInt(h.now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, ts)
+		req.Header.Set(webhookSignatureHeader, SignWebhookBody(h.cfg.Secret, ts, data))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validateHTTPURL 校验 webhook 地址为 http/https 绝对地址。
+func validateHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("webhook_url invalid")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("webhook_url must use http or https")
+	}
+	return nil
+}
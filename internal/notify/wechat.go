@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"qcc_plus/internal/store"
-	"qcc_plus/internal/timeutil"
 )
 
 type wechatConfig struct {
@@ -83,13 +82,14 @@ func (w *wechatChannel) Send(ctx context.Context, msg NotificationMessage) error
 }
 
 func formatWechatMarkdown(msg NotificationMessage) string {
+	l := labelsFor(msg.Language)
 	content := msg.Content
 	if content == "" {
-		content = "_无详细内容_"
+		content = "_" + l.NoContent + "_"
 	}
 	title := msg.Title
 	if title == "" {
 		title = msg.EventType
 	}
-	return fmt.Sprintf("**%s**\n> 事件类型：%s\n> 时间：%s\n\n%s", title, msg.EventType, timeutil.FormatBeijingTime(msg.OccurredAt), content)
+	return fmt.Sprintf("**%s**\n> %s：%s\n> %s：%s\n\n%s", title, l.EventType, msg.EventType, l.Time, formatTime(msg.OccurredAt, msg.Language), content)
 }
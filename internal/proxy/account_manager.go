@@ -14,6 +14,7 @@ import (
 type accountContextKey struct{}
 type isAdminContextKey struct{}
 type nodeContextKey struct{}
+type sessionContextKey struct{}
 
 func (p *Server) createAccount(name, proxyKey, password string, isAdmin bool) (*Account, error) {
 	name = strings.TrimSpace(name)
@@ -28,6 +29,13 @@ func (p *Server) createAccount(name, proxyKey, password string, isAdmin bool) (*
 	if existing := p.getAccountByProxyKey(proxyKey); existing != nil {
 		return nil, fmt.Errorf("proxy_api_key already exists")
 	}
+	if password != "" {
+		hashed, err := hashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		password = hashed
+	}
 	cfg := p.getConfig()
 	id := fmt.Sprintf("acc-%d", time.Now().UnixNano())
 	acc := &Account{
@@ -62,6 +70,28 @@ func (p *Server) createAccount(name, proxyKey, password string, isAdmin bool) (*
 	return acc, nil
 }
 
+// setAccountPassword 以 bcrypt 哈希更新账号密码并持久化。
+func (p *Server) setAccountPassword(acc *Account, password string) error {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	acc.Password = hashed
+	rec := store.AccountRecord{
+		ID:          acc.ID,
+		Name:        acc.Name,
+		Password:    acc.Password,
+		ProxyAPIKey: acc.ProxyAPIKey,
+		IsAdmin:     acc.IsAdmin,
+	}
+	p.mu.Unlock()
+	if p.store == nil {
+		return nil
+	}
+	return p.store.UpdateAccount(context.Background(), rec)
+}
+
 func accountFromCtx(r *http.Request) *Account {
 	if r == nil {
 		return nil
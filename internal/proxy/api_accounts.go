@@ -12,7 +12,7 @@ import (
 func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		if !isAdmin(r.Context()) {
+		if !hasPermission(r.Context(), PermSystem) {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 			return
 		}
@@ -30,14 +30,22 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
 			return
 		}
+		if p.memberUsernameTaken(r.Context(), req.Name) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name already used by an account member"})
+			return
+		}
 		acc, err := p.createAccount(req.Name, req.ProxyAPIKey, req.Password, req.IsAdmin)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		p.audit(r, auditEntry{Action: "account.create", TargetType: "account", TargetID: acc.ID, AccountID: acc.ID, After: p.accountAuditState(acc)})
 		writeJSON(w, http.StatusCreated, map[string]string{"id": acc.ID})
 	case http.MethodGet:
-		writeJSON(w, http.StatusOK, map[string]interface{}{"accounts": p.listAccounts(r.Context())})
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"accounts":      p.listAccounts(r.Context()),
+			"lb_strategies": supportedLBStrategies(),
+		})
 	case http.MethodPut:
 		id := r.URL.Query().Get("id")
 		if !canManageAccount(r.Context(), id) {
@@ -45,10 +53,13 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		var req struct {
-			Name        string `json:"name"`
-			ProxyAPIKey string `json:"proxy_api_key"`
-			Password    string `json:"password"`
-			IsAdmin     *bool  `json:"is_admin"`
+			Name        string  `json:"name"`
+			ProxyAPIKey string  `json:"proxy_api_key"`
+			Password    string  `json:"password"`
+			IsAdmin     *bool   `json:"is_admin"`
+			LBStrategy  *string `json:"lb_strategy"`
+			// ClientCertSubject mTLS 客户端证书主题，空字符串取消映射；仅管理员可设置。
+			ClientCertSubject *string `json:"client_cert_subject"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
@@ -58,6 +69,43 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
 			return
 		}
+		var hashedPassword string
+		if req.Password != "" {
+			hashed, err := hashPassword(req.Password)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			hashedPassword = hashed
+		}
+		var strategy LoadBalanceStrategy
+		if req.LBStrategy != nil {
+			parsed, err := parseLBStrategy(*req.LBStrategy)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			strategy = parsed
+		}
+		if req.ClientCertSubject != nil && !hasPermission(r.Context(), PermSystem) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "only admin can set client_cert_subject"})
+			return
+		}
+		// 所有校验在修改任何字段之前完成，避免请求被拒绝时账号只更新了一半。
+		var certSubject string
+		if req.ClientCertSubject != nil {
+			normalized, err := p.checkClientCertSubject(id, *req.ClientCertSubject)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			certSubject = normalized
+		}
+		if req.Name != "" && p.memberUsernameTaken(r.Context(), req.Name) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name already used by an account member"})
+			return
+		}
+		before := p.accountAuditState(p.getAccountByID(id))
 		p.mu.Lock()
 		acc := p.accountByID[id]
 		if acc == nil {
@@ -65,28 +113,34 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 			return
 		}
-		if req.Name != "" {
-			acc.Name = req.Name
-		}
 		if req.ProxyAPIKey != "" && req.ProxyAPIKey != acc.ProxyAPIKey {
 			if exist := p.accounts[req.ProxyAPIKey]; exist != nil && exist.ID != acc.ID {
 				p.mu.Unlock()
 				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "proxy_api_key already exists"})
 				return
 			}
+		}
+		if req.ClientCertSubject != nil {
+			if err := p.clientCertSubjectConflictLocked(acc.ID, certSubject); err != nil {
+				p.mu.Unlock()
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if req.Name != "" {
+			acc.Name = req.Name
+		}
+		if req.ProxyAPIKey != "" && req.ProxyAPIKey != acc.ProxyAPIKey {
 			delete(p.accounts, acc.ProxyAPIKey)
 			acc.ProxyAPIKey = req.ProxyAPIKey
 			p.accounts[acc.ProxyAPIKey] = acc
 		}
-		if req.Password != "" {
-			acc.Password = req.Password
+		if hashedPassword != "" {
+			acc.Password = hashedPassword
 		}
-		if req.IsAdmin != nil {
-			if !isAdmin(r.Context()) && !*req.IsAdmin {
-				// 非管理员不能修改 is_admin 以外的权限
-			} else {
-				acc.IsAdmin = *req.IsAdmin
-			}
+		// is_admin 属于平台级权限，只有平台管理员可以修改。
+		if req.IsAdmin != nil && hasPermission(r.Context(), PermSystem) {
+			acc.IsAdmin = *req.IsAdmin
 		}
 		p.mu.Unlock()
 		if p.store != nil {
@@ -98,9 +152,22 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 				IsAdmin:     acc.IsAdmin,
 			})
 		}
+		if req.LBStrategy != nil {
+			if err := p.setAccountLBStrategy(acc, strategy); err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if req.ClientCertSubject != nil {
+			if err := p.setAccountClientCertSubject(acc, certSubject); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		p.audit(r, auditEntry{Action: "account.update", TargetType: "account", TargetID: acc.ID, AccountID: acc.ID, Before: before, After: p.accountAuditState(acc)})
 		writeJSON(w, http.StatusOK, map[string]string{"id": acc.ID})
 	case http.MethodDelete:
-		if !isAdmin(r.Context()) {
+		if !hasPermission(r.Context(), PermSystem) {
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
@@ -113,6 +180,7 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "cannot delete default account"})
 			return
 		}
+		before := p.accountAuditState(p.getAccountByID(id))
 		p.mu.Lock()
 		acc := p.accountByID[id]
 		if acc == nil {
@@ -126,10 +194,16 @@ func (p *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 		}
 		delete(p.accounts, acc.ProxyAPIKey)
 		delete(p.accountByID, id)
+		p.forgetAPIKeys(id)
 		p.mu.Unlock()
 		if p.store != nil {
 			_ = p.store.DeleteAccount(context.Background(), id)
 		}
+		p.quotas.forget(id)
+		if err := p.sessionMgr.RevokeAccount(context.Background(), id); err != nil {
+			p.logger.Printf("revoke sessions of account %s failed: %v", id, err)
+		}
+		p.audit(r, auditEntry{Action: "account.delete", TargetType: "account", TargetID: id, AccountID: id, Before: before})
 		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -149,9 +223,65 @@ func (p *Server) listAccounts(ctx context.Context) []map[string]interface{} {
 		out = append(out, map[string]interface{}{
 			"id":            acc.ID,
 			"name":          acc.Name,
-			"proxy_api_key": acc.ProxyAPIKey,
+			"proxy_api_key": maskSecret(ctx, acc.ProxyAPIKey),
 			"is_admin":      acc.IsAdmin,
+			// lb_strategy 为生效策略，lb_strategy_override 为账号级覆盖（空表示跟随系统配置）。
+			"lb_strategy":          p.lbStrategyFor(acc),
+			"lb_strategy_override": acc.LBStrategy,
+			"client_cert_subject":  acc.ClientCertSubject,
 		})
 	}
 	return out
 }
+
+// /admin/api/accounts/quota?id=xxx
+// GET 返回账号配额与当前用量；PUT 设置配额（仅管理员），全部为 0 表示不限制。
+func (p *Server) handleAccountQuota(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !canManageAccount(r.Context(), id) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	acc := p.getAccountByID(id)
+	if acc == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		p.mu.RLock()
+		limits := acc.Quota
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":              acc.ID,
+			"quota":           limits,
+			"warn_thresholds": p.quotaWarnThresholds(limits),
+			"usage":           p.quotas.snapshot(acc.ID),
+		})
+	case http.MethodPut:
+		if !hasPermission(r.Context(), PermSystem) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		var req QuotaLimits
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.mu.RLock()
+		before := acc.Quota
+		p.mu.RUnlock()
+		if err := p.setAccountQuota(acc, req); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "account.quota", TargetType: "account", TargetID: acc.ID, AccountID: acc.ID, Before: before, After: req})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": acc.ID, "quota": req})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -2,7 +2,10 @@ package proxy
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,10 +35,12 @@ func (p *Server) handleActivate(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	before := p.nodeAuditState(req.ID)
 	if err := p.activate(req.ID); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	p.audit(r, auditEntry{Action: "node.activate", TargetType: "node", TargetID: req.ID, AccountID: node.AccountID, Before: before, After: p.nodeAuditState(req.ID)})
 	writeJSON(w, http.StatusOK, map[string]string{"active": req.ID})
 }
 
@@ -65,10 +70,12 @@ func (p *Server) handleDisable(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	before := p.nodeAuditState(req.ID)
 	if err := p.disableNode(req.ID); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	p.audit(r, auditEntry{Action: "node.disable", TargetType: "node", TargetID: req.ID, AccountID: node.AccountID, Before: before, After: p.nodeAuditState(req.ID)})
 	writeJSON(w, http.StatusOK, map[string]string{"disabled": req.ID})
 }
 
@@ -98,10 +105,12 @@ func (p *Server) handleEnable(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	before := p.nodeAuditState(req.ID)
 	if err := p.enableNode(req.ID); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	p.audit(r, auditEntry{Action: "node.enable", TargetType: "node", TargetID: req.ID, AccountID: node.AccountID, Before: before, After: p.nodeAuditState(req.ID)})
 	writeJSON(w, http.StatusOK, map[string]string{"enabled": req.ID})
 }
 
@@ -119,35 +128,76 @@ func (p *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := p.clientIP(r)
+	if d := p.loginGuard.lockedFor("ip:"+ip, "user:"+username); d > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("登录失败次数过多，请 %d 分钟后重试", int(math.Ceil(d.Minutes())))})
+		return
+	}
+
 	p.mu.RLock()
-	var account *Account
+	var (
+		account *Account
+		stored  string
+	)
 	for _, acc := range p.accountByID {
 		if acc.Name == username {
 			account = acc
+			stored = acc.Password
 			break
 		}
 	}
 	p.mu.RUnlock()
 
-	if account == nil || account.Password != password {
+	// 账号名优先；未匹配账号时按账号成员登录。
+	if account == nil {
+		p.loginMember(w, r, username, password, ip)
+		return
+	}
+	ok, needsUpgrade := checkPassword(stored, password)
+	if !ok {
+		p.recordLoginFailure(ip, username, account)
 		writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称或密码错误"})
 		return
 	}
+	// 仅清除用户名计数：IP 计数保留到窗口过期，避免用一个已知账号重置对其他账号的爆破计数。
+	p.loginGuard.reset("user:" + username)
+	if needsUpgrade {
+		if err := p.setAccountPassword(account, password); err != nil {
+			p.logger.Printf("upgrade password hash for account %s failed: %v", account.ID, err)
+		}
+	}
 
-	sess := p.sessionMgr.Create(account.ID, account.IsAdmin)
-	if sess == nil {
+	sess, err := p.sessionMgr.CreateWithMeta(account.ID, account.IsAdmin, r.UserAgent(), ip)
+	if err != nil {
+		p.logger.Printf("create session for account %s failed: %v", account.ID, err)
 		http.Error(w, "session creation failed", http.StatusInternalServerError)
 		return
 	}
+	setSessionCookie(w, sess, p.tlsEnabled())
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sess.Token,
-		Path:     "/",
-		MaxAge:   86400,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
+}
+
+// loginMember 账号成员登录，会话携带成员 ID 与角色。
+func (p *Server) loginMember(w http.ResponseWriter, r *http.Request, username, password, ip string) {
+	user, account := p.authenticateMember(r.Context(), username, password)
+	if user == nil {
+		p.recordLoginFailure(ip, username, account)
+		writeJSON(w, http.StatusOK, map[string]string{"error": "账号名称或密码错误"})
+		return
+	}
+	p.loginGuard.reset("user:" + username)
+	sess, err := p.sessionMgr.CreateForUser(account.ID, user.ID, Role(user.Role), r.UserAgent(), ip)
+	if err != nil {
+		p.logger.Printf("create session for member %s failed: %v", user.ID, err)
+		http.Error(w, "session creation failed", http.StatusInternalServerError)
+		return
+	}
+	if err := p.store.TouchUserLogin(r.Context(), user.ID, time.Now()); err != nil {
+		p.logger.Printf("record login of member %s failed: %v", user.ID, err)
+	}
+	setSessionCookie(w, sess, p.tlsEnabled())
 
 	http.Redirect(w, r, "/admin/dashboard", http.StatusFound)
 }
@@ -163,6 +213,7 @@ func (p *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 			Value:    "",
 			Path:     "/",
 			HttpOnly: true,
+			Secure:   p.tlsEnabled(),
 			Expires:  time.Unix(0, 0),
 		})
 	}
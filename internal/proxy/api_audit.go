@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+func auditEventView(rec store.AuditEventRecord) map[string]interface{} {
+	var changes map[string]auditChange
+	if rec.Changes != "" {
+		_ = json.Unmarshal([]byte(rec.Changes), &changes)
+	}
+	if changes == nil {
+		changes = map[string]auditChange{}
+	}
+	return map[string]interface{}{
+		"id":               rec.ID,
+		"created_at":       timeutil.FormatBeijingTime(rec.CreatedAt),
+		"account_id":       rec.AccountID,
+		"actor_account_id": rec.ActorAccountID,
+		"actor_user_id":    rec.ActorUserID,
+		"actor_session_id": rec.ActorSessionID,
+		"actor_role":       rec.ActorRole,
+		"action":           rec.Action,
+		"target_type":      rec.TargetType,
+		"target_id":        rec.TargetID,
+		"changes":          changes,
+		"ip":               rec.IP,
+		"user_agent":       rec.UserAgent,
+	}
+}
+
+// GET /admin/api/audit
+// 查询参数：
+// - account_id: 管理员可省略以查询全部账号，普通账号只能查询自己
+// - actor: 操作人账号 ID
+// - action / target_type / target_id: 精确过滤
+// - from / to: RFC3339
+// - limit: 默认 50，最大 500
+// - offset: 默认 0
+func (p *Server) handleAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	accountID := strings.TrimSpace(q.Get("account_id"))
+	if accountID == "" && !isAdmin(ctx) {
+		caller := accountFromCtx(r)
+		if caller == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		accountID = caller.ID
+	}
+	if accountID != "" && !canManageAccount(ctx, accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	from, err := parseTime(q.Get("from"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from time"})
+		return
+	}
+	to, err := parseTime(q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to time"})
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+
+	records, total, err := p.store.QueryAuditEvents(ctx, store.AuditQuery{
+		AccountID:      accountID,
+		ActorAccountID: strings.TrimSpace(q.Get("actor")),
+		Action:         strings.TrimSpace(q.Get("action")),
+		TargetType:     strings.TrimSpace(q.Get("target_type")),
+		TargetID:       strings.TrimSpace(q.Get("target_id")),
+		From:           from,
+		To:             to,
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		out = append(out, auditEventView(rec))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": out,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
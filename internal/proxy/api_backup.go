@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qcc_plus/internal/backup"
+	"qcc_plus/internal/timeutil"
+)
+
+// backupPassphraseHeader 备份加密口令通过请求头传递，避免出现在 URL 与访问日志中。
+const backupPassphraseHeader = "X-Backup-Passphrase"
+
+// maxBackupImportBytes 导入请求体上限。
+const maxBackupImportBytes = 32 << 20
+
+// handleBackupExport 处理 GET /admin/api/backup（仅管理员），下载整个实例的配置备份。
+// 查询参数 format=json|yaml（默认 json）；请求头 X-Backup-Passphrase 非空时加密备份。
+func (p *Server) handleBackupExport(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), PermSystem) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "store not enabled"})
+		return
+	}
+	encoding, err := backup.ParseEncoding(r.URL.Query().Get("format"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	bundle, err := backup.Export(r.Context(), p.store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	data, err := backup.Encode(bundle, encoding, r.Header.Get(backupPassphraseHeader))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	contentType := "application/json"
+	if encoding == backup.EncodingYAML {
+		contentType = "application/yaml"
+	}
+	filename := fmt.Sprintf("qcc_plus-backup-%s.%s", timeutil.NowBeijing().Format("20060102-150405"), encoding)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// handleBackupImport 处理 POST /admin/api/backup/import（仅管理员），请求体为 JSON 或 YAML 备份包。
+// 查询参数 mode=merge|replace（默认 merge）、dry_run=true 只返回变更计划；加密备份需提供 X-Backup-Passphrase。
+func (p *Server) handleBackupImport(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r.Context(), PermSystem) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "store not enabled"})
+		return
+	}
+	mode, err := backup.ParseMode(strings.TrimSpace(r.URL.Query().Get("mode")))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid dry_run"})
+			return
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBackupImportBytes+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "read body failed"})
+		return
+	}
+	if len(data) > maxBackupImportBytes {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "bundle too large"})
+		return
+	}
+	bundle, err := backup.Decode(data, r.Header.Get(backupPassphraseHeader))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, backup.ErrPassphraseRequired) {
+			status = http.StatusUnauthorized
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	plan, err := backup.Import(r.Context(), p.store, bundle, mode, dryRun)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if !dryRun {
+		p.audit(r, auditEntry{Action: "backup.import", TargetType: "backup", TargetID: string(mode),
+			After: map[string]any{"mode": mode, "changes": len(plan.Changes), "summary": plan.Summary}})
+		if err := p.reloadAccountsFromStore(); err != nil {
+			p.logger.Printf("reload accounts after backup import failed: %v", err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "imported, but reload failed: " + err.Error()})
+			return
+		}
+		p.logger.Printf("backup imported (mode=%s, changes=%d)", mode, len(plan.Changes))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"dry_run": dryRun, "plan": plan})
+}
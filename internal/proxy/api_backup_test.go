@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"qcc_plus/internal/store"
+)
+
+func TestBackupImportReloadsAndExports(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	srv.settingsCache = NewSettingsCache(st)
+
+	acc := srv.defaultAccount
+	admin := func(r *http.Request) *http.Request {
+		ctx := context.WithValue(context.WithValue(r.Context(), accountContextKey{}, acc), isAdminContextKey{}, true)
+		return r.WithContext(ctx)
+	}
+	bundle := `{"format":"qcc_plus-backup","version":1,
+		"accounts":[{"id":"default","name":"default","proxy_api_key":"test-proxy"},{"id":"team","name":"team","proxy_api_key":"pk-team","active_node_id":"imp1","retries":2,"fail_limit":2,"health_every_ms":60000}],
+		"nodes":[{"id":"imp1","account_id":"team","name":"imported","base_url":"https://imported.example.com","api_key":"sk-imp","health_check_method":"head","weight":1,"price_multiplier":2}]}`
+
+	req := admin(httptest.NewRequest(http.MethodPost, "/admin/api/backup/import?mode=merge&dry_run=true", strings.NewReader(bundle)))
+	rec := httptest.NewRecorder()
+	srv.handleBackupImport(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"action":"create"`) {
+		t.Fatalf("dry run status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if srv.getNode("imp1") != nil {
+		t.Fatal("dry run must not import")
+	}
+
+	req = admin(httptest.NewRequest(http.MethodPost, "/admin/api/backup/import?mode=merge", strings.NewReader(bundle)))
+	rec = httptest.NewRecorder()
+	srv.handleBackupImport(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	node := srv.getNode("imp1")
+	if node == nil || node.priceMultiplier() != 2 || srv.getAccountByProxyKey("pk-team") == nil {
+		t.Fatalf("imported config not loaded: node=%+v", node)
+	}
+	if team := srv.getAccountByID("team"); team == nil || team.ActiveID != "imp1" || team.Config.Retries != 2 {
+		t.Fatalf("account config not loaded: %+v", team)
+	}
+
+	req = admin(httptest.NewRequest(http.MethodGet, "/admin/api/backup?format=yaml", nil))
+	req.Header.Set(backupPassphraseHeader, "pw")
+	rec = httptest.NewRecorder()
+	srv.handleBackupExport(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "encrypted: true") || strings.Contains(rec.Body.String(), "sk-imp") {
+		t.Fatalf("encrypted export status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	req = admin(httptest.NewRequest(http.MethodGet, "/admin/api/backup", nil))
+	rec = httptest.NewRecorder()
+	srv.handleBackupExport(rec, req)
+	var exported struct {
+		Nodes []struct {
+			ID     string `json:"id"`
+			APIKey string `json:"api_key"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &exported); err != nil || len(exported.Nodes) != 1 || exported.Nodes[0].APIKey != "sk-imp" {
+		t.Fatalf("plain export: %v %s", err, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/api/backup", nil)
+	req = req.WithContext(context.WithValue(req.Context(), accountContextKey{}, acc))
+	rec = httptest.NewRecorder()
+	srv.handleBackupExport(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin export should be forbidden, got %d", rec.Code)
+	}
+}
+
+func TestBackupImportReloadKeepsRuntimeState(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+
+	acc := srv.defaultAccount
+	importBundle := func(weight string) {
+		t.Helper()
+		bundle := `{"format":"qcc_plus-backup","version":1,
+			"accounts":[{"id":"default","name":"default","proxy_api_key":"test-proxy"},{"id":"team","name":"team","proxy_api_key":"pk-team","active_node_id":"n1"}],
+			"nodes":[{"id":"n1","account_id":"team","name":"n1","base_url":"https://n1.example.com","weight":1},
+				{"id":"n2","account_id":"team","name":"n2","base_url":"https://n2.example.com","weight":` + weight + `}]}`
+		req := httptest.NewRequest(http.MethodPost, "/admin/api/backup/import?mode=merge", strings.NewReader(bundle))
+		req = req.WithContext(context.WithValue(context.WithValue(req.Context(), accountContextKey{}, acc), isAdminContextKey{}, true))
+		rec := httptest.NewRecorder()
+		srv.handleBackupImport(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import status=%d body=%s", rec.Code, rec.Body.String())
+		}
+	}
+	importBundle("1")
+
+	// 模拟运行时切换到 n2 并产生在途请求与指标。
+	n2 := srv.getNode("n2")
+	n2.InFlight = 3
+	n2.Metrics.Requests = 7
+	srv.getAccountByID("team").ActiveID = "n2"
+	cb := srv.getOrCreateCircuitBreaker("n2")
+
+	importBundle("5")
+	after := srv.getNode("n2")
+	if after != n2 || after.InFlight != 3 || after.Metrics.Requests != 7 || after.Weight != 5 {
+		t.Fatalf("runtime state not carried over: same=%v node=%+v", after == n2, after)
+	}
+	if team := srv.getAccountByID("team"); team == nil || team.ActiveID != "n2" || team.Nodes["n2"] != n2 {
+		t.Fatalf("active node reset: %+v", team)
+	}
+	if srv.getOrCreateCircuitBreaker("n2") != cb {
+		t.Fatal("circuit breaker replaced")
+	}
+}
@@ -51,10 +51,12 @@ func (p *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		healthEvery := time.Duration(req.HealthIntervalSec) * time.Second
+		before := p.configAuditState(acc)
 		if err := p.updateConfigForAccount(acc, req.Retries, req.FailLimit, healthEvery); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		p.audit(r, auditEntry{Action: "config.update", TargetType: "account", TargetID: acc.ID, AccountID: acc.ID, Before: before, After: p.configAuditState(acc)})
 		writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
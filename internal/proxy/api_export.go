@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// exportPageSize 导出时每次从数据库读取的行数，整个导出过程只在内存中保留一页。
+var exportPageSize = 1000
+
+// metricsExportColumns 监控数据导出列，顺序即 CSV 表头顺序。
+var metricsExportColumns = []string{
+	"timestamp", "account_id", "node_id", "api_key_id",
+	"requests_total", "requests_success", "requests_failed", "retry_attempts_total", "retry_success",
+	"response_time_sum_ms", "response_time_count", "bytes_total", "input_tokens", "output_tokens",
+	"first_byte_time_sum_ms", "stream_duration_sum_ms",
+	"p50_response_time_ms", "p95_response_time_ms", "p99_response_time_ms",
+	"p50_first_byte_ms", "p95_first_byte_ms", "p99_first_byte_ms",
+}
+
+// healthExportColumns 健康检查历史导出列。
+var healthExportColumns = []string{
+	"id", "check_time", "account_id", "node_id", "success", "response_time_ms",
+	"error_message", "check_method", "check_source",
+}
+
+// exportWriter 按 csv 或 ndjson 逐行写出记录，每页结束后刷新到客户端。
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  string
+	columns []string
+	csv     *csv.Writer
+}
+
+// parseExportFormat 解析 format 参数，默认 csv。
+func parseExportFormat(v string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "csv":
+		return "csv", nil
+	case "ndjson", "jsonl":
+		return "ndjson", nil
+	default:
+		return "", fmt.Errorf("format must be csv|ndjson")
+	}
+}
+
+// newExportWriter 写出响应头（以及 CSV 表头），之后只能通过 writeRow 追加数据。
+func newExportWriter(w http.ResponseWriter, format, filename string, columns []string) (*exportWriter, error) {
+	ew := &exportWriter{w: w, format: format, columns: columns}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		filename += ".csv"
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		filename += ".ndjson"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if format == "csv" {
+		ew.csv = csv.NewWriter(w)
+		if err := ew.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	}
+	return ew, nil
+}
+
+// writeRow 写出一行，values 与 columns 一一对应。
+func (ew *exportWriter) writeRow(values []interface{}) error {
+	if ew.csv != nil {
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = exportCSVValue(v)
+		}
+		return ew.csv.Write(fields)
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(ew.columns[i])
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(ew.w, b.String())
+	return err
+}
+
+// flush 把已写出的行推送给客户端。
+func (ew *exportWriter) flush() error {
+	if ew.csv != nil {
+		ew.csv.Flush()
+		if err := ew.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := ew.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// fail 在响应已开始后报告错误：NDJSON 追加一行 {"error": ...}，CSV 只能中断输出。
+func (ew *exportWriter) fail(err error) {
+	if ew.csv == nil {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		ew.w.Write(append(b, '\n'))
+	}
+	ew.flush()
+}
+
+func exportCSVValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// resolveExportScope 校验导出的账号与节点范围：非管理员只能导出自己的账号，节点必须属于该账号。
+func (p *Server) resolveExportScope(w http.ResponseWriter, r *http.Request) (accountID, nodeID string, ok bool) {
+	caller := accountFromCtx(r)
+	if caller == nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return "", "", false
+	}
+	accountID = strings.TrimSpace(r.URL.Query().Get("account_id"))
+	if accountID == "" {
+		accountID = caller.ID
+	}
+	if !isAdmin(r.Context()) && accountID != caller.ID {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return "", "", false
+	}
+	nodeID = strings.TrimSpace(r.URL.Query().Get("node_id"))
+	if nodeID != "" {
+		node := p.getNode(nodeID)
+		if node == nil || node.AccountID != accountID {
+			respondJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+			return "", "", false
+		}
+	}
+	return accountID, nodeID, true
+}
+
+// handleExportMetrics 处理 GET /api/export/metrics，流式导出监控数据。
+// 查询参数：
+// - granularity: raw|hour|day|month（默认 raw）
+// - from/to: RFC3339（默认窗口同 /api/nodes/:id/metrics）
+// - account_id: 仅管理员可指定其他账号
+// - node_id: 可选，只导出该节点
+// - format: csv|ndjson（默认 csv）
+func (p *Server) handleExportMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "metrics store not enabled"})
+		return
+	}
+	accountID, nodeID, ok := p.resolveExportScope(w, r)
+	if !ok {
+		return
+	}
+	format, err := parseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	gran, from, to, _, _, err := parseMetricsQueryParams(r)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	q := store.MetricsQuery{
+		AccountID:   accountID,
+		NodeID:      nodeID,
+		From:        from,
+		To:          to,
+		Granularity: gran,
+		Limit:       exportPageSize,
+	}
+	// 先取第一页再写响应头，查询错误仍可以正常的 JSON 错误返回。
+	records, err := p.store.QueryMetrics(r.Context(), q)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	ew, err := newExportWriter(w, format, fmt.Sprintf("metrics-%s-%s", gran, from.UTC().Format("20060102")), metricsExportColumns)
+	if err != nil {
+		return
+	}
+	for {
+		for _, rec := range records {
+			if err := ew.writeRow(metricsExportRow(rec)); err != nil {
+				return
+			}
+		}
+		if err := ew.flush(); err != nil || len(records) < exportPageSize {
+			return
+		}
+		cursor := records[len(records)-1].Cursor()
+		q.After = &cursor
+		if records, err = p.store.QueryMetrics(r.Context(), q); err != nil {
+			p.logger.Printf("export metrics for account %s failed: %v", accountID, err)
+			ew.fail(err)
+			return
+		}
+	}
+}
+
+func metricsExportRow(rec store.MetricsRecord) []interface{} {
+	return []interface{}{
+		rec.Timestamp.UTC().Format(time.RFC3339), rec.AccountID, rec.NodeID, rec.APIKeyID,
+		rec.RequestsTotal, rec.RequestsSuccess, rec.RequestsFailed, rec.RetryAttemptsTotal, rec.RetrySuccess,
+		rec.ResponseTimeSumMs, rec.ResponseTimeCount, rec.BytesTotal, rec.InputTokensTotal, rec.OutputTokensTotal,
+		rec.FirstByteTimeSumMs, rec.StreamDurationSumMs,
+		rec.ResponseTimeHist.Quantile(0.5), rec.ResponseTimeHist.Quantile(0.95), rec.ResponseTimeHist.Quantile(0.99),
+		rec.FirstByteHist.Quantile(0.5), rec.FirstByteHist.Quantile(0.95), rec.FirstByteHist.Quantile(0.99),
+	}
+}
+
+// handleExportHealthChecks 处理 GET /api/export/health-checks，流式导出健康检查历史。
+// 查询参数：
+// - from/to: RFC3339（默认最近 24 小时）
+// - account_id / node_id / format: 同 /api/export/metrics
+// - source: 可选，按检查来源过滤
+func (p *Server) handleExportHealthChecks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	accountID, nodeID, ok := p.resolveExportScope(w, r)
+	if !ok {
+		return
+	}
+	format, err := parseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	to, err := parseTime(r.URL.Query().Get("to"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to time"})
+		return
+	}
+	from, err := parseTime(r.URL.Query().Get("from"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from time"})
+		return
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if from.After(to) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+		return
+	}
+
+	params := store.QueryHealthCheckParams{
+		AccountID:   accountID,
+		NodeID:      nodeID,
+		From:        from,
+		To:          to,
+		Limit:       exportPageSize,
+		CheckSource: strings.TrimSpace(r.URL.Query().Get("source")),
+		Forward:     true,
+	}
+	records, err := p.store.QueryHealthChecks(r.Context(), params)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	ew, err := newExportWriter(w, format, "health-checks-"+from.UTC().Format("20060102"), healthExportColumns)
+	if err != nil {
+		return
+	}
+	for {
+		for _, rec := range records {
+			if err := ew.writeRow([]interface{}{
+				rec.ID, rec.CheckTime.UTC().Format(time.RFC3339), rec.AccountID, rec.NodeID, rec.Success, rec.ResponseTimeMs,
+				rec.ErrorMessage, rec.CheckMethod, rec.CheckSource,
+			}); err != nil {
+				return
+			}
+		}
+		if err := ew.flush(); err != nil || len(records) < exportPageSize {
+			return
+		}
+		params.AfterID = records[len(records)-1].ID
+		if records, err = p.store.QueryHealthChecks(r.Context(), params); err != nil {
+			p.logger.Printf("export health checks for account %s failed: %v", accountID, err)
+			ew.fail(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+func TestExportMetricsAndHealthChecksPaged(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+
+	old := exportPageSize
+	exportPageSize = 2
+	t.Cleanup(func() { exportPageSize = old })
+
+	acc := srv.defaultAccount
+	nodeID := acc.ActiveID
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	// 前三条时间戳相同，验证游标在同一时间点内不会重复或遗漏。
+	for i, off := range []int{0, 0, 0, 1, 2} {
+		rec := store.MetricsRecord{AccountID: acc.ID, NodeID: nodeID, Timestamp: base.Add(time.Duration(off) * time.Minute),
+			RequestsTotal: int64(i + 1), ResponseTimeCount: 1}
+		rec.ResponseTimeHist.Observe(100)
+		if err := st.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+		if err := st.InsertHealthCheck(ctx, &store.HealthCheckRecord{AccountID: acc.ID, NodeID: nodeID,
+			CheckTime: base.Add(time.Duration(i) * time.Minute), Success: i%2 == 0, CheckMethod: "api", CheckSource: "scheduled"}); err != nil {
+			t.Fatalf("insert health check: %v", err)
+		}
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), accountContextKey{}, acc))
+		rec := httptest.NewRecorder()
+		switch {
+		case strings.HasPrefix(path, "/api/export/metrics"):
+			srv.handleExportMetrics(rec, req)
+		default:
+			srv.handleExportHealthChecks(rec, req)
+		}
+		return rec
+	}
+
+	rec := get("/api/export/metrics?format=ndjson&node_id=" + nodeID)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status=%d type=%s body=%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	var seen []int64
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+			t.Fatalf("decode line %q: %v", sc.Text(), err)
+		}
+		seen = append(seen, int64(row["requests_total"].(float64)))
+		if row["p50_response_time_ms"].(float64) <= 0 {
+			t.Fatalf("percentile missing: %v", row)
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected 5 metrics rows across pages, got %v", seen)
+	}
+	for i, v := range seen {
+		if v != int64(i+1) {
+			t.Fatalf("rows out of order or duplicated: %v", seen)
+		}
+	}
+
+	rec = get("/api/export/health-checks?format=csv")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Disposition"), ".csv") {
+		t.Fatalf("status=%d headers=%v", rec.Code, rec.Header())
+	}
+	lines, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(lines) != 6 || lines[0][0] != "id" || lines[1][4] != "true" || lines[2][4] != "false" {
+		t.Fatalf("unexpected csv: %v", lines)
+	}
+
+	if rec := get("/api/export/metrics?account_id=other"); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin export of other account should be forbidden, got %d", rec.Code)
+	}
+	if rec := get("/api/export/metrics?format=xml"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown format should be rejected, got %d", rec.Code)
+	}
+	if rec := get("/api/export/metrics?granularity=hour"); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Fatalf("empty hourly export should only contain the header, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// 未登录或会话失效时返回 401 JSON，而不是重定向到登录页。
+	for _, cookie := range []string{"", "expired-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/export/metrics", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Fatalf("unauthenticated export (cookie %q) status=%d body=%s", cookie, rec.Code, rec.Body.String())
+		}
+	}
+}
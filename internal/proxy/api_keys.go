@@ -0,0 +1,404 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// apiKeyPrefix 新签发 API Key 的固定前缀，便于在日志与配置中识别。
+const apiKeyPrefix = "sk-qcc-"
+
+// APIKey 账号下的一把代理 API Key。明文只在创建时返回一次，内存与存储中仅保留 SHA-256 哈希。
+type APIKey struct {
+	ID            string
+	AccountID     string
+	Name          string
+	Hash          string
+	Prefix        string // 明文前若干位，仅用于展示
+	AllowedModels []string
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	Revoked       bool
+	Requests      int64
+	InputTokens   int64
+	OutputTokens  int64
+}
+
+// expired 判断 Key 在 now 时刻是否已过期。
+func (k *APIKey) expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// allowsModel 判断 Key 是否允许调用指定模型；未设置白名单时不限制。
+func (k *APIKey) allowsModel(model string) bool {
+	if len(k.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range k.AllowedModels {
+		if matchModelPattern(m, model) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey 生成新的明文 Key（sk-qcc- + 48 位十六进制）。
+func generateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+func apiKeyFromRecord(rec store.APIKeyRecord) *APIKey {
+	return &APIKey{
+		ID:            rec.ID,
+		AccountID:     rec.AccountID,
+		Name:          rec.Name,
+		Hash:          rec.KeyHash,
+		Prefix:        rec.KeyPrefix,
+		AllowedModels: rec.AllowedModels,
+		CreatedAt:     rec.CreatedAt,
+		ExpiresAt:     rec.ExpiresAt,
+		LastUsedAt:    rec.LastUsedAt,
+		Revoked:       rec.Revoked,
+		Requests:      rec.Requests,
+		InputTokens:   rec.InputTokens,
+		OutputTokens:  rec.OutputTokens,
+	}
+}
+
+// loadAPIKeysFromStore 启动时加载全部 API Key 到内存索引。
+func (p *Server) loadAPIKeysFromStore(ctx context.Context) error {
+	if p.store == nil {
+		return nil
+	}
+	recs, err := p.store.ListAPIKeys(ctx, "")
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rec := range recs {
+		p.apiKeys[rec.KeyHash] = apiKeyFromRecord(rec)
+	}
+	return nil
+}
+
+// errAPIKeyInvalid 表示 Key 已吊销或已过期。
+var errAPIKeyInvalid = errors.New("api key revoked or expired")
+
+// resolveProxyKey 根据请求携带的 Key 定位账号：先匹配账号主密钥，再匹配 API Key 哈希。
+// 未知 Key 返回 (nil, nil, nil)，由调用方决定是否回退默认账号；已吊销或过期的 Key 返回 errAPIKeyInvalid。
+func (p *Server) resolveProxyKey(raw string) (*Account, *APIKey, error) {
+	if raw == "" {
+		return nil, nil, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if acc := p.accounts[raw]; acc != nil {
+		return acc, nil, nil
+	}
+	key := p.apiKeys[hashAPIKey(raw)]
+	if key == nil {
+		return nil, nil, nil
+	}
+	if key.Revoked || key.expired(time.Now()) {
+		return nil, key, errAPIKeyInvalid
+	}
+	acc := p.accountByID[key.AccountID]
+	if acc == nil {
+		return nil, nil, nil
+	}
+	return acc, key, nil
+}
+
+// authenticateProxyRequest 解析代理请求的账号与 API Key，失败时已写出响应并返回 ok=false。
+// 优先使用 x-api-key / Bearer，其次是映射到账号的客户端证书，最后回退默认账号。
+func (p *Server) authenticateProxyRequest(w http.ResponseWriter, r *http.Request) (*Account, *APIKey, bool) {
+	account, key, err := p.resolveProxyKey(extractAPIKey(r))
+	if err != nil {
+		writeAnthropicError(w, http.StatusUnauthorized, "authentication_error", "API key has been revoked or has expired.")
+		return nil, nil, false
+	}
+	if account == nil {
+		// 未携带已知 Key 时，用已校验的 mTLS 客户端证书识别账号。
+		account = p.accountForClientCert(r)
+	}
+	if account == nil {
+		account = p.defaultAccount
+	}
+	if account == nil {
+		http.Error(w, "account not found", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	return account, key, true
+}
+
+// apiKeyID 返回 Key 的 ID，账号主密钥（nil）返回空串。
+func apiKeyID(k *APIKey) string {
+	if k == nil {
+		return ""
+	}
+	return k.ID
+}
+
+// requestModel 从请求体中读取 model 字段。
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &req) != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// writeAnthropicError 按 Anthropic API 错误格式写出响应。
+func writeAnthropicError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+// recordAPIKeyUsage 更新 Key 的最后使用时间与累计用量。
+func (p *Server) recordAPIKeyUsage(key *APIKey, u *usage) {
+	if key == nil {
+		return
+	}
+	var input, output int64
+	if u != nil {
+		input, output = u.input, u.output
+	}
+	now := time.Now().UTC()
+	p.mu.Lock()
+	key.LastUsedAt = &now
+	key.Requests++
+	key.InputTokens += input
+	key.OutputTokens += output
+	p.mu.Unlock()
+	if p.store != nil {
+		if err := p.store.RecordAPIKeyUsage(context.Background(), key.ID, input, output, now); err != nil {
+			p.logger.Printf("record api key %s usage failed: %v", key.ID, err)
+		}
+	}
+}
+
+// createAPIKey 为账号签发新 Key，返回记录与明文（明文仅此一次可见）。
+func (p *Server) createAPIKey(acc *Account, name string, expiresAt *time.Time, models []string) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("name required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("expires_at must be in the future")
+	}
+	cleaned := make([]string, 0, len(models))
+	for _, m := range models {
+		if m = strings.TrimSpace(m); m != "" {
+			if strings.Contains(m, ",") {
+				return nil, "", fmt.Errorf("invalid model %q", m)
+			}
+			cleaned = append(cleaned, m)
+		}
+	}
+	raw, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &APIKey{
+		ID:            fmt.Sprintf("key-%d", time.Now().UnixNano()),
+		AccountID:     acc.ID,
+		Name:          name,
+		Hash:          hashAPIKey(raw),
+		Prefix:        raw[:len(apiKeyPrefix)+6],
+		AllowedModels: cleaned,
+		CreatedAt:     time.Now().UTC(),
+		ExpiresAt:     expiresAt,
+	}
+	if p.store != nil {
+		if err := p.store.CreateAPIKey(context.Background(), store.APIKeyRecord{
+			ID:            key.ID,
+			AccountID:     key.AccountID,
+			Name:          key.Name,
+			KeyHash:       key.Hash,
+			KeyPrefix:     key.Prefix,
+			AllowedModels: key.AllowedModels,
+			CreatedAt:     key.CreatedAt,
+			ExpiresAt:     key.ExpiresAt,
+		}); err != nil {
+			return nil, "", err
+		}
+	}
+	p.mu.Lock()
+	p.apiKeys[key.Hash] = key
+	p.mu.Unlock()
+	return key, raw, nil
+}
+
+// findAPIKey 按 ID 查找 Key。
+func (p *Server) findAPIKey(id string) *APIKey {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, k := range p.apiKeys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// revokeAPIKey 吊销 Key，立即生效。
+func (p *Server) revokeAPIKey(key *APIKey) error {
+	if p.store != nil {
+		if err := p.store.RevokeAPIKey(context.Background(), key.ID, time.Now()); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	p.mu.Lock()
+	key.Revoked = true
+	p.mu.Unlock()
+	return nil
+}
+
+// forgetAPIKeys 删除账号时移除其全部 Key。调用方需持有 p.mu 写锁。
+func (p *Server) forgetAPIKeys(accountID string) {
+	for hash, k := range p.apiKeys {
+		if k.AccountID == accountID {
+			delete(p.apiKeys, hash)
+		}
+	}
+}
+
+func apiKeyView(k *APIKey, now time.Time) map[string]interface{} {
+	status := "active"
+	if k.Revoked {
+		status = "revoked"
+	} else if k.expired(now) {
+		status = "expired"
+	}
+	return map[string]interface{}{
+		"id":             k.ID,
+		"account_id":     k.AccountID,
+		"name":           k.Name,
+		"prefix":         k.Prefix,
+		"allowed_models": k.AllowedModels,
+		"created_at":     k.CreatedAt,
+		"expires_at":     k.ExpiresAt,
+		"last_used_at":   k.LastUsedAt,
+		"revoked":        k.Revoked,
+		"status":         status,
+		"requests":       k.Requests,
+		"input_tokens":   k.InputTokens,
+		"output_tokens":  k.OutputTokens,
+	}
+}
+
+// /admin/api/keys
+// GET ?account_id= 列出 Key；POST ?account_id= 创建 Key（返回明文一次）；DELETE ?id= 吊销 Key。
+func (p *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		accountID := r.URL.Query().Get("account_id")
+		if accountID == "" {
+			if caller := accountFromCtx(r); caller != nil {
+				accountID = caller.ID
+			}
+		}
+		if !canManageAccount(r.Context(), accountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		now := time.Now()
+		p.mu.RLock()
+		keys := make([]*APIKey, 0)
+		for _, k := range p.apiKeys {
+			if k.AccountID == accountID {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+		out := make([]map[string]interface{}, 0, len(keys))
+		for _, k := range keys {
+			out = append(out, apiKeyView(k, now))
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": out})
+	case http.MethodPost:
+		accountID := r.URL.Query().Get("account_id")
+		if !canManageAccount(r.Context(), accountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		acc := p.getAccountByID(accountID)
+		if acc == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		var req struct {
+			Name          string     `json:"name"`
+			ExpiresAt     *time.Time `json:"expires_at"`
+			ExpiresInDays int        `json:"expires_in_days"`
+			AllowedModels []string   `json:"allowed_models"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+		expiresAt := req.ExpiresAt
+		if expiresAt == nil && req.ExpiresInDays > 0 {
+			t := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &t
+		}
+		key, raw, err := p.createAPIKey(acc, req.Name, expiresAt, req.AllowedModels)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "api_key.create", TargetType: "api_key", TargetID: key.ID, AccountID: key.AccountID, After: p.apiKeyAuditState(key)})
+		view := apiKeyView(key, time.Now())
+		view["key"] = raw
+		writeJSON(w, http.StatusCreated, view)
+	case http.MethodDelete:
+		key := p.findAPIKey(r.URL.Query().Get("id"))
+		if key == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		if !canManageAccount(r.Context(), key.AccountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		before := p.apiKeyAuditState(key)
+		if err := p.revokeAPIKey(key); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "api_key.revoke", TargetType: "api_key", TargetID: key.ID, AccountID: key.AccountID, Before: before, After: p.apiKeyAuditState(key)})
+		writeJSON(w, http.StatusOK, map[string]string{"revoked": key.ID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
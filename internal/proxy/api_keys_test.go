@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAllowsModel(t *testing.T) {
+	k := &APIKey{AllowedModels: []string{"claude-3-5-haiku-20241022", "claude-sonnet-4*"}}
+	cases := map[string]bool{
+		"claude-3-5-haiku-20241022": true,
+		"claude-sonnet-4-20250514":  true,
+		"claude-opus-4-20250514":    false,
+		"":                          false,
+	}
+	for model, want := range cases {
+		if got := k.allowsModel(model); got != want {
+			t.Errorf("allowsModel(%q)=%v, want %v", model, got, want)
+		}
+	}
+	if !(&APIKey{}).allowsModel("anything") {
+		t.Fatalf("empty allow-list should allow all models")
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") == "" {
+			t.Errorf("upstream key missing")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().
+		WithUpstream(upstream.URL).
+		WithAPIKey("test-proxy"))
+	h := srv.Handler()
+	acc := srv.defaultAccount
+
+	key, raw, err := srv.createAPIKey(acc, "ci", nil, []string{"claude-3-5-haiku*"})
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if !strings.HasPrefix(raw, apiKeyPrefix) || key.Hash == raw || !strings.HasPrefix(raw, key.Prefix) {
+		t.Fatalf("unexpected key material: raw=%s hash=%s prefix=%s", raw, key.Hash, key.Prefix)
+	}
+
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"`+model+`"}`))
+		req.Header.Set("x-api-key", raw)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("claude-3-5-haiku-20241022"); rec.Code != http.StatusOK {
+		t.Fatalf("allowed model status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if key.LastUsedAt == nil || key.Requests != 1 {
+		t.Fatalf("usage not attributed: %+v", key)
+	}
+	if rec := send("claude-opus-4-20250514"); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "permission_error") {
+		t.Fatalf("disallowed model status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	if err := srv.revokeAPIKey(key); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if rec := send("claude-3-5-haiku-20241022"); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "authentication_error") {
+		t.Fatalf("revoked key status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if _, _, err := srv.createAPIKey(acc, "old", &past, nil); err == nil {
+		t.Fatalf("expected error for past expiry")
+	}
+	expired, rawExpired, err := srv.createAPIKey(acc, "short", nil, nil)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	expired.ExpiresAt = &past
+	if _, _, err := srv.resolveProxyKey(rawExpired); err != errAPIKeyInvalid {
+		t.Fatalf("expected expired key rejected, got %v", err)
+	}
+}
+
+// TestAPIKeyUsageCountedOncePerRequest 一次请求内的多次重试只计一次 Key 请求数。
+func TestAPIKeyUsageCountedOncePerRequest(t *testing.T) {
+	tries := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tries++
+		if tries < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().
+		WithUpstream(upstream.URL).
+		WithAPIKey("test-proxy").
+		WithRetry(3))
+	key, raw, err := srv.createAPIKey(srv.defaultAccount, "ci", nil, nil)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-3-5-haiku-20241022"}`))
+	req.Header.Set("x-api-key", raw)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || tries != 3 {
+		t.Fatalf("status=%d tries=%d", rec.Code, tries)
+	}
+	if key.Requests != 1 {
+		t.Fatalf("key requests = %d, want 1", key.Requests)
+	}
+}
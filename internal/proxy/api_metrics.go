@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -78,7 +79,7 @@ func (p *Server) handleGetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 		avgResp := safeDiv(rec.ResponseTimeSumMs, rec.ResponseTimeCount)
 		avgFirst := safeDiv(rec.FirstByteTimeSumMs, rec.ResponseTimeCount)
 		avgStream := safeDiv(rec.StreamDurationSumMs, rec.ResponseTimeCount)
-		data = append(data, map[string]interface{}{
+		data = append(data, withLatencyPercentiles(map[string]interface{}{
 			"timestamp":              timeutil.FormatBeijingTime(rec.Timestamp),
 			"requests_total":         rec.RequestsTotal,
 			"requests_success":       rec.RequestsSuccess,
@@ -89,7 +90,7 @@ func (p *Server) handleGetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 			"output_tokens":          rec.OutputTokensTotal,
 			"avg_first_byte_ms":      avgFirst,
 			"avg_stream_duration_ms": avgStream,
-		})
+		}, rec))
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -100,6 +101,21 @@ func (p *Server) handleGetNodeMetrics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleAccountAPIRoutes 按路径后缀分发 /api/accounts/:id/* 请求。
+func (p *Server) handleAccountAPIRoutes(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/metrics"):
+		p.handleGetAccountMetrics(w, r)
+	case strings.HasSuffix(r.URL.Path, "/costs"):
+		if !requirePermission(w, r, PermBilling) {
+			return
+		}
+		p.handleAccountCosts(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 // handleGetAccountMetrics 处理 GET /api/accounts/:id/metrics
 func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -111,7 +127,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accountID, ok := extractAccountIDFromPath(r.URL.Path)
+	accountID, ok := extractAccountIDFromPath(r.URL.Path, "/metrics")
 	if !ok {
 		http.NotFound(w, r)
 		return
@@ -134,6 +150,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 
 	q := store.MetricsQuery{
 		AccountID:   accountID,
+		APIKeyID:    r.URL.Query().Get("api_key_id"),
 		Granularity: gran,
 		From:        from,
 		To:          to,
@@ -161,6 +178,8 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 		cur.OutputTokensTotal += rec.OutputTokensTotal
 		cur.FirstByteTimeSumMs += rec.FirstByteTimeSumMs
 		cur.StreamDurationSumMs += rec.StreamDurationSumMs
+		cur.ResponseTimeHist.Merge(rec.ResponseTimeHist)
+		cur.FirstByteHist.Merge(rec.FirstByteHist)
 		agg[ts] = cur
 	}
 
@@ -182,7 +201,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 	data := make([]map[string]interface{}, 0, end-start)
 	for _, ts := range keys[start:end] {
 		rec := agg[ts]
-		data = append(data, map[string]interface{}{
+		data = append(data, withLatencyPercentiles(map[string]interface{}{
 			"timestamp":              timeutil.FormatBeijingTime(ts),
 			"requests_total":         rec.RequestsTotal,
 			"requests_success":       rec.RequestsSuccess,
@@ -193,7 +212,7 @@ func (p *Server) handleGetAccountMetrics(w http.ResponseWriter, r *http.Request)
 			"output_tokens":          rec.OutputTokensTotal,
 			"avg_first_byte_ms":      safeDiv(rec.FirstByteTimeSumMs, rec.ResponseTimeCount),
 			"avg_stream_duration_ms": safeDiv(rec.StreamDurationSumMs, rec.ResponseTimeCount),
-		})
+		}, rec))
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -210,7 +229,7 @@ func (p *Server) handleAggregateMetrics(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -256,13 +275,14 @@ func (p *Server) handleAggregateMetrics(w http.ResponseWriter, r *http.Request)
 	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-// handleCleanupMetrics 处理 POST /api/metrics/cleanup
+// handleCleanupMetrics 处理 POST /api/metrics/cleanup，立即按保留策略清理；account_id 为空时清理全部账号。
+// 返回各账号删除的行数。
 func (p *Server) handleCleanupMetrics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -279,11 +299,18 @@ func (p *Server) handleCleanupMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := p.store.CleanupMetrics(r.Context(), req.AccountID, time.Now().UTC()); err != nil {
-		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	ctx, cancel := context.WithTimeout(r.Context(), retentionTaskTimeout)
+	defer cancel()
+	results, err := applyRetentionPolicies(ctx, p.store, req.AccountID, time.Now().UTC())
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "purged": results})
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	var total store.RetentionResult
+	for _, res := range results {
+		total.Add(res)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "purged": results, "total": total.Total()})
 }
 
 // parseMetricsQueryParams 提取并校验查询参数，返回有效值与默认时间窗口。
@@ -401,13 +428,13 @@ func extractNodeIDFromPath(path string) (string, bool) {
 	return trimmed, true
 }
 
-func extractAccountIDFromPath(path string) (string, bool) {
-	// 期望格式：/api/accounts/{id}/metrics
-	if !strings.HasPrefix(path, "/api/accounts/") || !strings.HasSuffix(path, "/metrics") {
+func extractAccountIDFromPath(path, suffix string) (string, bool) {
+	// 期望格式：/api/accounts/{id}/metrics 或 /api/accounts/{id}/costs
+	if !strings.HasPrefix(path, "/api/accounts/") || !strings.HasSuffix(path, suffix) {
 		return "", false
 	}
 	trimmed := strings.TrimPrefix(path, "/api/accounts/")
-	trimmed = strings.TrimSuffix(trimmed, "/metrics")
+	trimmed = strings.TrimSuffix(trimmed, suffix)
 	trimmed = strings.TrimSuffix(trimmed, "/")
 	if trimmed == "" {
 		return "", false
@@ -415,6 +442,18 @@ func extractAccountIDFromPath(path string) (string, bool) {
 	return trimmed, true
 }
 
+// withLatencyPercentiles 追加响应耗时与首字节耗时的 p50/p95/p99（由直方图估算，无样本为 0）。
+func withLatencyPercentiles(m map[string]interface{}, rec store.MetricsRecord) map[string]interface{} {
+	for _, q := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.5}, {"p95", 0.95}, {"p99", 0.99}} {
+		m[q.name+"_response_time_ms"] = rec.ResponseTimeHist.Quantile(q.q)
+		m[q.name+"_first_byte_ms"] = rec.FirstByteHist.Quantile(q.q)
+	}
+	return m
+}
+
 func safeDiv(sum int64, count int64) float64 {
 	if count <= 0 {
 		return 0
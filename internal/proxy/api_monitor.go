@@ -15,6 +15,8 @@ type MonitorDashboardResponse struct {
 	AccountName string        `json:"account_name"`
 	Nodes       []MonitorNode `json:"nodes"`
 	UpdatedAt   string        `json:"updated_at"`
+	// CostTodayUSD 账号当天（北京时间）费用，分享页不返回。
+	CostTodayUSD *float64 `json:"cost_today_usd,omitempty"`
 }
 
 // ProxySummary 代理流量指标
@@ -45,7 +47,24 @@ type MonitorNode struct {
 	LastError string        `json:"last_error"`
 	Traffic   ProxySummary  `json:"traffic"` // 代理流量指标
 	Health    HealthSummary `json:"health"`  // 健康检查指标
+	Passive   PassiveHealth `json:"passive"` // 基于代理流量的被动健康评分
 	Trend24h  []TrendPoint  `json:"trend_24h"`
+	// CostTodayUSD 节点当天费用（已乘计费倍率），分享页不返回。
+	CostTodayUSD *float64 `json:"cost_today_usd,omitempty"`
+}
+
+// PassiveHealth 被动健康评分（最近 5 分钟的代理流量）。
+type PassiveHealth struct {
+	Score           *float64 `json:"score"` // 0~100，样本不足时为 null
+	Samples         int64    `json:"samples"`
+	SuccessRate     float64  `json:"success_rate"`
+	P95LatencyMs    float64  `json:"p95_latency_ms"`
+	AvgFirstByteMs  float64  `json:"avg_first_byte_ms"`
+	RateLimitRate   float64  `json:"rate_limit_rate"`
+	TimeoutRate     float64  `json:"timeout_rate"`
+	EffectiveWeight int      `json:"effective_weight"` // 权重值 + 降权惩罚
+	Demoted         bool     `json:"demoted"`
+	EjectedUntil    *string  `json:"ejected_until,omitempty"`
 }
 
 type TrendPoint struct {
@@ -64,6 +83,7 @@ type nodeSnapshot struct {
 	LastError string
 	Method    string
 	Metrics   metrics
+	Passive   passiveState
 	CreatedAt time.Time
 }
 
@@ -103,6 +123,14 @@ func (p *Server) handleMonitorDashboard(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "build dashboard failed"})
 		return
 	}
+	// 费用仅对登录用户展示，分享页不包含。
+	if byNode, total := p.todayCosts(r.Context(), resp.AccountID); byNode != nil {
+		resp.CostTodayUSD = &total
+		for i := range resp.Nodes {
+			cost := byNode[resp.Nodes[i].ID]
+			resp.Nodes[i].CostTodayUSD = &cost
+		}
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
@@ -149,6 +177,7 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 			LastError: n.LastError,
 			Method:    n.HealthCheckMethod,
 			Metrics:   n.Metrics,
+			Passive:   n.Passive,
 			CreatedAt: n.CreatedAt,
 		})
 	}
@@ -193,7 +222,7 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 			status = "disabled"
 		} else if snap.Failed || health.Status == "down" {
 			status = "offline"
-		} else if health.Status == "stale" {
+		} else if health.Status == "stale" || snap.Passive.Penalty > 0 || now.Before(snap.Passive.EjectedUntil) {
 			status = "degraded"
 		} else {
 			status = "online"
@@ -215,6 +244,7 @@ func (p *Server) buildMonitorDashboardResponse(ctx context.Context, target *Acco
 			LastError: lastError,
 			Traffic:   traffic,
 			Health:    health,
+			Passive:   summarizePassive(snap.Passive, snap.Weight, now),
 			Trend24h:  buildTrendPoints(trendRecords[snap.ID]),
 		})
 	}
@@ -97,6 +97,7 @@ func (p *Server) handleCreateMonitorShare(w http.ResponseWriter, r *http.Request
 		shareError(w, http.StatusInternalServerError, "CREATE_FAILED", err.Error())
 		return
 	}
+	p.audit(r, auditEntry{Action: "share.create", TargetType: "monitor_share", TargetID: rec.ID, AccountID: rec.AccountID, After: shareAuditState(rec)})
 
 	expireStr := (*string)(nil)
 	if !expireAt.IsZero() {
@@ -244,6 +245,9 @@ func (p *Server) handleRevokeMonitorShare(w http.ResponseWriter, r *http.Request
 		shareError(w, http.StatusInternalServerError, "REVOKE_FAILED", err.Error())
 		return
 	}
+	revoked := *rec
+	revoked.Revoked = true
+	p.audit(r, auditEntry{Action: "share.revoke", TargetType: "monitor_share", TargetID: rec.ID, AccountID: rec.AccountID, Before: shareAuditState(*rec), After: shareAuditState(revoked)})
 	w.WriteHeader(http.StatusNoContent)
 }
 
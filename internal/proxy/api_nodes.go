@@ -1,10 +1,12 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"qcc_plus/internal/timeutil"
@@ -34,7 +36,10 @@ func (p *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 	}
 	switch r.Method {
 	case http.MethodGet:
-		writeJSON(w, http.StatusOK, map[string]interface{}{"nodes": p.listNodes(acc)})
+		p.mu.RLock()
+		strategy := p.lbStrategyFor(acc)
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"nodes": p.listNodes(r.Context(), acc), "lb_strategy": strategy})
 	case http.MethodPut:
 		id := r.URL.Query().Get("id")
 		if id == "" {
@@ -57,15 +62,50 @@ func (p *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 			Weight            int     `json:"weight"`
 			HealthCheckMethod *string `json:"health_check_method"`
 			HealthCheckModel  *string `json:"health_check_model"`
+			// 省略表示保持不变，传空数组/空对象表示清除。
+			SupportedModels *[]string          `json:"supported_models"`
+			ModelMap        *map[string]string `json:"model_map"`
+			HealthProbes    *[]ProbeConfig     `json:"health_probes"`
+			PriceMultiplier *float64           `json:"price_multiplier"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 			return
 		}
+		if _, _, err := normalizeModelRules(derefStrings(req.SupportedModels), derefModelMap(req.ModelMap)); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if req.HealthProbes != nil {
+			if _, err := normalizeProbeChain(*req.HealthProbes); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		if req.PriceMultiplier != nil {
+			if err := validatePriceMultiplier(*req.PriceMultiplier); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+		before := p.nodeAuditState(id)
 		if err := p.updateNode(id, req.Name, req.BaseURL, req.APIKey, req.Weight, req.HealthCheckMethod, req.HealthCheckModel); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		if err := p.setNodeModels(id, req.SupportedModels, req.ModelMap); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setNodeProbes(id, req.HealthProbes); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setNodePriceMultiplier(id, req.PriceMultiplier); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "node.update", TargetType: "node", TargetID: id, AccountID: node.AccountID, Before: before, After: p.nodeAuditState(id)})
 		writeJSON(w, http.StatusOK, map[string]string{"id": id})
 	case http.MethodDelete:
 		id := r.URL.Query().Get("id")
@@ -82,40 +122,74 @@ func (p *Server) handleNodes(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 			return
 		}
+		before := p.nodeAuditState(id)
 		if err := p.deleteNode(id); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		p.audit(r, auditEntry{Action: "node.delete", TargetType: "node", TargetID: id, AccountID: node.AccountID, Before: before})
 		writeJSON(w, http.StatusOK, map[string]string{"deleted": id})
 	case http.MethodPost:
 		var req struct {
-			BaseURL           string `json:"base_url"`
-			APIKey            string `json:"api_key"`
-			Name              string `json:"name"`
-			Weight            int    `json:"weight"`
-			HealthCheckMethod string `json:"health_check_method"`
-			HealthCheckModel  string `json:"health_check_model"`
+			BaseURL           string            `json:"base_url"`
+			APIKey            string            `json:"api_key"`
+			Name              string            `json:"name"`
+			Weight            int               `json:"weight"`
+			HealthCheckMethod string            `json:"health_check_method"`
+			HealthCheckModel  string            `json:"health_check_model"`
+			SupportedModels   []string          `json:"supported_models"`
+			ModelMap          map[string]string `json:"model_map"`
+			HealthProbes      []ProbeConfig     `json:"health_probes"`
+			PriceMultiplier   *float64          `json:"price_multiplier"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 			return
 		}
+		if _, _, err := normalizeModelRules(req.SupportedModels, req.ModelMap); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if _, err := normalizeProbeChain(req.HealthProbes); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if req.PriceMultiplier != nil {
+			if err := validatePriceMultiplier(*req.PriceMultiplier); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
 		node, err := p.addNodeWithMethod(acc, req.Name, req.BaseURL, req.APIKey, req.Weight, req.HealthCheckMethod, req.HealthCheckModel)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+		if err := p.setNodeModels(node.ID, &req.SupportedModels, &req.ModelMap); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setNodeProbes(node.ID, &req.HealthProbes); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.setNodePriceMultiplier(node.ID, req.PriceMultiplier); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "node.create", TargetType: "node", TargetID: node.ID, AccountID: acc.ID, After: p.nodeAuditState(node.ID)})
 		writeJSON(w, http.StatusCreated, map[string]interface{}{"id": node.ID})
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// 列出节点，标注是否激活和是否含密钥。
-func (p *Server) listNodes(acc *Account) []map[string]interface{} {
+// 列出节点，标注是否激活和是否含密钥；无 PermSecrets 时隐藏地址中的凭据与探针请求头。
+func (p *Server) listNodes(ctx context.Context, acc *Account) []map[string]interface{} {
 	if acc == nil {
 		return nil
 	}
+	showSecrets := hasPermission(ctx, PermSecrets)
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	type nodeView struct {
@@ -124,6 +198,7 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 		createdAt time.Time
 	}
 	views := make([]nodeView, 0, len(acc.Nodes))
+	now := time.Now()
 	for id, n := range acc.Nodes {
 		healthMethod := normalizeHealthCheckMethod(n.HealthCheckMethod)
 		avgPerToken := "-"
@@ -140,13 +215,17 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 			}
 		}
 		lastHealthCheckAt := timeutil.FormatBeijingTime(n.Metrics.LastHealthCheckAt)
+		baseURL, probes := n.URL.String(), n.HealthProbes
+		if !showSecrets {
+			baseURL, probes = redactURLUserinfo(n.URL), redactProbeHeaders(probes)
+		}
 		views = append(views, nodeView{
 			weight:    n.Weight,
 			createdAt: n.CreatedAt,
 			view: map[string]interface{}{
 				"id":                    id,
 				"name":                  n.Name,
-				"base_url":              n.URL.String(),
+				"base_url":              baseURL,
 				"health_check_method":   healthMethod,
 				"health_check_model":    chooseNonEmpty(n.HealthCheckModel, defaultHealthCheckModel),
 				"active":                id == acc.ActiveID,
@@ -168,9 +247,16 @@ func (p *Server) listNodes(acc *Account) []map[string]interface{} {
 				"first_byte_ms":         n.Metrics.FirstByteDur.Milliseconds(),
 				"avg_recv_ms_per_token": avgPerToken,
 				"weight":                n.Weight,
+				"in_flight":             atomic.LoadInt64(&n.InFlight),
+				"ewma_latency_ms":       n.Metrics.EWMALatencyMS,
 				"failed":                n.Failed,
 				"disabled":              n.Disabled,
 				"last_error":            n.LastError,
+				"supported_models":      n.SupportedModels,
+				"model_map":             n.ModelMap,
+				"health_probes":         probes,
+				"price_multiplier":      n.priceMultiplier(),
+				"health_score":          summarizePassive(n.Passive, n.Weight, now),
 			},
 		})
 	}
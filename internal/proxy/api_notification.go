@@ -204,15 +204,22 @@ func (p *Server) updateNotificationChannel(w http.ResponseWriter, r *http.Reques
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
+	typeChanged := false
 	if req.ChannelType != nil {
 		if !isSupportedChannel(*req.ChannelType) {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported channel_type"})
 			return
 		}
+		typeChanged = *req.ChannelType != rec.ChannelType
 		rec.ChannelType = *req.ChannelType
 	}
 	if len(req.Config) > 0 {
-		cfg, err := validateChannelConfig(rec.ChannelType, req.Config)
+		patch := req.Config
+		if !typeChanged {
+			// 同类型渠道按字段合并，未提交的字段（如密码、签名密钥）保持不变
+			patch = mergeJSONObjects(rec.Config, req.Config)
+		}
+		cfg, err := validateChannelConfig(rec.ChannelType, patch)
 		if err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
@@ -351,9 +358,10 @@ func (p *Server) createNotificationSubscription(w http.ResponseWriter, r *http.R
 		return
 	}
 	var req struct {
-		ChannelID  string   `json:"channel_id"`
-		EventTypes []string `json:"event_types"`
-		Enabled    *bool    `json:"enabled"`
+		ChannelID  string          `json:"channel_id"`
+		EventTypes []string        `json:"event_types"`
+		Enabled    *bool           `json:"enabled"`
+		Rules      json.RawMessage `json:"rules"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
@@ -373,6 +381,11 @@ func (p *Server) createNotificationSubscription(w http.ResponseWriter, r *http.R
 			return
 		}
 	}
+	rules, err := normalizeSubscriptionRules(req.Rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 	ch, err := p.store.GetNotificationChannel(r.Context(), req.ChannelID)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
@@ -401,6 +414,7 @@ func (p *Server) createNotificationSubscription(w http.ResponseWriter, r *http.R
 			ChannelID: ch.ID,
 			EventType: evt,
 			Enabled:   enabled,
+			Rules:     rules,
 			CreatedAt: now,
 		}
 		if err := p.store.UpsertNotificationSubscription(context.Background(), rec); err != nil {
@@ -413,7 +427,7 @@ func (p *Server) createNotificationSubscription(w http.ResponseWriter, r *http.R
 	writeJSON(w, http.StatusCreated, map[string]interface{}{"subscriptions": resp})
 }
 
-// updateNotificationSubscription 更新订阅状态。
+// updateNotificationSubscription 更新订阅状态与规则；rules 为 null 时清除规则。
 func (p *Server) updateNotificationSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	if p.store == nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "notification store not enabled"})
@@ -439,17 +453,28 @@ func (p *Server) updateNotificationSubscription(w http.ResponseWriter, r *http.R
 		return
 	}
 	var req struct {
-		Enabled *bool `json:"enabled"`
+		Enabled *bool           `json:"enabled"`
+		Rules   json.RawMessage `json:"rules"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
-	if req.Enabled == nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "enabled required"})
+	if req.Enabled == nil && req.Rules == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "enabled or rules required"})
 		return
 	}
-	rec.Enabled = *req.Enabled
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+	if req.Rules != nil {
+		rules, err := normalizeSubscriptionRules(req.Rules)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		rec.Rules = rules
+	}
 	rec.UpdatedAt = time.Now()
 	if err := p.store.UpsertNotificationSubscription(context.Background(), *rec); err != nil {
 		p.logger.Printf("update subscription failed: %v", err)
@@ -505,6 +530,7 @@ func (p *Server) listEventTypes(w http.ResponseWriter, r *http.Request) {
 			"type":        e.Type,
 			"category":    e.Category,
 			"description": e.Description,
+			"severity":    notify.DefaultSeverity(e.Type),
 		})
 	}
 	writeJSON(w, http.StatusOK, map[string]interface{}{"event_types": resp})
@@ -570,15 +596,19 @@ func (p *Server) testNotification(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
 }
 
-// channelView 返回对外展示的渠道信息（隐藏敏感配置）。
+// channelView 返回对外展示的渠道信息（隐藏敏感配置，仅输出消息模板相关字段）。
 func channelView(rec store.NotificationChannelRecord) map[string]interface{} {
+	tpl, _ := notify.ParseMessageTemplate(rec.Config)
 	return map[string]interface{}{
-		"id":           rec.ID,
-		"name":         rec.Name,
-		"channel_type": rec.ChannelType,
-		"enabled":      rec.Enabled,
-		"created_at":   timeutil.FormatBeijingTime(rec.CreatedAt),
-		"updated_at":   timeutil.FormatBeijingTime(rec.UpdatedAt),
+		"id":               rec.ID,
+		"name":             rec.Name,
+		"channel_type":     rec.ChannelType,
+		"enabled":          rec.Enabled,
+		"language":         tpl.Language,
+		"title_template":   tpl.TitleTemplate,
+		"content_template": tpl.ContentTemplate,
+		"created_at":       timeutil.FormatBeijingTime(rec.CreatedAt),
+		"updated_at":       timeutil.FormatBeijingTime(rec.UpdatedAt),
 	}
 }
 
@@ -589,14 +619,28 @@ func subscriptionView(rec store.NotificationSubscriptionRecord) map[string]inter
 		"channel_id": rec.ChannelID,
 		"event_type": rec.EventType,
 		"enabled":    rec.Enabled,
+		"rules":      rec.Rules,
 		"created_at": timeutil.FormatBeijingTime(rec.CreatedAt),
 	}
 }
 
+// normalizeSubscriptionRules 校验订阅规则并返回规范化后的 JSON；空值或 null 返回 nil。
+func normalizeSubscriptionRules(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	rules, err := notify.ParseSubscriptionRules(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rules)
+}
+
 // channel与订阅校验相关辅助函数。
 func isSupportedChannel(tp string) bool {
 	switch tp {
-	case notify.ChannelWechatWork, notify.ChannelWechatPersonal:
+	case notify.ChannelWechatWork, notify.ChannelWechatPersonal,
+		notify.ChannelDingTalk, notify.ChannelSlack, notify.ChannelWebhook, notify.ChannelEmail:
 		return true
 	default:
 		return false
@@ -607,6 +651,10 @@ func validateChannelConfig(channelType string, raw json.RawMessage) (json.RawMes
 	if len(raw) == 0 {
 		return nil, errors.New("config required")
 	}
+	// 所有渠道均可携带 language / title_template / content_template
+	if _, err := notify.ParseMessageTemplate(raw); err != nil {
+		return nil, err
+	}
 	switch channelType {
 	case notify.ChannelWechatWork, notify.ChannelWechatPersonal:
 		var cfg struct {
@@ -622,11 +670,34 @@ func validateChannelConfig(channelType string, raw json.RawMessage) (json.RawMes
 			return nil, err
 		}
 		return raw, nil
+	case notify.ChannelDingTalk, notify.ChannelSlack, notify.ChannelWebhook, notify.ChannelEmail:
+		// 各渠道构造函数负责完整校验（URL、签名密钥、SMTP 地址与收件人等）
+		rec := store.NotificationChannelRecord{ChannelType: channelType, Config: raw}
+		if _, err := notify.BuildChannel(rec); err != nil {
+			return nil, err
+		}
+		return raw, nil
 	default:
 		return nil, fmt.Errorf("unsupported channel_type: %s", channelType)
 	}
 }
 
+// mergeJSONObjects 将 patch 的顶层字段覆盖到 base 上；任一方不是 JSON 对象时直接返回 patch。
+func mergeJSONObjects(base, patch json.RawMessage) json.RawMessage {
+	var baseObj, patchObj map[string]json.RawMessage
+	if json.Unmarshal(base, &baseObj) != nil || json.Unmarshal(patch, &patchObj) != nil || baseObj == nil || patchObj == nil {
+		return patch
+	}
+	for k, v := range patchObj {
+		baseObj[k] = v
+	}
+	merged, err := json.Marshal(baseObj)
+	if err != nil {
+		return patch
+	}
+	return merged
+}
+
 func validateURL(raw string) error {
 	if raw == "" {
 		return errors.New("webhook_url required")
@@ -673,9 +744,12 @@ func eventTypeCatalog() []eventTypeInfo {
 		{notify.EventRequestProxyError, "request", "代理错误"},
 		{notify.EventAccountQuotaWarning, "account", "账号配额预警"},
 		{notify.EventAccountAuthFailed, "account", "账号认证失败"},
+		{notify.EventAccountDigestHourly, "account", "每小时运行摘要"},
+		{notify.EventAccountDigestDaily, "account", "每日运行摘要"},
 		{notify.EventSystemTunnelStarted, "system", "隧道启动"},
 		{notify.EventSystemTunnelStopped, "system", "隧道停止"},
 		{notify.EventSystemTunnelError, "system", "隧道错误"},
 		{notify.EventSystemError, "system", "系统错误"},
+		{notify.EventSecurityAudit, "security", "管理操作审计"},
 	}
 }
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// outboxView 发件箱记录输出。
+func outboxView(rec store.NotificationOutboxRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              rec.ID,
+		"account_id":      rec.AccountID,
+		"channel_id":      rec.ChannelID,
+		"event_type":      rec.EventType,
+		"title":           rec.Title,
+		"content":         rec.Content,
+		"status":          rec.Status,
+		"attempts":        rec.Attempts,
+		"max_attempts":    rec.MaxAttempts,
+		"last_error":      rec.LastError,
+		"occurred_at":     timeutil.FormatBeijingTime(rec.OccurredAt),
+		"next_attempt_at": timeutil.FormatBeijingTime(rec.NextAttemptAt),
+		"created_at":      timeutil.FormatBeijingTime(rec.CreatedAt),
+		"updated_at":      timeutil.FormatBeijingTime(rec.UpdatedAt),
+	}
+}
+
+// GET /api/notification/outbox
+// 查询参数：
+// - status: pending / dead / sent，默认全部
+// - account_id: 管理员可省略以查询全部账号，普通账号只能查询自己
+// - limit: 默认 50，最大 500
+// - offset: 默认 0
+// 响应附带队列状态：queue_depth、queue_capacity、dropped（队列满丢弃数）、dead_letter（本进程进入死信数）。
+func (p *Server) handleNotificationOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "notification store not enabled"})
+		return
+	}
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	accountID := strings.TrimSpace(q.Get("account_id"))
+	if accountID == "" && !isAdmin(ctx) {
+		caller := accountFromCtx(r)
+		if caller == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		accountID = caller.ID
+	}
+	if accountID != "" && !canManageAccount(ctx, accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	status := strings.TrimSpace(q.Get("status"))
+	switch status {
+	case "", store.OutboxStatusPending, store.OutboxStatusSending, store.OutboxStatusDead, store.OutboxStatusSent:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid status"})
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+
+	records, total, err := p.store.QueryNotificationOutbox(ctx, store.NotificationOutboxQuery{
+		AccountID: accountID,
+		Status:    status,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		p.logger.Printf("query notification outbox failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query outbox failed"})
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		items = append(items, outboxView(rec))
+	}
+	depth, capacity := p.notifyMgr.QueueDepth()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":          items,
+		"total":          total,
+		"limit":          limit,
+		"offset":         offset,
+		"queue_depth":    depth,
+		"queue_capacity": capacity,
+		"dropped":        p.notifyMgr.DroppedCount(),
+		"dead_letter":    p.notifyMgr.DeadLetterCount(),
+	})
+}
+
+// POST /api/notification/outbox/{id}/resend
+// 立即重发一条 pending 或 dead 记录，返回更新后的记录；发送失败时 status 不变，原因见 last_error。
+func (p *Server) handleNotificationOutboxByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/notification/outbox/"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	if id == "" || action != "resend" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil || p.notifyMgr == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "notification store not enabled"})
+		return
+	}
+	rec, err := p.store.GetNotificationOutbox(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "outbox item not found"})
+			return
+		}
+		p.logger.Printf("get notification outbox failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "get outbox item failed"})
+		return
+	}
+	if !canManageAccount(r.Context(), rec.AccountID) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "outbox item not found"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	updated, err := p.notifyMgr.Resend(ctx, id)
+	if err != nil {
+		if errors.Is(err, notify.ErrOutboxAlreadySent) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "outbox item already sent"})
+			return
+		}
+		if errors.Is(err, notify.ErrOutboxInProgress) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "outbox item is being delivered"})
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "outbox item not found"})
+			return
+		}
+		p.logger.Printf("resend notification %s failed: %v", id, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "resend failed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, outboxView(*updated))
+}
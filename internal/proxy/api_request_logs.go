@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+// requestLogView 请求日志输出，withBodies 为 true 时附带请求/响应体。
+func requestLogView(rec store.RequestLogRecord, withBodies bool) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":            rec.ID,
+		"created_at":    timeutil.FormatBeijingTime(rec.CreatedAt),
+		"account_id":    rec.AccountID,
+		"api_key_id":    rec.APIKeyID,
+		"node_id":       rec.NodeID,
+		"model":         rec.Model,
+		"stream":        rec.Stream,
+		"status_code":   rec.StatusCode,
+		"latency_ms":    rec.LatencyMs,
+		"first_byte_ms": rec.FirstByteMs,
+		"input_tokens":  rec.InputTokens,
+		"output_tokens": rec.OutputTokens,
+		"retry_count":   rec.RetryCount,
+		"error":         rec.Error,
+	}
+	if withBodies {
+		out["request_body"] = rec.RequestBody
+		out["response_body"] = rec.ResponseBody
+	}
+	return out
+}
+
+// GET /admin/api/request-logs
+// 查询参数：
+// - id: 指定时返回单条日志详情（含请求/响应体）
+// - account_id: 管理员可省略以查询全部账号，普通账号只能查询自己
+// - api_key_id / node_id / model / status: 精确过滤
+// - errors_only: true 时仅返回失败请求
+// - from / to: RFC3339
+// - limit: 默认 50，最大 500
+// - offset: 默认 0
+func (p *Server) handleRequestLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if p.store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store not enabled"})
+		return
+	}
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	if v := q.Get("id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+			return
+		}
+		rec, err := p.store.GetRequestLog(ctx, id)
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "request log not found"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if !canManageAccount(ctx, rec.AccountID) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "request log not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, requestLogView(*rec, true))
+		return
+	}
+
+	accountID := strings.TrimSpace(q.Get("account_id"))
+	if accountID == "" && !isAdmin(ctx) {
+		caller := accountFromCtx(r)
+		if caller == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		accountID = caller.ID
+	}
+	if accountID != "" && !canManageAccount(ctx, accountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	from, err := parseTime(q.Get("from"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from time"})
+		return
+	}
+	to, err := parseTime(q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to time"})
+		return
+	}
+	status := 0
+	if v := q.Get("status"); v != "" {
+		if status, err = strconv.Atoi(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid status"})
+			return
+		}
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+	errorsOnly, _ := strconv.ParseBool(q.Get("errors_only"))
+
+	records, total, err := p.store.QueryRequestLogs(ctx, store.RequestLogQuery{
+		AccountID:  accountID,
+		APIKeyID:   strings.TrimSpace(q.Get("api_key_id")),
+		NodeID:     strings.TrimSpace(q.Get("node_id")),
+		Model:      strings.TrimSpace(q.Get("model")),
+		StatusCode: status,
+		ErrorsOnly: errorsOnly,
+		From:       from,
+		To:         to,
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	out := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		out = append(out, requestLogView(rec, false))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"logs":   out,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
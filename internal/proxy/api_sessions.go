@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// setSessionCookie 写入会话 Cookie，有效期与服务端会话过期时间保持一致（滑动续期后同步刷新）。
+// secure 为 true（监听端口启用 TLS）时附加 Secure 标记，Cookie 只经 HTTPS 发送。
+func setSessionCookie(w http.ResponseWriter, sess *Session, secure bool) {
+	maxAge := int(time.Until(sess.ExpiresAt).Seconds())
+	if maxAge <= 0 {
+		maxAge = 1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    sess.Token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sessionIDFromCtx 返回当前请求所属会话 ID。
+func sessionIDFromCtx(ctx context.Context) string {
+	id, _ := ctx.Value(sessionContextKey{}).(string)
+	return id
+}
+
+// sessionView 会话列表输出，不包含 token。
+func sessionView(sess *Session, currentID string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           sess.ID,
+		"account_id":   sess.AccountID,
+		"user_id":      sess.UserID,
+		"role":         sessionRole(sess),
+		"is_admin":     sess.IsAdmin,
+		"user_agent":   sess.UserAgent,
+		"ip":           sess.IP,
+		"created_at":   sess.CreatedAt,
+		"expires_at":   sess.ExpiresAt,
+		"last_seen_at": sess.LastSeenAt,
+		"current":      sess.ID == currentID,
+	}
+}
+
+// handleSessions 会话管理：
+//   - GET    ?account_id=  列出账号的有效会话（管理员可省略 account_id 列出全部，普通账号默认自己）
+//   - DELETE ?id=          吊销单个会话
+//   - DELETE ?account_id=  吊销账号的全部会话
+func (p *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		accountID := r.URL.Query().Get("account_id")
+		if accountID == "" && !isAdmin(ctx) {
+			if caller := accountFromCtx(r); caller != nil {
+				accountID = caller.ID
+			}
+		}
+		if accountID != "" && !canManageAccount(ctx, accountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		sessions, err := p.sessionMgr.List(ctx, accountID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		currentID := sessionIDFromCtx(ctx)
+		out := make([]map[string]interface{}, 0, len(sessions))
+		for _, sess := range sessions {
+			out = append(out, sessionView(sess, currentID))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": out})
+	case http.MethodDelete:
+		if id := r.URL.Query().Get("id"); id != "" {
+			sess, err := p.sessionMgr.Lookup(ctx, id)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			if sess == nil {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+				return
+			}
+			if !canManageAccount(ctx, sess.AccountID) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+				return
+			}
+			if err := p.sessionMgr.Revoke(ctx, id); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+					return
+				}
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			p.audit(r, auditEntry{Action: "session.revoke", TargetType: "session", TargetID: id, AccountID: sess.AccountID,
+				Before: sessionAuditState(sess, false), After: sessionAuditState(sess, true)})
+			writeJSON(w, http.StatusOK, map[string]string{"revoked": id})
+			return
+		}
+		accountID := r.URL.Query().Get("account_id")
+		if accountID == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id or account_id required"})
+			return
+		}
+		if !canManageAccount(ctx, accountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		if err := p.sessionMgr.RevokeAccount(ctx, accountID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.audit(r, auditEntry{Action: "session.revoke_all", TargetType: "account", TargetID: accountID, AccountID: accountID,
+			Before: map[string]bool{"revoked": false}, After: map[string]bool{"revoked": true}})
+		writeJSON(w, http.StatusOK, map[string]string{"revoked_account": accountID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 func (p *Server) handleTunnelConfig(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -55,6 +55,7 @@ func (p *Server) handleTunnelConfig(w http.ResponseWriter, r *http.Request) {
 		if existing == nil {
 			existing = &store.TunnelConfig{ID: "default"}
 		}
+		before := tunnelAuditState(existing)
 
 		if req.APIToken != "" {
 			existing.APIToken = strings.TrimSpace(req.APIToken)
@@ -76,6 +77,7 @@ func (p *Server) handleTunnelConfig(w http.ResponseWriter, r *http.Request) {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
+		p.audit(r, auditEntry{Action: "tunnel.config", TargetType: "tunnel", TargetID: existing.ID, Before: before, After: tunnelAuditState(existing)})
 		writeJSON(w, http.StatusOK, p.GetTunnelStatus())
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -87,7 +89,7 @@ func (p *Server) handleTunnelStart(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -95,6 +97,7 @@ func (p *Server) handleTunnelStart(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	p.audit(r, auditEntry{Action: "tunnel.start", TargetType: "tunnel", TargetID: "default", Before: map[string]bool{"running": false}, After: map[string]bool{"running": true}})
 	writeJSON(w, http.StatusOK, p.GetTunnelStatus())
 }
 
@@ -103,7 +106,7 @@ func (p *Server) handleTunnelStop(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -111,6 +114,7 @@ func (p *Server) handleTunnelStop(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 		return
 	}
+	p.audit(r, auditEntry{Action: "tunnel.stop", TargetType: "tunnel", TargetID: "default", Before: map[string]bool{"running": true}, After: map[string]bool{"running": false}})
 	writeJSON(w, http.StatusOK, p.GetTunnelStatus())
 }
 
@@ -119,7 +123,7 @@ func (p *Server) handleTunnelZones(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
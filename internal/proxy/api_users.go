@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// sessionRole 返回会话角色，账号自身登录的会话为 owner。
+func sessionRole(sess *Session) Role {
+	if sess == nil || sess.Role == "" {
+		return RoleOwner
+	}
+	return sess.Role
+}
+
+// memberUsernameTaken 判断名称是否已被账号成员占用（账号名与成员用户名共用登录入口，不能重复）。
+func (p *Server) memberUsernameTaken(ctx context.Context, name string) bool {
+	name = strings.TrimSpace(name)
+	if p.store == nil || name == "" {
+		return false
+	}
+	_, err := p.store.GetUserByUsername(ctx, name)
+	return err == nil
+}
+
+// accountNameTaken 判断名称是否已被账号使用。
+func (p *Server) accountNameTaken(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, acc := range p.accountByID {
+		if acc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateMember 校验成员用户名与密码，成功时返回成员及所属账号。
+func (p *Server) authenticateMember(ctx context.Context, username, password string) (*store.UserRecord, *Account) {
+	if p.store == nil {
+		burnPasswordCheck(password)
+		return nil, nil
+	}
+	user, err := p.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			p.logger.Printf("load account member %s failed: %v", username, err)
+		}
+		burnPasswordCheck(password)
+		return nil, nil
+	}
+	if user.Disabled {
+		burnPasswordCheck(password)
+		return nil, nil
+	}
+	if ok, _ := checkPassword(user.Password, password); !ok {
+		return nil, nil
+	}
+	acc := p.getAccountByID(user.AccountID)
+	if acc == nil {
+		return nil, nil
+	}
+	return user, acc
+}
+
+func userView(rec store.UserRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            rec.ID,
+		"account_id":    rec.AccountID,
+		"username":      rec.Username,
+		"role":          rec.Role,
+		"permissions":   rolePermissions[Role(rec.Role)],
+		"disabled":      rec.Disabled,
+		"created_at":    rec.CreatedAt,
+		"updated_at":    rec.UpdatedAt,
+		"last_login_at": rec.LastLoginAt,
+	}
+}
+
+// /admin/api/accounts/users 账号成员管理：
+//   - GET    ?account_id=  列出成员（默认当前账号）
+//   - POST   ?account_id=  创建成员 {"username","password","role"}
+//   - PUT    ?id=          修改成员 {"password","role","disabled"}，角色、密码或禁用状态变化时吊销其会话
+//   - DELETE ?id=          删除成员并吊销其会话
+func (p *Server) handleAccountUsers(w http.ResponseWriter, r *http.Request) {
+	if p.store == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "未启用存储，无法管理账号成员"})
+		return
+	}
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+		accountID := r.URL.Query().Get("account_id")
+		if accountID == "" {
+			if caller := accountFromCtx(r); caller != nil {
+				accountID = caller.ID
+			}
+		}
+		if !canManageAccount(ctx, accountID) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			return
+		}
+		if p.getAccountByID(accountID) == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "account not found"})
+			return
+		}
+		if r.Method == http.MethodGet {
+			users, err := p.store.ListUsers(ctx, accountID)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			out := make([]map[string]interface{}, 0, len(users))
+			for _, u := range users {
+				out = append(out, userView(u))
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"users": out})
+			return
+		}
+		p.createAccountUser(w, r, accountID)
+	case http.MethodPut:
+		p.updateAccountUser(w, r)
+	case http.MethodDelete:
+		user, ok := p.lookupManagedUser(w, r)
+		if !ok {
+			return
+		}
+		if err := p.store.DeleteUser(ctx, user.ID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.revokeUserSessions(ctx, user.ID)
+		p.audit(r, auditEntry{Action: "member.delete", TargetType: "member", TargetID: user.ID, AccountID: user.AccountID, Before: userAuditState(user)})
+		writeJSON(w, http.StatusOK, map[string]string{"deleted": user.ID})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (p *Server) createAccountUser(w http.ResponseWriter, r *http.Request, accountID string) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "username required"})
+		return
+	}
+	if len(req.Password) < 6 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
+		return
+	}
+	role, err := parseRole(req.Role)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if p.accountNameTaken(req.Username) || p.memberUsernameTaken(r.Context(), req.Username) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "username already exists"})
+		return
+	}
+	hashed, err := hashPassword(req.Password)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	rec := store.UserRecord{
+		ID:        fmt.Sprintf("usr-%d", now.UnixNano()),
+		AccountID: accountID,
+		Username:  req.Username,
+		Password:  hashed,
+		Role:      string(role),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.store.CreateUser(r.Context(), rec); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	p.audit(r, auditEntry{Action: "member.create", TargetType: "member", TargetID: rec.ID, AccountID: accountID, After: userAuditState(&rec)})
+	writeJSON(w, http.StatusCreated, userView(rec))
+}
+
+func (p *Server) updateAccountUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := p.lookupManagedUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string  `json:"password"`
+		Role     *string `json:"role"`
+		Disabled *bool   `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	before := userAuditState(user)
+	revoke := false
+	if req.Password != "" {
+		if len(req.Password) < 6 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "密码至少6位"})
+			return
+		}
+		hashed, err := hashPassword(req.Password)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		user.Password = hashed
+		revoke = true
+	}
+	if req.Role != nil {
+		role, err := parseRole(*req.Role)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		revoke = revoke || string(role) != user.Role
+		user.Role = string(role)
+	}
+	if req.Disabled != nil {
+		revoke = revoke || *req.Disabled != user.Disabled
+		user.Disabled = *req.Disabled
+	}
+	user.UpdatedAt = time.Now().UTC()
+	if err := p.store.UpdateUser(r.Context(), *user); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	// 会话中缓存了角色，变更后吊销使其重新登录以获得新权限。
+	if revoke {
+		p.revokeUserSessions(r.Context(), user.ID)
+	}
+	p.audit(r, auditEntry{Action: "member.update", TargetType: "member", TargetID: user.ID, AccountID: user.AccountID, Before: before, After: userAuditState(user)})
+	writeJSON(w, http.StatusOK, userView(*user))
+}
+
+// lookupManagedUser 按 ?id= 读取成员并校验调用方可管理其所属账号。
+func (p *Server) lookupManagedUser(w http.ResponseWriter, r *http.Request) (*store.UserRecord, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id required"})
+		return nil, false
+	}
+	user, err := p.store.GetUserByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return nil, false
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	if !canManageAccount(r.Context(), user.AccountID) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (p *Server) revokeUserSessions(ctx context.Context, userID string) {
+	if p.sessionMgr == nil {
+		return
+	}
+	if err := p.sessionMgr.RevokeUser(ctx, userID); err != nil {
+		p.logger.Printf("revoke sessions of member %s failed: %v", userID, err)
+	}
+}
+
+// GET /admin/api/me 返回当前会话的身份、角色与权限，前端据此隐藏无权限的操作。
+func (p *Server) handleCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	out := map[string]interface{}{
+		"user_id":     userIDFromCtx(ctx),
+		"role":        roleFromCtx(ctx),
+		"is_admin":    isAdmin(ctx),
+		"permissions": permissionsFor(ctx),
+	}
+	if acc := accountFromCtx(r); acc != nil {
+		out["account_id"] = acc.ID
+		out["account_name"] = acc.Name
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -41,9 +41,11 @@ func (p *Server) handleMonitorWebSocket(w http.ResponseWriter, r *http.Request)
 		accountID: accountID,
 		send:      make(chan []byte, 256),
 	}
-	p.wsHub.register <- client
-
-	go client.writePump()
+	if !p.wsHub.Register(client) {
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		_ = conn.Close()
+		return
+	}
 	go client.readPump()
 }
 
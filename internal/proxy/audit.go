@@ -0,0 +1,291 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+)
+
+// auditEntry 一次管理操作。Before/After 为操作前后的对象快照（可 JSON 序列化），
+// 创建时 Before 为 nil，删除时 After 为 nil。
+type auditEntry struct {
+	Action     string // 如 node.update、setting.update
+	TargetType string
+	TargetID   string
+	AccountID  string // 对象所属账号，空表示系统级对象
+	Before     any
+	After      any
+	Secret     bool // value 字段为密钥（如 secret 配置项），只记录是否变化
+}
+
+// auditChange 单个字段的变更。
+type auditChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// audit 记录管理操作并发布 security.audit 通知。写入失败只记录日志，不影响操作本身。
+func (p *Server) audit(r *http.Request, e auditEntry) {
+	ctx := r.Context()
+	changes := auditDiff(e.Before, e.After, e.Secret)
+	raw, err := json.Marshal(changes)
+	if err != nil {
+		p.logger.Printf("encode audit changes for %s failed: %v", e.Action, err)
+		raw = []byte("{}")
+	}
+	accountID := e.AccountID
+	if accountID == "" {
+		accountID = store.DefaultAccountID
+	}
+	rec := store.AuditEventRecord{
+		CreatedAt:      time.Now().UTC(),
+		AccountID:      accountID,
+		ActorSessionID: sessionIDFromCtx(ctx),
+		ActorUserID:    userIDFromCtx(ctx),
+		ActorRole:      string(roleFromCtx(ctx)),
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		Changes:        string(raw),
+		IP:             p.clientIP(r),
+		UserAgent:      r.UserAgent(),
+	}
+	actor := ""
+	if acc := accountFromCtx(r); acc != nil {
+		rec.ActorAccountID = acc.ID
+		actor = acc.Name
+	}
+	if p.store != nil {
+		// 操作已经生效，客户端断开也必须落库。
+		sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := p.store.InsertAuditEvent(sctx, rec); err != nil {
+			p.logger.Printf("record audit event %s %s failed: %v", e.Action, e.TargetID, err)
+		}
+	}
+	if p.notifyMgr != nil {
+		fields := make([]string, 0, len(changes))
+		for k := range changes {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		p.notifyMgr.Publish(notify.Event{
+			AccountID: accountID,
+			EventType: notify.EventSecurityAudit,
+			Data: map[string]any{
+				"action":           e.Action,
+				"target_type":      e.TargetType,
+				"target_id":        e.TargetID,
+				"actor":            actor,
+				"actor_account_id": rec.ActorAccountID,
+				"actor_user_id":    rec.ActorUserID,
+				"actor_role":       rec.ActorRole,
+				"changed_fields":   strings.Join(fields, ", "),
+				"ip":               rec.IP,
+			},
+			OccurredAt: rec.CreatedAt,
+		})
+	}
+}
+
+// auditDiff 比较前后快照，返回发生变化的字段（已脱敏）。
+func auditDiff(before, after any, secret bool) map[string]auditChange {
+	b, a := auditFields(before), auditFields(after)
+	out := make(map[string]auditChange)
+	for k, bv := range b {
+		av, ok := a[k]
+		if ok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		out[k] = auditChange{Before: redactAuditValue(k, bv, secret && k == "value"), After: redactAuditValue(k, av, secret && k == "value")}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			out[k] = auditChange{After: redactAuditValue(k, av, secret && k == "value")}
+		}
+	}
+	return out
+}
+
+// auditFields 把快照按 JSON 展开为字段表，非对象值记为 value 字段。
+func auditFields(v any) map[string]any {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil
+	}
+	if m, ok := decoded.(map[string]any); ok {
+		return m
+	}
+	return map[string]any{"value": decoded}
+}
+
+// isSecretAuditKey 判断字段名是否为密钥类字段。
+func isSecretAuditKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "password" || key == "token" || key == "api_token" ||
+		strings.HasSuffix(key, "api_key") || strings.Contains(key, "secret")
+}
+
+// redactAuditValue 脱敏审计值：密钥字段与探针请求头只保留占位符，地址中的凭据被替换。
+func redactAuditValue(key string, v any, secret bool) any {
+	if v == nil {
+		return nil
+	}
+	if secret || isSecretAuditKey(key) {
+		if s, ok := v.(string); ok && s == "" {
+			return v
+		}
+		return secretMask
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = redactAuditValue(k, item, strings.EqualFold(key, "headers"))
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = redactAuditValue(key, item, false)
+		}
+		return out
+	case string:
+		if strings.Contains(val, "@") && strings.Contains(val, "://") {
+			if u, err := url.Parse(val); err == nil && u.User != nil {
+				return redactURLUserinfo(u)
+			}
+		}
+	}
+	return v
+}
+
+// nodeAuditState 节点的审计快照，节点不存在时返回 nil。
+func (p *Server) nodeAuditState(id string) map[string]any {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := p.nodeIndex[id]
+	if n == nil {
+		return nil
+	}
+	state := map[string]any{
+		"name":                n.Name,
+		"base_url":            n.URL.String(),
+		"api_key":             n.APIKey,
+		"weight":              n.Weight,
+		"health_check_method": n.HealthCheckMethod,
+		"health_check_model":  n.HealthCheckModel,
+		"supported_models":    n.SupportedModels,
+		"model_map":           n.ModelMap,
+		"health_probes":       n.HealthProbes,
+		"price_multiplier":    n.PriceMultiplier,
+		"disabled":            n.Disabled,
+	}
+	if acc := p.accountByID[n.AccountID]; acc != nil {
+		state["active"] = acc.ActiveID == id
+	}
+	return state
+}
+
+// accountAuditState 账号的审计快照。
+func (p *Server) accountAuditState(acc *Account) map[string]any {
+	if acc == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return map[string]any{
+		"name":                acc.Name,
+		"password":            acc.Password,
+		"proxy_api_key":       acc.ProxyAPIKey,
+		"is_admin":            acc.IsAdmin,
+		"lb_strategy":         acc.LBStrategy,
+		"client_cert_subject": acc.ClientCertSubject,
+		"quota":               acc.Quota,
+	}
+}
+
+// userAuditState 账号成员的审计快照。
+func userAuditState(u *store.UserRecord) map[string]any {
+	if u == nil {
+		return nil
+	}
+	return map[string]any{
+		"account_id": u.AccountID,
+		"username":   u.Username,
+		"password":   u.Password,
+		"role":       u.Role,
+		"disabled":   u.Disabled,
+	}
+}
+
+// configAuditState 账号运行参数的审计快照。
+func (p *Server) configAuditState(acc *Account) map[string]any {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return map[string]any{
+		"retries":             acc.Config.Retries,
+		"fail_limit":          acc.Config.FailLimit,
+		"health_interval_sec": int(acc.Config.HealthEvery.Seconds()),
+	}
+}
+
+// apiKeyAuditState API Key 的审计快照，不含明文与哈希。
+func (p *Server) apiKeyAuditState(k *APIKey) map[string]any {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return map[string]any{
+		"name":           k.Name,
+		"allowed_models": k.AllowedModels,
+		"expires_at":     k.ExpiresAt,
+		"revoked":        k.Revoked,
+	}
+}
+
+// sessionAuditState 会话的审计快照，不含 token。
+func sessionAuditState(sess *Session, revoked bool) map[string]any {
+	return map[string]any{
+		"user_id": sess.UserID,
+		"role":    sessionRole(sess),
+		"ip":      sess.IP,
+		"revoked": revoked,
+	}
+}
+
+// tunnelAuditState 隧道配置的审计快照。
+func tunnelAuditState(cfg *store.TunnelConfig) map[string]any {
+	return map[string]any{
+		"api_token": cfg.APIToken,
+		"subdomain": cfg.Subdomain,
+		"zone":      cfg.Zone,
+		"enabled":   cfg.Enabled,
+	}
+}
+
+// shareAuditState 监控分享的审计快照，分享 token 视为密钥。
+func shareAuditState(rec store.MonitorShareRecord) map[string]any {
+	state := map[string]any{
+		"token":      rec.Token,
+		"created_by": rec.CreatedBy,
+		"revoked":    rec.Revoked,
+	}
+	if !rec.ExpireAt.IsZero() {
+		state["expire_at"] = rec.ExpireAt
+	}
+	return state
+}
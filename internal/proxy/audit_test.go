@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"qcc_plus/internal/store"
+)
+
+func TestAuditDiffRedactsSecrets(t *testing.T) {
+	before := map[string]any{"name": "relay", "api_key": "sk-old", "base_url": "https://u:p@relay.example.com", "weight": 1}
+	after := map[string]any{"name": "relay", "api_key": "sk-new", "base_url": "https://u:q@relay.example.com", "weight": 2}
+	changes := auditDiff(before, after, false)
+	if _, ok := changes["name"]; ok || len(changes) != 3 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	if c := changes["api_key"]; c.Before != secretMask || c.After != secretMask {
+		t.Fatalf("api_key not redacted: %+v", c)
+	}
+	raw, _ := json.Marshal(changes)
+	if strings.Contains(string(raw), "sk-") || strings.Contains(string(raw), "u:p") {
+		t.Fatalf("secret leaked: %s", raw)
+	}
+
+	secret := auditDiff(map[string]any{"value": "a", "scope": "system"}, map[string]any{"value": "b", "scope": "system"}, true)
+	if c := secret["value"]; c.Before != secretMask || c.After != secretMask {
+		t.Fatalf("secret setting not redacted: %+v", secret)
+	}
+	if created := auditDiff(nil, "x", false); created["value"].After != "x" || created["value"].Before != nil {
+		t.Fatalf("create diff = %+v", created)
+	}
+}
+
+func TestAuditTrailForNodeChanges(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	h := srv.Handler()
+	acc := srv.defaultAccount
+	sess, err := srv.sessionMgr.CreateWithMeta(acc.ID, false, "", "")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.9:51000"
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodPost, "/admin/api/nodes", `{"name":"relay","base_url":"https://relay.example.com","api_key":"sk-first"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create node status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec := call(http.MethodPut, "/admin/api/nodes?id="+created.ID, `{"name":"relay","base_url":"https://relay.example.com","api_key":"sk-second","weight":5}`); rec.Code != http.StatusOK {
+		t.Fatalf("update node status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodPost, "/admin/api/nodes/disable", `{"id":"`+created.ID+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("disable node status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = call(http.MethodGet, "/admin/api/audit?target_type=node&target_id="+created.ID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("query audit status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "sk-first") || strings.Contains(rec.Body.String(), "sk-second") {
+		t.Fatalf("audit leaked api key: %s", rec.Body.String())
+	}
+	var resp struct {
+		Events []struct {
+			Action         string                 `json:"action"`
+			AccountID      string                 `json:"account_id"`
+			ActorAccountID string                 `json:"actor_account_id"`
+			ActorSessionID string                 `json:"actor_session_id"`
+			IP             string                 `json:"ip"`
+			Changes        map[string]auditChange `json:"changes"`
+		} `json:"events"`
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Total != 3 || len(resp.Events) != 3 {
+		t.Fatalf("events = %+v", resp)
+	}
+	// 按时间倒序：disable、update、create。
+	if resp.Events[0].Action != "node.disable" || resp.Events[1].Action != "node.update" || resp.Events[2].Action != "node.create" {
+		t.Fatalf("unexpected actions: %+v", resp.Events)
+	}
+	update := resp.Events[1]
+	if update.ActorAccountID != acc.ID || update.ActorSessionID != sess.ID || update.AccountID != acc.ID || update.IP != "203.0.113.9" {
+		t.Fatalf("unexpected actor: %+v", update)
+	}
+	if len(update.Changes) != 2 || update.Changes["api_key"].After != secretMask {
+		t.Fatalf("unexpected update diff: %+v", update.Changes)
+	}
+	if w := update.Changes["weight"]; w.Before != float64(1) || w.After != float64(5) {
+		t.Fatalf("unexpected weight diff: %+v", w)
+	}
+	if d := resp.Events[0].Changes["disabled"]; d.After != true {
+		t.Fatalf("unexpected disable diff: %+v", resp.Events[0].Changes)
+	}
+}
+
+func TestAuditRecordedAfterClientDisconnect(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/admin/api/nodes", nil).WithContext(ctx)
+	srv.audit(req, auditEntry{Action: "node.create", TargetType: "node", TargetID: "n1", After: map[string]any{"name": "n1"}})
+
+	_, total, err := st.QueryAuditEvents(context.Background(), store.AuditQuery{TargetID: "n1"})
+	if err != nil || total != 1 {
+		t.Fatalf("audit event not recorded: total=%d err=%v", total, err)
+	}
+}
+
+func TestAuditTrailForKeysSessionsAndImport(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	h := srv.Handler()
+	acc := srv.defaultAccount
+	sess, err := srv.sessionMgr.CreateWithMeta(acc.ID, true, "", "")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	other, err := srv.sessionMgr.CreateWithMeta(acc.ID, true, "", "")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sess.Token})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodPost, "/admin/api/keys?account_id="+acc.ID, `{"name":"ci","allowed_models":["claude-*"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec := call(http.MethodDelete, "/admin/api/keys?id="+created.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke key status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodDelete, "/admin/api/sessions?id="+other.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke session status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	bundle := `{"format":"qcc_plus-backup","version":1,"accounts":[{"id":"default","name":"default","proxy_api_key":"test-proxy","is_admin":true}]}`
+	if rec := call(http.MethodPost, "/admin/api/backup/import?mode=merge&dry_run=true", bundle); rec.Code != http.StatusOK {
+		t.Fatalf("dry run status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := call(http.MethodPost, "/admin/api/backup/import?mode=merge", bundle); rec.Code != http.StatusOK {
+		t.Fatalf("import status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	events, total, err := st.QueryAuditEvents(context.Background(), store.AuditQuery{})
+	if err != nil || total != 4 {
+		t.Fatalf("events total=%d err=%v: %+v", total, err, events)
+	}
+	byAction := make(map[string]store.AuditEventRecord)
+	for _, e := range events {
+		byAction[e.Action] = e
+		if strings.Contains(e.Changes, created.Key) || strings.Contains(e.Changes, other.Token) {
+			t.Fatalf("audit leaked secret: %+v", e)
+		}
+	}
+	if e, ok := byAction["api_key.create"]; !ok || e.TargetID != created.ID || !strings.Contains(e.Changes, "claude-*") || !strings.Contains(e.Changes, `"ci"`) {
+		t.Fatalf("unexpected key create event: %+v", e)
+	}
+	if e, ok := byAction["api_key.revoke"]; !ok || !strings.Contains(e.Changes, `"revoked":{"before":false,"after":true}`) {
+		t.Fatalf("unexpected key revoke event: %+v", e)
+	}
+	if e, ok := byAction["session.revoke"]; !ok || e.TargetID != other.ID || e.ActorSessionID != sess.ID {
+		t.Fatalf("unexpected session event: %+v", e)
+	}
+	if e, ok := byAction["backup.import"]; !ok || !strings.Contains(e.Changes, `"merge"`) || !strings.Contains(e.Changes, `"summary"`) {
+		t.Fatalf("unexpected import event: %+v", e)
+	}
+}
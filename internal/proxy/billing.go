@@ -0,0 +1,417 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const (
+	// settingModelPrices 模型价格表（系统配置，object）：模型名 → ModelPrice，键支持 * 后缀通配。
+	settingModelPrices = "billing.model_prices"
+	// maxPriceMultiplier 节点计费倍率上限，防止误填导致费用失真。
+	maxPriceMultiplier = 100
+	// defaultCostReportDays 未指定 from 时费用报表覆盖的天数（含当天）。
+	defaultCostReportDays = 30
+	// maxCostReportDays 单次费用报表最多覆盖的天数。
+	maxCostReportDays = 366
+)
+
+// ModelPrice 模型单价（美元/百万 token）。CacheWrite/CacheRead 为 0 时分别按 Input 的 1.25 倍与 0.1 倍计算。
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+	CacheRead  float64 `json:"cache_read,omitempty"`
+}
+
+// cost 计算一次请求的费用（美元，未乘节点倍率）。
+func (mp ModelPrice) cost(u *usage) float64 {
+	cacheWrite := mp.CacheWrite
+	if cacheWrite == 0 {
+		cacheWrite = mp.Input * 1.25
+	}
+	cacheRead := mp.CacheRead
+	if cacheRead == 0 {
+		cacheRead = mp.Input * 0.1
+	}
+	return (float64(u.input)*mp.Input + float64(u.output)*mp.Output +
+		float64(u.cacheCreation)*cacheWrite + float64(u.cacheRead)*cacheRead) / 1e6
+}
+
+// modelPrices 读取系统配置 billing.model_prices；未配置或格式错误时返回空表（费用记为 0）。
+func (p *Server) modelPrices() map[string]ModelPrice {
+	if p.settingsCache == nil {
+		return nil
+	}
+	raw, ok := p.settingsCache.Get(settingModelPrices)
+	if !ok || raw == nil {
+		return nil
+	}
+	body, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(body, &prices); err != nil {
+		p.logger.Printf("ignore invalid %s: %v", settingModelPrices, err)
+		return nil
+	}
+	return prices
+}
+
+// lookupModelPrice 精确匹配优先，其次取前缀最长的通配规则，与节点模型映射的匹配方式一致。
+func lookupModelPrice(prices map[string]ModelPrice, model string) (ModelPrice, bool) {
+	if model == "" || len(prices) == 0 {
+		return ModelPrice{}, false
+	}
+	if mp, ok := prices[model]; ok {
+		return mp, true
+	}
+	var (
+		best    ModelPrice
+		bestLen = -1
+	)
+	for pattern, mp := range prices {
+		if strings.HasSuffix(pattern, "*") && matchModelPattern(pattern, model) && len(pattern) > bestLen {
+			best, bestLen = mp, len(pattern)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// priceMultiplier 返回节点计费倍率，未设置时为 1。调用方需持有 p.mu 读锁。
+func (n *Node) priceMultiplier() float64 {
+	if n.PriceMultiplier <= 0 {
+		return 1
+	}
+	return n.PriceMultiplier
+}
+
+// validatePriceMultiplier 校验节点计费倍率，0 表示恢复默认值 1。
+func validatePriceMultiplier(v float64) error {
+	if math.IsNaN(v) || v < 0 || v > maxPriceMultiplier {
+		return fmt.Errorf("price_multiplier must be between 0 and %d", maxPriceMultiplier)
+	}
+	return nil
+}
+
+// setNodePriceMultiplier 更新节点计费倍率，nil 表示保持不变。
+func (p *Server) setNodePriceMultiplier(id string, v *float64) error {
+	if v == nil {
+		return nil
+	}
+	if err := validatePriceMultiplier(*v); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	n, ok := p.nodeIndex[id]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	n.PriceMultiplier = *v
+	rec := toRecord(n)
+	p.mu.Unlock()
+
+	if p.store != nil {
+		return p.store.UpsertNode(context.Background(), rec)
+	}
+	return nil
+}
+
+// recordModelUsage 按模型累计用量与费用。model 为客户端请求的模型名，缺省时使用上游响应中的模型名。
+// 失败且无 token 消耗的请求不计入。
+func (p *Server) recordModelUsage(acc *Account, key *APIKey, node *Node, model string, u *usage, failed bool) {
+	if p.store == nil || acc == nil || node == nil || u == nil {
+		return
+	}
+	if failed && u.input == 0 && u.output == 0 && u.cacheCreation == 0 && u.cacheRead == 0 {
+		return
+	}
+	if model == "" {
+		model = u.model
+	}
+	p.mu.RLock()
+	multiplier := node.priceMultiplier()
+	p.mu.RUnlock()
+	var cost float64
+	if mp, ok := lookupModelPrice(p.modelPrices(), model); ok {
+		cost = mp.cost(u) * multiplier
+	}
+	rec := store.ModelUsageRecord{
+		Day:                 timeutil.NowBeijing().Format("2006-01-02"),
+		AccountID:           acc.ID,
+		NodeID:              node.ID,
+		APIKeyID:            apiKeyID(key),
+		Model:               model,
+		InputTokens:         u.input,
+		OutputTokens:        u.output,
+		CacheCreationTokens: u.cacheCreation,
+		CacheReadTokens:     u.cacheRead,
+		CostUSD:             cost,
+	}
+	if !failed {
+		rec.Requests = 1
+	}
+	if err := p.store.AddModelUsage(context.Background(), rec); err != nil {
+		p.logger.Printf("record model usage for account %s failed: %v", acc.ID, err)
+	}
+}
+
+// costGroupDims 费用报表支持的分组维度。
+var costGroupDims = map[string]bool{"day": true, "model": true, "api_key": true, "node": true, "account": true}
+
+// costReportRow 费用报表中的一行；未参与分组的维度为空。
+type costReportRow struct {
+	Day                 string  `json:"day,omitempty"`
+	AccountID           string  `json:"account_id,omitempty"`
+	NodeID              string  `json:"node_id,omitempty"`
+	NodeName            string  `json:"node_name,omitempty"`
+	APIKeyID            *string `json:"api_key_id,omitempty"` // 分组时账号主密钥为空串
+	APIKeyName          string  `json:"api_key_name,omitempty"`
+	Model               *string `json:"model,omitempty"`
+	Requests            int64   `json:"requests"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CostUSD             float64 `json:"cost_usd"`
+}
+
+func (r *costReportRow) add(rec store.ModelUsageRecord) {
+	r.Requests += rec.Requests
+	r.InputTokens += rec.InputTokens
+	r.OutputTokens += rec.OutputTokens
+	r.CacheCreationTokens += rec.CacheCreationTokens
+	r.CacheReadTokens += rec.CacheReadTokens
+	r.CostUSD += rec.CostUSD
+}
+
+// buildCostReport 按 groupBy 维度汇总逐日明细，结果按维度值排序。
+func buildCostReport(records []store.ModelUsageRecord, groupBy []string) (rows []*costReportRow, total costReportRow) {
+	dims := make(map[string]bool, len(groupBy))
+	for _, d := range groupBy {
+		dims[d] = true
+	}
+	index := make(map[string]*costReportRow)
+	var keys []string
+	for _, rec := range records {
+		total.add(rec)
+		var (
+			row   costReportRow
+			parts []string
+		)
+		if dims["day"] {
+			row.Day = rec.Day
+			parts = append(parts, rec.Day)
+		}
+		if dims["account"] {
+			row.AccountID = rec.AccountID
+			parts = append(parts, rec.AccountID)
+		}
+		if dims["node"] {
+			row.NodeID = rec.NodeID
+			parts = append(parts, rec.NodeID)
+		}
+		if dims["api_key"] {
+			id := rec.APIKeyID
+			row.APIKeyID = &id
+			parts = append(parts, id)
+		}
+		if dims["model"] {
+			m := rec.Model
+			row.Model = &m
+			parts = append(parts, m)
+		}
+		k := strings.Join(parts, "\x00")
+		cur := index[k]
+		if cur == nil {
+			cur = &row
+			index[k] = cur
+			keys = append(keys, k)
+		}
+		cur.add(rec)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rows = append(rows, index[k])
+	}
+	total.CostUSD = roundCost(total.CostUSD)
+	for _, r := range rows {
+		r.CostUSD = roundCost(r.CostUSD)
+	}
+	return rows, total
+}
+
+// roundCost 费用保留 6 位小数，避免浮点累加误差暴露在报表中。
+func roundCost(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// parseCostReportParams 解析 from/to（北京时间 YYYY-MM-DD，闭区间）、group_by 与过滤条件。
+func parseCostReportParams(r *http.Request) (store.ModelUsageQuery, []string, error) {
+	qv := r.URL.Query()
+	q := store.ModelUsageQuery{
+		NodeID:   strings.TrimSpace(qv.Get("node_id")),
+		APIKeyID: strings.TrimSpace(qv.Get("api_key_id")),
+		Model:    strings.TrimSpace(qv.Get("model")),
+	}
+	today := timeutil.NowBeijing()
+	to := today
+	if v := strings.TrimSpace(qv.Get("to")); v != "" {
+		t, err := timeutil.ParseBeijingTime("2006-01-02", v)
+		if err != nil {
+			return q, nil, fmt.Errorf("invalid to, expect YYYY-MM-DD")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(defaultCostReportDays - 1))
+	if v := strings.TrimSpace(qv.Get("from")); v != "" {
+		t, err := timeutil.ParseBeijingTime("2006-01-02", v)
+		if err != nil {
+			return q, nil, fmt.Errorf("invalid from, expect YYYY-MM-DD")
+		}
+		from = t
+	}
+	if from.After(to) {
+		return q, nil, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) > maxCostReportDays*24*time.Hour {
+		return q, nil, fmt.Errorf("date range must not exceed %d days", maxCostReportDays)
+	}
+	q.FromDay = from.Format("2006-01-02")
+	q.ToDay = to.Format("2006-01-02")
+
+	groupBy := []string{"day", "model"}
+	if v := strings.TrimSpace(qv.Get("group_by")); v != "" {
+		groupBy = groupBy[:0]
+		seen := make(map[string]bool)
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d == "" || seen[d] {
+				continue
+			}
+			if !costGroupDims[d] {
+				return q, nil, fmt.Errorf("unsupported group_by %q, available: account, api_key, day, model, node", d)
+			}
+			seen[d] = true
+			groupBy = append(groupBy, d)
+		}
+	}
+	return q, groupBy, nil
+}
+
+// handleAccountCosts 处理 GET /api/accounts/:id/costs，返回账号按模型/Key/节点/日期汇总的用量与费用。
+func (p *Server) handleAccountCosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	accountID, ok := extractAccountIDFromPath(r.URL.Path, "/costs")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	caller := accountFromCtx(r)
+	if caller == nil {
+		respondJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	if !isAdmin(r.Context()) && caller.ID != accountID {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	p.writeCostReport(w, r, accountID)
+}
+
+// handleCostReport 处理 GET /api/metrics/costs（仅管理员），可跨账号汇总，支持 account_id 过滤。
+func (p *Server) handleCostReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !hasPermission(r.Context(), PermSystem) {
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+	p.writeCostReport(w, r, strings.TrimSpace(r.URL.Query().Get("account_id")))
+}
+
+func (p *Server) writeCostReport(w http.ResponseWriter, r *http.Request, accountID string) {
+	if p.store == nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": "metrics store not enabled"})
+		return
+	}
+	q, groupBy, err := parseCostReportParams(r)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	q.AccountID = accountID
+	records, err := p.store.QueryModelUsage(r.Context(), q)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	rows, total := buildCostReport(records, groupBy)
+
+	// 补充节点与 Key 名称，便于报表展示。
+	p.mu.RLock()
+	keyNames := make(map[string]string, len(p.apiKeys))
+	for _, k := range p.apiKeys {
+		keyNames[k.ID] = k.Name
+	}
+	for _, row := range rows {
+		if n := p.nodeIndex[row.NodeID]; row.NodeID != "" && n != nil {
+			row.NodeName = n.Name
+		}
+		if row.APIKeyID != nil {
+			row.APIKeyName = keyNames[*row.APIKeyID]
+		}
+	}
+	p.mu.RUnlock()
+
+	if rows == nil {
+		rows = []*costReportRow{}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"items":    rows,
+		"total":    total,
+		"group_by": groupBy,
+		"from":     q.FromDay,
+		"to":       q.ToDay,
+		"currency": "USD",
+	})
+}
+
+// todayCosts 返回账号当天（北京时间）按节点汇总的费用及合计，存储未启用或查询失败时返回 nil。
+func (p *Server) todayCosts(ctx context.Context, accountID string) (map[string]float64, float64) {
+	if p.store == nil {
+		return nil, 0
+	}
+	day := timeutil.NowBeijing().Format("2006-01-02")
+	records, err := p.store.QueryModelUsage(ctx, store.ModelUsageQuery{AccountID: accountID, FromDay: day, ToDay: day})
+	if err != nil {
+		p.logger.Printf("query today costs for account %s failed: %v", accountID, err)
+		return nil, 0
+	}
+	byNode := make(map[string]float64)
+	var total float64
+	for _, rec := range records {
+		byNode[rec.NodeID] += rec.CostUSD
+		total += rec.CostUSD
+	}
+	for id, v := range byNode {
+		byNode[id] = roundCost(v)
+	}
+	return byNode, roundCost(total)
+}
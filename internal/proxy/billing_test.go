@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"qcc_plus/internal/store"
+)
+
+func TestParseUsageMergesStreamEvents(t *testing.T) {
+	sse := []byte("event: message_start\n" +
+		`data: {"type":"message_start","message":{"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":10,"cache_creation_input_tokens":100,"cache_read_input_tokens":200,"output_tokens":1}}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":50}}` + "\n\n")
+	u := parseUsage(sse)
+	if u.input != 10 || u.output != 50 || u.cacheCreation != 100 || u.cacheRead != 200 || u.model != "claude-sonnet-4-5-20250929" {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+
+	prices := map[string]ModelPrice{
+		"claude-sonnet-4*":   {Input: 3, Output: 15},
+		"claude-sonnet-4-5*": {Input: 2, Output: 10, CacheRead: 0.5},
+		"claude-opus-4-5":    {Input: 5, Output: 25},
+	}
+	mp, ok := lookupModelPrice(prices, u.model)
+	if !ok || mp.Input != 2 {
+		t.Fatalf("longest prefix should win: %+v %v", mp, ok)
+	}
+	// 10*2 + 50*10 + 100*2.5 + 200*0.5 = 870
+	if got := mp.cost(&u); math.Abs(got-870e-6) > 1e-12 {
+		t.Fatalf("unexpected cost %v", got)
+	}
+	if _, ok := lookupModelPrice(prices, "claude-opus-4-5-20251101"); ok {
+		t.Fatal("pattern without * should only match exactly")
+	}
+}
+
+func TestModelCostRecordedAndReported(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","model":"relay-sonnet","content":[],"usage":{"input_tokens":1000,"output_tokens":500,"cache_creation_input_tokens":2000,"cache_read_input_tokens":4000}}`))
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	srv.settingsCache = NewSettingsCache(st)
+	srv.settingsCache.UpdateLocal(settingModelPrices, map[string]any{
+		"claude-sonnet-4*": map[string]any{"input": float64(3), "output": float64(15)},
+	}, 0)
+
+	acc := srv.defaultAccount
+	nodeID := acc.ActiveID
+	multiplier := 2.0
+	if err := srv.setNodePriceMultiplier(nodeID, &multiplier); err != nil {
+		t.Fatalf("set multiplier: %v", err)
+	}
+	if bad := 101.0; srv.setNodePriceMultiplier(nodeID, &bad) == nil {
+		t.Fatal("multiplier above limit should be rejected")
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4-5","max_tokens":8,"messages":[]}`))
+		req.Header.Set("x-api-key", "test-proxy")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/accounts/"+acc.ID+"/costs?group_by=model,node", nil)
+	req = req.WithContext(context.WithValue(req.Context(), accountContextKey{}, acc))
+	rec := httptest.NewRecorder()
+	srv.handleAccountAPIRoutes(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("costs status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var report struct {
+		Items []costReportRow `json:"items"`
+		Total costReportRow   `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if len(report.Items) != 1 {
+		t.Fatalf("expected one row, got %+v", report.Items)
+	}
+	row := report.Items[0]
+	// 每次 (1000*3 + 500*15 + 2000*3.75 + 4000*0.3)/1e6 = 0.0192，乘倍率 2，共两次。
+	if row.Model == nil || *row.Model != "claude-sonnet-4-5" || row.NodeID != nodeID || row.Day != "" ||
+		row.Requests != 2 || row.CacheCreationTokens != 4000 || row.CacheReadTokens != 8000 || row.CostUSD != 0.0768 {
+		t.Fatalf("unexpected row: %+v", row)
+	}
+	if report.Total.CostUSD != 0.0768 || report.Total.InputTokens != 2000 {
+		t.Fatalf("unexpected total: %+v", report.Total)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/api/accounts/other/costs", nil)
+	other = other.WithContext(context.WithValue(other.Context(), accountContextKey{}, acc))
+	rec = httptest.NewRecorder()
+	srv.handleAccountAPIRoutes(rec, other)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin should not read other accounts, got %d", rec.Code)
+	}
+	bad := httptest.NewRequest(http.MethodGet, "/api/accounts/"+acc.ID+"/costs?group_by=team", nil)
+	bad = bad.WithContext(context.WithValue(bad.Context(), accountContextKey{}, acc))
+	rec = httptest.NewRecorder()
+	srv.handleAccountAPIRoutes(rec, bad)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown group_by should be rejected, got %d", rec.Code)
+	}
+}
@@ -2,8 +2,11 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -44,6 +47,10 @@ type Builder struct {
 	defaultAccountName        string
 	defaultProxyKey           string
 	cliRunner                 CliRunner
+	tlsCertFile               string
+	tlsKeyFile                string
+	tlsClientCAFile           string
+	tlsClientAuth             string
 }
 
 // NewBuilder 构建带默认监听地址和日志的 Builder。
@@ -224,7 +231,21 @@ func (b *Builder) WithDefaultAccount(name, proxyKey string) *Builder {
 	return b
 }
 
-// WithStoreDSN 传入 MySQL DSN 以启用持久化。
+// WithTLS 启用 TLS，证书与私钥文件变更后自动重新加载。
+func (b *Builder) WithTLS(certFile, keyFile string) *Builder {
+	b.tlsCertFile = certFile
+	b.tlsKeyFile = keyFile
+	return b
+}
+
+// WithClientCA 启用 mTLS：用 caFile 校验客户端证书，mode 为 none/optional/require（空表示 optional）。
+func (b *Builder) WithClientCA(caFile, mode string) *Builder {
+	b.tlsClientCAFile = caFile
+	b.tlsClientAuth = mode
+	return b
+}
+
+// WithStoreDSN 传入存储 DSN 以启用持久化（MySQL DSN 或 sqlite://path）。
 func (b *Builder) WithStoreDSN(dsn string) *Builder {
 	b.storeDSN = dsn
 	return b
@@ -278,6 +299,22 @@ func (b *Builder) Build() (*Server, error) {
 			logger.Printf("invalid METRICS_CLEANUP_INTERVAL=%s, fallback to %v", v, defaultCleanupInterval)
 		}
 	}
+	var metricsAllowNets []*net.IPNet
+	if v := os.Getenv("METRICS_ALLOW_IPS"); v != "" {
+		if nets, err := parseAllowList(v); err == nil {
+			metricsAllowNets = nets
+		} else {
+			logger.Printf("invalid METRICS_ALLOW_IPS=%s: %v", v, err)
+		}
+	}
+	var trustedProxies []*net.IPNet
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		if nets, err := parseAllowList(v); err == nil {
+			trustedProxies = nets
+		} else {
+			logger.Printf("invalid TRUSTED_PROXIES=%s: %v", v, err)
+		}
+	}
 	schedulerEnabled := true
 	if v := os.Getenv("METRICS_SCHEDULER_ENABLED"); v != "" {
 		schedulerEnabled = !(v == "0" || strings.EqualFold(v, "false") || strings.EqualFold(v, "off"))
@@ -332,7 +369,24 @@ func (b *Builder) Build() (*Server, error) {
 	healthRT := transport
 	transport = &retryTransport{base: transport, attempts: b.retries, logger: logger}
 
-	var st *store.Store
+	var tlsConfig *tls.Config
+	if b.tlsCertFile != "" || b.tlsKeyFile != "" {
+		if b.tlsCertFile == "" || b.tlsKeyFile == "" {
+			return nil, errors.New("tls requires both cert and key files")
+		}
+		certs, err := newCertReloader(b.tlsCertFile, b.tlsKeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err = buildTLSConfig(certs, b.tlsClientCAFile, b.tlsClientAuth)
+		if err != nil {
+			return nil, err
+		}
+	} else if b.tlsClientCAFile != "" {
+		return nil, errors.New("tls client CA requires tls cert and key files")
+	}
+
+	var st store.Store
 	if b.storeDSN != "" {
 		st, err = store.Open(b.storeDSN)
 		if err != nil {
@@ -375,6 +429,9 @@ func (b *Builder) Build() (*Server, error) {
 		accountByID:      make(map[string]*Account),
 		nodeIndex:        make(map[string]*Node),
 		nodeAccount:      make(map[string]*Account),
+		apiKeys:          make(map[string]*APIKey),
+		loginGuard:       newLoginGuard(),
+		passive:          newPassiveTracker(),
 		circuitBreakers:  make(map[string]*CircuitBreaker),
 		listenAddr:       b.listenAddr,
 		transport:        transport,
@@ -391,11 +448,22 @@ func (b *Builder) Build() (*Server, error) {
 		cbConfig:         loadCircuitBreakerConfig(),
 		warmupConfig:     loadWarmupConfig(),
 		warmupSem:        make(chan struct{}, warmupConcurrency),
+		prom:             newPromCollector(),
+		metricsAllowNets: metricsAllowNets,
+		trustedProxies:   trustedProxies,
+		tlsConfig:        tlsConfig,
+		loopStop:         make(chan struct{}),
+		shutdownDone:     make(chan struct{}),
 	}
 
 	if st != nil {
 		srv.settingsCache = NewSettingsCache(st)
+		if metricsScheduler != nil {
+			metricsScheduler.settings = srv.settingsCache
+		}
+		srv.sessionMgr = NewSessionManagerWithStore(defaultSessionTTL, NewDBSessionStore(st))
 	}
+	srv.quotas = newQuotaTracker(st, logger)
 
 	if healthAllInterval > 0 {
 		srv.healthScheduler = NewHealthScheduler(srv, healthAllInterval, healthCheckConcurrency, healthCheckConcurrencyCLI, logger)
@@ -464,7 +532,7 @@ func (b *Builder) Build() (*Server, error) {
 				record := store.AccountRecord{
 					ID:          acc.ID,
 					Name:        chooseNonEmpty(acc.Name, defaultAccountName),
-					Password:    chooseNonEmpty(acc.Password, "default123"),
+					Password:    passwordOrDefault(acc.Password, "default123"),
 					ProxyAPIKey: chooseNonEmpty(acc.ProxyAPIKey, defaultProxyKey),
 					IsAdmin:     acc.IsAdmin,
 				}
@@ -479,7 +547,7 @@ func (b *Builder) Build() (*Server, error) {
 				record := store.AccountRecord{
 					ID:          acc.ID,
 					Name:        chooseNonEmpty(acc.Name, "admin"),
-					Password:    chooseNonEmpty(acc.Password, "admin123"),
+					Password:    passwordOrDefault(acc.Password, "admin123"),
 					ProxyAPIKey: chooseNonEmpty(acc.ProxyAPIKey, adminKey),
 					IsAdmin:     true,
 				}
@@ -493,7 +561,7 @@ func (b *Builder) Build() (*Server, error) {
 			adminAccount := store.AccountRecord{
 				ID:          fmt.Sprintf("admin-%d", now.UnixNano()),
 				Name:        "admin",
-				Password:    "admin123",
+				Password:    mustHashPassword("admin123"),
 				ProxyAPIKey: adminKey,
 				IsAdmin:     true,
 				CreatedAt:   now,
@@ -509,6 +577,9 @@ func (b *Builder) Build() (*Server, error) {
 		if err := srv.loadAccountsFromStore(parsed, defaultCfg, b.upstreamKey); err != nil {
 			return nil, err
 		}
+		if err := srv.loadAPIKeysFromStore(context.Background()); err != nil {
+			return nil, err
+		}
 	} else {
 		// 内存模式：创建管理员与默认账号，并附加默认节点。
 		adminAccount := &Account{
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/timeutil"
+)
+
+// digestTopNodes 摘要中列出的节点数（按请求数降序）。
+const digestTopNodes = 5
+
+// digestLoop 每个整点发布各账号上一小时的运行摘要，北京时间 0 点额外发布前一日摘要。
+// 只有订阅了 account.digest_hourly / account.digest_daily 的渠道会收到消息。
+func (p *Server) digestLoop() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Hour).Add(time.Hour)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-p.loopStop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		p.publishDigests(next)
+	}
+}
+
+func (p *Server) publishDigests(end time.Time) {
+	if p.notifyMgr == nil || p.store == nil {
+		return
+	}
+	daily := timeutil.ToBeijingTime(end).Hour() == 0
+	p.mu.RLock()
+	accounts := make([]*Account, 0, len(p.accountByID))
+	for _, acc := range p.accountByID {
+		accounts = append(accounts, acc)
+	}
+	p.mu.RUnlock()
+
+	for _, acc := range accounts {
+		p.publishDigest(acc, notify.EventAccountDigestHourly, "hour", end.Add(-time.Hour), end)
+		if daily {
+			p.publishDigest(acc, notify.EventAccountDigestDaily, "day", end.Add(-24*time.Hour), end)
+		}
+	}
+}
+
+func (p *Server) publishDigest(acc *Account, eventType, period string, from, to time.Time) {
+	data, err := p.buildDigestData(context.Background(), acc, period, from, to)
+	if err != nil {
+		p.logger.Printf("build %s digest for account %s failed: %v", period, acc.ID, err)
+		return
+	}
+	p.notifyMgr.Publish(notify.Event{
+		AccountID:  acc.ID,
+		EventType:  eventType,
+		Data:       data,
+		DedupKey:   period + ":" + from.UTC().Format(time.RFC3339),
+		OccurredAt: to,
+	})
+}
+
+// buildDigestData 汇总 [from, to) 内的请求指标与当前节点健康状态，字段见 notify 内置摘要模板。
+func (p *Server) buildDigestData(ctx context.Context, acc *Account, period string, from, to time.Time) (map[string]any, error) {
+	recs, err := p.store.SummarizeMetrics(ctx, acc.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	names := make(map[string]string, len(acc.Nodes))
+	healthy := 0
+	unhealthy := []string{}
+	for id, n := range acc.Nodes {
+		names[id] = n.Name
+		switch {
+		case n.Disabled:
+		case n.Failed:
+			unhealthy = append(unhealthy, n.Name)
+		default:
+			healthy++
+		}
+	}
+	nodesTotal := len(acc.Nodes)
+	p.mu.RUnlock()
+	sort.Strings(unhealthy)
+
+	var requests, success, failed, latencySum, latencyCount, inputTokens, outputTokens int64
+	for _, r := range recs {
+		requests += r.RequestsTotal
+		success += r.RequestsSuccess
+		failed += r.RequestsFailed
+		latencySum += r.ResponseTimeSumMs
+		latencyCount += r.ResponseTimeCount
+		inputTokens += r.InputTokensTotal
+		outputTokens += r.OutputTokensTotal
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].RequestsTotal > recs[j].RequestsTotal })
+	if len(recs) > digestTopNodes {
+		recs = recs[:digestTopNodes]
+	}
+	nodes := make([]map[string]any, 0, len(recs))
+	for _, r := range recs {
+		name := names[r.NodeID]
+		if name == "" {
+			name = r.NodeID
+		}
+		nodes = append(nodes, map[string]any{
+			"node_id":        r.NodeID,
+			"name":           name,
+			"requests":       r.RequestsTotal,
+			"failed":         r.RequestsFailed,
+			"avg_latency_ms": int64(math.Round(safeDiv(r.ResponseTimeSumMs, r.ResponseTimeCount))),
+		})
+	}
+
+	successRate := 100.0
+	if requests > 0 {
+		successRate = float64(success) * 100 / float64(requests)
+	}
+	return map[string]any{
+		"account_name":    acc.Name,
+		"period":          period,
+		"from":            from,
+		"to":              to,
+		"requests":        requests,
+		"success":         success,
+		"failed":          failed,
+		"success_rate":    successRate,
+		"avg_latency_ms":  int64(math.Round(safeDiv(latencySum, latencyCount))),
+		"input_tokens":    inputTokens,
+		"output_tokens":   outputTokens,
+		"nodes_total":     nodesTotal,
+		"nodes_healthy":   healthy,
+		"unhealthy_nodes": unhealthy,
+		"nodes":           nodes,
+	}, nil
+}
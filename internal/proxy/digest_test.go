@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+func TestBuildDigestData(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+
+	acc := srv.defaultAccount
+	var node *Node
+	for _, n := range acc.Nodes {
+		node = n
+	}
+	if node == nil {
+		t.Fatal("default account has no node")
+	}
+	ctx := context.Background()
+	end := time.Now().UTC().Truncate(time.Hour)
+	for _, rec := range []store.MetricsRecord{
+		{AccountID: acc.ID, NodeID: node.ID, Timestamp: end.Add(-30 * time.Minute), RequestsTotal: 3, RequestsFailed: 1, ResponseTimeSumMs: 300, InputTokensTotal: 7},
+		{AccountID: acc.ID, NodeID: node.ID, Timestamp: end.Add(-2 * time.Hour), RequestsTotal: 5},
+	} {
+		if err := st.InsertMetrics(ctx, rec); err != nil {
+			t.Fatalf("insert metrics: %v", err)
+		}
+	}
+	srv.mu.Lock()
+	node.Failed = true
+	srv.mu.Unlock()
+
+	data, err := srv.buildDigestData(ctx, acc, "hour", end.Add(-time.Hour), end)
+	if err != nil {
+		t.Fatalf("build digest: %v", err)
+	}
+	if data["requests"] != int64(3) || data["failed"] != int64(1) || data["avg_latency_ms"] != int64(100) || data["input_tokens"] != int64(7) {
+		t.Fatalf("unexpected totals: %+v", data)
+	}
+	if rate := data["success_rate"].(float64); rate < 66.6 || rate > 66.7 {
+		t.Fatalf("unexpected success rate %v", rate)
+	}
+	unhealthy := data["unhealthy_nodes"].([]string)
+	nodes := data["nodes"].([]map[string]any)
+	if data["nodes_healthy"] != 0 || len(unhealthy) != 1 || unhealthy[0] != node.Name || len(nodes) != 1 || nodes[0]["name"] != node.Name {
+		t.Fatalf("unexpected node summary: %+v", data)
+	}
+}
@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 平滑重启时父进程通过环境变量告知子进程继承的文件描述符编号。
+const (
+	envInheritListenerFD = "PROXY_INHERIT_LISTENER_FD"
+	envHandoffReadyFD    = "PROXY_HANDOFF_READY_FD"
+	// handoffReadyTimeout 等待新进程开始接受连接的最长时间，超时则放弃交接继续服务。
+	handoffReadyTimeout = 60 * time.Second
+)
+
+// listen 优先复用父进程交接过来的监听 socket，否则按 listenAddr 新建监听。
+func (p *Server) listen() (net.Listener, error) {
+	if v := os.Getenv(envInheritListenerFD); v != "" {
+		os.Unsetenv(envInheritListenerFD)
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s=%q: %w", envInheritListenerFD, v, err)
+		}
+		f := os.NewFile(uintptr(fd), "inherited-listener")
+		ln, err := net.FileListener(f)
+		f.Close() // FileListener 已复制描述符
+		if err != nil {
+			return nil, fmt.Errorf("inherit listener: %w", err)
+		}
+		p.logger.Printf("inherited listener on %s from parent process", ln.Addr())
+		return ln, nil
+	}
+	return net.Listen("tcp", p.listenAddr)
+}
+
+// signalHandoffReady 在开始接受连接前通知父进程可以退出；非交接启动时为空操作。
+func signalHandoffReady(logger *log.Logger) {
+	v := os.Getenv(envHandoffReadyFD)
+	if v == "" {
+		return
+	}
+	os.Unsetenv(envHandoffReadyFD)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Printf("invalid %s=%q: %v", envHandoffReadyFD, v, err)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "handoff-ready")
+	if _, err := f.Write([]byte{1}); err != nil {
+		logger.Printf("signal handoff ready failed: %v", err)
+	}
+	f.Close()
+}
+
+// Handoff 以相同参数启动新进程并把监听 socket 交给它，新进程开始接受连接后返回。
+// 调用方随后应执行 Shutdown 排空本进程的请求；失败时新进程已被终止，本进程可继续服务。
+func (p *Server) Handoff() error {
+	p.serveMu.Lock()
+	ln := p.listener
+	p.serveMu.Unlock()
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok {
+		return errors.New("handoff requires a running TCP listener")
+	}
+	lnFile, err := tcpLn.File()
+	if err != nil {
+		return fmt.Errorf("dup listener: %w", err)
+	}
+	defer lnFile.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("resolve executable: %w", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles[i] 在子进程中的描述符为 3+i。
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	cmd.Env = append(handoffEnv(os.Environ()), envInheritListenerFD+"=3", envHandoffReadyFD+"=4")
+	if err := cmd.Start(); err != nil {
+		readyW.Close()
+		return fmt.Errorf("start new process: %w", err)
+	}
+	readyW.Close()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(handoffReadyTimeout):
+		err = errors.New("timed out waiting for new process")
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("handoff: %w", err)
+	}
+
+	p.handedOff.Store(true)
+	p.logger.Printf("listener handed off to new process pid=%d", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+// handoffEnv 去掉继承下来的交接变量，避免新进程误用。
+func handoffEnv(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envInheritListenerFD+"=") || strings.HasPrefix(kv, envHandoffReadyFD+"=") {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+// Shutdown 优雅关闭：停止接受新连接，等待进行中的请求（含流式响应）完成，
+// 向 WebSocket 客户端发送关闭帧，停止后台任务、隧道与通知并关闭存储。
+// ctx 到期后强制断开剩余连接。多次调用只执行一次。
+func (p *Server) Shutdown(ctx context.Context) error {
+	var shutdownErr error
+	p.shutdownOnce.Do(func() {
+		defer func() {
+			if p.shutdownDone != nil {
+				close(p.shutdownDone)
+			}
+		}()
+		p.draining.Store(true)
+
+		p.serveMu.Lock()
+		server := p.httpServer
+		p.serveMu.Unlock()
+		if server != nil {
+			if err := server.Shutdown(ctx); err != nil {
+				p.logger.Printf("graceful shutdown interrupted with %d requests in flight: %v", p.inflight.Load(), err)
+				_ = server.Close()
+				shutdownErr = err
+			}
+		}
+
+		p.waitBackground(ctx)
+
+		if p.wsHub != nil {
+			p.wsHub.Close(ctx)
+		}
+
+		p.tunnelMu.Lock()
+		mgr := p.tunnelMgr
+		p.tunnelMgr = nil
+		p.tunnelMu.Unlock()
+		if mgr != nil {
+			var err error
+			if p.handedOff.Load() {
+				err = mgr.Handover()
+			} else {
+				err = mgr.Stop()
+			}
+			if err != nil {
+				p.logger.Printf("stop tunnel on shutdown: %v", err)
+			}
+		}
+
+		if p.loopStop != nil {
+			close(p.loopStop)
+		}
+		p.Stop()
+		if p.notifyMgr != nil {
+			p.notifyMgr.Stop()
+		}
+		if p.store != nil {
+			if err := p.store.Close(); err != nil {
+				p.logger.Printf("close store: %v", err)
+			}
+		}
+		p.logger.Printf("proxy shut down")
+	})
+	return shutdownErr
+}
+
+// goBackground 异步执行需要在关闭前完成的写入；关闭开始后改为同步执行。
+func (p *Server) goBackground(fn func()) {
+	p.bgMu.Lock()
+	if p.bgClosed {
+		p.bgMu.Unlock()
+		fn()
+		return
+	}
+	p.bgWg.Add(1)
+	p.bgMu.Unlock()
+	go func() {
+		defer p.bgWg.Done()
+		fn()
+	}()
+}
+
+// waitBackground 停止登记新的异步写入并等待已有写入完成或 ctx 到期。
+func (p *Server) waitBackground(ctx context.Context) {
+	p.bgMu.Lock()
+	p.bgClosed = true
+	p.bgMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		p.bgWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.logger.Printf("shutdown: background writes still pending: %v", ctx.Err())
+	}
+}
+
+// rejectIfDraining 关闭过程中拒绝新的代理请求，提示客户端重试到其他实例。
+func (p *Server) rejectIfDraining(w http.ResponseWriter) bool {
+	if !p.draining.Load() {
+		return false
+	}
+	w.Header().Set("Connection", "close")
+	writeAnthropicError(w, http.StatusServiceUnavailable, "overloaded_error", "Proxy is shutting down, please retry.")
+	return true
+}
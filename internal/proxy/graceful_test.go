@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdownDrainsStreamsAndClosesWebSockets(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "event: message_start\ndata: {}\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = io.WriteString(w, "event: message_stop\ndata: {}\n\n")
+	}))
+	defer upstream.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	srv := buildServerNoWarmup(t, NewBuilder().
+		WithUpstream(upstream.URL).
+		WithAPIKey("test-proxy").
+		WithListenAddr("127.0.0.1:0"))
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start() }()
+
+	var addr string
+	deadline := time.Now().Add(5 * time.Second)
+	for addr == "" {
+		srv.serveMu.Lock()
+		if srv.listener != nil {
+			addr = srv.listener.Addr().String()
+		}
+		srv.serveMu.Unlock()
+		if addr == "" {
+			if time.Now().After(deadline) {
+				t.Fatalf("server did not start listening")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// WebSocket 监控连接。
+	sess := srv.sessionMgr.Create(srv.defaultAccount.ID, true)
+	if sess == nil {
+		t.Fatalf("create session failed")
+	}
+	header := http.Header{}
+	header.Set("Cookie", "session_token="+sess.Token)
+	wsConn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/api/monitor/ws", header)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer wsConn.Close()
+
+	// 进行中的流式请求。
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/v1/messages", strings.NewReader(`{"model":"claude-3","stream":true}`))
+	req.Header.Set("x-api-key", "test-proxy")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, "message_start") {
+		t.Fatalf("first event = %q, %v", line, err)
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	// 关闭期间新请求被拒绝（监听已关闭或返回 503）。
+	deadline = time.Now().Add(5 * time.Second)
+	for !srv.draining.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("server not draining")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "overloaded_error") {
+		t.Fatalf("draining response = %d %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before stream finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	rest, err := io.ReadAll(reader)
+	if err != nil || !strings.Contains(string(rest), "message_stop") {
+		t.Fatalf("stream tail = %q, %v", rest, err)
+	}
+
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Fatalf("shutdown: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("shutdown did not finish")
+	}
+	select {
+	case err := <-startErr:
+		if err != nil {
+			t.Fatalf("start returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("start did not return after shutdown")
+	}
+
+	_ = wsConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := wsConn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+			t.Fatalf("websocket close = %v, want 1001", err)
+		}
+		break
+	}
+}
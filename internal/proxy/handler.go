@@ -3,6 +3,7 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"qcc_plus/internal/version"
@@ -67,36 +69,50 @@ func (p *Server) handler() http.Handler {
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/login", p.handleLogin)
 	apiMux.HandleFunc("/logout", p.handleLogout)
-	apiMux.HandleFunc("/admin/api/accounts", p.requireSession(p.handleAccounts))
-	apiMux.HandleFunc("/admin/api/nodes", p.requireSession(p.handleNodes))
-	apiMux.HandleFunc("/admin/api/config", p.requireSession(p.handleConfig))
-	apiMux.HandleFunc("/admin/api/nodes/activate", p.requireSession(p.handleActivate))
-	apiMux.HandleFunc("/admin/api/nodes/disable", p.requireSession(p.handleDisable))
-	apiMux.HandleFunc("/admin/api/nodes/enable", p.requireSession(p.handleEnable))
-	apiMux.HandleFunc("/admin/api/tunnel", p.requireSession(p.handleTunnelConfig))
-	apiMux.HandleFunc("/admin/api/tunnel/start", p.requireSession(p.handleTunnelStart))
-	apiMux.HandleFunc("/admin/api/tunnel/stop", p.requireSession(p.handleTunnelStop))
-	apiMux.HandleFunc("/admin/api/tunnel/zones", p.requireSession(p.handleTunnelZones))
-	apiMux.HandleFunc("/api/notification/channels", p.requireSession(p.handleNotificationChannels))
-	apiMux.HandleFunc("/api/notification/channels/", p.requireSession(p.handleNotificationChannelByID))
-	apiMux.HandleFunc("/api/notification/subscriptions", p.requireSession(p.handleNotificationSubscriptions))
-	apiMux.HandleFunc("/api/notification/subscriptions/", p.requireSession(p.handleNotificationSubscriptionByID))
-	apiMux.HandleFunc("/api/notification/event-types", p.requireSession(p.listEventTypes))
-	apiMux.HandleFunc("/api/notification/test", p.requireSession(p.testNotification))
-	apiMux.HandleFunc("/api/nodes/", p.requireSession(p.handleNodeAPIRoutes))
-	apiMux.HandleFunc("/api/accounts/", p.requireSession(p.handleGetAccountMetrics))
-	apiMux.HandleFunc("/api/metrics/aggregate", p.requireSession(p.handleAggregateMetrics))
-	apiMux.HandleFunc("/api/metrics/cleanup", p.requireSession(p.handleCleanupMetrics))
-	apiMux.HandleFunc("/api/monitor/dashboard", p.requireSession(p.handleMonitorDashboard))
-	apiMux.HandleFunc("/api/monitor/shares", p.requireSession(p.handleMonitorShares))
-	apiMux.HandleFunc("/api/monitor/shares/", p.requireSession(p.handleRevokeMonitorShare))
+	apiMux.HandleFunc("/admin/api/accounts", p.requireSession(access{read: PermView, write: PermAccountManage, methods: map[string]Permission{http.MethodPost: PermSystem, http.MethodDelete: PermSystem}}, p.handleAccounts))
+	apiMux.HandleFunc("/admin/api/accounts/quota", p.requireSession(readWrite(PermView, PermSystem), p.handleAccountQuota))
+	apiMux.HandleFunc("/admin/api/accounts/users", p.requireSession(only(PermAccountManage), p.handleAccountUsers))
+	apiMux.HandleFunc("/admin/api/me", p.requireSession(access{}, p.handleCurrentUser))
+	apiMux.HandleFunc("/admin/api/keys", p.requireSession(readWrite(PermView, PermKeysManage), p.handleAPIKeys))
+	apiMux.HandleFunc("/admin/api/sessions", p.requireSession(only(PermAccountManage), p.handleSessions))
+	apiMux.HandleFunc("/admin/api/request-logs", p.requireSession(only(PermLogsRead), p.handleRequestLogs))
+	apiMux.HandleFunc("/admin/api/audit", p.requireSession(only(PermAccountManage), p.handleAuditEvents))
+	apiMux.HandleFunc("/admin/api/nodes", p.requireSession(readWrite(PermView, PermNodesManage), p.handleNodes))
+	apiMux.HandleFunc("/admin/api/config", p.requireSession(readWrite(PermView, PermNodesManage), p.handleConfig))
+	apiMux.HandleFunc("/admin/api/nodes/activate", p.requireSession(only(PermNodesManage), p.handleActivate))
+	apiMux.HandleFunc("/admin/api/nodes/disable", p.requireSession(only(PermNodesManage), p.handleDisable))
+	apiMux.HandleFunc("/admin/api/nodes/enable", p.requireSession(only(PermNodesManage), p.handleEnable))
+	apiMux.HandleFunc("/admin/api/backup", p.requireSession(only(PermSystem), p.handleBackupExport))
+	apiMux.HandleFunc("/admin/api/backup/import", p.requireSession(only(PermSystem), p.handleBackupImport))
+	apiMux.HandleFunc("/admin/api/tunnel", p.requireSession(only(PermSystem), p.handleTunnelConfig))
+	apiMux.HandleFunc("/admin/api/tunnel/start", p.requireSession(only(PermSystem), p.handleTunnelStart))
+	apiMux.HandleFunc("/admin/api/tunnel/stop", p.requireSession(only(PermSystem), p.handleTunnelStop))
+	apiMux.HandleFunc("/admin/api/tunnel/zones", p.requireSession(only(PermSystem), p.handleTunnelZones))
+	apiMux.HandleFunc("/api/notification/channels", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationChannels))
+	apiMux.HandleFunc("/api/notification/channels/", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationChannelByID))
+	apiMux.HandleFunc("/api/notification/subscriptions", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationSubscriptions))
+	apiMux.HandleFunc("/api/notification/subscriptions/", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationSubscriptionByID))
+	apiMux.HandleFunc("/api/notification/event-types", p.requireSession(only(PermView), p.listEventTypes))
+	apiMux.HandleFunc("/api/notification/test", p.requireSession(only(PermNotifyManage), p.testNotification))
+	apiMux.HandleFunc("/api/notification/outbox", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationOutbox))
+	apiMux.HandleFunc("/api/notification/outbox/", p.requireSession(readWrite(PermView, PermNotifyManage), p.handleNotificationOutboxByID))
+	apiMux.HandleFunc("/api/nodes/", p.requireSession(only(PermView), p.handleNodeAPIRoutes))
+	apiMux.HandleFunc("/api/accounts/", p.requireSession(only(PermView), p.handleAccountAPIRoutes))
+	apiMux.HandleFunc("/api/metrics/aggregate", p.requireSession(only(PermSystem), p.handleAggregateMetrics))
+	apiMux.HandleFunc("/api/metrics/costs", p.requireSession(only(PermSystem), p.handleCostReport))
+	apiMux.HandleFunc("/api/metrics/cleanup", p.requireSession(only(PermSystem), p.handleCleanupMetrics))
+	apiMux.HandleFunc("/api/export/metrics", p.requireSession(only(PermView), p.handleExportMetrics))
+	apiMux.HandleFunc("/api/export/health-checks", p.requireSession(only(PermView), p.handleExportHealthChecks))
+	apiMux.HandleFunc("/api/monitor/dashboard", p.requireSession(only(PermView), p.handleMonitorDashboard))
+	apiMux.HandleFunc("/api/monitor/shares", p.requireSession(readWrite(PermView, PermSharesManage), p.handleMonitorShares))
+	apiMux.HandleFunc("/api/monitor/shares/", p.requireSession(only(PermSharesManage), p.handleRevokeMonitorShare))
 	apiMux.HandleFunc("/api/monitor/share/", p.handleAccessMonitorShare)
-	settingsHandler := &SettingsHandler{store: p.store, cache: p.settingsCache}
-	apiMux.HandleFunc("/api/settings/version", p.requireSession(settingsHandler.GetVersion))
-	apiMux.HandleFunc("/api/settings", p.requireSession(settingsHandler.ListSettings))
-	apiMux.HandleFunc("/api/settings/batch", p.requireSession(settingsHandler.BatchUpdate))
-	apiMux.HandleFunc("/api/settings/", p.requireSession(settingsHandler.HandleSetting))
-	apiMux.HandleFunc("/api/claude-config/template", p.requireSession(p.handleClaudeConfigTemplate))
+	settingsHandler := &SettingsHandler{store: p.store, cache: p.settingsCache, audit: p.audit}
+	apiMux.HandleFunc("/api/settings/version", p.requireSession(only(PermSystem), settingsHandler.GetVersion))
+	apiMux.HandleFunc("/api/settings", p.requireSession(only(PermSystem), settingsHandler.ListSettings))
+	apiMux.HandleFunc("/api/settings/batch", p.requireSession(only(PermSystem), settingsHandler.BatchUpdate))
+	apiMux.HandleFunc("/api/settings/", p.requireSession(only(PermSystem), settingsHandler.HandleSetting))
+	apiMux.HandleFunc("/api/claude-config/template", p.requireSession(only(PermSecrets), p.handleClaudeConfigTemplate))
 	apiMux.HandleFunc("/api/claude-config/download/", p.handleClaudeConfigDownload)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -107,6 +123,11 @@ func (p *Server) handler() http.Handler {
 			return
 		}
 
+		if path == "/metrics" {
+			p.handlePrometheusMetrics(w, r)
+			return
+		}
+
 		if path == "/api/monitor/ws" {
 			p.handleMonitorWebSocket(w, r)
 			return
@@ -138,8 +159,9 @@ func (p *Server) handler() http.Handler {
 		}
 
 		if (strings.HasPrefix(path, "/api/nodes/") && strings.HasSuffix(path, "/metrics")) ||
-			(strings.HasPrefix(path, "/api/accounts/") && strings.HasSuffix(path, "/metrics")) ||
-			path == "/api/metrics/aggregate" || path == "/api/metrics/cleanup" {
+			(strings.HasPrefix(path, "/api/accounts/") && (strings.HasSuffix(path, "/metrics") || strings.HasSuffix(path, "/costs"))) ||
+			path == "/api/metrics/aggregate" || path == "/api/metrics/cleanup" || path == "/api/metrics/costs" ||
+			path == "/api/export/metrics" || path == "/api/export/health-checks" {
 			apiMux.ServeHTTP(w, r)
 			return
 		}
@@ -180,185 +202,246 @@ func (p *Server) handler() http.Handler {
 		// 只代理 /v1/messages 接口，其他请求透传到上游
 		if path == "/v1/messages" {
 			// Proxy endpoints for /v1/messages
-			proxyKey := extractAPIKey(r)
-			account := p.getAccountByProxyKey(proxyKey)
-			if account == nil {
-				account = p.defaultAccount
+			if p.rejectIfDraining(w) {
+				return
 			}
-			if account == nil {
-				http.Error(w, "account not found", http.StatusUnauthorized)
+			account, apiKey, ok := p.authenticateProxyRequest(w, r)
+			if !ok {
 				return
 			}
-
-			skipNodes := make(map[string]bool)
-			firstAttemptFailed := false
-			baseCtx := context.WithValue(r.Context(), accountContextKey{}, account)
-			baseCtx = context.WithValue(baseCtx, nodeContextKey{}, nil)
-			overallDeadline := time.Time{}
-			if p.retryConfig.TotalTimeout > 0 {
-				overallDeadline = time.Now().Add(p.retryConfig.TotalTimeout)
+			releaseQuota, ok := p.acquireQuota(w, account)
+			if !ok {
+				return
 			}
+			defer releaseQuota()
+
 			var bodyBytes []byte
 			if r.Body != nil {
 				bodyBytes, _ = io.ReadAll(r.Body)
 				r.Body.Close()
 			}
-
-			// attempt 只计算真正发送请求的次数，maxLoops 防止无限循环
-			// maxLoops = 节点数量 * 2，确保即使有熔断器也能尝试所有节点
-			attempt := 0
-			maxLoops := len(account.Nodes) * 2
-			if maxLoops < 20 {
-				maxLoops = 20 // 至少尝试 20 次循环
-			}
-			for loops := 0; loops < maxLoops; loops++ {
-				reqForAttempt := r.Clone(baseCtx)
-				if len(bodyBytes) > 0 {
-					reqForAttempt.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-					reqForAttempt.ContentLength = int64(len(bodyBytes))
-				}
-				node := p.selectHealthyNodeExcluding(account, skipNodes)
-				if node == nil {
-					break
+			if apiKey != nil {
+				if model := requestModel(bodyBytes); !apiKey.allowsModel(model) {
+					writeAnthropicError(w, http.StatusForbidden, "permission_error", fmt.Sprintf("API key %q is not allowed to use model %q.", apiKey.Name, model))
+					return
 				}
+			}
 
-				// 检查熔断器
-				var cb *CircuitBreaker
-				if p.cbConfig.Enabled {
-					cb = p.getOrCreateCircuitBreaker(node.ID)
-					if !cb.AllowRequest() {
-						p.logger.Printf("node %s circuit breaker is open, skipping (loop %d/%d, tried %d nodes)", node.Name, loops+1, maxLoops, attempt)
-						skipNodes[node.ID] = true
-						continue // 跳过此节点，不计入 attempt
-					}
-				}
+			p.forwardMessages(w, r, account, apiKey, bodyBytes)
+			return
+		}
 
-				usage := &usage{}
-				proxy, streamState := p.newReverseProxy(node, usage)
-				p.logger.Printf("%s %s via %s (account=%s, node %d/%d)", r.Method, r.URL.String(), node.Name, account.ID, attempt+1, len(account.Nodes))
+		if path == "/v1/chat/completions" {
+			if p.rejectIfDraining(w) {
+				return
+			}
+			p.handleChatCompletions(w, r)
+			return
+		}
 
-				start := time.Now()
-				mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+		// 其他请求透传到上游（不做任何处理）
+		account, _, ok := p.authenticateProxyRequest(w, r)
+		if !ok {
+			return
+		}
+		node, err := p.getActiveNodeForAccount(account)
+		if err != nil {
+			http.Error(w, "no active upstream node", http.StatusServiceUnavailable)
+			return
+		}
+		// 透传代理：不记录指标，不处理失败
+		proxy := p.newPassthroughProxy(node)
+		proxy.ServeHTTP(w, r)
+	})
+}
 
-				// 计算本次尝试的超时时间：按配置的 per-attempt 优先，其次单次超时，再受总超时约束
-				timeout := p.retryConfig.PerRequestTimeout
-				if len(p.retryConfig.PerAttemptTimeouts) > attempt {
-					timeout = p.retryConfig.PerAttemptTimeouts[attempt]
-				}
-				if !overallDeadline.IsZero() {
-					remaining := time.Until(overallDeadline)
-					if remaining <= 0 {
-						http.Error(w, "all nodes failed after retry", http.StatusBadGateway)
-						return
-					}
-					if remaining < timeout {
-						timeout = remaining
-					}
-				}
+// forwardMessages 将 Anthropic Messages 请求按账号路由到健康节点，负责重试、熔断、指标与用量记录。
+// w 实现 attemptResetter 时，每次尝试前会被通知，以便丢弃上一次失败尝试的响应头。
+func (p *Server) forwardMessages(w http.ResponseWriter, r *http.Request, account *Account, apiKey *APIKey, bodyBytes []byte) {
+	p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	skipNodes := make(map[string]bool)
+	firstAttemptFailed := false
+	baseCtx := context.WithValue(r.Context(), accountContextKey{}, account)
+	baseCtx = context.WithValue(baseCtx, nodeContextKey{}, nil)
+	overallDeadline := time.Time{}
+	if p.retryConfig.TotalTimeout > 0 {
+		overallDeadline = time.Now().Add(p.retryConfig.TotalTimeout)
+	}
+	reqLog := p.beginRequestLog(account, apiKey, bodyBytes)
+	defer p.finishRequestLog(reqLog)
+	// 跳过无法服务该模型的节点（节点模型白名单/模型映射）。
+	model := requestModel(bodyBytes)
+	if !p.excludeNodesForModel(account, model, skipNodes) {
+		msg := fmt.Sprintf("No upstream node supports model %q.", model)
+		reqLog.fail(http.StatusNotFound, msg)
+		writeAnthropicError(w, http.StatusNotFound, "not_found_error", msg)
+		return
+	}
 
-				attemptCtx := context.WithValue(baseCtx, nodeContextKey{}, node)
-				attemptCtx, cancel := context.WithTimeout(attemptCtx, timeout)
-				reqForAttempt = reqForAttempt.WithContext(attemptCtx)
-				proxy.ServeHTTP(wrapFirstByteFlush(mw, streamState), reqForAttempt)
-				cancel()
+	// attempt 只计算真正发送请求的次数，maxLoops 防止无限循环
+	// maxLoops = 节点数量 * 2，确保即使有熔断器也能尝试所有节点
+	attempt := 0
+	maxLoops := len(account.Nodes) * 2
+	if maxLoops < 20 {
+		maxLoops = 20 // 至少尝试 20 次循环
+	}
+	for loops := 0; loops < maxLoops; loops++ {
+		reqForAttempt := r.Clone(baseCtx)
+		if len(bodyBytes) > 0 {
+			reqForAttempt.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+			reqForAttempt.ContentLength = int64(len(bodyBytes))
+		}
+		node := p.selectHealthyNodeExcluding(account, skipNodes)
+		if node == nil {
+			break
+		}
 
-				// 真正发送了请求，计数器+1
-				attempt++
+		// 检查熔断器
+		var cb *CircuitBreaker
+		if p.cbConfig.Enabled {
+			cb = p.getOrCreateCircuitBreaker(node.ID)
+			if !cb.AllowRequest() {
+				p.logger.Printf("node %s circuit breaker is open, skipping (loop %d/%d, tried %d nodes)", node.Name, loops+1, maxLoops, attempt)
+				skipNodes[node.ID] = true
+				continue // 跳过此节点，不计入 attempt
+			}
+		}
 
-				upstreamStatus := extractUpstreamStatus(mw)
-				statusForRetry := upstreamStatus
-				if statusForRetry == 0 {
-					statusForRetry = mw.status
-				}
+		usage := &usage{}
+		proxy, streamState := p.newReverseProxy(node, usage)
+		p.logger.Printf("%s %s via %s (account=%s, node %d/%d)", r.Method, r.URL.String(), node.Name, account.ID, attempt+1, len(account.Nodes))
 
-				failed := mw.status != http.StatusOK || statusForRetry >= http.StatusInternalServerError
+		start := time.Now()
+		mw := &metricsWriter{ResponseWriter: w, status: http.StatusOK}
+		reqLog.prepare(mw)
 
-				if attempt == 1 && failed {
-					firstAttemptFailed = true
-				}
+		// 计算本次尝试的超时时间：按配置的 per-attempt 优先，其次单次超时，再受总超时约束
+		timeout := p.retryConfig.PerRequestTimeout
+		if len(p.retryConfig.PerAttemptTimeouts) > attempt {
+			timeout = p.retryConfig.PerAttemptTimeouts[attempt]
+		}
+		if !overallDeadline.IsZero() {
+			remaining := time.Until(overallDeadline)
+			if remaining <= 0 {
+				reqLog.fail(http.StatusBadGateway, "all nodes failed after retry")
+				http.Error(w, "all nodes failed after retry", http.StatusBadGateway)
+				return
+			}
+			if remaining < timeout {
+				timeout = remaining
+			}
+		}
 
-				if cb != nil {
-					cb.RecordResult(!failed)
-				}
+		attemptCtx := context.WithValue(baseCtx, nodeContextKey{}, node)
+		attemptCtx, cancel := context.WithTimeout(attemptCtx, timeout)
+		reqForAttempt = reqForAttempt.WithContext(attemptCtx)
+		if ar, ok := w.(attemptResetter); ok {
+			ar.resetAttempt()
+		}
+		serveAttempt(proxy, node, wrapFirstByteFlush(mw, streamState), reqForAttempt)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
 
-				shouldRetry := failed && statusForRetry >= http.StatusInternalServerError && shouldRetryStatus(statusForRetry, p.retryConfig)
-				isLastAttempt := attempt >= p.retryConfig.MaxAttempts
-				finalAttempt := !failed || !shouldRetry || isLastAttempt
+		// 真正发送了请求，计数器+1
+		attempt++
 
-				var retryAttemptsTotal int64
-				if finalAttempt {
-					retryAttemptsTotal = int64(attempt)
-				}
-				var retrySuccess int64
-				if finalAttempt && !failed && firstAttemptFailed {
-					retrySuccess = 1
-				}
+		upstreamStatus := extractUpstreamStatus(mw)
+		statusForRetry := upstreamStatus
+		if statusForRetry == 0 {
+			statusForRetry = mw.status
+		}
 
-				p.recordMetrics(node.ID, start, mw, usage, retryAttemptsTotal, retrySuccess)
+		failed := mw.status != http.StatusOK || statusForRetry >= http.StatusInternalServerError
 
-				if !failed {
-					return
-				}
+		if attempt == 1 && failed {
+			firstAttemptFailed = true
+		}
 
-				errMsg := extractErrorMessage(mw, statusForRetry)
-				if account != nil {
-					p.recordHealthEvent(account.ID, node.ID, HealthCheckMethodProxy, CheckSourceProxyFail, false, time.Since(start), errMsg, time.Now().UTC())
-				}
-				if p.shouldFail(node.ID, errMsg) {
-					// 仅在最后一次尝试失败时才把节点标记为全局失败，避免单请求重试耗尽所有节点
-					if isLastAttempt {
-						p.handleFailure(node.ID, errMsg)
-					} else {
-						p.logger.Printf("[retry] node %s failed in attempt %d, will try other nodes", node.Name, attempt+1)
-					}
-				}
-				skipNodes[node.ID] = true
+		if cb != nil {
+			cb.RecordResult(!failed)
+		}
+		p.observePassive(node.ID, start, mw, statusForRetry, timedOut)
 
-				if !shouldRetry {
-					return
-				}
+		shouldRetry := failed && statusForRetry >= http.StatusInternalServerError && shouldRetryStatus(statusForRetry, p.retryConfig)
+		isLastAttempt := attempt >= p.retryConfig.MaxAttempts
+		finalAttempt := !failed || !shouldRetry || isLastAttempt
 
-				// 如果还有可尝试的节点，记录日志并继续
-				if shouldRetry {
-					p.logger.Printf("retrying with next node (tried %d/%d nodes), %s failed: %s", attempt, len(account.Nodes), node.Name, errMsg)
-					backoff := calculateBackoff(attempt-1, p.retryConfig)
-					time.Sleep(backoff)
-				}
-			}
+		var retryAttemptsTotal int64
+		if finalAttempt {
+			retryAttemptsTotal = int64(attempt)
+		}
+		var retrySuccess int64
+		if finalAttempt && !failed && firstAttemptFailed {
+			retrySuccess = 1
+		}
 
-			// 检查响应是否已写入（避免重复调用 WriteHeader）
-			if _, ok := w.(interface{ Header() http.Header }); ok {
-				if w.Header().Get("Content-Type") == "" {
-					// 响应头未写入，可以安全调用 http.Error
-					http.Error(w, "all nodes failed after retry", http.StatusBadGateway)
-				}
-			}
+		p.recordMetrics(node.ID, apiKeyID(apiKey), start, mw, usage, retryAttemptsTotal, retrySuccess)
+		p.recordModelUsage(account, apiKey, node, model, usage, failed)
+		p.recordQuotaUsage(account, usage)
+		// 与重试指标一致，Key 用量按客户端请求计一次，只在最终尝试记录。
+		if finalAttempt {
+			p.recordAPIKeyUsage(apiKey, usage)
+		}
+
+		if !failed {
+			reqLog.observe(node, mw, usage, attempt, "")
 			return
 		}
 
-		// 其他请求透传到上游（不做任何处理）
-		proxyKey := extractAPIKey(r)
-		account := p.getAccountByProxyKey(proxyKey)
-		if account == nil {
-			account = p.defaultAccount
+		errMsg := extractErrorMessage(mw, statusForRetry)
+		reqLog.observe(node, mw, usage, attempt, errMsg)
+		if account != nil {
+			p.recordHealthEvent(account.ID, node.ID, HealthCheckMethodProxy, CheckSourceProxyFail, false, time.Since(start), errMsg, time.Now().UTC())
 		}
-		if account == nil {
-			http.Error(w, "account not found", http.StatusUnauthorized)
-			return
+		if p.shouldFail(node.ID, errMsg) {
+			// 仅在最后一次尝试失败时才把节点标记为全局失败，避免单请求重试耗尽所有节点
+			if isLastAttempt {
+				p.handleFailure(node.ID, errMsg)
+			} else {
+				p.logger.Printf("[retry] node %s failed in attempt %d, will try other nodes", node.Name, attempt+1)
+			}
 		}
-		node, err := p.getActiveNodeForAccount(account)
-		if err != nil {
-			http.Error(w, "no active upstream node", http.StatusServiceUnavailable)
+		skipNodes[node.ID] = true
+
+		if !shouldRetry {
 			return
 		}
-		// 透传代理：不记录指标，不处理失败
-		proxy := p.newPassthroughProxy(node)
-		proxy.ServeHTTP(w, r)
-	})
+
+		// 如果还有可尝试的节点，记录日志并继续
+		if shouldRetry {
+			p.logger.Printf("retrying with next node (tried %d/%d nodes), %s failed: %s", attempt, len(account.Nodes), node.Name, errMsg)
+			backoff := calculateBackoff(attempt-1, p.retryConfig)
+			time.Sleep(backoff)
+		}
+	}
+
+	// 检查响应是否已写入（避免重复调用 WriteHeader）
+	if _, ok := w.(interface{ Header() http.Header }); ok {
+		if w.Header().Get("Content-Type") == "" {
+			// 响应头未写入，可以安全调用 http.Error
+			reqLog.fail(http.StatusBadGateway, "all nodes failed after retry")
+			http.Error(w, "all nodes failed after retry", http.StatusBadGateway)
+		}
+	}
+}
+
+// serveAttempt 向节点转发一次尝试并维护在途计数。客户端中途断开时 ReverseProxy 会以
+// http.ErrAbortHandler panic，计数必须通过 defer 归还，否则会永久偏高。
+func serveAttempt(proxy http.Handler, node *Node, w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&node.InFlight, 1)
+	defer atomic.AddInt64(&node.InFlight, -1)
+	proxy.ServeHTTP(w, r)
 }
 
-// requireSession 会话中间件，未登录则跳转登录页（页面请求）或返回 401（API 请求）。
-func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+// attemptResetter 由需要区分多次重试尝试的 ResponseWriter 实现（如 OpenAI 协议转换）。
+type attemptResetter interface {
+	resetAttempt()
+}
+
+// requireSession 会话中间件，未登录则跳转登录页（页面请求）或返回 401（API 请求）；
+// 已登录但不具备路由所需权限时返回 403。
+func (p *Server) requireSession(rule access, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if p.sessionMgr == nil {
 			http.Error(w, "session manager missing", http.StatusInternalServerError)
@@ -373,7 +456,8 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 			strings.HasPrefix(r.URL.Path, "/api/metrics/") ||
 			strings.HasPrefix(r.URL.Path, "/api/monitor/") ||
 			strings.HasPrefix(r.URL.Path, "/api/settings") ||
-			strings.HasPrefix(r.URL.Path, "/api/claude-config/")
+			strings.HasPrefix(r.URL.Path, "/api/claude-config/") ||
+			strings.HasPrefix(r.URL.Path, "/api/export/")
 
 		cookie, err := r.Cookie("session_token")
 		if err != nil || cookie.Value == "" {
@@ -408,10 +492,26 @@ func (p *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
 			}
 			return
 		}
+		if sess.renewed {
+			setSessionCookie(w, sess, p.tlsEnabled())
+		}
 		ctx := context.WithValue(r.Context(), accountContextKey{}, acc)
+		ctx = context.WithValue(ctx, sessionContextKey{}, sess.ID)
 		if sess.IsAdmin {
 			ctx = context.WithValue(ctx, isAdminContextKey{}, true)
 		}
+		if sess.UserID != "" {
+			ctx = context.WithValue(ctx, userContextKey{}, sess.UserID)
+			ctx = context.WithValue(ctx, roleContextKey{}, sess.Role)
+		}
+		if perm := rule.required(r.Method); perm != "" && !hasPermission(ctx, perm) {
+			if isAPIRequest {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+			} else {
+				http.Error(w, "forbidden", http.StatusForbidden)
+			}
+			return
+		}
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -3,10 +3,7 @@ package proxy
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"strings"
@@ -110,10 +107,15 @@ func (p *Server) handleFailure(nodeID string, errMsg string) {
 	p.logger.Printf("node %s marked failed (fail_streak=%d, fail_limit=%d): %s", nodeName, failStreak, failLimit, errMsg)
 	if p.notifyMgr != nil && acc != nil {
 		p.notifyMgr.Publish(notify.Event{
-			AccountID:  acc.ID,
-			EventType:  notify.EventNodeFailed,
-			Title:      "节点故障告警",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**错误信息**: %s\n**失败次数**: %d\n**时间**: %s", nodeName, errMsg, failStreak, timeutil.FormatBeijingTime(time.Now())),
+			AccountID: acc.ID,
+			EventType: notify.EventNodeFailed,
+			Data: map[string]any{
+				"source":      "request",
+				"node_id":     nodeID,
+				"node_name":   nodeName,
+				"error":       errMsg,
+				"fail_streak": failStreak,
+			},
 			DedupKey:   node.ID,
 			OccurredAt: time.Now(),
 		})
@@ -139,7 +141,13 @@ func (p *Server) healthLoop() {
 		if interval <= 0 {
 			return
 		}
-		time.Sleep(interval)
+		timer := time.NewTimer(interval)
+		select {
+		case <-p.loopStop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
 		p.checkFailedNodes()
 	}
 }
@@ -218,40 +226,13 @@ func (p *Server) checkNodeHealth(acc *Account, id string, source string) {
 		nodeCopy.AccountID = acc.ID
 	}
 
-	// 根据健康检查方式设置超时时间
-	method := normalizeHealthCheckMethod(nodeCopy.HealthCheckMethod)
-	if method == HealthCheckMethodCLI && nodeCopy.APIKey == "" {
+	chain := probeChainFor(nodeCopy)
+	if len(nodeCopy.HealthProbes) == 0 && chain[0].Type == HealthCheckMethodCLI && nodeCopy.APIKey == "" {
 		// CLI 需要 API Key，缺失时自动降级为 HEAD，避免探活失败卡死。
 		p.logger.Printf("health check mode cli requires api key, fallback to head for node %s", nodeCopy.Name)
-		method = HealthCheckMethodHEAD
-	}
-
-	timeout := 5 * time.Second
-	if method == HealthCheckMethodCLI {
-		// CLI 方式需要执行外部 CLI，需要更长的超时时间（进程+模型加载开销）
-		timeout = 30 * time.Second
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	var (
-		ok      bool
-		pingErr string
-		latency time.Duration
-	)
-
-	switch method {
-	case HealthCheckMethodAPI:
-		ok, pingErr, latency = p.healthCheckViaAPI(ctx, nodeCopy)
-	case HealthCheckMethodHEAD:
-		ok, pingErr, latency = p.healthCheckViaHEAD(ctx, nodeCopy)
-	case HealthCheckMethodCLI:
-		ok, pingErr, latency = p.healthCheckViaCLI(ctx, nodeCopy)
-		// 不再自动降级，保留 CLI 失败的真实错误信息，便于调试
-	default:
-		ok, pingErr, latency = p.healthCheckViaAPI(ctx, nodeCopy)
+		chain = []ProbeConfig{{Type: HealthCheckMethodHEAD}}
 	}
+	method, ok, pingErr, latency := p.runProbeChain(nodeCopy, chain)
 	checkedAt := time.Now().UTC()
 	p.recordHealthEvent(nodeCopy.AccountID, nodeCopy.ID, method, source, ok, latency, pingErr, checkedAt)
 
@@ -331,10 +312,14 @@ func (p *Server) checkNodeHealth(acc *Account, id string, source string) {
 				// 发送节点离线通知
 				if p.notifyMgr != nil {
 					p.notifyMgr.Publish(notify.Event{
-						AccountID:  acc.ID,
-						EventType:  notify.EventNodeFailed,
-						Title:      "节点健康检查失败",
-						Content:    fmt.Sprintf("**节点名称**: %s\n**错误信息**: %s\n**检测时间**: %s", n.Name, pingErr, timeutil.FormatBeijingTime(time.Now())),
+						AccountID: acc.ID,
+						EventType: notify.EventNodeFailed,
+						Data: map[string]any{
+							"source":    "health_check",
+							"node_id":   n.ID,
+							"node_name": n.Name,
+							"error":     pingErr,
+						},
 						DedupKey:   n.ID,
 						OccurredAt: time.Now(),
 					})
@@ -376,8 +361,7 @@ func (p *Server) checkNodeHealth(acc *Account, id string, source string) {
 			p.notifyMgr.Publish(notify.Event{
 				AccountID:  acc.ID,
 				EventType:  notify.EventNodeRecovered,
-				Title:      "节点已恢复",
-				Content:    fmt.Sprintf("**节点名称**: %s\n**恢复时间**: %s", n.Name, timeutil.FormatBeijingTime(time.Now())),
+				Data:       map[string]any{"node_id": n.ID, "node_name": n.Name},
 				DedupKey:   n.ID,
 				OccurredAt: time.Now(),
 			})
@@ -455,111 +439,22 @@ func (p *Server) maybePromoteRecovered(n *Node) {
 	}
 }
 
+// normalizeHealthCheckMethod 归一化健康检查方式，支持任意已注册的探针名称，未知值使用全局默认。
 func normalizeHealthCheckMethod(method string) string {
-	switch strings.ToLower(method) {
-	case HealthCheckMethodAPI:
-		return HealthCheckMethodAPI
-	case HealthCheckMethodHEAD:
-		return HealthCheckMethodHEAD
-	case HealthCheckMethodCLI:
-		return HealthCheckMethodCLI
-	default:
-		// 使用全局默认值，支持环境变量覆盖
-		return defaultHealthCheckMethod
+	m := strings.ToLower(strings.TrimSpace(method))
+	if _, ok := lookupHealthProbe(m); ok {
+		return m
 	}
+	// 使用全局默认值，支持环境变量覆盖
+	return defaultHealthCheckMethod
 }
 
 func healthMethodRequiresAPIKey(method string) bool {
-	m := normalizeHealthCheckMethod(method)
-	return m == HealthCheckMethodAPI || m == HealthCheckMethodCLI
-}
-
-func (p *Server) healthCheckViaAPI(ctx context.Context, node Node) (bool, string, time.Duration) {
-	if node.APIKey == "" {
-		return false, "api health check requires api key", 0
-	}
-	prompt := map[string]interface{}{
-		"model":      "claude-3-5-haiku-20241022",
-		"max_tokens": 1,
-		"messages": []map[string]string{
-			{"role": "user", "content": "hi"},
-		},
-	}
-	bodyBytes, _ := json.Marshal(prompt)
-	apiURL := strings.TrimSuffix(node.URL.String(), "/") + "/v1/messages"
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("x-api-key", node.APIKey)
-	req.Header.Set("Authorization", "Bearer "+node.APIKey)
-
-	client := &http.Client{Transport: p.healthRT, Timeout: 5 * time.Second}
-	start := time.Now()
-	resp, err := client.Do(req)
-	latency := time.Since(start)
-	if err != nil {
-		return false, err.Error(), latency
-	}
-	defer resp.Body.Close()
-	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
-	if ok {
-		return true, "", latency
-	}
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
-	return false, fmt.Sprintf("status %d: %s", resp.StatusCode, string(body)), latency
-}
-
-func (p *Server) healthCheckViaHEAD(ctx context.Context, node Node) (bool, string, time.Duration) {
-	client := &http.Client{Transport: p.healthRT, Timeout: 5 * time.Second}
-	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, node.URL.String(), nil)
-	start := time.Now()
-	resp, err := client.Do(req)
-	latency := time.Since(start)
-	if err != nil {
-		return false, err.Error(), latency
-	}
-	defer resp.Body.Close()
-	ok := resp.StatusCode == http.StatusOK
-	if ok {
-		return true, "", latency
-	}
-	return false, fmt.Sprintf("status %d", resp.StatusCode), latency
-}
-
-func (p *Server) healthCheckViaCLI(ctx context.Context, node Node) (bool, string, time.Duration) {
-	runner := p.cliRunner
-	if runner == nil {
-		runner = defaultCLIRunner
-	}
-	if node.APIKey == "" {
-		return false, "cli health check requires api key", 0
-	}
-	if node.URL == nil {
-		return false, "cli health check requires valid base url", 0
-	}
-
-	model := node.HealthCheckModel
-	if model == "" {
-		model = defaultHealthCheckModel
-	}
-	env := map[string]string{
-		"ANTHROPIC_API_KEY":    node.APIKey,
-		"ANTHROPIC_AUTH_TOKEN": chooseNonEmpty(os.Getenv("ANTHROPIC_AUTH_TOKEN"), node.APIKey),
-		"ANTHROPIC_BASE_URL":   node.URL.String(),
-	}
-
-	start := time.Now()
-	// 使用简短的 prompt 让模型只回复 "ok"，减少输出 token 数量
-	out, err := runner(ctx, "claude", env, "say ok", model)
-	latency := time.Since(start)
-	if err != nil {
-		// 不再返回 fallback 标志，直接返回错误
-		return false, err.Error(), latency
-	}
-	if strings.TrimSpace(out) == "" {
-		return false, "cli health check returned empty output", latency
+	switch normalizeHealthCheckMethod(method) {
+	case HealthCheckMethodAPI, HealthCheckMethodCLI, HealthCheckMethodStream, HealthCheckMethodCountTokens, HealthCheckMethodToolUse:
+		return true
 	}
-	return true, "", latency
+	return false
 }
 
 func (p *Server) recordHealthEvent(accountID, nodeID, method, source string, success bool, latency time.Duration, errMsg string, checkTime time.Time) {
@@ -592,14 +487,14 @@ func (p *Server) recordHealthEvent(accountID, nodeID, method, source string, suc
 	}
 
 	if p.store != nil {
-		go func(rec store.HealthCheckRecord) {
+		p.goBackground(func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 			defer cancel()
 			if !p.shouldInsertHealthRecord(ctx, rec.AccountID, rec.NodeID, rec.Success, rec.CheckTime) {
 				return
 			}
 			_ = p.store.InsertHealthCheck(ctx, &rec)
-		}(rec)
+		})
 	}
 
 	if p.wsHub != nil {
@@ -657,7 +552,7 @@ func defaultCLIRunner(ctx context.Context, image string, env map[string]string,
 	_ = image
 
 	// 使用 -p/--print 来获取非交互式输出
-	// 超时通过 context 控制（在 healthCheckViaCLI 中设置）
+	// 超时通过 context 控制（由探针链按探针超时设置）
 	// --tools "" 禁用所有工具，避免加载工具定义，加速响应
 	args := []string{"-p", prompt, "--tools", ""}
 
@@ -138,7 +138,13 @@ func (h *HealthScheduler) checkLoop() {
 	defer h.recoverPanic("check loop")
 
 	// 延迟 30 秒后执行首次检查，避免启动时负载峰值。
-	time.Sleep(30 * time.Second)
+	timer := time.NewTimer(30 * time.Second)
+	select {
+	case <-h.stopCh:
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
 	h.checkAllNodes()
 
 	ticker := time.NewTicker(h.interval)
@@ -225,21 +231,22 @@ func (h *HealthScheduler) checkAllNodes() {
 				}
 			}()
 
-			method := func() string {
+			usesCLI := func() bool {
 				if t.acc == nil {
-					return ""
+					return false
 				}
 				p.mu.RLock()
 				n := t.acc.Nodes[t.id]
-				p.mu.RUnlock()
-				if n == nil {
-					return ""
+				var chain []ProbeConfig
+				if n != nil {
+					chain = probeChainFor(*n)
 				}
-				return normalizeHealthCheckMethod(n.HealthCheckMethod)
+				p.mu.RUnlock()
+				return probeChainUsesCLI(chain)
 			}()
 
 			release := func() func() {
-				if method == HealthCheckMethodCLI {
+				if usesCLI {
 					// 双层信号量：总并发 + CLI 专用并发
 					if semCLI != nil && semCLI != semAll {
 						semCLI <- struct{}{}
@@ -0,0 +1,485 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/timeutil"
+)
+
+// 被动健康评分：根据 /v1/messages 真实流量在滑动窗口内的成功率、p95 延时、首字节时间、
+// 429 限流与超时比例计算 0~100 的评分，用于自动降权/恢复与离群摘除。
+const (
+	passiveBucketWidth = 10 * time.Second
+	passiveBucketCount = 30 // 窗口 = 30 × 10s = 5 分钟
+	passiveEvalEvery   = 5 * time.Second
+	maxEjectMultiplier = 10 // 连续摘除时长最多放大到 eject_sec 的 10 倍
+
+	settingPassiveEnabled         = "health.passive_enabled"
+	settingPassiveMinSamples      = "health.passive_min_samples"
+	settingPassiveDemoteScore     = "health.passive_demote_score"
+	settingPassivePromoteScore    = "health.passive_promote_score"
+	settingPassiveDemotePenalty   = "health.passive_demote_penalty"
+	settingPassiveEjectScore      = "health.passive_eject_score"
+	settingPassiveEjectSec        = "health.passive_eject_sec"
+	settingPassiveMaxEjectPercent = "health.passive_max_eject_percent"
+)
+
+// passiveLatencyBoundsMs 请求耗时直方图上界（毫秒），用于估算 p95。
+var passiveLatencyBoundsMs = []float64{250, 500, 1000, 2000, 5000, 10000, 20000, 30000, 60000, 120000, 300000}
+
+// passiveConfig 被动评分配置，来自 settings（health.passive_*）。
+type passiveConfig struct {
+	Enabled         bool
+	MinSamples      int
+	DemoteScore     float64 // 低于该分降权
+	PromoteScore    float64 // 降权节点回到该分以上恢复原权重
+	DemotePenalty   int     // 降权时叠加到权重值上的惩罚
+	EjectScore      float64 // 低于该分摘除
+	EjectDuration   time.Duration
+	MaxEjectPercent int // 同一账号最多同时摘除的可用节点比例
+}
+
+func defaultPassiveConfig() passiveConfig {
+	return passiveConfig{
+		Enabled:         true,
+		MinSamples:      20,
+		DemoteScore:     70,
+		PromoteScore:    85,
+		DemotePenalty:   10,
+		EjectScore:      30,
+		EjectDuration:   30 * time.Second,
+		MaxEjectPercent: 50,
+	}
+}
+
+func (p *Server) passiveConfig() passiveConfig {
+	cfg := defaultPassiveConfig()
+	if p.settingsCache == nil {
+		return cfg
+	}
+	c := p.settingsCache
+	cfg.Enabled = c.GetBool(settingPassiveEnabled, cfg.Enabled)
+	cfg.MinSamples = c.GetInt(settingPassiveMinSamples, cfg.MinSamples)
+	cfg.DemoteScore = float64(c.GetInt(settingPassiveDemoteScore, int(cfg.DemoteScore)))
+	cfg.PromoteScore = float64(c.GetInt(settingPassivePromoteScore, int(cfg.PromoteScore)))
+	cfg.DemotePenalty = c.GetInt(settingPassiveDemotePenalty, cfg.DemotePenalty)
+	cfg.EjectScore = float64(c.GetInt(settingPassiveEjectScore, int(cfg.EjectScore)))
+	cfg.EjectDuration = time.Duration(c.GetInt(settingPassiveEjectSec, int(cfg.EjectDuration/time.Second))) * time.Second
+	cfg.MaxEjectPercent = c.GetInt(settingPassiveMaxEjectPercent, cfg.MaxEjectPercent)
+	if cfg.MinSamples < 1 {
+		cfg.MinSamples = 1
+	}
+	if cfg.PromoteScore < cfg.DemoteScore {
+		cfg.PromoteScore = cfg.DemoteScore
+	}
+	return cfg
+}
+
+// passiveSample 一次代理尝试的结果。
+type passiveSample struct {
+	ok          bool
+	latency     time.Duration
+	firstByte   time.Duration // 0 表示未收到响应
+	rateLimited bool
+	timedOut    bool
+}
+
+type passiveBucket struct {
+	slot           int64 // 时间槽序号（unix 时间 / 桶宽），用于判断桶是否过期
+	requests       int64
+	success        int64
+	rateLimited    int64
+	timeouts       int64
+	latency        [12]int64 // 与 passiveLatencyBoundsMs 对应，最后一格为溢出
+	firstByteSumMs float64
+	firstByteCount int64
+}
+
+// passiveWindow 按时间槽循环复用的滑动窗口。
+type passiveWindow struct {
+	buckets [passiveBucketCount]passiveBucket
+}
+
+func passiveSlot(t time.Time) int64 {
+	return t.UnixNano() / int64(passiveBucketWidth)
+}
+
+func (w *passiveWindow) add(now time.Time, s passiveSample) {
+	slot := passiveSlot(now)
+	b := &w.buckets[slot%passiveBucketCount]
+	if b.slot != slot {
+		*b = passiveBucket{slot: slot}
+	}
+	b.requests++
+	if s.ok {
+		b.success++
+	}
+	if s.rateLimited {
+		b.rateLimited++
+	}
+	if s.timedOut {
+		b.timeouts++
+	}
+	ms := float64(s.latency.Microseconds()) / 1000
+	idx := sort.SearchFloat64s(passiveLatencyBoundsMs, ms)
+	b.latency[idx]++
+	if s.firstByte > 0 {
+		b.firstByteSumMs += float64(s.firstByte.Microseconds()) / 1000
+		b.firstByteCount++
+	}
+}
+
+// passiveStats 窗口内的汇总指标。
+type passiveStats struct {
+	Requests       int64
+	Success        int64
+	RateLimited    int64
+	Timeouts       int64
+	P95LatencyMs   float64
+	AvgFirstByteMs float64
+}
+
+func (w *passiveWindow) stats(now time.Time) passiveStats {
+	var (
+		st      passiveStats
+		latency [12]int64
+		fbSum   float64
+		fbCount int64
+	)
+	current := passiveSlot(now)
+	oldest := current - passiveBucketCount + 1
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.requests == 0 || b.slot < oldest || b.slot > current {
+			continue
+		}
+		st.Requests += b.requests
+		st.Success += b.success
+		st.RateLimited += b.rateLimited
+		st.Timeouts += b.timeouts
+		for j, c := range b.latency {
+			latency[j] += c
+		}
+		fbSum += b.firstByteSumMs
+		fbCount += b.firstByteCount
+	}
+	if st.Requests > 0 {
+		target := int64(math.Ceil(float64(st.Requests) * 0.95))
+		var cum int64
+		for j, c := range latency {
+			cum += c
+			if cum >= target {
+				if j >= len(passiveLatencyBoundsMs) {
+					j = len(passiveLatencyBoundsMs) - 1
+				}
+				st.P95LatencyMs = passiveLatencyBoundsMs[j]
+				break
+			}
+		}
+	}
+	if fbCount > 0 {
+		st.AvgFirstByteMs = fbSum / float64(fbCount)
+	}
+	return st
+}
+
+// passiveTracker 保存各节点的滑动窗口，独立加锁，避免在请求路径上争用 p.mu。
+type passiveTracker struct {
+	mu      sync.Mutex
+	windows map[string]*passiveWindow
+	now     func() time.Time
+}
+
+func newPassiveTracker() *passiveTracker {
+	return &passiveTracker{windows: make(map[string]*passiveWindow), now: time.Now}
+}
+
+func (t *passiveTracker) observe(nodeID string, s passiveSample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := t.windows[nodeID]
+	if w == nil {
+		w = &passiveWindow{}
+		t.windows[nodeID] = w
+	}
+	w.add(t.now(), s)
+}
+
+func (t *passiveTracker) stats(nodeID string) passiveStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if w := t.windows[nodeID]; w != nil {
+		return w.stats(t.now())
+	}
+	return passiveStats{}
+}
+
+// reset 清空节点窗口（摘除到期或节点删除时），让节点以新样本重新评分。
+func (t *passiveTracker) reset(nodeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.windows, nodeID)
+}
+
+// passiveState 节点当前的被动评分结果，受 p.mu 保护。
+type passiveState struct {
+	Stats        passiveStats
+	Score        float64
+	Scored       bool // 样本数达到 min_samples 才评分
+	Penalty      int  // 降权惩罚，叠加到 Weight 上
+	EjectedUntil time.Time
+	Ejections    int // 连续摘除次数，用于放大摘除时长
+}
+
+// effectiveWeight 节点参与选择时的权重值（越小优先级越高）。调用方需持有 p.mu 读锁。
+func (n *Node) effectiveWeight() int {
+	return n.Weight + n.Passive.Penalty
+}
+
+// ejected 判断节点是否处于被动摘除期。调用方需持有 p.mu 读锁。
+func (n *Node) ejected(now time.Time) bool {
+	return now.Before(n.Passive.EjectedUntil)
+}
+
+// summarizePassive 生成监控大屏展示的被动评分。
+func summarizePassive(st passiveState, weight int, now time.Time) PassiveHealth {
+	view := PassiveHealth{
+		Samples:         st.Stats.Requests,
+		SuccessRate:     100,
+		P95LatencyMs:    st.Stats.P95LatencyMs,
+		AvgFirstByteMs:  math.Round(st.Stats.AvgFirstByteMs),
+		EffectiveWeight: weight + st.Penalty,
+		Demoted:         st.Penalty > 0,
+	}
+	if st.Scored {
+		score := st.Score
+		view.Score = &score
+	}
+	if total := float64(st.Stats.Requests); total > 0 {
+		view.SuccessRate = math.Round(float64(st.Stats.Success)/total*10000) / 100
+		view.RateLimitRate = math.Round(float64(st.Stats.RateLimited)/total*10000) / 100
+		view.TimeoutRate = math.Round(float64(st.Stats.Timeouts)/total*10000) / 100
+	}
+	if now.Before(st.EjectedUntil) {
+		until := timeutil.FormatBeijingTime(st.EjectedUntil)
+		view.EjectedUntil = &until
+	}
+	return view
+}
+
+// passiveOutcome 判断一次转发尝试是否计入被动健康统计及是否算作节点失败：
+// 超时、传输错误（无状态码）、5xx、429 与 408 记为失败；其余 4xx 由客户端请求导致，不计样本。
+func passiveOutcome(status int, timedOut bool) (record, ok bool) {
+	switch {
+	case timedOut || status == 0 || status >= http.StatusInternalServerError:
+		return true, false
+	case status == http.StatusTooManyRequests || status == http.StatusRequestTimeout:
+		return true, false
+	case status >= http.StatusBadRequest:
+		return false, false
+	}
+	return true, true
+}
+
+// observePassive 记录一次 /v1/messages 转发尝试，status 为上游状态码。
+func (p *Server) observePassive(nodeID string, start time.Time, mw *metricsWriter, status int, timedOut bool) {
+	if p.passive == nil || mw == nil {
+		return
+	}
+	record, ok := passiveOutcome(status, timedOut)
+	if !record {
+		return
+	}
+	s := passiveSample{
+		ok:          ok,
+		latency:     time.Since(start),
+		rateLimited: status == http.StatusTooManyRequests,
+		timedOut:    timedOut,
+	}
+	if mw.firstWrite {
+		s.firstByte = mw.firstAt.Sub(start)
+	}
+	p.passive.observe(nodeID, s)
+}
+
+// passiveScore 计算 0~100 评分：成功率分量（≥100% 为 1，≤50% 为 0）乘以其余指标的加权和，
+// 请求大量失败的节点即使延时正常也会得到接近 0 的评分。refLatency / refFirstByte 为账号内节点的中位数，
+// 延时类指标按相对中位数的倍数扣分（≤1.5 倍不扣分，≥4 倍扣满），避免不同输出长度导致绝对阈值失真。
+func passiveScore(st passiveStats, refLatency, refFirstByte float64) float64 {
+	if st.Requests == 0 {
+		return 100
+	}
+	total := float64(st.Requests)
+	success := clamp01((float64(st.Success)/total - 0.5) / 0.5)
+	rateLimit := clamp01(1 - float64(st.RateLimited)/total/0.2)
+	timeout := clamp01(1 - float64(st.Timeouts)/total/0.1)
+	score := success * (0.4 + 0.15*rateLimit + 0.15*timeout +
+		0.15*relativeLatencyScore(st.P95LatencyMs, refLatency) +
+		0.15*relativeLatencyScore(st.AvgFirstByteMs, refFirstByte))
+	return math.Round(score*1000) / 10
+}
+
+func relativeLatencyScore(v, ref float64) float64 {
+	if v <= 0 || ref <= 0 {
+		return 1
+	}
+	return clamp01(1 - (v/ref-1.5)/2.5)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	sort.Float64s(vals)
+	mid := len(vals) / 2
+	if len(vals)%2 == 0 {
+		return (vals[mid-1] + vals[mid]) / 2
+	}
+	return vals[mid]
+}
+
+// passiveHealthLoop 定期重新计算各账号节点评分。
+func (p *Server) passiveHealthLoop() {
+	ticker := time.NewTicker(passiveEvalEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.loopStop:
+			return
+		case <-ticker.C:
+			p.evaluatePassiveHealth()
+		}
+	}
+}
+
+func (p *Server) evaluatePassiveHealth() {
+	if p.passive == nil {
+		return
+	}
+	p.mu.RLock()
+	accounts := make([]*Account, 0, len(p.accountByID))
+	for _, acc := range p.accountByID {
+		accounts = append(accounts, acc)
+	}
+	p.mu.RUnlock()
+
+	cfg := p.passiveConfig()
+	for _, acc := range accounts {
+		if p.evaluateAccountPassive(acc, cfg) {
+			// 评分导致降权、恢复或摘除时重新选择激活节点（仅在变化时发送切换通知）。
+			if _, err := p.selectBestAndActivate(acc, "健康评分变化"); err != nil && p.logger != nil {
+				p.logger.Printf("[passive] reselect for account %s failed: %v", acc.ID, err)
+			}
+		}
+	}
+}
+
+// evaluateAccountPassive 更新账号下节点的评分、降权与摘除状态，返回是否有节点的选择优先级发生变化。
+func (p *Server) evaluateAccountPassive(acc *Account, cfg passiveConfig) bool {
+	p.mu.RLock()
+	ids := make([]string, 0, len(acc.Nodes))
+	for id := range acc.Nodes {
+		ids = append(ids, id)
+	}
+	p.mu.RUnlock()
+	sort.Strings(ids)
+
+	stats := make(map[string]passiveStats, len(ids))
+	var latencies, firstBytes []float64
+	for _, id := range ids {
+		st := p.passive.stats(id)
+		stats[id] = st
+		if st.Requests >= int64(cfg.MinSamples) {
+			latencies = append(latencies, st.P95LatencyMs)
+			if st.AvgFirstByteMs > 0 {
+				firstBytes = append(firstBytes, st.AvgFirstByteMs)
+			}
+		}
+	}
+	refLatency, refFirstByte := median(latencies), median(firstBytes)
+
+	now := p.passive.now()
+	changed := false
+	var expired []string
+	p.mu.Lock()
+	eligible, ejected := 0, 0
+	for _, n := range acc.Nodes {
+		if n.Disabled || n.Failed {
+			continue
+		}
+		eligible++
+		if n.ejected(now) {
+			ejected++
+		}
+	}
+	for _, id := range ids {
+		n := acc.Nodes[id]
+		if n == nil {
+			continue
+		}
+		st := stats[id]
+		prev := n.Passive
+		n.Passive.Stats = st
+		n.Passive.Scored = st.Requests >= int64(cfg.MinSamples)
+		n.Passive.Score = passiveScore(st, refLatency, refFirstByte)
+		if !prev.EjectedUntil.IsZero() && !n.ejected(now) {
+			// 摘除到期：清空窗口，以新样本重新评分
+			n.Passive.EjectedUntil = time.Time{}
+			expired = append(expired, id)
+			changed = true
+			if p.logger != nil {
+				p.logger.Printf("[passive] node %s ejection expired, back in rotation", n.Name)
+			}
+			continue
+		}
+		if !cfg.Enabled {
+			n.Passive.Penalty = 0
+			n.Passive.EjectedUntil = time.Time{}
+			changed = changed || prev.Penalty != 0 || !prev.EjectedUntil.IsZero()
+			continue
+		}
+		switch {
+		case !n.Passive.Scored:
+			// 降权节点在窗口内已无流量时恢复原权重，重新获得试探机会。
+			if st.Requests == 0 && n.Passive.Penalty > 0 {
+				n.Passive.Penalty = 0
+			}
+		case n.Passive.Score >= cfg.PromoteScore:
+			n.Passive.Penalty = 0
+			n.Passive.Ejections = 0
+		case n.Passive.Score < cfg.DemoteScore:
+			n.Passive.Penalty = cfg.DemotePenalty
+		}
+		if n.Passive.Scored && n.Passive.Score < cfg.EjectScore && !n.Disabled && !n.Failed && !n.ejected(now) &&
+			(ejected+1)*100 <= cfg.MaxEjectPercent*eligible {
+			n.Passive.Ejections++
+			mult := n.Passive.Ejections
+			if mult > maxEjectMultiplier {
+				mult = maxEjectMultiplier
+			}
+			n.Passive.EjectedUntil = now.Add(time.Duration(mult) * cfg.EjectDuration)
+			ejected++
+			if p.logger != nil {
+				p.logger.Printf("[passive] node %s ejected until %s (score %.1f)", n.Name, n.Passive.EjectedUntil.Format(time.RFC3339), n.Passive.Score)
+			}
+		}
+		if n.Passive.Penalty != prev.Penalty && p.logger != nil {
+			p.logger.Printf("[passive] node %s effective weight %d -> %d (score %.1f)", n.Name, n.Weight+prev.Penalty, n.effectiveWeight(), n.Passive.Score)
+		}
+		changed = changed || n.Passive.Penalty != prev.Penalty || !n.Passive.EjectedUntil.Equal(prev.EjectedUntil)
+	}
+	p.mu.Unlock()
+
+	for _, id := range expired {
+		p.passive.reset(id)
+	}
+	return changed
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func feedPassive(tr *passiveTracker, nodeID string, n int, s passiveSample) {
+	for i := 0; i < n; i++ {
+		tr.observe(nodeID, s)
+	}
+}
+
+func TestPassiveWindowStats(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newPassiveTracker()
+	tr.now = func() time.Time { return now }
+
+	feedPassive(tr, "a", 18, passiveSample{ok: true, latency: 800 * time.Millisecond, firstByte: 300 * time.Millisecond})
+	feedPassive(tr, "a", 1, passiveSample{latency: 7 * time.Second, rateLimited: true})
+	feedPassive(tr, "a", 1, passiveSample{latency: 40 * time.Second, timedOut: true})
+	st := tr.stats("a")
+	if st.Requests != 20 || st.Success != 18 || st.RateLimited != 1 || st.Timeouts != 1 {
+		t.Fatalf("unexpected counters: %+v", st)
+	}
+	if st.P95LatencyMs != 10000 || st.AvgFirstByteMs != 300 {
+		t.Fatalf("unexpected latency stats: p95=%v first_byte=%v", st.P95LatencyMs, st.AvgFirstByteMs)
+	}
+
+	// 超过 5 分钟窗口的样本不再计入
+	now = now.Add(passiveBucketWidth * passiveBucketCount)
+	if st := tr.stats("a"); st.Requests != 0 {
+		t.Fatalf("expired samples still counted: %+v", st)
+	}
+}
+
+func TestPassiveScoringDemotesAndEjects(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tr := newPassiveTracker()
+	tr.now = func() time.Time { return now }
+	good := &Node{ID: "good", Name: "good", Weight: 2}
+	slow := &Node{ID: "slow", Name: "slow", Weight: 1}
+	dead := &Node{ID: "dead", Name: "dead", Weight: 1}
+	spare := &Node{ID: "spare", Name: "spare", Weight: 3}
+	acc := lbTestAccount(good, slow, dead, spare)
+	srv := &Server{passive: tr, logger: log.New(io.Discard, "", 0)}
+	cfg := defaultPassiveConfig()
+
+	feedPassive(tr, "good", 30, passiveSample{ok: true, latency: 900 * time.Millisecond, firstByte: 400 * time.Millisecond})
+	feedPassive(tr, "spare", 30, passiveSample{ok: true, latency: 900 * time.Millisecond, firstByte: 400 * time.Millisecond})
+	// 仍能成功但延时高且频繁限流：降权而非摘除
+	feedPassive(tr, "slow", 25, passiveSample{ok: true, latency: 15 * time.Second, firstByte: 4 * time.Second})
+	feedPassive(tr, "slow", 5, passiveSample{latency: 300 * time.Millisecond, rateLimited: true})
+	feedPassive(tr, "dead", 30, passiveSample{latency: 30 * time.Second, timedOut: true})
+
+	if !srv.evaluateAccountPassive(acc, cfg) {
+		t.Fatal("expected selection priority change")
+	}
+	if !slow.Passive.Scored || slow.Passive.Score >= cfg.DemoteScore || slow.Passive.Score < cfg.EjectScore {
+		t.Fatalf("slow node should be demoted only, score=%v", slow.Passive.Score)
+	}
+	if slow.effectiveWeight() != 1+cfg.DemotePenalty || good.Passive.Score != 100 {
+		t.Fatalf("unexpected weights: slow=%d good score=%v", slow.effectiveWeight(), good.Passive.Score)
+	}
+	if !dead.ejected(now) || dead.Passive.Score >= cfg.EjectScore {
+		t.Fatalf("dead node should be ejected: %+v", dead.Passive)
+	}
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "good" {
+		t.Fatalf("expected good node after demotion/ejection, got %s", n.ID)
+	}
+
+	// 摘除到期后清空窗口重新评分；慢节点恢复后取消降权
+	now = now.Add(cfg.EjectDuration + time.Second)
+	tr.reset("slow")
+	feedPassive(tr, "slow", 30, passiveSample{ok: true, latency: 900 * time.Millisecond, firstByte: 400 * time.Millisecond})
+	srv.evaluateAccountPassive(acc, cfg)
+	if dead.ejected(now) || tr.stats("dead").Requests != 0 {
+		t.Fatalf("ejection should expire and reset window: %+v", dead.Passive)
+	}
+	if slow.Passive.Penalty != 0 {
+		t.Fatalf("slow node should be promoted back, score=%v", slow.Passive.Score)
+	}
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "dead" && n.ID != "slow" {
+		t.Fatalf("weight-1 nodes should lead again, got %s", n.ID)
+	}
+}
+
+func TestPassiveEjectionRespectsMaxPercent(t *testing.T) {
+	tr := newPassiveTracker()
+	a := &Node{ID: "a", Name: "a", Weight: 1}
+	b := &Node{ID: "b", Name: "b", Weight: 2}
+	acc := lbTestAccount(a, b)
+	srv := &Server{passive: tr, logger: log.New(io.Discard, "", 0)}
+
+	feedPassive(tr, "a", 30, passiveSample{latency: time.Second})
+	feedPassive(tr, "b", 30, passiveSample{latency: time.Second})
+	srv.evaluateAccountPassive(acc, defaultPassiveConfig())
+	now := time.Now()
+	if a.ejected(now) == b.ejected(now) {
+		t.Fatalf("exactly one of two failing nodes may be ejected at 50%%: a=%v b=%v", a.ejected(now), b.ejected(now))
+	}
+}
+
+// TestPassiveEvaluationWithoutLogger 未配置 logger 的 Server 在降权/摘除时不应 panic。
+func TestPassiveEvaluationWithoutLogger(t *testing.T) {
+	tr := newPassiveTracker()
+	slow := &Node{ID: "slow", Name: "slow", Weight: 1}
+	dead := &Node{ID: "dead", Name: "dead", Weight: 1}
+	good := &Node{ID: "good", Name: "good", Weight: 2}
+	acc := lbTestAccount(slow, dead, good)
+	srv := &Server{passive: tr}
+
+	feedPassive(tr, "good", 30, passiveSample{ok: true, latency: 900 * time.Millisecond, firstByte: 400 * time.Millisecond})
+	feedPassive(tr, "slow", 25, passiveSample{ok: true, latency: 15 * time.Second, firstByte: 4 * time.Second})
+	feedPassive(tr, "slow", 5, passiveSample{latency: 300 * time.Millisecond, rateLimited: true})
+	feedPassive(tr, "dead", 30, passiveSample{latency: 30 * time.Second, timedOut: true})
+	srv.evaluateAccountPassive(acc, defaultPassiveConfig())
+	if !dead.ejected(time.Now()) || slow.Passive.Penalty == 0 {
+		t.Fatalf("expected ejection and demotion: dead=%+v slow=%+v", dead.Passive, slow.Passive)
+	}
+}
+
+func TestPassiveSkipsClientErrors(t *testing.T) {
+	tr := newPassiveTracker()
+	srv := &Server{passive: tr}
+	start := time.Now()
+	for _, status := range []int{200, 400, 401, 404, 413, 422, 429, 408, 500, 529, 0} {
+		srv.observePassive("a", start, &metricsWriter{status: status}, status, false)
+	}
+	srv.observePassive("a", start, &metricsWriter{}, 0, true)
+	st := tr.stats("a")
+	// 200 成功；429、408、500、529、传输错误与超时记为失败；其余 4xx 不计样本
+	if st.Requests != 7 || st.Success != 1 || st.RateLimited != 1 || st.Timeouts != 1 {
+		t.Fatalf("unexpected counters: %+v", st)
+	}
+}
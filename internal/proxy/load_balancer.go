@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"qcc_plus/internal/store"
+)
+
+// LoadBalanceStrategy 节点选择策略。
+type LoadBalanceStrategy string
+
+const (
+	// LBStrategyPriority 严格优先级：始终选择权重值最小的健康节点（默认，兼容旧行为）。
+	LBStrategyPriority LoadBalanceStrategy = "priority"
+	// LBStrategyWeighted 平滑加权轮询：权重值越小分得的流量越多。
+	LBStrategyWeighted LoadBalanceStrategy = "weighted_round_robin"
+	// LBStrategyLeastInFlight 最少在途请求。
+	LBStrategyLeastInFlight LoadBalanceStrategy = "least_inflight"
+	// LBStrategyEWMALatency 基于首字节延时 EWMA 的最低延时优先。
+	LBStrategyEWMALatency LoadBalanceStrategy = "ewma_latency"
+
+	defaultLBStrategy = LBStrategyPriority
+	settingLBStrategy = "proxy.lb_strategy"
+
+	// ewmaAlpha 新样本权重，越大对延时变化越敏感。
+	ewmaAlpha = 0.3
+)
+
+// nodeSelector 从候选节点中选出一个。candidates 非空且已按 (有效权重, ID) 排序，调用方持有 p.mu 读锁。
+type nodeSelector interface {
+	Select(acc *Account, candidates []*Node) *Node
+}
+
+var (
+	selectorsMu   sync.RWMutex
+	nodeSelectors = map[LoadBalanceStrategy]nodeSelector{}
+)
+
+// registerNodeSelector 注册选择策略，同名覆盖。
+func registerNodeSelector(name LoadBalanceStrategy, sel nodeSelector) {
+	selectorsMu.Lock()
+	defer selectorsMu.Unlock()
+	nodeSelectors[name] = sel
+}
+
+func getNodeSelector(name LoadBalanceStrategy) nodeSelector {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	if sel, ok := nodeSelectors[name]; ok {
+		return sel
+	}
+	return nodeSelectors[defaultLBStrategy]
+}
+
+// supportedLBStrategies 返回已注册策略名（排序后），供 API 展示与校验。
+func supportedLBStrategies() []string {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+	names := make([]string, 0, len(nodeSelectors))
+	for name := range nodeSelectors {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseLBStrategy 校验并规范化策略名；空串表示跟随系统默认。
+func parseLBStrategy(raw string) (LoadBalanceStrategy, error) {
+	name := LoadBalanceStrategy(strings.ToLower(strings.TrimSpace(raw)))
+	if name == "" {
+		return "", nil
+	}
+	selectorsMu.RLock()
+	_, ok := nodeSelectors[name]
+	selectorsMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unsupported lb_strategy %q, available: %s", raw, strings.Join(supportedLBStrategies(), ", "))
+	}
+	return name, nil
+}
+
+func init() {
+	registerNodeSelector(LBStrategyPriority, prioritySelector{})
+	registerNodeSelector(LBStrategyWeighted, &weightedRoundRobinSelector{current: make(map[string]map[string]int)})
+	registerNodeSelector(LBStrategyLeastInFlight, leastInFlightSelector{})
+	registerNodeSelector(LBStrategyEWMALatency, ewmaLatencySelector{})
+}
+
+// prioritySelector 选择权重值最小的节点。
+type prioritySelector struct{}
+
+func (prioritySelector) Select(_ *Account, candidates []*Node) *Node {
+	return candidates[0]
+}
+
+// weightedRoundRobinSelector 平滑加权轮询（nginx 算法）。
+// 权重值越小优先级越高，因此有效权重取 maxWeight+1-Weight：权重 1 与 2 的节点按 2:1 分配流量。
+type weightedRoundRobinSelector struct {
+	mu      sync.Mutex
+	current map[string]map[string]int // accountID -> nodeID -> current weight
+}
+
+func (s *weightedRoundRobinSelector) Select(acc *Account, candidates []*Node) *Node {
+	maxWeight := 0
+	for _, n := range candidates {
+		if n.effectiveWeight() > maxWeight {
+			maxWeight = n.effectiveWeight()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.current[acc.ID]
+	if state == nil {
+		state = make(map[string]int)
+		s.current[acc.ID] = state
+	}
+	// 清理已不在候选中的节点，避免删除/失败节点残留的累计值影响分配。
+	alive := make(map[string]struct{}, len(candidates))
+	for _, n := range candidates {
+		alive[n.ID] = struct{}{}
+	}
+	for id := range state {
+		if _, ok := alive[id]; !ok {
+			delete(state, id)
+		}
+	}
+
+	var (
+		best  *Node
+		total int
+	)
+	for _, n := range candidates {
+		effective := maxWeight + 1 - n.effectiveWeight()
+		if effective < 1 {
+			effective = 1
+		}
+		total += effective
+		state[n.ID] += effective
+		if best == nil || state[n.ID] > state[best.ID] {
+			best = n
+		}
+	}
+	state[best.ID] -= total
+	return best
+}
+
+// leastInFlightSelector 选择在途请求最少的节点，相同时按权重优先。
+type leastInFlightSelector struct{}
+
+func (leastInFlightSelector) Select(_ *Account, candidates []*Node) *Node {
+	best := candidates[0]
+	bestLoad := atomic.LoadInt64(&best.InFlight)
+	for _, n := range candidates[1:] {
+		if load := atomic.LoadInt64(&n.InFlight); load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+	return best
+}
+
+// ewmaLatencySelector 选择延时评分最低的节点。
+// 评分 = 首字节延时 EWMA（无流量样本时退化为最近一次探活延时）×（在途请求数+1），
+// 在途放大可避免所有请求瞬间涌向同一个最快节点。从未测得延时的节点评分为 0，优先获得试探流量。
+type ewmaLatencySelector struct{}
+
+func (ewmaLatencySelector) Select(_ *Account, candidates []*Node) *Node {
+	best := candidates[0]
+	bestScore := latencyScore(best)
+	for _, n := range candidates[1:] {
+		if score := latencyScore(n); score < bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+func latencyScore(n *Node) float64 {
+	latency := n.Metrics.EWMALatencyMS
+	if latency <= 0 && n.Metrics.LastPingMS > 0 {
+		latency = float64(n.Metrics.LastPingMS)
+	}
+	return latency * float64(atomic.LoadInt64(&n.InFlight)+1)
+}
+
+// updateLatencyEWMA 合并一个首字节延时样本。调用方需持有 p.mu 写锁。
+func updateLatencyEWMA(m *metrics, sampleMS float64) {
+	if sampleMS < 0 {
+		return
+	}
+	if m.EWMALatencyMS <= 0 {
+		m.EWMALatencyMS = sampleMS
+		return
+	}
+	m.EWMALatencyMS = ewmaAlpha*sampleMS + (1-ewmaAlpha)*m.EWMALatencyMS
+}
+
+// lbStrategyFor 返回账号生效的策略：账号覆盖 > 系统配置 proxy.lb_strategy > priority。调用方需持有 p.mu。
+func (p *Server) lbStrategyFor(acc *Account) LoadBalanceStrategy {
+	if acc != nil && acc.LBStrategy != "" {
+		return acc.LBStrategy
+	}
+	if p.settingsCache != nil {
+		if name, err := parseLBStrategy(p.settingsCache.GetString(settingLBStrategy, "")); err == nil && name != "" {
+			return name
+		}
+	}
+	return defaultLBStrategy
+}
+
+// setAccountLBStrategy 更新账号级策略覆盖并持久化到 settings（scope=account）；空串表示恢复跟随系统配置。
+func (p *Server) setAccountLBStrategy(acc *Account, strategy LoadBalanceStrategy) error {
+	if acc == nil {
+		return nil
+	}
+	p.mu.Lock()
+	acc.LBStrategy = strategy
+	p.mu.Unlock()
+
+	if p.store == nil {
+		return nil
+	}
+	if strategy == "" {
+		if err := p.store.DeleteSetting(settingLBStrategy, "account", acc.ID); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	accountID := acc.ID
+	desc := "账号级节点选择策略"
+	return p.store.UpsertSetting(&store.Setting{
+		Key:         settingLBStrategy,
+		Scope:       "account",
+		AccountID:   &accountID,
+		Value:       string(strategy),
+		DataType:    "string",
+		Category:    "performance",
+		Description: &desc,
+	})
+}
+
+// loadAccountLBStrategy 从 settings 读取账号级策略覆盖。
+func (p *Server) loadAccountLBStrategy(accountID string) LoadBalanceStrategy {
+	if p.store == nil {
+		return ""
+	}
+	setting, err := p.store.GetSetting(settingLBStrategy, "account", accountID)
+	if err != nil || setting == nil {
+		return ""
+	}
+	raw, _ := setting.Value.(string)
+	name, err := parseLBStrategy(raw)
+	if err != nil {
+		p.logger.Printf("account %s: ignore invalid %s=%v", accountID, settingLBStrategy, setting.Value)
+		return ""
+	}
+	return name
+}
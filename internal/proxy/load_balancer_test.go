@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func lbTestAccount(nodes ...*Node) *Account {
+	acc := &Account{ID: "acc", Nodes: make(map[string]*Node), FailedSet: make(map[string]struct{})}
+	for _, n := range nodes {
+		acc.Nodes[n.ID] = n
+	}
+	return acc
+}
+
+// TestWeightedRoundRobinDistribution 权重 1 与 2 的节点应按 2:1 分配流量。
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	acc := lbTestAccount(&Node{ID: "a", Weight: 1}, &Node{ID: "b", Weight: 2})
+	acc.LBStrategy = LBStrategyWeighted
+	srv := &Server{}
+
+	counts := map[string]int{}
+	for i := 0; i < 30; i++ {
+		counts[srv.selectHealthyNodeExcluding(acc, nil).ID]++
+	}
+	if counts["a"] != 20 || counts["b"] != 10 {
+		t.Fatalf("unexpected distribution: %v", counts)
+	}
+
+	// 排除节点后只剩一个候选。
+	if n := srv.selectHealthyNodeExcluding(acc, map[string]bool{"a": true}); n == nil || n.ID != "b" {
+		t.Fatalf("expected b when a skipped, got %+v", n)
+	}
+}
+
+func TestLeastInFlightAndEWMASelection(t *testing.T) {
+	a := &Node{ID: "a", Weight: 1, InFlight: 3}
+	b := &Node{ID: "b", Weight: 2, InFlight: 1}
+	acc := lbTestAccount(a, b)
+	srv := &Server{}
+
+	acc.LBStrategy = LBStrategyLeastInFlight
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "b" {
+		t.Fatalf("least_inflight picked %s, want b", n.ID)
+	}
+
+	acc.LBStrategy = LBStrategyEWMALatency
+	a.InFlight, b.InFlight = 0, 0
+	updateLatencyEWMA(&a.Metrics, 800)
+	updateLatencyEWMA(&b.Metrics, 200)
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "b" {
+		t.Fatalf("ewma_latency picked %s, want b", n.ID)
+	}
+	// 在途请求放大评分：b 延时 200ms × 5 > a 800ms × 1。
+	b.InFlight = 4
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "a" {
+		t.Fatalf("ewma_latency with load picked %s, want a", n.ID)
+	}
+
+	acc.LBStrategy = LBStrategyPriority
+	if n := srv.selectHealthyNodeExcluding(acc, nil); n.ID != "a" {
+		t.Fatalf("priority picked %s, want a", n.ID)
+	}
+}
+
+func TestParseLBStrategy(t *testing.T) {
+	if s, err := parseLBStrategy(" Least_InFlight "); err != nil || s != LBStrategyLeastInFlight {
+		t.Fatalf("parse: %v %v", s, err)
+	}
+	if s, err := parseLBStrategy(""); err != nil || s != "" {
+		t.Fatalf("empty should follow system default: %v %v", s, err)
+	}
+	if _, err := parseLBStrategy("random"); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
+
+// TestServeAttemptReleasesInFlightOnAbort 客户端断开导致 ErrAbortHandler panic 时在途计数仍需归还。
+func TestServeAttemptReleasesInFlightOnAbort(t *testing.T) {
+	node := &Node{ID: "a"}
+	aborting := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		if node.InFlight != 1 {
+			t.Errorf("in-flight during attempt = %d, want 1", node.InFlight)
+		}
+		panic(http.ErrAbortHandler)
+	})
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Fatalf("unexpected recover value: %v", rec)
+			}
+		}()
+		serveAttempt(aborting, node, httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	}()
+	if node.InFlight != 0 {
+		t.Fatalf("in-flight leaked: %d", node.InFlight)
+	}
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+)
+
+const (
+	settingLoginMaxFailures = "security.login_max_failures"
+	settingLoginLockoutSec  = "security.login_lockout_sec"
+
+	defaultLoginMaxFailures = 5
+	defaultLoginLockout     = 15 * time.Minute
+)
+
+// loginAttempts 单个 IP 或用户名的失败记录。
+type loginAttempts struct {
+	failures    int
+	firstAt     time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard 按 IP 与用户名分别统计登录失败，连续失败达到阈值后在锁定时长内拒绝登录。
+// 失败计数在一个锁定时长的窗口内累计，窗口过期后重新计数。
+type loginGuard struct {
+	mu        sync.Mutex
+	entries   map[string]*loginAttempts
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{entries: make(map[string]*loginAttempts), now: time.Now}
+}
+
+// lockedFor 返回 keys 中剩余锁定时间最长的一项，未锁定时返回 0。
+func (g *loginGuard) lockedFor(keys ...string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	var remaining time.Duration
+	for _, k := range keys {
+		if e := g.entries[k]; e != nil && now.Before(e.lockedUntil) {
+			if d := e.lockedUntil.Sub(now); d > remaining {
+				remaining = d
+			}
+		}
+	}
+	return remaining
+}
+
+// fail 记录一次失败，返回该 key 是否因此进入锁定。
+func (g *loginGuard) fail(key string, maxFailures int, lockout time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.pruneLocked(now, lockout)
+	e := g.entries[key]
+	if e == nil || now.Sub(e.firstAt) > lockout {
+		e = &loginAttempts{firstAt: now}
+		g.entries[key] = e
+	}
+	e.failures++
+	if e.failures >= maxFailures {
+		e.failures = 0
+		e.firstAt = now
+		e.lockedUntil = now.Add(lockout)
+		return true
+	}
+	return false
+}
+
+// reset 登录成功后清除失败记录。
+func (g *loginGuard) reset(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range keys {
+		delete(g.entries, k)
+	}
+}
+
+// pruneLocked 每分钟最多清理一次过期记录，避免扫描型攻击撑大内存。调用方需持有 g.mu。
+func (g *loginGuard) pruneLocked(now time.Time, window time.Duration) {
+	if now.Sub(g.lastPrune) < time.Minute {
+		return
+	}
+	g.lastPrune = now
+	for k, e := range g.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.firstAt) > window {
+			delete(g.entries, k)
+		}
+	}
+}
+
+// clientIP 返回请求来源 IP。默认只使用直连地址；仅当直连方命中 TRUSTED_PROXIES 时才解析转发头：
+// 从 X-Forwarded-For 最右侧向左跳过可信代理，取第一个不可信的地址（由最外层可信代理写入，客户端无法伪造），
+// 没有 X-Forwarded-For 时使用代理设置的 X-Real-IP。
+func (p *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !ipInNets(net.ParseIP(host), p.trustedProxies) {
+		return host
+	}
+	if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+		hops := strings.Split(strings.Join(fwd, ","), ",")
+		var last net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			last = ip
+			if !ipInNets(ip, p.trustedProxies) {
+				return ip.String()
+			}
+		}
+		// 整条链都是可信代理时取最左侧的有效地址。
+		if last != nil {
+			return last.String()
+		}
+		return host
+	}
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real.String()
+	}
+	return host
+}
+
+// ipInNets 判断 ip 是否落在任一网段内，ip 为 nil 时返回 false。
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginLimits 返回失败阈值与锁定时长（系统配置 security.login_max_failures / security.login_lockout_sec）。
+func (p *Server) loginLimits() (int, time.Duration) {
+	maxFailures, lockout := defaultLoginMaxFailures, defaultLoginLockout
+	if p.settingsCache != nil {
+		if v := p.settingsCache.GetInt(settingLoginMaxFailures, maxFailures); v > 0 {
+			maxFailures = v
+		}
+		if v := p.settingsCache.GetInt(settingLoginLockoutSec, 0); v > 0 {
+			lockout = time.Duration(v) * time.Second
+		}
+	}
+	return maxFailures, lockout
+}
+
+// recordLoginFailure 记录登录失败；IP 或用户名进入锁定时发送 account.auth_failed 通知。
+func (p *Server) recordLoginFailure(ip, username string, account *Account) {
+	maxFailures, lockout := p.loginLimits()
+	ipLocked := p.loginGuard.fail("ip:"+ip, maxFailures, lockout)
+	userLocked := p.loginGuard.fail("user:"+username, maxFailures, lockout)
+	if !ipLocked && !userLocked {
+		return
+	}
+	p.logger.Printf("login locked: ip=%s username=%s ip_locked=%v user_locked=%v", ip, username, ipLocked, userLocked)
+	if p.notifyMgr == nil {
+		return
+	}
+	accountID := store.DefaultAccountID
+	if account != nil {
+		accountID = account.ID
+	} else if p.defaultAccount != nil {
+		accountID = p.defaultAccount.ID
+	}
+	target := "ip"
+	if userLocked {
+		target = "account"
+	}
+	p.notifyMgr.Publish(notify.Event{
+		AccountID: accountID,
+		EventType: notify.EventAccountAuthFailed,
+		Data: map[string]any{
+			"username":    username,
+			"ip":          ip,
+			"lock_target": target,
+			"failures":    maxFailures,
+			"lockout":     lockout.String(),
+		},
+		DedupKey:   "login:" + ip + ":" + username,
+		OccurredAt: time.Now(),
+	})
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginUpgradesPlaintextPassword(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(up.URL))
+
+	for i := 0; i < 2; i++ {
+		rec := postLogin(srv, "10.0.0.1:1234", "admin", "admin123")
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login #%d status=%d body=%s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	acc := srv.getAccountByID("admin-mem")
+	if acc == nil || !isPasswordHash(acc.Password) {
+		t.Fatalf("password should be upgraded to bcrypt hash: %+v", acc)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(up.URL))
+	now := time.Now()
+	srv.loginGuard.now = func() time.Time { return now }
+
+	for i := 0; i < defaultLoginMaxFailures; i++ {
+		if rec := postLogin(srv, "203.0.113.7:5555", "admin", "wrong"); rec.Code != http.StatusOK {
+			t.Fatalf("failure #%d status=%d", i+1, rec.Code)
+		}
+	}
+	// 锁定期间即使密码正确也拒绝，来自其他 IP 的同名账号同样被锁定。
+	rec := postLogin(srv, "198.51.100.1:5555", "admin", "admin123")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 while locked, got %d", rec.Code)
+	}
+
+	now = now.Add(defaultLoginLockout + time.Second)
+	if rec := postLogin(srv, "198.51.100.1:5555", "admin", "admin123"); rec.Code != http.StatusFound {
+		t.Fatalf("expected login after lockout expires, got %d", rec.Code)
+	}
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	srv := &Server{}
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = "127.0.0.1:1000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	r.Header.Set("X-Real-IP", "203.0.113.10")
+	// 未配置可信代理时即使直连方为本机也不信任转发头。
+	if got := srv.clientIP(r); got != "127.0.0.1" {
+		t.Fatalf("clientIP without trusted proxies=%s", got)
+	}
+
+	nets, err := parseAllowList("127.0.0.1,10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	srv.trustedProxies = nets
+	// 取最右侧不可信的一跳，客户端自行添加的左侧值被忽略。
+	if got := srv.clientIP(r); got != "198.51.100.7" {
+		t.Fatalf("clientIP via trusted proxy=%s", got)
+	}
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.3")
+	if got := srv.clientIP(r); got != "198.51.100.7" {
+		t.Fatalf("clientIP via proxy chain=%s", got)
+	}
+	r.Header.Del("X-Forwarded-For")
+	if got := srv.clientIP(r); got != "203.0.113.10" {
+		t.Fatalf("clientIP via X-Real-IP=%s", got)
+	}
+	r.RemoteAddr = "198.51.100.2:1000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if got := srv.clientIP(r); got != "198.51.100.2" {
+		t.Fatalf("clientIP from untrusted peer=%s", got)
+	}
+}
+
+// TestLoginLockoutIgnoresSpoofedForwardedFor 伪造 X-Forwarded-For 不能绕过按 IP 的锁定。
+func TestLoginLockoutIgnoresSpoofedForwardedFor(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(up.URL))
+	h := srv.Handler()
+	for i := 0; i < defaultLoginMaxFailures; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=nobody"+strconv.Itoa(i)+"&password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", "198.51.100."+strconv.Itoa(i+1))
+		req.RemoteAddr = "127.0.0.1:5555"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if rec := postLogin(srv, "127.0.0.1:5555", "admin", "admin123"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected ip lockout despite spoofed headers, got %d", rec.Code)
+	}
+	if !isPasswordHash(dummyPasswordHash()) {
+		t.Fatalf("dummy hash should be bcrypt")
+	}
+}
+
+func postLogin(srv *Server, remote, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username="+username+"&password="+password))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	return rec
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"regexp"
 	"time"
 
 	"qcc_plus/internal/store"
@@ -19,6 +20,10 @@ type metricsWriter struct {
 	lastAt      time.Time
 	bytes       int64
 	status      int
+
+	captureLimit int // >0 时缓存响应体前 captureLimit 字节，供请求日志使用
+	captured     []byte
+	capTruncated bool
 }
 
 func (mw *metricsWriter) Header() http.Header { return mw.ResponseWriter.Header() }
@@ -42,10 +47,29 @@ func (mw *metricsWriter) Write(b []byte) (int, error) {
 	}
 	mw.lastAt = time.Now()
 	mw.bytes += int64(len(b))
+	if mw.captureLimit > 0 && !mw.capTruncated {
+		room := mw.captureLimit - len(mw.captured)
+		if len(b) > room {
+			mw.captured = append(mw.captured, b[:room]...)
+			mw.capTruncated = true
+		} else {
+			mw.captured = append(mw.captured, b...)
+		}
+	}
 	return mw.ResponseWriter.Write(b)
 }
 
-func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter, u *usage, retryAttempts, retrySuccess int64) {
+// Flush 透传到底层 ResponseWriter，保证流式响应按 FlushInterval 及时下发。
+func (mw *metricsWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接。
+func (mw *metricsWriter) Unwrap() http.ResponseWriter { return mw.ResponseWriter }
+
+func (p *Server) recordMetrics(nodeID, apiKeyID string, start time.Time, mw *metricsWriter, u *usage, retryAttempts, retrySuccess int64) {
 	end := time.Now()
 	var (
 		nodeRec      store.NodeRecord
@@ -82,6 +106,9 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 	node.Metrics.Requests++
 	if mw != nil && mw.firstWrite {
 		node.Metrics.FirstByteDur += mw.firstAt.Sub(start)
+		if mw.status == http.StatusOK {
+			updateLatencyEWMA(&node.Metrics, float64(mw.firstAt.Sub(start).Microseconds())/1000)
+		}
 		node.Metrics.StreamDur += mw.lastAt.Sub(mw.firstAt)
 		node.Metrics.TotalBytes += mw.bytes
 	}
@@ -103,6 +130,7 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 	if p.store != nil {
 		nodeRec = toRecord(node)
 		metricsRec = buildMetricsRecord(accountID, nodeID, start, end, mw, u, retryAttempts, retrySuccess)
+		metricsRec.APIKeyID = apiKeyID
 	}
 	nodeName = node.Name
 	nodeIDCopy = node.ID
@@ -118,6 +146,8 @@ func (p *Server) recordMetrics(nodeID string, start time.Time, mw *metricsWriter
 	method = node.HealthCheckMethod
 	p.mu.Unlock()
 
+	p.prom.observe(accountID, nodeIDCopy, start, end, mw, u, retryAttempts)
+
 	if p.store != nil {
 		_ = p.store.UpsertNode(context.Background(), nodeRec)
 		if metricsRec != nil {
@@ -196,10 +226,12 @@ func buildMetricsRecord(accountID, nodeID string, start, end time.Time, mw *metr
 		}
 		if mw.firstWrite {
 			rec.FirstByteTimeSumMs = mw.firstAt.Sub(start).Milliseconds()
+			rec.FirstByteHist.Observe(rec.FirstByteTimeSumMs)
 			rec.StreamDurationSumMs = mw.lastAt.Sub(mw.firstAt).Milliseconds()
 			rec.ResponseTimeSumMs = mw.lastAt.Sub(start).Milliseconds()
 		}
 	}
+	rec.ResponseTimeHist.Observe(rec.ResponseTimeSumMs)
 	if u != nil {
 		rec.InputTokensTotal = u.input
 		rec.OutputTokensTotal = u.output
@@ -207,18 +239,52 @@ func buildMetricsRecord(accountID, nodeID string, start, end time.Time, mw *metr
 	return rec
 }
 
-// 从响应体或 SSE 数据中粗略提取 usage 字段（JSON 格式）。
-func parseUsage(b []byte) (int64, int64) {
+// parseUsage 从响应体或 SSE 数据中粗略提取 usage 与模型名。
+// 流式响应的 usage 分散在 message_start（输入与缓存）与 message_delta（累计输出）中，因此合并所有 usage 对象，各字段取最大值。
+func parseUsage(b []byte) usage {
+	var u usage
 	key := []byte("\"usage\"")
-	idx := bytes.LastIndex(b, key)
-	if idx < 0 {
-		return 0, 0
+	for off := 0; off < len(b); {
+		idx := bytes.Index(b[off:], key)
+		if idx < 0 {
+			break
+		}
+		idx += off
+		off = idx + len(key)
+		obj := jsonObjectAt(b, idx+len(key))
+		if obj == nil {
+			continue
+		}
+		var tmp struct {
+			InputTokens              int64 `json:"input_tokens"`
+			OutputTokens             int64 `json:"output_tokens"`
+			CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+		}
+		if err := json.Unmarshal(obj, &tmp); err != nil {
+			continue
+		}
+		u.input = maxInt64(u.input, tmp.InputTokens)
+		u.output = maxInt64(u.output, tmp.OutputTokens)
+		u.cacheCreation = maxInt64(u.cacheCreation, tmp.CacheCreationInputTokens)
+		u.cacheRead = maxInt64(u.cacheRead, tmp.CacheReadInputTokens)
 	}
-	braceStart := bytes.IndexByte(b[idx:], '{')
+	if m := usageModelPattern.FindSubmatch(b); m != nil {
+		u.model = string(m[1])
+	}
+	return u
+}
+
+// usageModelPattern 匹配响应中首个 "model" 字段（非流式响应顶层或 message_start.message）。
+var usageModelPattern = regexp.MustCompile(`"model"\s*:\s*"([^"\\]+)"`)
+
+// jsonObjectAt 返回 from 之后第一个完整（花括号配平）的 JSON 对象；数据被截断时返回 nil。
+func jsonObjectAt(b []byte, from int) []byte {
+	braceStart := bytes.IndexByte(b[from:], '{')
 	if braceStart < 0 {
-		return 0, 0
+		return nil
 	}
-	braceStart += idx
+	braceStart += from
 	depth := 0
 	for i := braceStart; i < len(b); i++ {
 		switch b[i] {
@@ -227,17 +293,9 @@ func parseUsage(b []byte) (int64, int64) {
 		case '}':
 			depth--
 			if depth == 0 {
-				usageObj := b[braceStart : i+1]
-				var tmp struct {
-					InputTokens  int64 `json:"input_tokens"`
-					OutputTokens int64 `json:"output_tokens"`
-				}
-				if err := json.Unmarshal(usageObj, &tmp); err == nil {
-					return tmp.InputTokens, tmp.OutputTokens
-				}
-				break
+				return b[braceStart : i+1]
 			}
 		}
 	}
-	return 0, 0
+	return nil
 }
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// matchModelPattern 判断模型名是否匹配规则；规则以 * 结尾时按前缀匹配。
+func matchModelPattern(pattern, model string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(model, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == model
+}
+
+// mapModel 按节点模型映射改写模型名：精确匹配优先，其次取前缀最长的通配规则。调用方需持有 p.mu 读锁。
+func (n *Node) mapModel(model string) (string, bool) {
+	if model == "" || len(n.ModelMap) == 0 {
+		return "", false
+	}
+	if target, ok := n.ModelMap[model]; ok {
+		return target, true
+	}
+	best, bestLen := "", -1
+	for pattern, target := range n.ModelMap {
+		if strings.HasSuffix(pattern, "*") && matchModelPattern(pattern, model) && len(pattern) > bestLen {
+			best, bestLen = target, len(pattern)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// supportsModel 判断节点能否服务请求模型：未配置白名单或模型为空时不限制，命中模型映射的模型视为支持。调用方需持有 p.mu 读锁。
+func (n *Node) supportsModel(model string) bool {
+	if model == "" || len(n.SupportedModels) == 0 {
+		return true
+	}
+	for _, pattern := range n.SupportedModels {
+		if matchModelPattern(pattern, model) {
+			return true
+		}
+	}
+	_, mapped := n.mapModel(model)
+	return mapped
+}
+
+// normalizeModelRules 清理并校验模型白名单与模型映射。
+func normalizeModelRules(supported []string, modelMap map[string]string) ([]string, map[string]string, error) {
+	var cleaned []string
+	for _, m := range supported {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if strings.Contains(strings.TrimSuffix(m, "*"), "*") || strings.Contains(m, ",") {
+			return nil, nil, fmt.Errorf("invalid model pattern %q: only a trailing * is allowed", m)
+		}
+		cleaned = append(cleaned, m)
+	}
+	var mapping map[string]string
+	for from, to := range modelMap {
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if from == "" || to == "" {
+			return nil, nil, errors.New("model_map keys and values must not be empty")
+		}
+		if strings.Contains(strings.TrimSuffix(from, "*"), "*") || strings.Contains(to, "*") {
+			return nil, nil, fmt.Errorf("invalid model_map entry %q -> %q: only a trailing * is allowed in keys", from, to)
+		}
+		if mapping == nil {
+			mapping = make(map[string]string, len(modelMap))
+		}
+		mapping[from] = to
+	}
+	return cleaned, mapping, nil
+}
+
+func derefStrings(v *[]string) []string {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func derefModelMap(v *map[string]string) map[string]string {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// setNodeModels 更新节点的模型白名单与模型映射，nil 表示保持不变。
+func (p *Server) setNodeModels(id string, supported *[]string, modelMap *map[string]string) error {
+	if supported == nil && modelMap == nil {
+		return nil
+	}
+	p.mu.Lock()
+	n, ok := p.nodeIndex[id]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	nextSupported, nextMap := n.SupportedModels, n.ModelMap
+	if supported != nil {
+		nextSupported = *supported
+	}
+	if modelMap != nil {
+		nextMap = *modelMap
+	}
+	cleaned, mapping, err := normalizeModelRules(nextSupported, nextMap)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	// 整体替换而非原地修改，请求路径只需读锁即可安全读取。
+	n.SupportedModels = cleaned
+	n.ModelMap = mapping
+	rec := toRecord(n)
+	p.mu.Unlock()
+
+	if p.store != nil {
+		return p.store.UpsertNode(context.Background(), rec)
+	}
+	return nil
+}
+
+// excludeNodesForModel 把账号下无法服务该模型的节点加入 skip，返回是否仍有节点可用。
+func (p *Server) excludeNodesForModel(acc *Account, model string, skip map[string]bool) bool {
+	if acc == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	available := len(acc.Nodes) == 0
+	for id, n := range acc.Nodes {
+		if n.supportsModel(model) {
+			available = true
+		} else {
+			skip[id] = true
+		}
+	}
+	return available
+}
+
+// rewriteModelForNode 按节点模型映射改写请求体中的 model 字段，未命中映射时原样返回。
+func (p *Server) rewriteModelForNode(node *Node, body []byte) ([]byte, bool) {
+	model := requestModel(body)
+	p.mu.RLock()
+	target, ok := node.mapModel(model)
+	p.mu.RUnlock()
+	if !ok || target == model {
+		return body, false
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body, false
+	}
+	encoded, err := json.Marshal(target)
+	if err != nil {
+		return body, false
+	}
+	payload["model"] = encoded
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload); err != nil {
+		return body, false
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), true
+}
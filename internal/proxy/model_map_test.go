@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNodeModelMapPrecedence(t *testing.T) {
+	n := &Node{ModelMap: map[string]string{
+		"claude-sonnet-4-5-*":        "relay-sonnet",
+		"claude-sonnet-4-5-2025*":    "relay-sonnet-2025",
+		"claude-sonnet-4-5-20250929": "relay-sonnet-exact",
+	}}
+	cases := map[string]string{
+		"claude-sonnet-4-5-20250929": "relay-sonnet-exact",
+		"claude-sonnet-4-5-20251101": "relay-sonnet-2025",
+		"claude-sonnet-4-5-latest":   "relay-sonnet",
+	}
+	for model, want := range cases {
+		if got, ok := n.mapModel(model); !ok || got != want {
+			t.Errorf("mapModel(%q)=%q,%v want %q", model, got, ok, want)
+		}
+	}
+	if _, ok := n.mapModel("claude-opus-4-1"); ok {
+		t.Fatalf("unmapped model should not be rewritten")
+	}
+
+	n.SupportedModels = []string{"claude-haiku-*"}
+	if !n.supportsModel("claude-haiku-4-5") || !n.supportsModel("claude-sonnet-4-5-x") || n.supportsModel("claude-opus-4-1") {
+		t.Fatalf("unexpected supportsModel result")
+	}
+	if _, _, err := normalizeModelRules([]string{"claude-*-4"}, nil); err == nil {
+		t.Fatalf("expected error for inner wildcard")
+	}
+}
+
+func TestForwardMessagesRoutesByModel(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			seen[name] = requestModel(body)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	primary := newUpstream("primary")
+	defer primary.Close()
+	relay := newUpstream("relay")
+	defer relay.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(primary.URL).WithAPIKey("test-proxy"))
+	acc := srv.defaultAccount
+	var primaryID string
+	for id := range acc.Nodes {
+		primaryID = id
+	}
+	haikuOnly := []string{"claude-haiku-*"}
+	if err := srv.setNodeModels(primaryID, &haikuOnly, nil); err != nil {
+		t.Fatalf("set primary models: %v", err)
+	}
+	relayNode, err := srv.addNodeWithMethod(acc, "relay", relay.URL, "relay-key", 5, HealthCheckMethodHEAD, "")
+	if err != nil {
+		t.Fatalf("add relay: %v", err)
+	}
+	relayMap := map[string]string{"claude-sonnet-4-5-*": "relay-sonnet"}
+	relayModels := []string{}
+	if err := srv.setNodeModels(relayNode.ID, &relayModels, &relayMap); err != nil {
+		t.Fatalf("set relay models: %v", err)
+	}
+
+	send := func(model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"`+model+`","max_tokens":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-api-key", "test-proxy")
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send("claude-sonnet-4-5-20250929"); rec.Code != http.StatusOK {
+		t.Fatalf("sonnet status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := send("claude-haiku-4-5"); rec.Code != http.StatusOK {
+		t.Fatalf("haiku status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	mu.Lock()
+	if seen["relay"] != "relay-sonnet" || seen["primary"] != "claude-haiku-4-5" {
+		t.Fatalf("unexpected routing: %+v", seen)
+	}
+	mu.Unlock()
+
+	// 限定了白名单的 relay 只能服务映射内的模型，primary 只服务 haiku。
+	relayOnly := []string{"claude-sonnet-4-5-*"}
+	if err := srv.setNodeModels(relayNode.ID, &relayOnly, nil); err != nil {
+		t.Fatalf("set relay models: %v", err)
+	}
+	if rec := send("claude-opus-4-1"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "not_found_error") {
+		t.Fatalf("unsupported model status=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
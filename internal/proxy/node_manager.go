@@ -5,11 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"time"
 
 	"qcc_plus/internal/notify"
 	"qcc_plus/internal/store"
-	"qcc_plus/internal/timeutil"
 )
 
 // 添加新节点（默认账号）。
@@ -75,8 +75,7 @@ func (p *Server) addNodeWithMethod(acc *Account, name, rawURL, apiKey string, we
 		p.notifyMgr.Publish(notify.Event{
 			AccountID:  acc.ID,
 			EventType:  notify.EventNodeAdded,
-			Title:      "节点新增",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s\n**权重**: %d\n**时间**: %s", node.Name, node.URL.String(), node.Weight, timeutil.FormatBeijingTime(time.Now())),
+			Data:       map[string]any{"node_id": node.ID, "node_name": node.Name, "url": node.URL.String(), "weight": node.Weight},
 			DedupKey:   node.ID,
 			OccurredAt: time.Now(),
 		})
@@ -149,8 +148,7 @@ func (p *Server) updateNode(id, name, rawURL string, apiKey *string, weight int,
 		p.notifyMgr.Publish(notify.Event{
 			AccountID:  acc.ID,
 			EventType:  notify.EventNodeUpdated,
-			Title:      "节点已更新",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s\n**权重**: %d", n.Name, n.URL.String(), n.Weight),
+			Data:       map[string]any{"node_id": n.ID, "node_name": n.Name, "url": n.URL.String(), "weight": n.Weight},
 			DedupKey:   n.ID,
 			OccurredAt: time.Now(),
 		})
@@ -184,6 +182,10 @@ func (p *Server) deleteNode(id string) error {
 	delete(p.nodeIndex, id)
 	delete(p.nodeAccount, id)
 	p.mu.Unlock()
+	p.forgetProbes(id)
+	if p.passive != nil {
+		p.passive.reset(id)
+	}
 
 	if p.store != nil {
 		if err := p.store.DeleteNode(context.Background(), id); err != nil {
@@ -199,8 +201,7 @@ func (p *Server) deleteNode(id string) error {
 		p.notifyMgr.Publish(notify.Event{
 			AccountID:  accID,
 			EventType:  notify.EventNodeDeleted,
-			Title:      "节点已删除",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**地址**: %s", n.Name, baseURL),
+			Data:       map[string]any{"node_id": n.ID, "node_name": n.Name, "url": baseURL},
 			DedupKey:   n.ID,
 			OccurredAt: time.Now(),
 		})
@@ -259,29 +260,45 @@ func (p *Server) getActiveNode(acc ...*Account) (*Node, error) {
 	return p.getActiveNodeForAccount(p.defaultAccount)
 }
 
-// selectHealthyNodeExcluding 选择健康节点，排除 skipNodes
+// selectHealthyNodeExcluding 按账号的负载均衡策略选择健康节点，排除 skipNodes
 func (p *Server) selectHealthyNodeExcluding(acc *Account, skipNodes map[string]bool) *Node {
 	if acc == nil {
 		return nil
 	}
-
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	var bestNode *Node
+	strategy := p.lbStrategyFor(acc)
+	now := time.Now()
+	candidates := make([]*Node, 0, len(acc.Nodes))
+	var ejected []*Node
 	for id, n := range acc.Nodes {
 		if n.Failed || n.Disabled || p.isInFailedSet(acc, id) || skipNodes[id] {
 			continue
 		}
+		// 被动评分摘除的节点仅在没有其他候选时兜底使用
+		if n.ejected(now) {
+			ejected = append(ejected, n)
+			continue
+		}
 
 		// 不在选择阶段过滤熔断器状态，交由请求阶段的 AllowRequest() 控制
 		// 这样熔断器可以在冷却后进入 Half-Open 状态进行试探
-
-		if bestNode == nil || n.Weight < bestNode.Weight {
-			bestNode = n
-		}
+		candidates = append(candidates, n)
+	}
+	if len(candidates) == 0 {
+		candidates = ejected
 	}
-	return bestNode
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if wi, wj := candidates[i].effectiveWeight(), candidates[j].effectiveWeight(); wi != wj {
+			return wi < wj
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return getNodeSelector(strategy).Select(acc, candidates)
 }
 
 // isInFailedSet 判断节点是否在失败集合中。调用方需确保并发安全（外部加锁或只读场景）。
@@ -308,11 +325,12 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 	prevNode := acc.Nodes[prevID]
 	bestID := ""
 	var bestNode *Node
+	now := time.Now()
 	for id, n := range acc.Nodes {
-		if n.Failed || n.Disabled || p.isInFailedSet(acc, id) {
+		if n.Failed || n.Disabled || p.isInFailedSet(acc, id) || n.ejected(now) {
 			continue
 		}
-		if bestNode == nil || n.Weight < bestNode.Weight || (n.Weight == bestNode.Weight && n.CreatedAt.Before(bestNode.CreatedAt)) {
+		if bestNode == nil || betterActiveCandidate(n, bestNode) {
 			bestNode = n
 			bestID = id
 		}
@@ -355,10 +373,16 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 			fromName = prevNode.Name
 		}
 		p.notifyMgr.Publish(notify.Event{
-			AccountID:  acc.ID,
-			EventType:  notify.EventNodeSwitched,
-			Title:      "节点自动切换",
-			Content:    fmt.Sprintf("**从节点**: %s\n**到节点**: %s (权重: %d)\n**切换原因**: %s", chooseNonEmpty(fromName, "-"), bestNode.Name, bestNode.Weight, switchReason),
+			AccountID: acc.ID,
+			EventType: notify.EventNodeSwitched,
+			Data: map[string]any{
+				"node_id":      bestID,
+				"from_node_id": prevID,
+				"from_node":    chooseNonEmpty(fromName, "-"),
+				"to_node":      bestNode.Name,
+				"weight":       bestNode.Weight,
+				"reason":       switchReason,
+			},
 			DedupKey:   fmt.Sprintf("switch:%s", acc.ID),
 			OccurredAt: time.Now(),
 		})
@@ -367,6 +391,14 @@ func (p *Server) selectBestAndActivate(acc *Account, reason ...string) (*Node, e
 	return bestNode, nil
 }
 
+// betterActiveCandidate 按有效权重（含被动评分降权）与创建时间比较激活候选。调用方需持有 p.mu。
+func betterActiveCandidate(n, best *Node) bool {
+	if wn, wb := n.effectiveWeight(), best.effectiveWeight(); wn != wb {
+		return wn < wb
+	}
+	return n.CreatedAt.Before(best.CreatedAt)
+}
+
 // selectBestAndActivateExcluding 选择最佳节点并激活（排除指定节点）
 // 用于预热失败后尝试下一个节点
 func (p *Server) selectBestAndActivateExcluding(acc *Account, skipNodes map[string]bool, reason ...string) (*Node, error) {
@@ -384,11 +416,12 @@ func (p *Server) selectBestAndActivateExcluding(acc *Account, skipNodes map[stri
 	bestID := ""
 	var bestNode *Node
 
+	now := time.Now()
 	for id, n := range acc.Nodes {
-		if n.Failed || n.Disabled || p.isInFailedSet(acc, id) || (skipNodes != nil && skipNodes[id]) {
+		if n.Failed || n.Disabled || p.isInFailedSet(acc, id) || n.ejected(now) || (skipNodes != nil && skipNodes[id]) {
 			continue
 		}
-		if bestNode == nil || n.Weight < bestNode.Weight || (n.Weight == bestNode.Weight && n.CreatedAt.Before(bestNode.CreatedAt)) {
+		if bestNode == nil || betterActiveCandidate(n, bestNode) {
 			bestNode = n
 			bestID = id
 		}
@@ -431,10 +464,16 @@ func (p *Server) selectBestAndActivateExcluding(acc *Account, skipNodes map[stri
 			fromName = prevNode.Name
 		}
 		p.notifyMgr.Publish(notify.Event{
-			AccountID:  acc.ID,
-			EventType:  notify.EventNodeSwitched,
-			Title:      "节点自动切换",
-			Content:    fmt.Sprintf("**从节点**: %s\n**到节点**: %s (权重: %d)\n**切换原因**: %s", chooseNonEmpty(fromName, "-"), bestNode.Name, bestNode.Weight, switchReason),
+			AccountID: acc.ID,
+			EventType: notify.EventNodeSwitched,
+			Data: map[string]any{
+				"node_id":      bestID,
+				"from_node_id": prevID,
+				"from_node":    chooseNonEmpty(fromName, "-"),
+				"to_node":      bestNode.Name,
+				"weight":       bestNode.Weight,
+				"reason":       switchReason,
+			},
 			DedupKey:   fmt.Sprintf("switch:%s", acc.ID),
 			OccurredAt: time.Now(),
 		})
@@ -467,8 +506,7 @@ func (p *Server) disableNode(id string) error {
 		p.notifyMgr.Publish(notify.Event{
 			AccountID:  acc.ID,
 			EventType:  notify.EventNodeDisabled,
-			Title:      "节点已禁用",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**操作**: 手动禁用", n.Name),
+			Data:       map[string]any{"node_id": n.ID, "node_name": n.Name},
 			DedupKey:   n.ID,
 			OccurredAt: time.Now(),
 		})
@@ -510,8 +548,7 @@ func (p *Server) enableNode(id string) error {
 		p.notifyMgr.Publish(notify.Event{
 			AccountID:  acc.ID,
 			EventType:  notify.EventNodeEnabled,
-			Title:      "节点已启用",
-			Content:    fmt.Sprintf("**节点名称**: %s\n**权重**: %d", n.Name, n.Weight),
+			Data:       map[string]any{"node_id": n.ID, "node_name": n.Name, "weight": n.Weight},
 			DedupKey:   n.ID,
 			OccurredAt: time.Now(),
 		})
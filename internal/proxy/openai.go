@@ -0,0 +1,836 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAI Chat Completions 兼容层：把 /v1/chat/completions 请求转换为 Anthropic Messages，
+// 复用 /v1/messages 的账号路由、重试、熔断与指标，再把响应（含 SSE 流）转换回 OpenAI 格式。
+
+const (
+	openAIDefaultMaxTokens   = 4096
+	defaultAnthropicVersion  = "2023-06-01"
+	openAIChunkObject        = "chat.completion.chunk"
+	openAICompletionObject   = "chat.completion"
+	openAIErrorTypeInvalid   = "invalid_request_error"
+	openAIErrorTypeUpstream  = "api_error"
+	openAIStreamDoneSentinel = "data: [DONE]\n\n"
+	// openAIMaxBodyBytes 请求体上限，base64 图片较多时仍有余量。
+	openAIMaxBodyBytes = 32 << 20
+)
+
+type openAIChatRequest struct {
+	Model               string          `json:"model"`
+	Messages            []openAIMessage `json:"messages"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	Stop                json.RawMessage `json:"stop,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+	Tools             []openAITool    `json:"tools,omitempty"`
+	ToolChoice        json.RawMessage `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	User              string          `json:"user,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+type anthropicBlock map[string]any
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicResponse 非流式 Messages 响应中关心的字段。
+type anthropicResponse struct {
+	ID         string `json:"id"`
+	Model      string `json:"model"`
+	StopReason string `json:"stop_reason"`
+	Content    []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		ID    string          `json:"id"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// handleChatCompletions 处理 OpenAI 兼容的 /v1/chat/completions 请求。
+func (p *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, openAIErrorTypeInvalid, "method not allowed")
+		return
+	}
+	// 鉴权、限流与模型白名单的 Anthropic 格式错误同样经由转换 writer 输出为 OpenAI 格式。
+	// 先鉴权再读取请求体，未授权的请求不会占用读取与解析的开销。
+	ow := newOpenAIResponseWriter(w, "", false, false)
+	account, apiKey, ok := p.authenticateProxyRequest(ow, r)
+	if !ok {
+		ow.finish()
+		return
+	}
+	var raw []byte
+	if r.Body != nil {
+		var err error
+		raw, err = io.ReadAll(http.MaxBytesReader(w, r.Body, openAIMaxBodyBytes))
+		r.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeOpenAIError(w, http.StatusRequestEntityTooLarge, openAIErrorTypeInvalid, "request body too large")
+				return
+			}
+			writeOpenAIError(w, http.StatusBadRequest, openAIErrorTypeInvalid, "read body failed: "+err.Error())
+			return
+		}
+	}
+	var req openAIChatRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, openAIErrorTypeInvalid, "invalid JSON body: "+err.Error())
+		return
+	}
+	body, err := convertOpenAIRequest(&req)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, openAIErrorTypeInvalid, err.Error())
+		return
+	}
+
+	ow.model, ow.stream, ow.includeUsage = req.Model, req.Stream, req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	defer ow.finish()
+
+	releaseQuota, ok := p.acquireQuota(ow, account)
+	if !ok {
+		return
+	}
+	defer releaseQuota()
+	if apiKey != nil && !apiKey.allowsModel(req.Model) {
+		writeAnthropicError(ow, http.StatusForbidden, "permission_error", fmt.Sprintf("API key %q is not allowed to use model %q.", apiKey.Name, req.Model))
+		return
+	}
+
+	upstreamReq := r.Clone(r.Context())
+	upstreamReq.URL.Path = "/v1/messages"
+	upstreamReq.URL.RawPath = ""
+	upstreamReq.RequestURI = ""
+	upstreamReq.Header.Set("Content-Type", "application/json")
+	// 需要解析上游响应体，禁止压缩。
+	upstreamReq.Header.Del("Accept-Encoding")
+	if upstreamReq.Header.Get("anthropic-version") == "" {
+		upstreamReq.Header.Set("anthropic-version", defaultAnthropicVersion)
+	}
+	if req.Stream {
+		upstreamReq.Header.Set("Accept", "text/event-stream")
+	}
+	p.forwardMessages(ow, upstreamReq, account, apiKey, body)
+}
+
+// convertOpenAIRequest 把 Chat Completions 请求体转换为 Anthropic Messages 请求体。
+func convertOpenAIRequest(req *openAIChatRequest) ([]byte, error) {
+	if strings.TrimSpace(req.Model) == "" {
+		return nil, errors.New("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	var systemParts []string
+	messages := make([]anthropicMessage, 0, len(req.Messages))
+	appendBlocks := func(role string, blocks []anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		// Anthropic 要求 user/assistant 交替出现，相邻同角色消息合并。
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := openAIContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if text != "" {
+				systemParts = append(systemParts, text)
+			}
+		case "user":
+			blocks, err := openAIContentBlocks(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			appendBlocks("user", blocks)
+		case "assistant":
+			blocks, err := openAIContentBlocks(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(`{}`)
+				if args := strings.TrimSpace(call.Function.Arguments); args != "" {
+					if !json.Valid([]byte(args)) {
+						return nil, fmt.Errorf("messages[%d]: tool call %s has invalid JSON arguments", i, call.ID)
+					}
+					input = json.RawMessage(args)
+				}
+				blocks = append(blocks, anthropicBlock{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": input,
+				})
+			}
+			appendBlocks("assistant", blocks)
+		case "tool", "function":
+			text, err := openAIContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if msg.ToolCallID == "" {
+				return nil, fmt.Errorf("messages[%d]: tool_call_id is required for tool messages", i)
+			}
+			appendBlocks("user", []anthropicBlock{{
+				"type":        "tool_result",
+				"tool_use_id": msg.ToolCallID,
+				"content":     text,
+			}})
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+	if len(messages) == 0 {
+		return nil, errors.New("messages must contain at least one user or assistant message")
+	}
+
+	maxTokens := req.MaxCompletionTokens
+	if maxTokens <= 0 {
+		maxTokens = req.MaxTokens
+	}
+	if maxTokens <= 0 {
+		maxTokens = openAIDefaultMaxTokens
+	}
+	out := map[string]any{
+		"model":      req.Model,
+		"max_tokens": maxTokens,
+		"messages":   messages,
+	}
+	if len(systemParts) > 0 {
+		out["system"] = strings.Join(systemParts, "\n\n")
+	}
+	if req.Temperature != nil {
+		out["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		out["top_p"] = *req.TopP
+	}
+	if stops, err := openAIStopSequences(req.Stop); err != nil {
+		return nil, err
+	} else if len(stops) > 0 {
+		out["stop_sequences"] = stops
+	}
+	if req.Stream {
+		out["stream"] = true
+	}
+	if req.User != "" {
+		out["metadata"] = map[string]string{"user_id": req.User}
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			if t.Type != "" && t.Type != "function" {
+				return nil, fmt.Errorf("unsupported tool type %q", t.Type)
+			}
+			schema := t.Function.Parameters
+			if len(schema) == 0 || string(schema) == "null" {
+				schema = json.RawMessage(`{"type":"object","properties":{}}`)
+			}
+			tool := map[string]any{"name": t.Function.Name, "input_schema": schema}
+			if t.Function.Description != "" {
+				tool["description"] = t.Function.Description
+			}
+			tools = append(tools, tool)
+		}
+		out["tools"] = tools
+		choice, err := openAIToolChoice(req.ToolChoice, req.ParallelToolCalls)
+		if err != nil {
+			return nil, err
+		}
+		if choice != nil {
+			out["tool_choice"] = choice
+		}
+	}
+	return json.Marshal(out)
+}
+
+// openAIContentText 读取字符串或文本分片数组形式的 content。
+func openAIContentText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("content must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// openAIContentBlocks 把 content 转换为 Anthropic 内容块，支持文本与图片（data URL 或 http(s) URL）。
+func openAIContentBlocks(raw json.RawMessage) ([]anthropicBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "" {
+			return nil, nil
+		}
+		return []anthropicBlock{{"type": "text", "text": s}}, nil
+	}
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, errors.New("content must be a string or an array of content parts")
+	}
+	blocks := make([]anthropicBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{"type": "text", "text": part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return nil, errors.New("image_url.url is required")
+			}
+			source, err := anthropicImageSource(part.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, anthropicBlock{"type": "image", "source": source})
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+func anthropicImageSource(url string) (map[string]string, error) {
+	if strings.HasPrefix(url, "data:") {
+		meta, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		mediaType, enc, _ := strings.Cut(meta, ";")
+		if !ok || enc != "base64" || mediaType == "" {
+			return nil, errors.New("image data URL must be base64 encoded")
+		}
+		return map[string]string{"type": "base64", "media_type": mediaType, "data": data}, nil
+	}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return map[string]string{"type": "url", "url": url}, nil
+	}
+	return nil, errors.New("image_url.url must be a data URL or http(s) URL")
+}
+
+func openAIStopSequences(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "" {
+			return nil, nil
+		}
+		return []string{s}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, errors.New("stop must be a string or an array of strings")
+	}
+	return list, nil
+}
+
+// openAIToolChoice 转换 tool_choice：auto→auto，required→any，none→none，指定函数→tool。
+func openAIToolChoice(raw json.RawMessage, parallel *bool) (map[string]any, error) {
+	var choice map[string]any
+	var s string
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+	case json.Unmarshal(raw, &s) == nil:
+		switch s {
+		case "auto":
+			choice = map[string]any{"type": "auto"}
+		case "required":
+			choice = map[string]any{"type": "any"}
+		case "none":
+			choice = map[string]any{"type": "none"}
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice %q", s)
+		}
+	default:
+		var named struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+			return nil, errors.New("tool_choice must be a string or {\"type\":\"function\",\"function\":{\"name\":...}}")
+		}
+		choice = map[string]any{"type": "tool", "name": named.Function.Name}
+	}
+	if parallel != nil && !*parallel {
+		if choice == nil {
+			choice = map[string]any{"type": "auto"}
+		}
+		if choice["type"] != "none" {
+			choice["disable_parallel_tool_use"] = true
+		}
+	}
+	return choice, nil
+}
+
+// openAIFinishReason 把 Anthropic stop_reason 映射为 OpenAI finish_reason。
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	case "":
+		return ""
+	default:
+		return "stop"
+	}
+}
+
+// convertAnthropicResponse 把非流式 Messages 响应转换为 chat.completion。
+func convertAnthropicResponse(body []byte, model string, created int64) ([]byte, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	var text strings.Builder
+	toolCalls := make([]openAIToolCall, 0)
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			var call openAIToolCall
+			call.ID = block.ID
+			call.Type = "function"
+			call.Function.Name = block.Name
+			call.Function.Arguments = string(block.Input)
+			if len(block.Input) == 0 {
+				call.Function.Arguments = "{}"
+			}
+			toolCalls = append(toolCalls, call)
+		}
+	}
+	message := map[string]any{"role": "assistant", "content": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+	}
+	if resp.Model != "" {
+		model = resp.Model
+	}
+	return json.Marshal(map[string]any{
+		"id":      "chatcmpl-" + strings.TrimPrefix(resp.ID, "msg_"),
+		"object":  openAICompletionObject,
+		"created": created,
+		"model":   model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": openAIFinishReason(resp.StopReason),
+		}},
+		"usage": openAIUsage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	})
+}
+
+// openAIErrorFromBody 从 Anthropic 错误、代理错误或纯文本中提取状态码、错误类型与消息。
+// retryTransport 会把上游 4xx 包装为 502 proxy_error，这里还原上游的状态码与原始错误。
+func openAIErrorFromBody(status int, body []byte) (int, string, string) {
+	var payload struct {
+		Error struct {
+			Type           string `json:"type"`
+			Message        string `json:"message"`
+			UpstreamStatus int    `json:"upstream_status"`
+			UpstreamBody   string `json:"upstream_body"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error.Message != "" {
+		if us := payload.Error.UpstreamStatus; us >= 400 && us < 500 && payload.Error.UpstreamBody != "" {
+			return openAIErrorFromBody(us, []byte(payload.Error.UpstreamBody))
+		}
+		errType := payload.Error.Type
+		if errType == "" {
+			errType = openAIErrorTypeUpstream
+		}
+		return status, errType, payload.Error.Message
+	}
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	if status >= http.StatusInternalServerError {
+		return status, openAIErrorTypeUpstream, msg
+	}
+	return status, openAIErrorTypeInvalid, msg
+}
+
+// writeOpenAIError 按 OpenAI 错误格式写出响应。
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    errType,
+			"param":   nil,
+			"code":    nil,
+		},
+	})
+}
+
+// openAIResponseWriter 接收上游 Anthropic 响应并转换为 OpenAI 格式写给客户端。
+// 非 200 响应先缓存，重试成功时丢弃；最终在 finish 时输出 OpenAI 错误格式。
+type openAIResponseWriter struct {
+	w            http.ResponseWriter
+	header       http.Header
+	model        string
+	stream       bool
+	includeUsage bool
+	created      int64
+
+	status    int
+	committed bool
+	body      bytes.Buffer
+
+	// 流式转换状态
+	lineBuf      bytes.Buffer
+	id           string
+	toolIndex    map[int]int
+	nextTool     int
+	inputTokens  int64
+	outputTokens int64
+	done         bool
+}
+
+func newOpenAIResponseWriter(w http.ResponseWriter, model string, stream, includeUsage bool) *openAIResponseWriter {
+	return &openAIResponseWriter{
+		w:            w,
+		header:       make(http.Header),
+		model:        model,
+		stream:       stream,
+		includeUsage: includeUsage,
+		created:      time.Now().Unix(),
+		toolIndex:    make(map[int]int),
+	}
+}
+
+func (o *openAIResponseWriter) Header() http.Header { return o.header }
+
+// resetAttempt 新的重试尝试开始前清除上一次失败响应留下的头与缓存。
+func (o *openAIResponseWriter) resetAttempt() {
+	if o.committed {
+		return
+	}
+	o.header = make(http.Header)
+	o.status = 0
+	o.body.Reset()
+}
+
+func (o *openAIResponseWriter) WriteHeader(code int) {
+	if o.committed {
+		return
+	}
+	o.status = code
+	o.body.Reset()
+	if code != http.StatusOK {
+		return
+	}
+	o.committed = true
+	dst := o.w.Header()
+	for _, k := range []string{"X-Proxy-Node", "X-Usage-Input-Tokens", "X-Usage-Output-Tokens", "Request-Id"} {
+		if v := o.header.Get(k); v != "" {
+			dst.Set(k, v)
+		}
+	}
+	if o.stream {
+		dst.Set("Content-Type", "text/event-stream")
+		dst.Set("Cache-Control", "no-cache")
+		o.w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (o *openAIResponseWriter) Write(b []byte) (int, error) {
+	if o.status == 0 {
+		o.WriteHeader(http.StatusOK)
+	}
+	if !o.committed || !o.stream {
+		o.body.Write(b)
+		return len(b), nil
+	}
+	o.lineBuf.Write(b)
+	for {
+		line, err := o.lineBuf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行放回缓冲区等待后续数据。
+			rest := append([]byte(nil), line...)
+			o.lineBuf.Reset()
+			o.lineBuf.Write(rest)
+			break
+		}
+		o.handleSSELine(bytes.TrimRight(line, "\r\n"))
+	}
+	return len(b), nil
+}
+
+func (o *openAIResponseWriter) Flush() {
+	if f, ok := o.w.(http.Flusher); ok && o.committed {
+		f.Flush()
+	}
+}
+
+// finish 输出最终结果：非流式响应整体转换，错误转换为 OpenAI 错误格式。
+func (o *openAIResponseWriter) finish() {
+	if !o.committed {
+		status := o.status
+		if status == 0 {
+			status = http.StatusBadGateway
+		}
+		if ra := o.header.Get("Retry-After"); ra != "" {
+			o.w.Header().Set("Retry-After", ra)
+		}
+		status, errType, msg := openAIErrorFromBody(status, o.body.Bytes())
+		writeOpenAIError(o.w, status, errType, msg)
+		return
+	}
+	if o.stream {
+		if o.lineBuf.Len() > 0 {
+			o.handleSSELine(bytes.TrimRight(o.lineBuf.Bytes(), "\r\n"))
+			o.lineBuf.Reset()
+		}
+		return
+	}
+	out, err := convertAnthropicResponse(o.body.Bytes(), o.model, o.created)
+	if err != nil {
+		writeOpenAIError(o.w, http.StatusBadGateway, openAIErrorTypeUpstream, "invalid upstream response: "+err.Error())
+		return
+	}
+	o.w.Header().Set("Content-Type", "application/json")
+	o.w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	o.w.WriteHeader(http.StatusOK)
+	_, _ = o.w.Write(out)
+}
+
+// handleSSELine 处理一行 Anthropic SSE，只关心 data 行（事件类型同样包含在 JSON 的 type 字段中）。
+func (o *openAIResponseWriter) handleSSELine(line []byte) {
+	if o.done || !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	var ev struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			ID    string `json:"id"`
+			Model string `json:"model"`
+			Usage struct {
+				InputTokens int64 `json:"input_tokens"`
+			} `json:"usage"`
+		} `json:"message"`
+		ContentBlock struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage struct {
+			OutputTokens int64 `json:"output_tokens"`
+		} `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return
+	}
+	switch ev.Type {
+	case "message_start":
+		o.id = "chatcmpl-" + strings.TrimPrefix(ev.Message.ID, "msg_")
+		if ev.Message.Model != "" {
+			o.model = ev.Message.Model
+		}
+		o.inputTokens = ev.Message.Usage.InputTokens
+		o.writeChunk(map[string]any{"role": "assistant", "content": ""}, nil)
+	case "content_block_start":
+		if ev.ContentBlock.Type != "tool_use" {
+			return
+		}
+		idx := o.nextTool
+		o.nextTool++
+		o.toolIndex[ev.Index] = idx
+		o.writeChunk(map[string]any{"tool_calls": []map[string]any{{
+			"index":    idx,
+			"id":       ev.ContentBlock.ID,
+			"type":     "function",
+			"function": map[string]any{"name": ev.ContentBlock.Name, "arguments": ""},
+		}}}, nil)
+	case "content_block_delta":
+		switch ev.Delta.Type {
+		case "text_delta":
+			o.writeChunk(map[string]any{"content": ev.Delta.Text}, nil)
+		case "input_json_delta":
+			idx, ok := o.toolIndex[ev.Index]
+			if !ok {
+				return
+			}
+			o.writeChunk(map[string]any{"tool_calls": []map[string]any{{
+				"index":    idx,
+				"function": map[string]any{"arguments": ev.Delta.PartialJSON},
+			}}}, nil)
+		}
+	case "message_delta":
+		if ev.Usage.OutputTokens > 0 {
+			o.outputTokens = ev.Usage.OutputTokens
+		}
+		if reason := openAIFinishReason(ev.Delta.StopReason); reason != "" {
+			o.writeChunk(map[string]any{}, reason)
+		}
+	case "message_stop":
+		if o.includeUsage {
+			o.writeFrame(map[string]any{
+				"id":      o.id,
+				"object":  openAIChunkObject,
+				"created": o.created,
+				"model":   o.model,
+				"choices": []any{},
+				"usage": openAIUsage{
+					PromptTokens:     o.inputTokens,
+					CompletionTokens: o.outputTokens,
+					TotalTokens:      o.inputTokens + o.outputTokens,
+				},
+			})
+		}
+		o.writeRaw([]byte(openAIStreamDoneSentinel))
+		o.done = true
+	case "error":
+		o.writeFrame(map[string]any{"error": map[string]any{
+			"message": ev.Error.Message,
+			"type":    chooseNonEmpty(ev.Error.Type, openAIErrorTypeUpstream),
+		}})
+		o.done = true
+	}
+}
+
+func (o *openAIResponseWriter) writeChunk(delta map[string]any, finishReason any) {
+	o.writeFrame(map[string]any{
+		"id":      o.id,
+		"object":  openAIChunkObject,
+		"created": o.created,
+		"model":   o.model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+func (o *openAIResponseWriter) writeFrame(v any) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	frame := make([]byte, 0, len(buf)+8)
+	frame = append(frame, "data: "...)
+	frame = append(frame, buf...)
+	frame = append(frame, '\n', '\n')
+	o.writeRaw(frame)
+}
+
+func (o *openAIResponseWriter) writeRaw(b []byte) {
+	_, _ = o.w.Write(b)
+	if f, ok := o.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConvertOpenAIRequest(t *testing.T) {
+	req := openAIChatRequest{
+		Model: "claude-sonnet-4-20250514",
+		Messages: []openAIMessage{
+			{Role: "system", Content: json.RawMessage(`"be brief"`)},
+			{Role: "user", Content: json.RawMessage(`[{"type":"text","text":"weather?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]`)},
+			{Role: "assistant", ToolCalls: []openAIToolCall{{ID: "call_1", Type: "function"}}},
+			{Role: "tool", ToolCallID: "call_1", Content: json.RawMessage(`"sunny"`)},
+			{Role: "user", Content: json.RawMessage(`"thanks"`)},
+		},
+		Stop:       json.RawMessage(`"END"`),
+		ToolChoice: json.RawMessage(`"required"`),
+	}
+	req.Messages[2].ToolCalls[0].Function.Name = "get_weather"
+	req.Messages[2].ToolCalls[0].Function.Arguments = `{"city":"Beijing"}`
+	var tool openAITool
+	tool.Type = "function"
+	tool.Function.Name = "get_weather"
+	tool.Function.Parameters = json.RawMessage(`{"type":"object"}`)
+	req.Tools = []openAITool{tool}
+
+	body, err := convertOpenAIRequest(&req)
+	if err != nil {
+		t.Fatalf("convert: %v", err)
+	}
+	var got struct {
+		System        string             `json:"system"`
+		MaxTokens     int                `json:"max_tokens"`
+		StopSequences []string           `json:"stop_sequences"`
+		Messages      []anthropicMessage `json:"messages"`
+		Tools         []map[string]any   `json:"tools"`
+		ToolChoice    map[string]any     `json:"tool_choice"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.System != "be brief" || got.MaxTokens != openAIDefaultMaxTokens || len(got.StopSequences) != 1 {
+		t.Fatalf("unexpected top-level fields: %s", body)
+	}
+	// 工具结果与随后的用户消息合并为同一条 user 消息，保持角色交替。
+	if len(got.Messages) != 3 || got.Messages[0].Role != "user" || got.Messages[1].Role != "assistant" || got.Messages[2].Role != "user" {
+		t.Fatalf("unexpected messages: %s", body)
+	}
+	if got.Messages[0].Content[1]["type"] != "image" || got.Messages[1].Content[0]["type"] != "tool_use" {
+		t.Fatalf("unexpected content blocks: %s", body)
+	}
+	if got.Messages[2].Content[0]["type"] != "tool_result" || got.Messages[2].Content[0]["tool_use_id"] != "call_1" || len(got.Messages[2].Content) != 2 {
+		t.Fatalf("unexpected tool result: %s", body)
+	}
+	if got.Tools[0]["name"] != "get_weather" || got.Tools[0]["input_schema"] == nil || got.ToolChoice["type"] != "any" {
+		t.Fatalf("unexpected tools: %s", body)
+	}
+
+	if _, err := convertOpenAIRequest(&openAIChatRequest{Model: "m", Messages: []openAIMessage{{Role: "system", Content: json.RawMessage(`"x"`)}}}); err == nil {
+		t.Fatalf("expected error without user/assistant messages")
+	}
+}
+
+func TestChatCompletionsNonStreaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected upstream request %s version=%q", r.URL.Path, r.Header.Get("anthropic-version"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"system":"sys"`) {
+			t.Errorf("system prompt not forwarded: %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-x","stop_reason":"tool_use",
+			"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"lookup","input":{"q":"go"}}],
+			"usage":{"input_tokens":12,"output_tokens":7}}`)
+	}))
+	defer upstream.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy"))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(
+		`{"model":"claude-x","messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-proxy")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Content   string           `json:"content"`
+				ToolCalls []openAIToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body.String())
+	}
+	if resp.ID != "chatcmpl-1" || resp.Object != "chat.completion" || len(resp.Choices) != 1 {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+	c := resp.Choices[0]
+	if c.Message.Content != "checking" || c.FinishReason != "tool_calls" || len(c.Message.ToolCalls) != 1 ||
+		c.Message.ToolCalls[0].Function.Arguments != `{"q":"go"}` {
+		t.Fatalf("unexpected choice: %s", rec.Body.String())
+	}
+	if resp.Usage.TotalTokens != 19 {
+		t.Fatalf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestChatCompletionsStreaming(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_2","model":"claude-x","usage":{"input_tokens":5}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_9","name":"lookup","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		`{"type":"message_stop"}`,
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"stream":true`) {
+			t.Errorf("stream flag not forwarded: %s", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			var head struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(ev), &head)
+			io.WriteString(w, "event: "+head.Type+"\ndata: "+ev+"\n\n")
+		}
+	}))
+	defer upstream.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy"))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(
+		`{"model":"claude-x","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-proxy")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status=%d ct=%s body=%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	var text, args, finish string
+	var usage *openAIUsage
+	frames := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+	if frames[len(frames)-1] != "data: [DONE]" {
+		t.Fatalf("stream should end with [DONE]: %q", rec.Body.String())
+	}
+	for _, frame := range frames[:len(frames)-1] {
+		var chunk struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta struct {
+					Content   string           `json:"content"`
+					ToolCalls []openAIToolCall `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(frame, "data: ")), &chunk); err != nil {
+			t.Fatalf("bad frame %q: %v", frame, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("unexpected object in %q", frame)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			text += c.Delta.Content
+			for _, tc := range c.Delta.ToolCalls {
+				args += tc.Function.Arguments
+			}
+			if c.FinishReason != nil {
+				finish = *c.FinishReason
+			}
+		}
+	}
+	if text != "Hello" || args != `{"q":"go"}` || finish != "tool_calls" {
+		t.Fatalf("text=%q args=%q finish=%q", text, args, finish)
+	}
+	if usage == nil || usage.PromptTokens != 5 || usage.CompletionTokens != 9 {
+		t.Fatalf("unexpected usage chunk: %+v", usage)
+	}
+}
+
+func TestChatCompletionsUpstreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens too large"}}`)
+	}))
+	defer upstream.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy"))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(
+		`{"model":"claude-x","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-proxy")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusBadRequest {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if resp.Error.Type != "invalid_request_error" || resp.Error.Message != "max_tokens too large" {
+		t.Fatalf("unexpected error: %s", rec.Body.String())
+	}
+}
+
+func TestChatCompletionsAuthenticatesBeforeReadingBody(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	h := srv.Handler()
+
+	key, raw, err := srv.createAPIKey(srv.defaultAccount, "revoked", nil, nil)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if err := srv.revokeAPIKey(key); err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+
+	// 鉴权失败直接返回 401，不解析请求体。
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`not json`))
+	req.Header.Set("Authorization", "Bearer "+raw)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Fatalf("unauthenticated status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(strings.Repeat("a", openAIMaxBodyBytes+1)))
+	req.Header.Set("Authorization", "Bearer test-proxy")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body status=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashPassword 使用 bcrypt 生成密码哈希。
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// mustHashPassword 用于写入内置默认密码；哈希失败（仅在随机源异常时发生）时退回明文，登录时会再次升级。
+func mustHashPassword(password string) string {
+	if hash, err := hashPassword(password); err == nil {
+		return hash
+	}
+	return password
+}
+
+// passwordOrDefault 已有密码时原样返回，为空时才哈希内置默认密码，避免每次启动都执行 bcrypt。
+func passwordOrDefault(stored, fallback string) string {
+	if stored != "" {
+		return stored
+	}
+	return mustHashPassword(fallback)
+}
+
+// isPasswordHash 判断存储值是否为 bcrypt 哈希；否则视为旧版明文密码。
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// dummyPasswordHash 用于不存在的用户名，懒加载避免启动时多一次 bcrypt。
+var dummyPasswordHash = sync.OnceValue(func() string { return mustHashPassword("qcc-dummy-password") })
+
+// burnPasswordCheck 对不存在或已禁用的用户执行一次同等开销的 bcrypt 比较，避免响应耗时暴露用户名是否存在。
+func burnPasswordCheck(password string) {
+	checkPassword(dummyPasswordHash(), password)
+}
+
+// checkPassword 校验密码。needsUpgrade 为 true 表示存储的是明文，校验通过后应改写为哈希。
+func checkPassword(stored, password string) (ok bool, needsUpgrade bool) {
+	if stored == "" {
+		return false, false
+	}
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, false
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true
+}
@@ -0,0 +1,569 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HealthCheckMethodStream      = "stream"       // SSE 流式往返，校验 message_stop
+	HealthCheckMethodCountTokens = "count_tokens" // POST /v1/messages/count_tokens
+	HealthCheckMethodToolUse     = "tool_use"     // 强制调用工具，校验 tool_use 内容块
+	HealthCheckMethodHTTP        = "http"         // 自定义 HTTP 请求，校验状态码与响应体正则
+)
+
+const (
+	maxProbeChain       = 8
+	maxProbeTimeoutSec  = 300
+	maxProbeIntervalSec = 86400
+	probeToolName       = "report_status"
+	probeBodyLimit      = 64 << 10
+)
+
+// ProbeConfig 探针链中的一项，通过节点 API 的 health_probes 字段配置。
+type ProbeConfig struct {
+	Type         string            `json:"type"`                    // 已注册的探针名称
+	Model        string            `json:"model,omitempty"`         // 为空时使用节点 health_check_model
+	TimeoutSec   int               `json:"timeout_sec,omitempty"`   // 单次超时，为空时使用探针默认值
+	IntervalSec  int               `json:"interval_sec,omitempty"`  // 最小执行间隔，未到期时沿用上次成功结果
+	Method       string            `json:"method,omitempty"`        // http：请求方法，默认 GET
+	URL          string            `json:"url,omitempty"`           // http：绝对地址或相对节点地址的路径，默认节点地址
+	Headers      map[string]string `json:"headers,omitempty"`       // http：附加请求头
+	Body         string            `json:"body,omitempty"`          // http：请求体
+	ExpectStatus int               `json:"expect_status,omitempty"` // http：期望状态码，为空表示任意 2xx
+	ExpectBody   string            `json:"expect_body,omitempty"`   // http：响应体需匹配的正则
+}
+
+// ProbeEnv 探针执行时可用的依赖。
+type ProbeEnv struct {
+	Transport http.RoundTripper // 健康检查专用 Transport，超时由 ctx 控制
+	CLIRunner CliRunner
+}
+
+// HealthProbe 健康检查探针。Check 返回 nil 表示健康。
+type HealthProbe interface {
+	Check(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error
+	// Validate 在节点 API 保存探针配置前校验探针专属字段。
+	Validate(cfg ProbeConfig) error
+	// DefaultTimeout 未配置 timeout_sec 时的单次超时。
+	DefaultTimeout() time.Duration
+}
+
+var (
+	healthProbesMu sync.RWMutex
+	healthProbes   = map[string]HealthProbe{}
+)
+
+// RegisterHealthProbe 按名称注册探针，名称不区分大小写，同名覆盖。
+func RegisterHealthProbe(name string, probe HealthProbe) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || probe == nil {
+		panic("proxy: invalid health probe registration")
+	}
+	healthProbesMu.Lock()
+	healthProbes[name] = probe
+	healthProbesMu.Unlock()
+}
+
+func lookupHealthProbe(name string) (HealthProbe, bool) {
+	healthProbesMu.RLock()
+	defer healthProbesMu.RUnlock()
+	probe, ok := healthProbes[strings.ToLower(strings.TrimSpace(name))]
+	return probe, ok
+}
+
+// healthProbeNames 返回已注册的探针名称（升序）。
+func healthProbeNames() []string {
+	healthProbesMu.RLock()
+	defer healthProbesMu.RUnlock()
+	names := make([]string, 0, len(healthProbes))
+	for name := range healthProbes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// probeFunc 内置探针的通用实现。
+type probeFunc struct {
+	timeout  time.Duration
+	check    func(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error
+	validate func(cfg ProbeConfig) error
+}
+
+func (f probeFunc) Check(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	return f.check(ctx, env, node, cfg)
+}
+
+func (f probeFunc) Validate(cfg ProbeConfig) error {
+	if f.validate == nil {
+		return nil
+	}
+	return f.validate(cfg)
+}
+
+func (f probeFunc) DefaultTimeout() time.Duration { return f.timeout }
+
+func init() {
+	RegisterHealthProbe(HealthCheckMethodAPI, probeFunc{timeout: 5 * time.Second, check: probeMessages})
+	RegisterHealthProbe(HealthCheckMethodHEAD, probeFunc{timeout: 5 * time.Second, check: probeHEAD})
+	// CLI 方式需要执行外部 CLI，需要更长的超时时间（进程+模型加载开销）
+	RegisterHealthProbe(HealthCheckMethodCLI, probeFunc{timeout: 30 * time.Second, check: probeCLI})
+	RegisterHealthProbe(HealthCheckMethodStream, probeFunc{timeout: 15 * time.Second, check: probeStream})
+	RegisterHealthProbe(HealthCheckMethodCountTokens, probeFunc{timeout: 5 * time.Second, check: probeCountTokens})
+	RegisterHealthProbe(HealthCheckMethodToolUse, probeFunc{timeout: 20 * time.Second, check: probeToolUse})
+	RegisterHealthProbe(HealthCheckMethodHTTP, probeFunc{timeout: 5 * time.Second, check: probeHTTP, validate: validateHTTPProbe})
+}
+
+// normalizeProbeChain 清理并校验节点探针链，空链返回 nil（使用 health_check_method）。
+func normalizeProbeChain(chain []ProbeConfig) ([]ProbeConfig, error) {
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	if len(chain) > maxProbeChain {
+		return nil, fmt.Errorf("health_probes supports at most %d probes", maxProbeChain)
+	}
+	cleaned := make([]ProbeConfig, 0, len(chain))
+	for i, cfg := range chain {
+		cfg.Type = strings.ToLower(strings.TrimSpace(cfg.Type))
+		cfg.Model = strings.TrimSpace(cfg.Model)
+		probe, ok := lookupHealthProbe(cfg.Type)
+		if !ok {
+			return nil, fmt.Errorf("health_probes[%d]: unknown probe type %q (available: %s)", i, cfg.Type, strings.Join(healthProbeNames(), ", "))
+		}
+		if cfg.TimeoutSec < 0 || cfg.TimeoutSec > maxProbeTimeoutSec {
+			return nil, fmt.Errorf("health_probes[%d]: timeout_sec must be between 0 and %d", i, maxProbeTimeoutSec)
+		}
+		if cfg.IntervalSec < 0 || cfg.IntervalSec > maxProbeIntervalSec {
+			return nil, fmt.Errorf("health_probes[%d]: interval_sec must be between 0 and %d", i, maxProbeIntervalSec)
+		}
+		if err := probe.Validate(cfg); err != nil {
+			return nil, fmt.Errorf("health_probes[%d]: %w", i, err)
+		}
+		cleaned = append(cleaned, cfg)
+	}
+	return cleaned, nil
+}
+
+// probeChainFor 返回节点实际执行的探针链；未配置 health_probes 时由 health_check_method 组成单项链。
+func probeChainFor(n Node) []ProbeConfig {
+	if len(n.HealthProbes) > 0 {
+		return n.HealthProbes
+	}
+	return []ProbeConfig{{Type: normalizeHealthCheckMethod(n.HealthCheckMethod)}}
+}
+
+func probeChainUsesCLI(chain []ProbeConfig) bool {
+	for _, cfg := range chain {
+		if cfg.Type == HealthCheckMethodCLI {
+			return true
+		}
+	}
+	return false
+}
+
+// runProbeChain 依次执行探针链，遇到首个失败即停止。
+// 返回用于历史记录的探针名称（失败的探针，成功时为链首探针）及首个实际执行探针的耗时。
+func (p *Server) runProbeChain(node Node, chain []ProbeConfig) (string, bool, string, time.Duration) {
+	env := ProbeEnv{Transport: p.healthRT, CLIRunner: p.cliRunner}
+	if env.CLIRunner == nil {
+		env.CLIRunner = defaultCLIRunner
+	}
+	var latency time.Duration
+	for i, cfg := range chain {
+		probe, ok := lookupHealthProbe(cfg.Type)
+		if !ok {
+			return cfg.Type, false, fmt.Sprintf("unknown health probe %q", cfg.Type), latency
+		}
+		key := fmt.Sprintf("%s/%d/%s", node.ID, i, cfg.Type)
+		if p.probeFresh(key, cfg.IntervalSec) {
+			continue
+		}
+		timeout := probe.DefaultTimeout()
+		if cfg.TimeoutSec > 0 {
+			timeout = time.Duration(cfg.TimeoutSec) * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := probe.Check(ctx, env, node, cfg)
+		elapsed := time.Since(start)
+		cancel()
+		if latency == 0 {
+			latency = elapsed
+		}
+		if err != nil {
+			p.markProbe(key, false)
+			msg := err.Error()
+			if len(chain) > 1 {
+				msg = cfg.Type + ": " + msg
+			}
+			return cfg.Type, false, msg, latency
+		}
+		p.markProbe(key, true)
+	}
+	return chain[0].Type, true, "", latency
+}
+
+// probeFresh 判断探针是否仍在 interval_sec 内且上次成功；失败的探针总是重新执行。
+func (p *Server) probeFresh(key string, intervalSec int) bool {
+	if intervalSec <= 0 {
+		return false
+	}
+	p.probeMu.Lock()
+	defer p.probeMu.Unlock()
+	last, ok := p.probeLastOK[key]
+	return ok && time.Since(last) < time.Duration(intervalSec)*time.Second
+}
+
+func (p *Server) markProbe(key string, ok bool) {
+	p.probeMu.Lock()
+	defer p.probeMu.Unlock()
+	if !ok {
+		delete(p.probeLastOK, key)
+		return
+	}
+	if p.probeLastOK == nil {
+		p.probeLastOK = make(map[string]time.Time)
+	}
+	p.probeLastOK[key] = time.Now()
+}
+
+// forgetProbes 清理节点的探针执行记录（探针链变更或节点删除时调用）。
+func (p *Server) forgetProbes(nodeID string) {
+	p.probeMu.Lock()
+	defer p.probeMu.Unlock()
+	for key := range p.probeLastOK {
+		if strings.HasPrefix(key, nodeID+"/") {
+			delete(p.probeLastOK, key)
+		}
+	}
+}
+
+// setNodeProbes 更新节点探针链，nil 表示保持不变，空数组表示恢复使用 health_check_method。
+func (p *Server) setNodeProbes(id string, probes *[]ProbeConfig) error {
+	if probes == nil {
+		return nil
+	}
+	chain, err := normalizeProbeChain(*probes)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	n, ok := p.nodeIndex[id]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	n.HealthProbes = chain
+	rec := toRecord(n)
+	p.mu.Unlock()
+	p.forgetProbes(id)
+
+	if p.store != nil {
+		return p.store.UpsertNode(context.Background(), rec)
+	}
+	return nil
+}
+
+// encodeProbeChain 将探针链序列化为 JSON 存储，空链存为 nil。
+func encodeProbeChain(chain []ProbeConfig) json.RawMessage {
+	if len(chain) == 0 {
+		return nil
+	}
+	buf, _ := json.Marshal(chain)
+	return buf
+}
+
+func decodeProbeChain(raw json.RawMessage) ([]ProbeConfig, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var chain []ProbeConfig
+	if err := json.Unmarshal(raw, &chain); err != nil {
+		return nil, err
+	}
+	return normalizeProbeChain(chain)
+}
+
+func probeModel(node Node, cfg ProbeConfig) string {
+	return chooseNonEmpty(cfg.Model, node.HealthCheckModel, defaultHealthCheckModel)
+}
+
+// postAnthropic 使用节点凭据向上游发送 JSON 请求，非 2xx 响应转换为错误。
+func postAnthropic(ctx context.Context, env ProbeEnv, node Node, name, path string, payload any) (*http.Response, error) {
+	if node.APIKey == "" {
+		return nil, fmt.Errorf("%s health check requires api key", name)
+	}
+	if node.URL == nil {
+		return nil, fmt.Errorf("%s health check requires valid base url", name)
+	}
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	apiURL := strings.TrimSuffix(node.URL.String(), "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("x-api-key", node.APIKey)
+	req.Header.Set("Authorization", "Bearer "+node.APIKey)
+
+	resp, err := (&http.Client{Transport: env.Transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func probeMessages(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	resp, err := postAnthropic(ctx, env, node, HealthCheckMethodAPI, "/v1/messages", map[string]any{
+		"model":      probeModel(node, cfg),
+		"max_tokens": 1,
+		"messages":   []map[string]string{{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func probeHEAD(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	if node.URL == nil {
+		return errors.New("head health check requires valid base url")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, node.URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: env.Transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func probeCLI(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	if node.APIKey == "" {
+		return errors.New("cli health check requires api key")
+	}
+	if node.URL == nil {
+		return errors.New("cli health check requires valid base url")
+	}
+	cliEnv := map[string]string{
+		"ANTHROPIC_API_KEY":    node.APIKey,
+		"ANTHROPIC_AUTH_TOKEN": chooseNonEmpty(os.Getenv("ANTHROPIC_AUTH_TOKEN"), node.APIKey),
+		"ANTHROPIC_BASE_URL":   node.URL.String(),
+	}
+	// 使用简短的 prompt 让模型只回复 "ok"，减少输出 token 数量
+	out, err := env.CLIRunner(ctx, "claude", cliEnv, "say ok", probeModel(node, cfg))
+	if err != nil {
+		// 不做降级，保留 CLI 失败的真实错误信息，便于调试
+		return err
+	}
+	if strings.TrimSpace(out) == "" {
+		return errors.New("cli health check returned empty output")
+	}
+	return nil
+}
+
+// probeStream 发起流式请求并读取 SSE 直到 message_stop，校验上游流式链路完整。
+func probeStream(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	resp, err := postAnthropic(ctx, env, node, HealthCheckMethodStream, "/v1/messages", map[string]any{
+		"model":      probeModel(node, cfg),
+		"max_tokens": 8,
+		"stream":     true,
+		"messages":   []map[string]string{{"role": "user", "content": "say ok"}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	events := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var evt struct {
+			Type  string          `json:"type"`
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &evt) != nil {
+			continue
+		}
+		events++
+		switch evt.Type {
+		case "message_stop":
+			return nil
+		case "error":
+			return fmt.Errorf("stream error event: %s", string(evt.Error))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return fmt.Errorf("stream ended without message_stop after %d events", events)
+}
+
+// probeCountTokens 调用 token 计数接口，校验返回的 input_tokens。
+func probeCountTokens(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	resp, err := postAnthropic(ctx, env, node, HealthCheckMethodCountTokens, "/v1/messages/count_tokens", map[string]any{
+		"model":    probeModel(node, cfg),
+		"messages": []map[string]string{{"role": "user", "content": "hi"}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		InputTokens int64 `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, probeBodyLimit)).Decode(&out); err != nil {
+		return fmt.Errorf("decode count_tokens response: %w", err)
+	}
+	if out.InputTokens <= 0 {
+		return errors.New("count_tokens returned no input_tokens")
+	}
+	return nil
+}
+
+// probeToolUse 强制模型调用探测工具，校验响应中包含对应的 tool_use 内容块。
+func probeToolUse(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	resp, err := postAnthropic(ctx, env, node, HealthCheckMethodToolUse, "/v1/messages", map[string]any{
+		"model":      probeModel(node, cfg),
+		"max_tokens": 64,
+		"tools": []map[string]any{{
+			"name":        probeToolName,
+			"description": "Report the current service status.",
+			"input_schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"status": map[string]string{"type": "string"}},
+				"required":   []string{"status"},
+			},
+		}},
+		"tool_choice": map[string]string{"type": "tool", "name": probeToolName},
+		"messages":    []map[string]string{{"role": "user", "content": "Report status ok."}},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		StopReason string `json:"stop_reason"`
+		Content    []struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"content"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, probeBodyLimit)).Decode(&out); err != nil {
+		return fmt.Errorf("decode tool_use response: %w", err)
+	}
+	for _, block := range out.Content {
+		if block.Type == "tool_use" && block.Name == probeToolName {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s tool_use block in response (stop_reason=%s)", probeToolName, out.StopReason)
+}
+
+// probeTarget 解析 http 探针地址：绝对地址原样使用，其余视为相对节点地址的路径。
+func probeTarget(node Node, raw string) (string, error) {
+	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+		return raw, nil
+	}
+	if node.URL == nil {
+		return "", errors.New("http health check requires valid base url")
+	}
+	if raw == "" {
+		return node.URL.String(), nil
+	}
+	return strings.TrimSuffix(node.URL.String(), "/") + "/" + strings.TrimPrefix(raw, "/"), nil
+}
+
+func probeHTTP(ctx context.Context, env ProbeEnv, node Node, cfg ProbeConfig) error {
+	target, err := probeTarget(node, cfg.URL)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, chooseNonEmpty(strings.ToUpper(cfg.Method), http.MethodGet), target, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := (&http.Client{Transport: env.Transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+	if cfg.ExpectStatus > 0 && resp.StatusCode != cfg.ExpectStatus {
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, cfg.ExpectStatus)
+	}
+	if cfg.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if cfg.ExpectBody != "" {
+		re, err := regexp.Compile(cfg.ExpectBody)
+		if err != nil {
+			return err
+		}
+		if !re.Match(respBody) {
+			return fmt.Errorf("response body does not match %q", cfg.ExpectBody)
+		}
+	}
+	return nil
+}
+
+func validateHTTPProbe(cfg ProbeConfig) error {
+	switch strings.ToUpper(cfg.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodOptions:
+	default:
+		return fmt.Errorf("unsupported http method %q", cfg.Method)
+	}
+	if cfg.URL != "" {
+		if _, err := url.Parse(cfg.URL); err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+	}
+	if cfg.ExpectStatus != 0 && (cfg.ExpectStatus < 100 || cfg.ExpectStatus > 599) {
+		return errors.New("expect_status must be a valid HTTP status code")
+	}
+	if _, err := regexp.Compile(cfg.ExpectBody); err != nil {
+		return fmt.Errorf("invalid expect_body: %w", err)
+	}
+	return nil
+}
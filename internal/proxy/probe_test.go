@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// probeUpstream 模拟 Anthropic 兼容上游；truncate 为 true 时流式响应缺少 message_stop。
+func probeUpstream(t *testing.T, truncate *atomic.Bool, counts map[string]*atomic.Int64) Node {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := counts[r.URL.Path]; c != nil {
+			c.Add(1)
+		}
+		if r.Header.Get("x-api-key") != "sk-test" && r.URL.Path != "/status" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]any
+		_ = json.Unmarshal(body, &req)
+		switch {
+		case r.URL.Path == "/status":
+			fmt.Fprint(w, `{"status":"ok"}`)
+		case r.URL.Path == "/v1/messages/count_tokens":
+			fmt.Fprint(w, `{"input_tokens":8}`)
+		case req["stream"] == true:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n")
+			fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\"}\n\n")
+			if !truncate.Load() {
+				fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			}
+		case req["tools"] != nil:
+			fmt.Fprintf(w, `{"stop_reason":"tool_use","content":[{"type":"tool_use","name":%q,"input":{"status":"ok"}}]}`, probeToolName)
+		default:
+			fmt.Fprint(w, `{"content":[{"type":"text","text":"ok"}]}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	return Node{ID: "n1", Name: "relay", URL: u, APIKey: "sk-test"}
+}
+
+func TestBuiltinProbes(t *testing.T) {
+	var truncate atomic.Bool
+	node := probeUpstream(t, &truncate, nil)
+	env := ProbeEnv{Transport: http.DefaultTransport}
+	for _, cfg := range []ProbeConfig{
+		{Type: HealthCheckMethodAPI},
+		{Type: HealthCheckMethodStream},
+		{Type: HealthCheckMethodCountTokens},
+		{Type: HealthCheckMethodToolUse},
+		{Type: HealthCheckMethodHTTP, URL: "/status", ExpectStatus: 200, ExpectBody: `"status":"ok"`},
+	} {
+		probe, ok := lookupHealthProbe(cfg.Type)
+		if !ok {
+			t.Fatalf("probe %s not registered", cfg.Type)
+		}
+		if err := probe.Check(context.Background(), env, node, cfg); err != nil {
+			t.Fatalf("probe %s failed: %v", cfg.Type, err)
+		}
+	}
+
+	truncate.Store(true)
+	probe, _ := lookupHealthProbe(HealthCheckMethodStream)
+	if err := probe.Check(context.Background(), env, node, ProbeConfig{}); err == nil || !strings.Contains(err.Error(), "message_stop") {
+		t.Fatalf("expected missing message_stop error, got %v", err)
+	}
+	probe, _ = lookupHealthProbe(HealthCheckMethodHTTP)
+	if err := probe.Check(context.Background(), env, node, ProbeConfig{URL: "/status", ExpectBody: "degraded"}); err == nil {
+		t.Fatal("expected body regex mismatch")
+	}
+	node.APIKey = ""
+	probe, _ = lookupHealthProbe(HealthCheckMethodToolUse)
+	if err := probe.Check(context.Background(), env, node, ProbeConfig{}); err == nil || !strings.Contains(err.Error(), "requires api key") {
+		t.Fatalf("expected api key error, got %v", err)
+	}
+}
+
+func TestProbeChainIntervalAndValidation(t *testing.T) {
+	var truncate atomic.Bool
+	counts := map[string]*atomic.Int64{"/status": {}, "/v1/messages/count_tokens": {}, "/v1/messages": {}}
+	node := probeUpstream(t, &truncate, counts)
+	p := &Server{healthRT: http.DefaultTransport}
+
+	chain, err := normalizeProbeChain([]ProbeConfig{
+		{Type: " HTTP ", URL: "/status"},
+		{Type: "count_tokens", IntervalSec: 3600},
+		{Type: "stream", Model: "claude-sonnet-4-5", TimeoutSec: 10},
+	})
+	if err != nil {
+		t.Fatalf("normalize chain: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		method, ok, msg, _ := p.runProbeChain(node, chain)
+		if !ok || method != HealthCheckMethodHTTP || msg != "" {
+			t.Fatalf("run %d: method=%s ok=%v msg=%s", i, method, ok, msg)
+		}
+	}
+	if counts["/status"].Load() != 2 || counts["/v1/messages/count_tokens"].Load() != 1 || counts["/v1/messages"].Load() != 2 {
+		t.Fatalf("unexpected probe calls: status=%d count=%d messages=%d",
+			counts["/status"].Load(), counts["/v1/messages/count_tokens"].Load(), counts["/v1/messages"].Load())
+	}
+
+	truncate.Store(true)
+	method, ok, msg, _ := p.runProbeChain(node, chain)
+	if ok || method != HealthCheckMethodStream || !strings.HasPrefix(msg, "stream: ") {
+		t.Fatalf("expected stream failure, got method=%s ok=%v msg=%s", method, ok, msg)
+	}
+
+	for _, bad := range [][]ProbeConfig{
+		{{Type: "ping"}},
+		{{Type: "http", ExpectBody: "("}},
+		{{Type: "http", Method: "TRACE"}},
+		{{Type: "api", TimeoutSec: 301}},
+	} {
+		if _, err := normalizeProbeChain(bad); err == nil {
+			t.Fatalf("expected validation error for %+v", bad)
+		}
+	}
+	if normalizeHealthCheckMethod("Tool_Use") != HealthCheckMethodToolUse || !healthMethodRequiresAPIKey("stream") {
+		t.Fatal("registered probes should be accepted as health_check_method")
+	}
+}
@@ -0,0 +1,430 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"qcc_plus/internal/version"
+)
+
+var (
+	// promLatencyBuckets 整体耗时直方图桶（秒），覆盖长流式响应。
+	promLatencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	// promFirstByteBuckets 首字节耗时直方图桶（秒）。
+	promFirstByteBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30}
+)
+
+type promHistogram struct {
+	buckets []float64
+	counts  []uint64 // 非累计计数，输出时再累加
+	sum     float64
+	count   uint64
+}
+
+func newPromHistogram(buckets []float64) promHistogram {
+	return promHistogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *promHistogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type promSeriesKey struct {
+	account string
+	node    string
+}
+
+// promSeries 单个账号+节点维度的累计指标，进程重启后归零（Prometheus 会自动处理计数器重置）。
+type promSeries struct {
+	requests     map[int]uint64 // 按状态码计数
+	failures     uint64
+	retries      uint64
+	inputTokens  int64
+	outputTokens int64
+	bytes        int64
+	latency      promHistogram
+	firstByte    promHistogram
+}
+
+// promCollector 汇总代理请求的计数器与直方图。
+type promCollector struct {
+	mu     sync.Mutex
+	series map[promSeriesKey]*promSeries
+}
+
+func newPromCollector() *promCollector {
+	return &promCollector{series: make(map[promSeriesKey]*promSeries)}
+}
+
+// observe 记录一次上游尝试；retryAttempts 仅在最终尝试时非零，超过 1 的部分计为重试次数。
+func (c *promCollector) observe(accountID, nodeID string, start, end time.Time, mw *metricsWriter, u *usage, retryAttempts int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := promSeriesKey{account: accountID, node: nodeID}
+	s, ok := c.series[key]
+	if !ok {
+		s = &promSeries{
+			requests:  make(map[int]uint64),
+			latency:   newPromHistogram(promLatencyBuckets),
+			firstByte: newPromHistogram(promFirstByteBuckets),
+		}
+		c.series[key] = s
+	}
+	status := http.StatusOK
+	if mw != nil {
+		status = mw.status
+		s.bytes += mw.bytes
+		if mw.firstWrite {
+			s.firstByte.observe(mw.firstAt.Sub(start).Seconds())
+		}
+	}
+	s.requests[status]++
+	if status != http.StatusOK {
+		s.failures++
+	}
+	if retryAttempts > 1 {
+		s.retries += uint64(retryAttempts - 1)
+	}
+	if u != nil {
+		s.inputTokens += u.input
+		s.outputTokens += u.output
+	}
+	s.latency.observe(end.Sub(start).Seconds())
+}
+
+// promWriter 以 Prometheus 文本格式输出指标。
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *promWriter) family(name, typ, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w *promWriter) sample(name string, labels []string, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i])
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(promEscape(labels[i+1]))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+func (w *promWriter) histogram(name string, labels []string, h promHistogram) {
+	var cumulative uint64
+	for i, b := range h.buckets {
+		cumulative += h.counts[i]
+		w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", strconv.FormatFloat(b, 'g', -1, 64)), float64(cumulative))
+	}
+	w.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), float64(h.count))
+	w.sample(name+"_sum", labels, h.sum)
+	w.sample(name+"_count", labels, float64(h.count))
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promEscape(v string) string {
+	return promLabelEscaper.Replace(v)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeRequestMetrics 输出请求计数器与直方图，按账号、节点排序保证输出稳定。
+func (c *promCollector) writeRequestMetrics(w *promWriter) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]promSeriesKey, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].node < keys[j].node
+	})
+	labelsOf := func(k promSeriesKey) []string { return []string{"account", k.account, "node", k.node} }
+
+	// 计数器与直方图均按上游尝试记录：一次客户端请求重试到 N 个节点会在各节点上各计一次。
+	w.family("qcc_upstream_attempts_total", "counter", "Upstream attempts (one per node tried, retries included) by account, node and HTTP status code.")
+	for _, k := range keys {
+		s := c.series[k]
+		codes := make([]int, 0, len(s.requests))
+		for code := range s.requests {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			w.sample("qcc_upstream_attempts_total", append(labelsOf(k), "code", strconv.Itoa(code)), float64(s.requests[code]))
+		}
+	}
+	w.family("qcc_upstream_attempt_failures_total", "counter", "Upstream attempts that did not return 200.")
+	for _, k := range keys {
+		w.sample("qcc_upstream_attempt_failures_total", labelsOf(k), float64(c.series[k].failures))
+	}
+	w.family("qcc_request_retries_total", "counter", "Extra attempts spent on retries, attributed to the node that finished the request.")
+	for _, k := range keys {
+		w.sample("qcc_request_retries_total", labelsOf(k), float64(c.series[k].retries))
+	}
+	w.family("qcc_tokens_total", "counter", "Tokens reported by upstream usage.")
+	for _, k := range keys {
+		w.sample("qcc_tokens_total", append(labelsOf(k), "direction", "input"), float64(c.series[k].inputTokens))
+		w.sample("qcc_tokens_total", append(labelsOf(k), "direction", "output"), float64(c.series[k].outputTokens))
+	}
+	w.family("qcc_response_bytes_total", "counter", "Response bytes written to clients.")
+	for _, k := range keys {
+		w.sample("qcc_response_bytes_total", labelsOf(k), float64(c.series[k].bytes))
+	}
+	w.family("qcc_request_duration_seconds", "histogram", "Upstream attempt duration from send to last byte.")
+	for _, k := range keys {
+		w.histogram("qcc_request_duration_seconds", labelsOf(k), c.series[k].latency)
+	}
+	w.family("qcc_first_byte_seconds", "histogram", "Time to first response byte per upstream attempt.")
+	for _, k := range keys {
+		w.histogram("qcc_first_byte_seconds", labelsOf(k), c.series[k].firstByte)
+	}
+}
+
+type promNodeState struct {
+	account    string
+	node       string
+	name       string
+	active     bool
+	failed     bool
+	disabled   bool
+	inFlight   int64
+	failStreak int64
+	weight     int
+	ewmaMS     float64
+	pingMS     int64
+	passive    passiveState
+}
+
+// writeStateMetrics 输出节点健康、熔断器、连接与队列等瞬时状态。
+func (p *Server) writeStateMetrics(w *promWriter) {
+	p.mu.RLock()
+	var nodes []promNodeState
+	for _, acc := range p.accountByID {
+		for _, n := range acc.Nodes {
+			nodes = append(nodes, promNodeState{
+				account:    acc.ID,
+				node:       n.ID,
+				name:       n.Name,
+				active:     acc.ActiveID == n.ID,
+				failed:     n.Failed,
+				disabled:   n.Disabled,
+				inFlight:   atomic.LoadInt64(&n.InFlight),
+				failStreak: n.Metrics.FailStreak,
+				weight:     n.Weight,
+				ewmaMS:     n.Metrics.EWMALatencyMS,
+				pingMS:     n.Metrics.LastPingMS,
+				passive:    n.Passive,
+			})
+		}
+	}
+	p.mu.RUnlock()
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].account != nodes[j].account {
+			return nodes[i].account < nodes[j].account
+		}
+		return nodes[i].node < nodes[j].node
+	})
+	labelsOf := func(n promNodeState) []string { return []string{"account", n.account, "node", n.node} }
+
+	w.family("qcc_node_info", "gauge", "Static node metadata, always 1.")
+	for _, n := range nodes {
+		w.sample("qcc_node_info", append(labelsOf(n), "name", n.name), 1)
+	}
+	w.family("qcc_node_up", "gauge", "1 if the node is enabled and not marked failed.")
+	for _, n := range nodes {
+		w.sample("qcc_node_up", labelsOf(n), boolGauge(!n.failed && !n.disabled))
+	}
+	w.family("qcc_node_disabled", "gauge", "1 if the node was disabled manually.")
+	for _, n := range nodes {
+		w.sample("qcc_node_disabled", labelsOf(n), boolGauge(n.disabled))
+	}
+	w.family("qcc_node_active", "gauge", "1 if the node is the account's active node.")
+	for _, n := range nodes {
+		w.sample("qcc_node_active", labelsOf(n), boolGauge(n.active))
+	}
+	w.family("qcc_node_in_flight", "gauge", "Requests currently in flight to the node.")
+	for _, n := range nodes {
+		w.sample("qcc_node_in_flight", labelsOf(n), float64(n.inFlight))
+	}
+	w.family("qcc_node_fail_streak", "gauge", "Consecutive failures of the node.")
+	for _, n := range nodes {
+		w.sample("qcc_node_fail_streak", labelsOf(n), float64(n.failStreak))
+	}
+	w.family("qcc_node_weight", "gauge", "Configured node weight (lower means higher priority).")
+	for _, n := range nodes {
+		w.sample("qcc_node_weight", labelsOf(n), float64(n.weight))
+	}
+	w.family("qcc_node_health_score", "gauge", "Passive health score (0-100) from live proxy traffic; absent until enough samples.")
+	for _, n := range nodes {
+		if n.passive.Scored {
+			w.sample("qcc_node_health_score", labelsOf(n), n.passive.Score)
+		}
+	}
+	w.family("qcc_node_effective_weight", "gauge", "Node weight plus passive health demotion penalty.")
+	for _, n := range nodes {
+		w.sample("qcc_node_effective_weight", labelsOf(n), float64(n.weight+n.passive.Penalty))
+	}
+	w.family("qcc_node_ejected", "gauge", "1 if the node is temporarily ejected by passive health scoring.")
+	now := time.Now()
+	for _, n := range nodes {
+		w.sample("qcc_node_ejected", labelsOf(n), boolGauge(now.Before(n.passive.EjectedUntil)))
+	}
+	w.family("qcc_node_ewma_first_byte_seconds", "gauge", "EWMA of first byte latency for successful requests.")
+	for _, n := range nodes {
+		w.sample("qcc_node_ewma_first_byte_seconds", labelsOf(n), n.ewmaMS/1000)
+	}
+	w.family("qcc_node_health_check_latency_seconds", "gauge", "Latency of the last health check.")
+	for _, n := range nodes {
+		w.sample("qcc_node_health_check_latency_seconds", labelsOf(n), float64(n.pingMS)/1000)
+	}
+
+	w.family("qcc_circuit_breaker_state", "gauge", "Circuit breaker state: 0=closed, 1=open, 2=half-open.")
+	for _, n := range nodes {
+		p.cbMu.RLock()
+		cb := p.circuitBreakers[n.node]
+		p.cbMu.RUnlock()
+		if cb != nil {
+			w.sample("qcc_circuit_breaker_state", labelsOf(n), float64(cb.GetState()))
+		}
+	}
+
+	w.family("qcc_websocket_clients", "gauge", "Connected monitor WebSocket clients.")
+	w.sample("qcc_websocket_clients", nil, float64(p.wsHub.ClientCount()))
+
+	if p.notifyMgr != nil {
+		depth, capacity := p.notifyMgr.QueueDepth()
+		w.family("qcc_notify_queue_depth", "gauge", "Notification events waiting in the queue.")
+		w.sample("qcc_notify_queue_depth", nil, float64(depth))
+		w.family("qcc_notify_queue_capacity", "gauge", "Notification queue capacity.")
+		w.sample("qcc_notify_queue_capacity", nil, float64(capacity))
+		w.family("qcc_notify_dropped_total", "counter", "Notification events dropped because the queue was full.")
+		w.sample("qcc_notify_dropped_total", nil, float64(p.notifyMgr.DroppedCount()))
+		w.family("qcc_notify_dead_letter_total", "counter", "Notifications moved to the dead-letter state after exhausting retries.")
+		w.sample("qcc_notify_dead_letter_total", nil, float64(p.notifyMgr.DeadLetterCount()))
+	}
+
+	if p.store != nil {
+		stats := p.store.Stats()
+		w.family("qcc_db_open_connections", "gauge", "Open database connections.")
+		w.sample("qcc_db_open_connections", nil, float64(stats.OpenConnections))
+		w.family("qcc_db_in_use_connections", "gauge", "Database connections in use.")
+		w.sample("qcc_db_in_use_connections", nil, float64(stats.InUse))
+		w.family("qcc_db_idle_connections", "gauge", "Idle database connections.")
+		w.sample("qcc_db_idle_connections", nil, float64(stats.Idle))
+		w.family("qcc_db_max_open_connections", "gauge", "Maximum open database connections.")
+		w.sample("qcc_db_max_open_connections", nil, float64(stats.MaxOpenConnections))
+		w.family("qcc_db_wait_count_total", "counter", "Total connections waited for.")
+		w.sample("qcc_db_wait_count_total", nil, float64(stats.WaitCount))
+		w.family("qcc_db_wait_duration_seconds_total", "counter", "Total time blocked waiting for a connection.")
+		w.sample("qcc_db_wait_duration_seconds_total", nil, stats.WaitDuration.Seconds())
+	}
+
+	w.family("qcc_build_info", "gauge", "Build metadata, always 1.")
+	w.sample("qcc_build_info", []string{"version", version.Version, "commit", version.GitCommit, "go_version", version.GoVersion}, 1)
+}
+
+// parseAllowList 解析逗号分隔的 IP/CIDR 白名单，单个 IP 视为 /32 或 /128。
+func parseAllowList(raw string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// metricsAuthorized 允许管理员密钥（x-admin-key 或 Bearer）或来源 IP 命中 METRICS_ALLOW_IPS 白名单的请求。
+func (p *Server) metricsAuthorized(r *http.Request) bool {
+	key := r.Header.Get("x-admin-key")
+	if key == "" {
+		key = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key != "" && p.adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(p.adminKey)) == 1 {
+		return true
+	}
+	if len(p.metricsAllowNets) == 0 {
+		return false
+	}
+	// 转发头只在直连方为可信代理时生效，避免经由本机/内网代理伪造 X-Forwarded-For 命中白名单。
+	return ipInNets(net.ParseIP(p.clientIP(r)), p.metricsAllowNets)
+}
+
+// GET /metrics Prometheus 文本格式指标。
+func (p *Server) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.metricsAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	pw := &promWriter{}
+	p.prom.writeRequestMetrics(pw)
+	p.writeStateMetrics(pw)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(pw.buf.Bytes())
+}
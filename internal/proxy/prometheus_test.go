@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetricsEndpoint(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":[],"usage":{"input_tokens":7,"output_tokens":2}}`))
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy").WithAdminKey("metrics-admin"))
+	h := srv.Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-haiku-4-5","max_tokens":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "test-proxy")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("proxy status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	scrape := func(mutate func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = "203.0.113.9:5555"
+		mutate(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := scrape(func(*http.Request) {}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous scrape status=%d", rec.Code)
+	}
+	rec = scrape(func(r *http.Request) { r.Header.Set("Authorization", "Bearer metrics-admin") })
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("admin scrape status=%d type=%s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`qcc_upstream_attempts_total{account="default",node="default",code="200"} 1`,
+		`qcc_tokens_total{account="default",node="default",direction="input"} 7`,
+		`qcc_request_duration_seconds_bucket{account="default",node="default",le="+Inf"} 1`,
+		`qcc_first_byte_seconds_count{account="default",node="default"} 1`,
+		`qcc_node_up{account="default",node="default"} 1`,
+		"# TYPE qcc_request_duration_seconds histogram",
+		"qcc_websocket_clients 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+
+	nets, err := parseAllowList("10.0.0.0/8, 203.0.113.9")
+	if err != nil {
+		t.Fatalf("parse allow list: %v", err)
+	}
+	srv.metricsAllowNets = nets
+	if rec := scrape(func(*http.Request) {}); rec.Code != http.StatusOK {
+		t.Fatalf("allow-listed scrape status=%d", rec.Code)
+	}
+	// 经由本机代理转发时，伪造的 X-Forwarded-For 不能命中白名单。
+	spoofed := func(r *http.Request) {
+		r.RemoteAddr = "127.0.0.1:5555"
+		r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	}
+	if rec := scrape(spoofed); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("spoofed scrape status=%d", rec.Code)
+	}
+	srv.trustedProxies, _ = parseAllowList("127.0.0.1")
+	if rec := scrape(spoofed); rec.Code != http.StatusOK {
+		t.Fatalf("scrape via trusted proxy status=%d", rec.Code)
+	}
+	if _, err := parseAllowList("not-an-ip"); err == nil {
+		t.Fatalf("expected error for invalid allow-list entry")
+	}
+}
@@ -300,9 +300,9 @@ func TestParseUsageFromSSE(t *testing.T) {
 	s := []byte("event: message_start\n\n" +
 		"event: message_delta\ndata: {\"type\":\"message_delta\"}\n\n" +
 		"event: message_stop\ndata: {\"type\":\"message_stop\",\"usage\":{\"input_tokens\":11,\"output_tokens\":22}}\n\n")
-	in, out := parseUsage(s)
-	if in != 11 || out != 22 {
-		t.Fatalf("unexpected usage %d %d", in, out)
+	u := parseUsage(s)
+	if u.input != 11 || u.output != 22 {
+		t.Fatalf("unexpected usage %d %d", u.input, u.output)
 	}
 }
 
@@ -464,8 +464,8 @@ func TestAccountsCreateStoresPassword(t *testing.T) {
 	if created == nil {
 		t.Fatalf("account not registered")
 	}
-	if created.Password != "secret6" {
-		t.Fatalf("password not stored, got %q", created.Password)
+	if ok, _ := checkPassword(created.Password, "secret6"); !ok || !isPasswordHash(created.Password) {
+		t.Fatalf("password not stored as bcrypt hash, got %q", created.Password)
 	}
 }
 
@@ -0,0 +1,481 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/notify"
+	"qcc_plus/internal/store"
+	"qcc_plus/internal/timeutil"
+)
+
+const settingQuotaWarnThresholds = "quota.warn_thresholds"
+
+// defaultQuotaWarnThresholds 未配置 quota.warn_thresholds 时使用的告警阈值（百分比）。
+var defaultQuotaWarnThresholds = []int{80, 100}
+
+// QuotaLimits 账号级限流与 token 预算，0 表示不限制。
+type QuotaLimits struct {
+	RPM            int   `json:"rpm"`
+	MaxConcurrency int   `json:"max_concurrency"`
+	DailyTokens    int64 `json:"daily_tokens"`
+	MonthlyTokens  int64 `json:"monthly_tokens"`
+	// WarnThresholds 为空表示跟随系统配置 quota.warn_thresholds。
+	WarnThresholds []int `json:"warn_thresholds,omitempty"`
+}
+
+func (q QuotaLimits) validate() error {
+	if q.RPM < 0 || q.MaxConcurrency < 0 || q.DailyTokens < 0 || q.MonthlyTokens < 0 {
+		return errors.New("quota limits must be >= 0")
+	}
+	for _, t := range q.WarnThresholds {
+		if t <= 0 || t > 1000 {
+			return fmt.Errorf("invalid warn threshold %d", t)
+		}
+	}
+	return nil
+}
+
+// quotaExceededError 请求被限流时返回，RetryAfter 为建议的重试等待时间。
+type quotaExceededError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *quotaExceededError) Error() string { return e.Message }
+
+// quotaPeriodUsage 单个统计周期（北京时间自然日/自然月）的内存用量。
+type quotaPeriodUsage struct {
+	key    string
+	used   int64
+	warned int
+}
+
+type accountQuotaState struct {
+	mu       sync.Mutex
+	requests []time.Time // 最近一分钟内的请求时间，用于滑动窗口 RPM
+	inflight int
+	periods  map[string]*quotaPeriodUsage
+}
+
+// quotaWarning 一次新跨越的告警阈值。
+type quotaWarning struct {
+	Period    string
+	PeriodKey string
+	Threshold int
+	Used      int64
+	Limit     int64
+}
+
+// quotaStoreTimeout 单次用量读写的超时，避免存储阻塞请求路径。
+const quotaStoreTimeout = 3 * time.Second
+
+// quotaTracker 维护各账号的限流窗口、在途请求与 token 用量；用量同时写入存储，重启后从存储恢复。
+type quotaTracker struct {
+	mu     sync.Mutex
+	states map[string]*accountQuotaState
+	store  store.QuotaStore
+	logger *log.Logger
+	now    func() time.Time
+}
+
+func newQuotaTracker(st store.QuotaStore, logger *log.Logger) *quotaTracker {
+	return &quotaTracker{states: make(map[string]*accountQuotaState), store: st, logger: logger, now: time.Now}
+}
+
+func (t *quotaTracker) logf(format string, args ...any) {
+	if t.logger != nil {
+		t.logger.Printf(format, args...)
+	}
+}
+
+func (t *quotaTracker) state(accountID string) *accountQuotaState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.states[accountID]
+	if st == nil {
+		st = &accountQuotaState{periods: make(map[string]*quotaPeriodUsage)}
+		t.states[accountID] = st
+	}
+	return st
+}
+
+// forget 丢弃账号的内存状态（账号删除时调用）。
+func (t *quotaTracker) forget(accountID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.states, accountID)
+	t.mu.Unlock()
+}
+
+// quotaPeriodKey 返回北京时间下的周期标识及下一周期开始时间。
+func quotaPeriodKey(period string, now time.Time) (string, time.Time) {
+	bj := now.In(timeutil.BeijingLocation)
+	if period == store.QuotaPeriodMonth {
+		start := time.Date(bj.Year(), bj.Month(), 1, 0, 0, 0, 0, timeutil.BeijingLocation)
+		return bj.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(bj.Year(), bj.Month(), bj.Day(), 0, 0, 0, 0, timeutil.BeijingLocation)
+	return bj.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+// loadPeriods 跨周期时在锁外从存储加载当前周期用量。读取失败时不缓存，下次调用重试，
+// 避免一次存储故障把整个周期的用量清零。调用方不能持有 st.mu。
+func (t *quotaTracker) loadPeriods(accountID string, st *accountQuotaState, now time.Time) {
+	if t.store == nil {
+		return
+	}
+	for _, period := range []string{store.QuotaPeriodDay, store.QuotaPeriodMonth} {
+		key, _ := quotaPeriodKey(period, now)
+		st.mu.Lock()
+		u := st.periods[period]
+		st.mu.Unlock()
+		if u != nil && u.key == key {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), quotaStoreTimeout)
+		rec, err := t.store.GetAccountUsage(ctx, accountID, period, key)
+		cancel()
+		loaded := &quotaPeriodUsage{key: key}
+		switch {
+		case err == nil:
+			loaded.used = rec.InputTokens + rec.OutputTokens
+			loaded.warned = rec.WarnedPct
+		case errors.Is(err, store.ErrNotFound):
+		default:
+			t.logf("load %s quota usage for account %s failed: %v", period, accountID, err)
+			continue
+		}
+		st.mu.Lock()
+		if cur := st.periods[period]; cur == nil || cur.key != key {
+			st.periods[period] = loaded
+		}
+		st.mu.Unlock()
+	}
+}
+
+// period 返回当前周期用量，调用方需持有 st.mu 并先调用 loadPeriods。
+// 未加载成功的周期返回不缓存的临时用量，本次增量仍会写入存储。
+func (t *quotaTracker) period(st *accountQuotaState, period string, now time.Time) *quotaPeriodUsage {
+	key, _ := quotaPeriodKey(period, now)
+	u := st.periods[period]
+	if u != nil && u.key == key {
+		return u
+	}
+	u = &quotaPeriodUsage{key: key}
+	if t.store == nil {
+		st.periods[period] = u
+	}
+	return u
+}
+
+// acquire 检查 token 预算、RPM 与并发限制，通过后占用一个并发名额；调用方需在请求结束后调用 release。
+func (t *quotaTracker) acquire(accountID string, limits QuotaLimits) (release func(), err error) {
+	noop := func() {}
+	if t == nil {
+		return noop, nil
+	}
+	if limits.RPM <= 0 && limits.MaxConcurrency <= 0 && limits.DailyTokens <= 0 && limits.MonthlyTokens <= 0 {
+		return noop, nil
+	}
+	now := t.now()
+	st := t.state(accountID)
+	if limits.DailyTokens > 0 || limits.MonthlyTokens > 0 {
+		t.loadPeriods(accountID, st, now)
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	budgets := []struct {
+		period string
+		limit  int64
+		label  string
+	}{
+		{store.QuotaPeriodDay, limits.DailyTokens, "daily"},
+		{store.QuotaPeriodMonth, limits.MonthlyTokens, "monthly"},
+	}
+	for _, b := range budgets {
+		if b.limit <= 0 {
+			continue
+		}
+		if u := t.period(st, b.period, now); u.used >= b.limit {
+			_, next := quotaPeriodKey(b.period, now)
+			return nil, &quotaExceededError{
+				Message:    fmt.Sprintf("This request would exceed your account's %s token quota (%d tokens). Please wait until the quota resets.", b.label, b.limit),
+				RetryAfter: next.Sub(now),
+			}
+		}
+	}
+
+	if limits.RPM > 0 {
+		cutoff := now.Add(-time.Minute)
+		keep := st.requests[:0]
+		for _, ts := range st.requests {
+			if ts.After(cutoff) {
+				keep = append(keep, ts)
+			}
+		}
+		st.requests = keep
+		if len(st.requests) >= limits.RPM {
+			return nil, &quotaExceededError{
+				Message:    fmt.Sprintf("This request would exceed your account's rate limit of %d requests per minute. Please try again later.", limits.RPM),
+				RetryAfter: st.requests[0].Add(time.Minute).Sub(now),
+			}
+		}
+	}
+	if limits.MaxConcurrency > 0 && st.inflight >= limits.MaxConcurrency {
+		return nil, &quotaExceededError{
+			Message:    fmt.Sprintf("This request would exceed your account's limit of %d concurrent requests. Please try again later.", limits.MaxConcurrency),
+			RetryAfter: time.Second,
+		}
+	}
+
+	if limits.RPM > 0 {
+		st.requests = append(st.requests, now)
+	}
+	st.inflight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			st.mu.Lock()
+			st.inflight--
+			st.mu.Unlock()
+		})
+	}, nil
+}
+
+// record 累加一次请求的 token 用量并持久化，返回本次新跨越的告警阈值。
+func (t *quotaTracker) record(accountID string, limits QuotaLimits, thresholds []int, input, output int64) []quotaWarning {
+	if t == nil || input+output <= 0 {
+		return nil
+	}
+	now := t.now()
+	st := t.state(accountID)
+
+	type pending struct {
+		period, key string
+		warned      int
+	}
+	var (
+		warnings []quotaWarning
+		marks    []pending
+		keys     = map[string]string{}
+	)
+	t.loadPeriods(accountID, st, now)
+	st.mu.Lock()
+	for _, b := range []struct {
+		period string
+		limit  int64
+	}{{store.QuotaPeriodDay, limits.DailyTokens}, {store.QuotaPeriodMonth, limits.MonthlyTokens}} {
+		u := t.period(st, b.period, now)
+		u.used += input + output
+		keys[b.period] = u.key
+		if b.limit <= 0 {
+			continue
+		}
+		pct := int(math.Floor(float64(u.used) * 100 / float64(b.limit)))
+		crossed := 0
+		for _, th := range thresholds {
+			if th > u.warned && pct >= th && th > crossed {
+				crossed = th
+			}
+		}
+		if crossed > 0 {
+			u.warned = crossed
+			marks = append(marks, pending{b.period, u.key, crossed})
+			warnings = append(warnings, quotaWarning{Period: b.period, PeriodKey: u.key, Threshold: crossed, Used: u.used, Limit: b.limit})
+		}
+	}
+	st.mu.Unlock()
+
+	if t.store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), quotaStoreTimeout)
+		defer cancel()
+		for period, key := range keys {
+			if err := t.store.AddAccountUsage(ctx, accountID, period, key, input, output); err != nil {
+				t.logf("record %s quota usage for account %s failed: %v", period, accountID, err)
+			}
+		}
+		for _, m := range marks {
+			if err := t.store.MarkQuotaWarned(ctx, accountID, m.period, m.key, m.warned); err != nil {
+				t.logf("mark %s quota warning for account %s failed: %v", m.period, accountID, err)
+			}
+		}
+	}
+	return warnings
+}
+
+// quotaUsageView 账号当前周期用量快照。
+type quotaUsageView struct {
+	RPMUsed     int    `json:"rpm_used"`
+	InFlight    int    `json:"in_flight"`
+	DailyKey    string `json:"daily_key"`
+	DailyUsed   int64  `json:"daily_used"`
+	MonthlyKey  string `json:"monthly_key"`
+	MonthlyUsed int64  `json:"monthly_used"`
+}
+
+func (t *quotaTracker) snapshot(accountID string) quotaUsageView {
+	if t == nil {
+		return quotaUsageView{}
+	}
+	now := t.now()
+	st := t.state(accountID)
+	t.loadPeriods(accountID, st, now)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	view := quotaUsageView{InFlight: st.inflight}
+	cutoff := now.Add(-time.Minute)
+	for _, ts := range st.requests {
+		if ts.After(cutoff) {
+			view.RPMUsed++
+		}
+	}
+	day := t.period(st, store.QuotaPeriodDay, now)
+	month := t.period(st, store.QuotaPeriodMonth, now)
+	view.DailyKey, view.DailyUsed = day.key, day.used
+	view.MonthlyKey, view.MonthlyUsed = month.key, month.used
+	return view
+}
+
+// writeRateLimitError 按 Anthropic API 错误格式返回 429。
+func writeRateLimitError(w http.ResponseWriter, err *quotaExceededError) {
+	secs := int(math.Ceil(err.RetryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("retry-after", strconv.Itoa(secs))
+	writeAnthropicError(w, http.StatusTooManyRequests, "rate_limit_error", err.Message)
+}
+
+// quotaWarnThresholds 返回生效的告警阈值：账号配置 > 系统配置 quota.warn_thresholds > 80/100。
+func (p *Server) quotaWarnThresholds(limits QuotaLimits) []int {
+	if len(limits.WarnThresholds) > 0 {
+		return limits.WarnThresholds
+	}
+	if p.settingsCache != nil {
+		if raw, ok := p.settingsCache.Get(settingQuotaWarnThresholds); ok {
+			if items, ok := raw.([]any); ok {
+				out := make([]int, 0, len(items))
+				for _, item := range items {
+					if v, ok := item.(float64); ok && v > 0 {
+						out = append(out, int(v))
+					}
+				}
+				if len(out) > 0 {
+					sort.Ints(out)
+					return out
+				}
+			}
+		}
+	}
+	return defaultQuotaWarnThresholds
+}
+
+// acquireQuota 对账号执行限流检查，被拒绝时已写出 429 响应并返回 ok=false。
+func (p *Server) acquireQuota(w http.ResponseWriter, acc *Account) (release func(), ok bool) {
+	p.mu.RLock()
+	limits := acc.Quota
+	p.mu.RUnlock()
+	release, err := p.quotas.acquire(acc.ID, limits)
+	if err != nil {
+		var qerr *quotaExceededError
+		if errors.As(err, &qerr) {
+			p.logger.Printf("account %s rate limited: %s", acc.ID, qerr.Message)
+			writeRateLimitError(w, qerr)
+		}
+		return nil, false
+	}
+	return release, true
+}
+
+// recordQuotaUsage 累加账号 token 用量，并在跨越告警阈值时发送配额告警。
+func (p *Server) recordQuotaUsage(acc *Account, u *usage) {
+	if u == nil || p.quotas == nil {
+		return
+	}
+	p.mu.RLock()
+	limits := acc.Quota
+	p.mu.RUnlock()
+	warnings := p.quotas.record(acc.ID, limits, p.quotaWarnThresholds(limits), u.input, u.output)
+	if p.notifyMgr == nil {
+		return
+	}
+	for _, wn := range warnings {
+		severity := notify.SeverityWarning
+		if wn.Threshold >= 100 {
+			severity = notify.SeverityCritical
+		}
+		p.notifyMgr.Publish(notify.Event{
+			AccountID: acc.ID,
+			EventType: notify.EventAccountQuotaWarning,
+			Severity:  severity,
+			Data: map[string]any{
+				"account_name": acc.Name,
+				"period":       string(wn.Period),
+				"period_key":   wn.PeriodKey,
+				"used":         wn.Used,
+				"limit":        wn.Limit,
+				"threshold":    wn.Threshold,
+			},
+			DedupKey:   fmt.Sprintf("%s:%s:%d", wn.Period, wn.PeriodKey, wn.Threshold),
+			OccurredAt: time.Now(),
+		})
+	}
+}
+
+// setAccountQuota 更新账号配额并持久化；limits 为零值时删除配置。
+func (p *Server) setAccountQuota(acc *Account, limits QuotaLimits) error {
+	p.mu.Lock()
+	acc.Quota = limits
+	p.mu.Unlock()
+	if p.store == nil {
+		return nil
+	}
+	ctx := context.Background()
+	if limits.RPM == 0 && limits.MaxConcurrency == 0 && limits.DailyTokens == 0 && limits.MonthlyTokens == 0 && len(limits.WarnThresholds) == 0 {
+		if err := p.store.DeleteAccountQuota(ctx, acc.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+	return p.store.UpsertAccountQuota(ctx, store.AccountQuotaRecord{
+		AccountID:      acc.ID,
+		RPM:            limits.RPM,
+		MaxConcurrency: limits.MaxConcurrency,
+		DailyTokens:    limits.DailyTokens,
+		MonthlyTokens:  limits.MonthlyTokens,
+		WarnThresholds: limits.WarnThresholds,
+	})
+}
+
+// loadAccountQuota 从存储读取账号配额。
+func (p *Server) loadAccountQuota(ctx context.Context, accountID string) QuotaLimits {
+	if p.store == nil {
+		return QuotaLimits{}
+	}
+	rec, err := p.store.GetAccountQuota(ctx, accountID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			p.logger.Printf("account %s: load quota failed: %v", accountID, err)
+		}
+		return QuotaLimits{}
+	}
+	return QuotaLimits{
+		RPM:            rec.RPM,
+		MaxConcurrency: rec.MaxConcurrency,
+		DailyTokens:    rec.DailyTokens,
+		MonthlyTokens:  rec.MonthlyTokens,
+		WarnThresholds: rec.WarnThresholds,
+	}
+}
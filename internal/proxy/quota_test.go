@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+func TestQuotaTrackerRPMAndConcurrency(t *testing.T) {
+	now := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	tr := newQuotaTracker(nil, nil)
+	tr.now = func() time.Time { return now }
+
+	limits := QuotaLimits{RPM: 2, MaxConcurrency: 1}
+	release, err := tr.acquire("acc", limits)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	if _, err := tr.acquire("acc", limits); err == nil {
+		t.Fatalf("expected concurrency limit")
+	}
+	release()
+	release() // 重复释放不应使在途计数为负
+
+	rel2, err := tr.acquire("acc", limits)
+	if err != nil {
+		t.Fatalf("second acquire: %v", err)
+	}
+	rel2()
+	_, err = tr.acquire("acc", limits)
+	qerr, ok := err.(*quotaExceededError)
+	if !ok || !strings.Contains(qerr.Message, "per minute") || qerr.RetryAfter != time.Minute {
+		t.Fatalf("expected rpm limit, got %v", err)
+	}
+
+	// 窗口滑过后恢复。
+	now = now.Add(61 * time.Second)
+	if _, err := tr.acquire("acc", limits); err != nil {
+		t.Fatalf("acquire after window: %v", err)
+	}
+}
+
+func TestQuotaTrackerTokenBudgetAndWarnings(t *testing.T) {
+	// 北京时间 2025-01-02 23:59:00。
+	now := time.Date(2025, 1, 2, 15, 59, 0, 0, time.UTC)
+	tr := newQuotaTracker(nil, nil)
+	tr.now = func() time.Time { return now }
+	limits := QuotaLimits{DailyTokens: 1000}
+	thresholds := []int{80, 100}
+
+	if ws := tr.record("acc", limits, thresholds, 500, 200); len(ws) != 0 {
+		t.Fatalf("unexpected warnings at 70%%: %+v", ws)
+	}
+	ws := tr.record("acc", limits, thresholds, 100, 50)
+	if len(ws) != 1 || ws[0].Threshold != 80 || ws[0].PeriodKey != "2025-01-02" {
+		t.Fatalf("expected 80%% warning, got %+v", ws)
+	}
+	if ws := tr.record("acc", limits, thresholds, 10, 0); len(ws) != 0 {
+		t.Fatalf("80%% warning should fire once: %+v", ws)
+	}
+	// 一次跨越多个阈值时只告警最高的一个。
+	ws = tr.record("acc", limits, thresholds, 200, 0)
+	if len(ws) != 1 || ws[0].Threshold != 100 || ws[0].Used != 1060 {
+		t.Fatalf("expected 100%% warning, got %+v", ws)
+	}
+
+	_, err := tr.acquire("acc", limits)
+	qerr, ok := err.(*quotaExceededError)
+	if !ok || qerr.RetryAfter != time.Minute {
+		t.Fatalf("expected daily quota exceeded until midnight, got %v", err)
+	}
+
+	// 北京时间跨日后日预算重置。
+	now = now.Add(2 * time.Minute)
+	if _, err := tr.acquire("acc", limits); err != nil {
+		t.Fatalf("acquire on next day: %v", err)
+	}
+	if snap := tr.snapshot("acc"); snap.DailyUsed != 0 || snap.MonthlyUsed != 1060 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+// flakyQuotaStore 按调用次数让 GetAccountUsage 失败，用于验证读取失败不会清零周期用量。
+type flakyQuotaStore struct {
+	store.QuotaStore
+	failures int
+	used     int64
+	added    int64
+}
+
+func (f *flakyQuotaStore) GetAccountUsage(ctx context.Context, accountID, period, periodKey string) (*store.AccountUsageRecord, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("connection reset")
+	}
+	if period == store.QuotaPeriodMonth {
+		return nil, store.ErrNotFound
+	}
+	return &store.AccountUsageRecord{InputTokens: f.used + f.added}, nil
+}
+
+func (f *flakyQuotaStore) AddAccountUsage(ctx context.Context, accountID, period, periodKey string, input, output int64) error {
+	if period == store.QuotaPeriodDay {
+		f.added += input + output
+	}
+	return nil
+}
+
+func TestQuotaUsageLoadErrorNotCached(t *testing.T) {
+	fs := &flakyQuotaStore{failures: 2, used: 900}
+	tr := newQuotaTracker(fs, nil)
+	limits := QuotaLimits{DailyTokens: 1000}
+
+	// 读取失败时放行本次请求，但不缓存零用量。
+	release, err := tr.acquire("acc", limits)
+	if err != nil {
+		t.Fatalf("acquire while store is failing: %v", err)
+	}
+	release()
+	tr.record("acc", limits, nil, 100, 0)
+	if _, err := tr.acquire("acc", limits); err == nil {
+		t.Fatal("expected daily quota to be enforced once the store recovers")
+	}
+	if snap := tr.snapshot("acc"); snap.DailyUsed != 1000 || snap.MonthlyUsed != 100 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestMessagesRateLimited(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().
+		WithUpstream(upstream.URL).
+		WithAPIKey("test-proxy"))
+	if err := srv.setAccountQuota(srv.defaultAccount, QuotaLimits{RPM: 1}); err != nil {
+		t.Fatalf("set quota: %v", err)
+	}
+	h := srv.Handler()
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set("x-api-key", srv.defaultAccount.ProxyAPIKey)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("first request status=%d", rec.Code)
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("retry-after") == "" {
+		t.Fatalf("expected 429 with retry-after, got %d %v", rec.Code, rec.Header())
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Type != "error" || body.Error.Type != "rate_limit_error" {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
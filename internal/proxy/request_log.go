@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	defaultRequestLogBodyMax       = 16 * 1024
+	defaultRequestLogRetentionDays = 7
+	// 开启工具脱敏时需先拿到完整 JSON 才能解析，响应体按该上限缓存，脱敏后再截断到 body_max_bytes。
+	requestLogRedactCaptureMax = 1 << 20
+	redactedPlaceholder        = "[redacted]"
+	truncatedSuffix            = "...(truncated)"
+)
+
+// requestLog 单个代理请求的日志采集状态，跨多次重试尝试累积。
+type requestLog struct {
+	rec          store.RequestLogRecord
+	start        time.Time
+	captureLimit int // 响应体缓存上限，0 表示不采集请求/响应体
+	bodyMax      int
+	redactSystem bool
+	redactTools  bool
+	respBody     []byte
+	respTrunc    bool
+	respType     string
+}
+
+// beginRequestLog 按系统配置初始化请求日志，未开启时返回 nil。
+func (p *Server) beginRequestLog(account *Account, apiKey *APIKey, body []byte) *requestLog {
+	if p.store == nil || p.settingsCache == nil || !p.settingsCache.GetBool("request_log.enabled", false) {
+		return nil
+	}
+	var meta struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	_ = json.Unmarshal(body, &meta)
+	l := &requestLog{
+		start: time.Now(),
+		rec: store.RequestLogRecord{
+			APIKeyID: apiKeyID(apiKey),
+			Model:    meta.Model,
+			Stream:   meta.Stream,
+		},
+	}
+	if account != nil {
+		l.rec.AccountID = account.ID
+	}
+	if !p.settingsCache.GetBool("request_log.capture_bodies", false) {
+		return l
+	}
+	l.bodyMax = p.settingsCache.GetInt("request_log.body_max_bytes", defaultRequestLogBodyMax)
+	if l.bodyMax <= 0 {
+		l.bodyMax = defaultRequestLogBodyMax
+	}
+	l.redactSystem = p.settingsCache.GetBool("request_log.redact_system", true)
+	l.redactTools = p.settingsCache.GetBool("request_log.redact_tools", true)
+	l.captureLimit = l.bodyMax
+	if l.redactTools && l.captureLimit < requestLogRedactCaptureMax {
+		l.captureLimit = requestLogRedactCaptureMax
+	}
+	l.rec.RequestBody = truncateBody(redactRequestBody(body, l.redactSystem, l.redactTools), l.bodyMax, false)
+	return l
+}
+
+// prepare 为本次尝试的 metricsWriter 开启响应体采集。
+func (l *requestLog) prepare(mw *metricsWriter) {
+	if l != nil {
+		mw.captureLimit = l.captureLimit
+	}
+}
+
+// observe 记录一次尝试的结果，最后一次尝试的节点、状态码与响应体生效，token 用量累加。
+func (l *requestLog) observe(node *Node, mw *metricsWriter, u *usage, attempt int, errMsg string) {
+	if l == nil {
+		return
+	}
+	if node != nil {
+		l.rec.NodeID = node.ID
+	}
+	l.rec.StatusCode = mw.status
+	l.rec.RetryCount = attempt - 1
+	l.rec.Error = errMsg
+	if mw.firstWrite && l.rec.FirstByteMs == 0 && mw.status == http.StatusOK {
+		l.rec.FirstByteMs = mw.firstAt.Sub(l.start).Milliseconds()
+	}
+	if u != nil {
+		l.rec.InputTokens += u.input
+		l.rec.OutputTokens += u.output
+	}
+	if l.captureLimit > 0 {
+		l.respBody, l.respTrunc = mw.captured, mw.capTruncated
+		l.respType = mw.Header().Get("Content-Type")
+	}
+}
+
+// fail 记录未真正转发到上游的失败（无可用节点、超时等）。
+func (l *requestLog) fail(status int, errMsg string) {
+	if l == nil {
+		return
+	}
+	l.rec.StatusCode = status
+	l.rec.Error = errMsg
+}
+
+// finishRequestLog 补全耗时与响应体后写库，写入失败只记录日志不影响请求。
+func (p *Server) finishRequestLog(l *requestLog) {
+	if l == nil {
+		return
+	}
+	l.rec.CreatedAt = l.start.UTC()
+	l.rec.LatencyMs = time.Since(l.start).Milliseconds()
+	if l.captureLimit > 0 && len(l.respBody) > 0 {
+		body := redactResponseBody(l.respBody, l.respType, l.respTrunc, l.redactTools)
+		l.rec.ResponseBody = truncateBody(body, l.bodyMax, l.respTrunc)
+	}
+	if err := p.store.InsertRequestLog(context.Background(), l.rec); err != nil {
+		p.logger.Printf("[RequestLog] insert failed: %v", err)
+	}
+}
+
+// truncateBody 截断到 max 字节（不切断 UTF-8 字符），被截断时追加标记。
+func truncateBody(b []byte, max int, truncated bool) string {
+	if len(b) > max {
+		b = b[:max]
+		for i := 0; i < utf8.UTFMax-1 && len(b) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(b); r != utf8.RuneError || size > 1 {
+				break
+			}
+			b = b[:len(b)-1]
+		}
+		truncated = true
+	}
+	if truncated {
+		return string(b) + truncatedSuffix
+	}
+	return string(b)
+}
+
+// redactRequestBody 隐藏请求中的 system 提示词、工具定义以及消息中的工具调用参数与工具结果。
+func redactRequestBody(body []byte, redactSystem, redactTools bool) []byte {
+	if !redactSystem && !redactTools {
+		return body
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return body
+	}
+	placeholder, _ := json.Marshal(redactedPlaceholder)
+	if _, ok := payload["system"]; ok && redactSystem {
+		payload["system"] = placeholder
+	}
+	if redactTools {
+		if _, ok := payload["tools"]; ok {
+			payload["tools"] = placeholder
+		}
+		var messages []map[string]json.RawMessage
+		if raw, ok := payload["messages"]; ok && json.Unmarshal(raw, &messages) == nil {
+			for _, msg := range messages {
+				var blocks []map[string]json.RawMessage
+				if json.Unmarshal(msg["content"], &blocks) != nil {
+					continue
+				}
+				for _, block := range blocks {
+					redactToolBlock(block, placeholder)
+				}
+				msg["content"] = marshalNoEscape(blocks, msg["content"])
+			}
+			payload["messages"] = marshalNoEscape(messages, raw)
+		}
+	}
+	return marshalNoEscape(payload, body)
+}
+
+// redactToolBlock 隐藏单个内容块中的工具调用参数或工具结果。
+func redactToolBlock(block map[string]json.RawMessage, placeholder json.RawMessage) {
+	var typ string
+	_ = json.Unmarshal(block["type"], &typ)
+	switch typ {
+	case "tool_use", "server_tool_use":
+		if _, ok := block["input"]; ok {
+			block["input"] = placeholder
+		}
+	case "tool_result":
+		if _, ok := block["content"]; ok {
+			block["content"] = placeholder
+		}
+	}
+}
+
+// redactResponseBody 隐藏响应中的工具调用参数，兼容 JSON 与 SSE 两种格式。
+func redactResponseBody(body []byte, contentType string, truncated, redactTools bool) []byte {
+	if !redactTools {
+		return body
+	}
+	placeholder, _ := json.Marshal(redactedPlaceholder)
+	if strings.Contains(contentType, "text/event-stream") {
+		lines := bytes.Split(body, []byte("\n"))
+		if truncated && len(lines) > 0 {
+			// 截断处的半行无法解析，直接丢弃
+			lines = lines[:len(lines)-1]
+		}
+		for i, line := range lines {
+			data, ok := bytes.CutPrefix(line, []byte("data:"))
+			if !ok {
+				continue
+			}
+			var evt map[string]json.RawMessage
+			if json.Unmarshal(bytes.TrimSpace(data), &evt) != nil {
+				continue
+			}
+			changed := false
+			var block map[string]json.RawMessage
+			if json.Unmarshal(evt["content_block"], &block) == nil && block != nil {
+				redactToolBlock(block, placeholder)
+				evt["content_block"] = marshalNoEscape(block, evt["content_block"])
+				changed = true
+			}
+			var delta map[string]json.RawMessage
+			if json.Unmarshal(evt["delta"], &delta) == nil && delta != nil {
+				if _, ok := delta["partial_json"]; ok {
+					delta["partial_json"] = placeholder
+					evt["delta"] = marshalNoEscape(delta, evt["delta"])
+					changed = true
+				}
+			}
+			if changed {
+				lines[i] = append([]byte("data: "), marshalNoEscape(evt, data)...)
+			}
+		}
+		return bytes.Join(lines, []byte("\n"))
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		if bytes.Contains(body, []byte("tool_use")) {
+			return []byte(redactedPlaceholder)
+		}
+		return body
+	}
+	var blocks []map[string]json.RawMessage
+	if json.Unmarshal(payload["content"], &blocks) != nil {
+		return body
+	}
+	for _, block := range blocks {
+		redactToolBlock(block, placeholder)
+	}
+	payload["content"] = marshalNoEscape(blocks, payload["content"])
+	return marshalNoEscape(payload, body)
+}
+
+// marshalNoEscape 序列化时不转义 HTML 字符，失败时返回 fallback。
+func marshalNoEscape(v any, fallback []byte) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fallback
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"qcc_plus/internal/store"
+)
+
+func TestRedactRequestAndResponseBodies(t *testing.T) {
+	req := []byte(`{"model":"m","system":"secret prompt","tools":[{"name":"bash"}],"messages":[` +
+		`{"role":"assistant","content":[{"type":"text","text":"hi <b>"},{"type":"tool_use","id":"t1","name":"bash","input":{"cmd":"rm -rf"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"file list"}]}]}`)
+	got := string(redactRequestBody(req, true, true))
+	for _, leak := range []string{"secret prompt", `"bash"}`, "rm -rf", "file list"} {
+		if strings.Contains(got, leak) {
+			t.Fatalf("request body leaked %q: %s", leak, got)
+		}
+	}
+	if !strings.Contains(got, "hi <b>") || !strings.Contains(got, `"name":"bash"`) {
+		t.Fatalf("non-tool content should be kept: %s", got)
+	}
+	if got := string(redactRequestBody(req, false, false)); got != string(req) {
+		t.Fatalf("redaction disabled should keep body unchanged")
+	}
+
+	sse := []byte("event: content_block_start\n" +
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"t1","name":"bash","input":{}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"cmd\":\"ls"}}` + "\n\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"partial sec`)
+	got = string(redactResponseBody(sse, "text/event-stream", true, true))
+	if strings.Contains(got, "ls") || strings.Contains(got, "partial sec") || !strings.Contains(got, redactedPlaceholder) {
+		t.Fatalf("sse redaction failed: %s", got)
+	}
+
+	resp := []byte(`{"content":[{"type":"text","text":"ok"},{"type":"tool_use","name":"bash","input":{"cmd":"whoami"}}]}`)
+	if got := string(redactResponseBody(resp, "application/json", false, true)); strings.Contains(got, "whoami") || !strings.Contains(got, `"text":"ok"`) {
+		t.Fatalf("json redaction failed: %s", got)
+	}
+
+	if got := truncateBody([]byte("héllo"), 2, false); got != "h"+truncatedSuffix {
+		t.Fatalf("truncate should not split runes: %q", got)
+	}
+}
+
+func TestRequestLogRecordedAndQueried(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":[{"type":"tool_use","name":"bash","input":{"cmd":"whoami"}}],"usage":{"input_tokens":12,"output_tokens":3}}`))
+	}))
+	defer upstream.Close()
+
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(upstream.URL).WithAPIKey("test-proxy"))
+	// 内存模式构建后再挂上 SQLite 存储，避免走账号持久化流程。
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	srv.settingsCache = NewSettingsCache(st)
+	for key, value := range map[string]any{
+		"request_log.enabled":        true,
+		"request_log.capture_bodies": true,
+		"request_log.body_max_bytes": float64(4096),
+	} {
+		srv.settingsCache.UpdateLocal(key, value, 0)
+	}
+
+	body := `{"model":"claude-haiku-4-5","max_tokens":8,"system":"top secret","messages":[{"role":"user","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", "test-proxy")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	logs, total, err := srv.store.QueryRequestLogs(context.Background(), store.RequestLogQuery{AccountID: srv.defaultAccount.ID})
+	if err != nil || total != 1 {
+		t.Fatalf("expected one log, total=%d err=%v", total, err)
+	}
+	entry := logs[0]
+	if entry.Model != "claude-haiku-4-5" || entry.StatusCode != http.StatusOK || entry.NodeID == "" ||
+		entry.InputTokens != 12 || entry.OutputTokens != 3 || entry.RetryCount != 0 {
+		t.Fatalf("unexpected log entry: %+v", entry)
+	}
+
+	detailReq := httptest.NewRequest(http.MethodGet, "/admin/api/request-logs?id="+jsonNumber(entry.ID), nil)
+	detailReq = detailReq.WithContext(context.WithValue(context.WithValue(detailReq.Context(),
+		accountContextKey{}, srv.defaultAccount), isAdminContextKey{}, true))
+	detailRec := httptest.NewRecorder()
+	srv.handleRequestLogs(detailRec, detailReq)
+	if detailRec.Code != http.StatusOK {
+		t.Fatalf("detail status=%d body=%s", detailRec.Code, detailRec.Body.String())
+	}
+	var detail struct {
+		RequestBody  string `json:"request_body"`
+		ResponseBody string `json:"response_body"`
+	}
+	if err := json.Unmarshal(detailRec.Body.Bytes(), &detail); err != nil {
+		t.Fatalf("decode detail: %v", err)
+	}
+	if strings.Contains(detail.RequestBody, "top secret") || !strings.Contains(detail.RequestBody, `"content":"hi"`) {
+		t.Fatalf("request body not redacted as expected: %s", detail.RequestBody)
+	}
+	if strings.Contains(detail.ResponseBody, "whoami") || !strings.Contains(detail.ResponseBody, "tool_use") {
+		t.Fatalf("response body not redacted as expected: %s", detail.ResponseBody)
+	}
+}
+
+func jsonNumber(v int64) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+// retentionTaskTimeout 单轮数据保留清理的最长耗时；分批删除不会长时间锁表，可放宽超时。
+const retentionTaskTimeout = 30 * time.Minute
+
+// orphanRetentionKey 清理结果中已删除账号遗留数据的汇总键。
+const orphanRetentionKey = "_orphaned"
+
+// retentionSettingFields retention.* 设置键与策略字段的对应关系。
+// 系统级设置为默认策略，scope=account 的同名设置覆盖单个账号。
+var retentionSettingFields = map[string]func(*store.RetentionPolicy) *int{
+	"retention.metrics_raw_days":          func(p *store.RetentionPolicy) *int { return &p.MetricsRawDays },
+	"retention.metrics_hourly_days":       func(p *store.RetentionPolicy) *int { return &p.MetricsHourlyDays },
+	"retention.metrics_daily_days":        func(p *store.RetentionPolicy) *int { return &p.MetricsDailyDays },
+	"retention.metrics_monthly_days":      func(p *store.RetentionPolicy) *int { return &p.MetricsMonthlyDays },
+	"retention.health_history_days":       func(p *store.RetentionPolicy) *int { return &p.HealthHistoryDays },
+	"retention.notification_history_days": func(p *store.RetentionPolicy) *int { return &p.NotificationHistoryDays },
+	"retention.monitor_share_days":        func(p *store.RetentionPolicy) *int { return &p.MonitorShareDays },
+	"retention.delete_batch_size":         func(p *store.RetentionPolicy) *int { return &p.BatchSize },
+}
+
+// retentionMinDays 各级监控数据的最短保留天数（0 表示永久保留，不受限制）。
+// 调度器每小时重新聚合前一天与上个月的数据并覆盖写入，源数据必须保留到聚合窗口之外，
+// 否则日、月汇总会被部分数据的合计覆盖。
+var retentionMinDays = map[string]int{
+	"retention.metrics_raw_days":    1,
+	"retention.metrics_hourly_days": 2,
+	"retention.metrics_daily_days":  62,
+}
+
+// retentionSettingInt 读取数字设置值，非数字返回 false。
+func retentionSettingInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
+
+// validateRetentionSetting 校验待保存的 retention.* 设置值，其他键直接通过。
+func validateRetentionSetting(key string, value any) error {
+	if _, ok := retentionSettingFields[key]; !ok {
+		return nil
+	}
+	n, ok := retentionSettingInt(value)
+	if !ok || n < 0 {
+		return fmt.Errorf("%s must be a non-negative number", key)
+	}
+	if floor := retentionMinDays[key]; n > 0 && n < floor {
+		return fmt.Errorf("%s must be 0 (keep forever) or at least %d", key, floor)
+	}
+	return nil
+}
+
+// applyRetentionSetting 将单个设置值覆盖到策略上；未知键、非数字或负数忽略，低于最短保留天数的值提升到下限。
+func applyRetentionSetting(p *store.RetentionPolicy, key string, value any) {
+	field, ok := retentionSettingFields[key]
+	if !ok {
+		return
+	}
+	n, ok := retentionSettingInt(value)
+	if !ok || n < 0 {
+		return
+	}
+	if floor := retentionMinDays[key]; n > 0 && n < floor {
+		n = floor
+	}
+	*field(p) = n
+}
+
+// resolveRetentionPolicies 读取 retention.* 设置，返回系统策略与各账号覆盖后的策略。
+// 按键前缀而不是分类筛选，分类被改动的设置同样生效。
+func resolveRetentionPolicies(st store.Store, accountIDs []string) (store.RetentionPolicy, map[string]store.RetentionPolicy, error) {
+	system := store.DefaultRetentionPolicy()
+	all, err := st.ListSettings("", "", "")
+	if err != nil {
+		return system, nil, err
+	}
+	var settings []store.Setting
+	for _, s := range all {
+		if strings.HasPrefix(s.Key, "retention.") {
+			settings = append(settings, s)
+		}
+	}
+	for _, s := range settings {
+		if s.Scope == "system" {
+			applyRetentionSetting(&system, s.Key, s.Value)
+		}
+	}
+	policies := make(map[string]store.RetentionPolicy, len(accountIDs))
+	for _, id := range accountIDs {
+		policies[id] = system
+	}
+	for _, s := range settings {
+		if s.Scope != "account" || s.AccountID == nil {
+			continue
+		}
+		if p, ok := policies[*s.AccountID]; ok {
+			applyRetentionSetting(&p, s.Key, s.Value)
+			policies[*s.AccountID] = p
+		}
+	}
+	return system, policies, nil
+}
+
+// applyRetentionPolicies 按各账号生效的保留策略清理数据，返回每个账号删除的行数。
+// accountID 非空时只清理该账号；否则最后按系统策略清理已删除账号遗留的数据，计入 orphanRetentionKey。
+// 单个账号失败不影响其余账号，返回遇到的第一个错误。
+func applyRetentionPolicies(ctx context.Context, st store.Store, accountID string, now time.Time) (map[string]store.RetentionResult, error) {
+	var ids []string
+	if accountID != "" {
+		ids = []string{accountID}
+	} else {
+		accounts, err := st.ListAccounts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list accounts: %w", err)
+		}
+		for _, a := range accounts {
+			ids = append(ids, a.ID)
+		}
+	}
+	system, policies, err := resolveRetentionPolicies(st, ids)
+	if err != nil {
+		return nil, fmt.Errorf("load retention settings: %w", err)
+	}
+
+	results := make(map[string]store.RetentionResult, len(ids))
+	var firstErr error
+	for _, id := range ids {
+		res, err := st.ApplyRetention(ctx, id, policies[id], now)
+		results[id] = res
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("account %s: %w", id, err)
+		}
+		if ctx.Err() != nil {
+			return results, firstErr
+		}
+	}
+	if accountID == "" {
+		res, err := st.ApplyOrphanRetention(ctx, ids, system, now)
+		if res.Total() > 0 || err != nil {
+			results[orphanRetentionKey] = res
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("orphaned data: %w", err)
+		}
+	}
+	return results, firstErr
+}
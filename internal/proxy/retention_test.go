@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+func TestRetentionPolicyAccountOverride(t *testing.T) {
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream("http://127.0.0.1:1").WithAPIKey("test-proxy"))
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	srv.store = st
+	ctx := context.Background()
+
+	for _, id := range []string{"short", "long"} {
+		if err := st.CreateAccount(ctx, store.AccountRecord{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 系统级收紧到 3 天，long 账号覆盖为 20 天，非法值被忽略。
+	long := "long"
+	for _, s := range []store.Setting{
+		{Key: "retention.metrics_raw_days", Scope: "system", Value: 3, DataType: "number", Category: "retention"},
+		{Key: "retention.metrics_raw_days", Scope: "account", AccountID: &long, Value: 20, DataType: "number", Category: "retention"},
+		{Key: "retention.health_history_days", Scope: "account", AccountID: &long, Value: -1, DataType: "number", Category: "retention"},
+	} {
+		s := s
+		if err := st.UpsertSetting(&s); err != nil {
+			t.Fatalf("upsert setting: %v", err)
+		}
+	}
+	system, policies, err := resolveRetentionPolicies(st, []string{"short", "long"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if system.MetricsRawDays != 3 || policies["short"].MetricsRawDays != 3 || policies["long"].MetricsRawDays != 20 ||
+		policies["long"].HealthHistoryDays != 30 || policies["long"].MetricsDailyDays != 365 {
+		t.Fatalf("unexpected policies: system=%+v %+v", system, policies)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range []string{"short", "long"} {
+		if err := st.InsertMetrics(ctx, store.MetricsRecord{AccountID: id, NodeID: "n1", Timestamp: now.AddDate(0, 0, -10), RequestsTotal: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/metrics/cleanup", strings.NewReader(`{}`))
+	req = req.WithContext(context.WithValue(context.WithValue(req.Context(), accountContextKey{}, srv.defaultAccount), isAdminContextKey{}, true))
+	rec := httptest.NewRecorder()
+	srv.handleCleanupMetrics(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cleanup status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Purged map[string]store.RetentionResult `json:"purged"`
+		Total  int64                            `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Total != 1 || resp.Purged["short"].MetricsRaw != 1 || resp.Purged["long"].MetricsRaw != 0 {
+		t.Fatalf("unexpected purge report: %s", rec.Body.String())
+	}
+}
+
+func TestRetentionPurgesDeletedAccountsAndIgnoresCategory(t *testing.T) {
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ctx := context.Background()
+	if err := st.CreateAccount(ctx, store.AccountRecord{ID: "live", Name: "live"}); err != nil {
+		t.Fatal(err)
+	}
+	// 分类被改成其他值的 retention.* 设置仍然生效。
+	if err := st.UpsertSetting(&store.Setting{Key: "retention.metrics_raw_days", Scope: "system", Value: 3, DataType: "number", Category: "monitor"}); err != nil {
+		t.Fatalf("upsert setting: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range []string{"live", "ghost"} {
+		if err := st.InsertMetrics(ctx, store.MetricsRecord{AccountID: id, NodeID: "n1", Timestamp: now.AddDate(0, 0, -5), RequestsTotal: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := applyRetentionPolicies(ctx, st, "", now)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if results["live"].MetricsRaw != 1 || results[orphanRetentionKey].MetricsRaw != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if _, ok := results["ghost"]; ok {
+		t.Fatalf("orphaned data should be reported under %s: %+v", orphanRetentionKey, results)
+	}
+}
+
+func TestRetentionKeepsAggregationSources(t *testing.T) {
+	st, err := store.Open("sqlite://" + filepath.Join(t.TempDir(), "qcc.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	ctx := context.Background()
+	if err := st.CreateAccount(ctx, store.AccountRecord{ID: "acc", Name: "acc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	monthStart := startOfMonth(now)
+	lastMonth := monthStart.AddDate(0, -1, 0)
+	oldest := lastMonth.Add(36 * time.Hour)
+	for _, ts := range []time.Time{oldest, monthStart.Add(-12 * time.Hour)} {
+		if err := st.InsertMetrics(ctx, store.MetricsRecord{AccountID: "acc", NodeID: "n1", Timestamp: ts, RequestsTotal: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, gran := range []store.MetricsGranularity{store.MetricsGranularityHourly, store.MetricsGranularityDaily, store.MetricsGranularityMonthly} {
+		if err := st.AggregateMetrics(ctx, "", gran, lastMonth, monthStart); err != nil {
+			t.Fatalf("aggregate %s: %v", gran, err)
+		}
+	}
+
+	// 直接写入存储的过小值在清理时按下限处理，保存接口会拒绝。
+	// 日汇总保留期取在两行之间：不设下限时只删掉较早的一行，月汇总被剩余部分的合计覆盖。
+	dailyDays := int(now.Sub(oldest) / (24 * time.Hour))
+	for key, days := range map[string]int{"retention.metrics_raw_days": 1, "retention.metrics_hourly_days": 1, "retention.metrics_daily_days": dailyDays} {
+		if err := st.UpsertSetting(&store.Setting{Key: key, Scope: "system", Value: days, DataType: "number", Category: "retention"}); err != nil {
+			t.Fatalf("upsert setting: %v", err)
+		}
+	}
+	if err := validateRetentionSetting("retention.metrics_daily_days", float64(30)); err == nil {
+		t.Fatal("expected daily retention below the aggregation window to be rejected")
+	}
+	if err := validateRetentionSetting("retention.metrics_daily_days", float64(0)); err != nil {
+		t.Fatalf("0 should mean keep forever: %v", err)
+	}
+	if _, err := applyRetentionPolicies(ctx, st, "", now); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	NewMetricsScheduler(st, log.New(io.Discard, "", 0)).runAggregation()
+
+	monthly, err := st.QueryMetrics(ctx, store.MetricsQuery{AccountID: "acc", Granularity: store.MetricsGranularityMonthly, From: lastMonth, To: monthStart})
+	if err != nil {
+		t.Fatalf("query monthly: %v", err)
+	}
+	var total int64
+	for _, m := range monthly {
+		total += m.RequestsTotal
+	}
+	if total != 2 {
+		t.Fatalf("monthly totals lost after cleanup: %+v", monthly)
+	}
+}
@@ -79,16 +79,21 @@ func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	if t.notifyMgr != nil && lastErr != nil {
 		if acc := accountFromCtx(req); acc != nil {
-			nodeName := ""
+			nodeID, nodeName := "", ""
 			if n := nodeFromCtx(req); n != nil {
-				nodeName = n.Name
+				nodeID, nodeName = n.ID, n.Name
 			}
-			errText := lastErr.Error()
 			t.notifyMgr.Publish(notify.Event{
-				AccountID:  acc.ID,
-				EventType:  notify.EventRequestFailed,
-				Title:      "请求失败告警",
-				Content:    fmt.Sprintf("**请求**: %s %s\n**节点**: %s\n**重试次数**: %d\n**错误信息**: %s", req.Method, req.URL.String(), chooseNonEmpty(nodeName, "-"), attempts, errText),
+				AccountID: acc.ID,
+				EventType: notify.EventRequestFailed,
+				Data: map[string]any{
+					"method":    req.Method,
+					"url":       req.URL.String(),
+					"node_id":   nodeID,
+					"node_name": chooseNonEmpty(nodeName, "-"),
+					"attempts":  attempts,
+					"error":     lastErr.Error(),
+				},
 				OccurredAt: time.Now(),
 			})
 		}
@@ -153,9 +158,15 @@ func (u *usageReader) Read(p []byte) (int, error) {
 func (u *usageReader) Close() error {
 	err := u.ReadCloser.Close()
 	if u.tracker != nil && u.buf != nil {
-		if in, out := parseUsage(u.buf.Bytes()); in > 0 || out > 0 {
-			u.tracker.input = in
-			u.tracker.output = out
+		parsed := parseUsage(u.buf.Bytes())
+		if parsed.input > 0 || parsed.output > 0 || parsed.cacheCreation > 0 || parsed.cacheRead > 0 {
+			u.tracker.input = parsed.input
+			u.tracker.output = parsed.output
+			u.tracker.cacheCreation = parsed.cacheCreation
+			u.tracker.cacheRead = parsed.cacheRead
+		}
+		if parsed.model != "" {
+			u.tracker.model = parsed.model
 		}
 	}
 	return err
@@ -353,6 +364,9 @@ func (p *Server) newReverseProxy(node *Node, u *usage) (*httputil.ReverseProxy,
 				if cleaned, ok := cleanTools(bodyBytes); ok {
 					bodyBytes = cleaned
 				}
+				if rewritten, ok := p.rewriteModelForNode(node, bodyBytes); ok {
+					bodyBytes = rewritten
+				}
 
 				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 				req.ContentLength = int64(len(bodyBytes))
@@ -373,15 +387,20 @@ func (p *Server) newReverseProxy(node *Node, u *usage) (*httputil.ReverseProxy,
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
 		if p.notifyMgr != nil {
 			if acc := accountFromCtx(r); acc != nil {
-				nodeName := ""
+				nodeID, nodeName := "", ""
 				if n := nodeFromCtx(r); n != nil {
-					nodeName = n.Name
+					nodeID, nodeName = n.ID, n.Name
 				}
 				p.notifyMgr.Publish(notify.Event{
-					AccountID:  acc.ID,
-					EventType:  notify.EventRequestProxyError,
-					Title:      "代理错误告警",
-					Content:    fmt.Sprintf("**请求**: %s %s\n**节点**: %s\n**错误信息**: %v", r.Method, r.URL.String(), chooseNonEmpty(nodeName, "-"), err),
+					AccountID: acc.ID,
+					EventType: notify.EventRequestProxyError,
+					Data: map[string]any{
+						"method":    r.Method,
+						"url":       r.URL.String(),
+						"node_id":   nodeID,
+						"node_name": chooseNonEmpty(nodeName, "-"),
+						"error":     err.Error(),
+					},
 					OccurredAt: time.Now(),
 				})
 			}
@@ -17,10 +17,11 @@ const (
 
 // MetricsScheduler 负责周期性聚合与清理监控数据。
 type MetricsScheduler struct {
-	store  *store.Store
-	logger *log.Logger
-	stopCh chan struct{}
-	wg     sync.WaitGroup
+	store    store.Store
+	settings *SettingsCache // 可选，用于读取请求日志保留天数
+	logger   *log.Logger
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
 
 	aggregateInterval time.Duration
 	cleanupInterval   time.Duration
@@ -28,7 +29,7 @@ type MetricsScheduler struct {
 }
 
 // NewMetricsScheduler 创建调度器，默认每小时聚合、每天清理一次。
-func NewMetricsScheduler(s *store.Store, logger *log.Logger) *MetricsScheduler {
+func NewMetricsScheduler(s store.Store, logger *log.Logger) *MetricsScheduler {
 	if logger == nil {
 		logger = log.Default()
 	}
@@ -170,17 +171,32 @@ func (m *MetricsScheduler) runCleanup() {
 	start := time.Now()
 	m.logger.Printf("[MetricsScheduler] Starting daily cleanup...")
 
-	ctx, cancel := m.taskContext(30 * time.Second)
+	ctx, cancel := m.taskContext(retentionTaskTimeout)
 	defer cancel()
 
-	if err := m.store.CleanupMetrics(ctx, "", time.Now().UTC()); err != nil {
+	results, err := applyRetentionPolicies(ctx, m.store, "", time.Now().UTC())
+	var total store.RetentionResult
+	for accountID, res := range results {
+		total.Add(res)
+		if res.Total() > 0 {
+			m.logger.Printf("[MetricsScheduler] Retention purged %d rows for account %s: %+v", res.Total(), accountID, res)
+		}
+	}
+	if err != nil {
 		m.logger.Printf("[MetricsScheduler] Cleanup failed: %v", err)
-	} else {
-		m.logger.Printf("[MetricsScheduler] Cleanup completed in %v", time.Since(start))
 	}
+	m.logger.Printf("[MetricsScheduler] Cleanup completed in %v, purged %d rows across %d accounts", time.Since(start), total.Total(), len(results))
 
-	if err := m.store.CleanupHealthChecks(ctx, time.Time{}); err != nil {
-		m.logger.Printf("[MetricsScheduler] Health history cleanup failed: %v", err)
+	retentionDays := defaultRequestLogRetentionDays
+	if m.settings != nil {
+		retentionDays = m.settings.GetInt("request_log.retention_days", defaultRequestLogRetentionDays)
+	}
+	if retentionDays > 0 {
+		if n, err := m.store.CleanupRequestLogs(ctx, time.Now().UTC().AddDate(0, 0, -retentionDays)); err != nil {
+			m.logger.Printf("[MetricsScheduler] Request log cleanup failed: %v", err)
+		} else if n > 0 {
+			m.logger.Printf("[MetricsScheduler] Removed %d request logs older than %d days", n, retentionDays)
+		}
 	}
 }
 
@@ -2,13 +2,15 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"qcc_plus/internal/notify"
@@ -40,7 +42,7 @@ type Server struct {
 	healthEvery      time.Duration
 	healthRT         http.RoundTripper
 	cliRunner        CliRunner
-	store            *store.Store
+	store            store.Store
 	adminKey         string
 	notifyMgr        *notify.Manager
 	metricsScheduler *MetricsScheduler
@@ -55,6 +57,9 @@ type Server struct {
 	warmupConfig WarmupConfig
 	warmupSem    chan struct{}
 
+	probeMu     sync.Mutex
+	probeLastOK map[string]time.Time // 节点/序号/探针 → 上次成功时间，用于 interval_sec 节流
+
 	tunnelMgr *tunnel.Manager
 	tunnelMu  sync.Mutex
 
@@ -65,6 +70,31 @@ type Server struct {
 	circuitBreakers map[string]*CircuitBreaker // 每个节点一个熔断器
 	cbMu            sync.RWMutex               // 保护 circuitBreakers
 	cbConfig        CircuitBreakerConfig       // 熔断器配置
+
+	quotas  *quotaTracker      // 账号限流与 token 配额
+	apiKeys map[string]*APIKey // sha256(key) -> APIKey，受 mu 保护
+
+	loginGuard *loginGuard     // 登录失败锁定
+	passive    *passiveTracker // 被动健康评分滑动窗口
+
+	prom             *promCollector // Prometheus 请求指标
+	metricsAllowNets []*net.IPNet   // 免密访问 /metrics 的来源 IP 白名单
+	trustedProxies   []*net.IPNet   // 可信反向代理（TRUSTED_PROXIES），见 clientIP
+	tlsConfig        *tls.Config    // 非空时监听端口启用 TLS，见 tls.go
+
+	// 优雅关闭与平滑重启，见 graceful.go。
+	serveMu      sync.Mutex
+	httpServer   *http.Server
+	listener     net.Listener
+	draining     atomic.Bool    // 关闭中：拒绝新的代理请求
+	handedOff    atomic.Bool    // 监听 socket 已交给新进程
+	inflight     atomic.Int64   // 正在处理的 /v1/messages 请求数
+	loopStop     chan struct{}  // 关闭后健康检查、摘要、被动评分等后台循环退出
+	bgMu         sync.Mutex     // 保护 bgClosed
+	bgClosed     bool           // 关闭后不再登记新的异步写入
+	bgWg         sync.WaitGroup // 关闭前需要完成的异步写入
+	shutdownOnce sync.Once
+	shutdownDone chan struct{}
 }
 
 // Start 运行反向代理并阻塞直到关闭。
@@ -83,15 +113,31 @@ func (p *Server) Start() error {
 	}
 
 	go p.healthLoop()
+	go p.digestLoop()
+	go p.passiveHealthLoop()
+
+	ln, err := p.listen()
+	if err != nil {
+		return err
+	}
 	server := &http.Server{
-		Addr:         p.listenAddr,
 		Handler:      p.handler(),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 0, // 支持流式响应
 	}
+	p.serveMu.Lock()
+	p.httpServer = server
+	p.listener = ln // 平滑重启交接的是未包装 TLS 的原始 TCP 监听
+	p.serveMu.Unlock()
+	scheme := "http"
+	if p.tlsConfig != nil {
+		server.TLSConfig = p.tlsConfig
+		ln = tls.NewListener(ln, p.tlsConfig)
+		scheme = "https"
+	}
 
-	p.logger.Printf("Claude Code proxy listening on %s", p.listenAddr)
-	p.logger.Printf("Admin panel: http://%s/admin", p.listenAddr)
+	p.logger.Printf("Claude Code proxy listening on %s (%s)", p.listenAddr, scheme)
+	p.logger.Printf("Admin panel: %s://%s/admin", scheme, p.listenAddr)
 	p.logger.Printf("默认登录凭证:")
 	p.logger.Printf("  - 管理员: username=admin, password=admin123")
 	p.logger.Printf("  - 默认账号: username=%s, password=default123", chooseNonEmpty(p.defaultAccName, "default"))
@@ -105,7 +151,16 @@ func (p *Server) Start() error {
 	}
 	p.mu.RUnlock()
 
-	return server.ListenAndServe()
+	signalHandoffReady(p.logger)
+	err = server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		// 等待 Shutdown 排空请求并释放资源后再返回，避免进程提前退出。
+		if p.shutdownDone != nil {
+			<-p.shutdownDone
+		}
+		return nil
+	}
+	return err
 }
 
 // Stop 用于优雅关闭后台任务。
@@ -119,6 +174,7 @@ func (p *Server) Stop() {
 	if p.settingsStopCh != nil {
 		close(p.settingsStopCh)
 		p.settingsWg.Wait()
+		p.settingsStopCh = nil
 	}
 }
 
@@ -259,25 +315,36 @@ func (p *Server) createDefaultAccount(defaultUpstream *url.URL, defaultCfg store
 
 // 从持久层加载账号、节点与配置。
 func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg store.Config, defaultUpstreamKey string) error {
+	accs, err := p.buildAccountsFromStore(defaultUpstream, defaultCfg, defaultUpstreamKey)
+	if err != nil {
+		return err
+	}
+	for _, acc := range accs {
+		p.registerAccount(acc)
+	}
+	// 如果未找到默认账号，则返回 nil 让上层创建。
+	return nil
+}
+
+// buildAccountsFromStore 从持久层构建账号与节点，不修改服务器状态。
+func (p *Server) buildAccountsFromStore(defaultUpstream *url.URL, defaultCfg store.Config, defaultUpstreamKey string) ([]*Account, error) {
 	if p.store == nil {
-		return nil
+		return nil, nil
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	accounts, err := p.store.ListAccounts(ctx)
 	if err != nil {
-		return err
-	}
-	if len(accounts) == 0 {
-		return nil
+		return nil, err
 	}
+	out := make([]*Account, 0, len(accounts))
 	for _, a := range accounts {
 		cfg := Config{Retries: defaultCfg.Retries, FailLimit: defaultCfg.FailLimit, HealthEvery: defaultCfg.HealthEvery}
 		// 加载节点与活动节点
 		recs, cfgLoaded, active, err := p.store.LoadAllByAccount(ctx, a.ID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if cfgLoaded.Retries > 0 {
 			cfg.Retries = cfgLoaded.Retries
@@ -308,6 +375,10 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 			Nodes:       make(map[string]*Node),
 			FailedSet:   make(map[string]struct{}),
 			ActiveID:    active,
+			LBStrategy:  p.loadAccountLBStrategy(a.ID),
+			Quota:       p.loadAccountQuota(ctx, a.ID),
+
+			ClientCertSubject: p.loadAccountClientCertSubject(a.ID),
 		}
 
 		// 如果账号没有节点且是默认账号，创建一个默认节点以保证可用。
@@ -337,6 +408,10 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 				u, _ := url.Parse(r.BaseURL)
 				hcMethod := normalizeHealthCheckMethod(chooseNonEmpty(r.HealthCheckMethod, defaultHealthCheckMethod))
 				hcModel := chooseNonEmpty(r.HealthCheckModel, defaultHealthCheckModel)
+				probes, err := decodeProbeChain(r.HealthProbes)
+				if err != nil {
+					p.logger.Printf("invalid health_probes for node %s, ignored: %v", r.Name, err)
+				}
 				if healthMethodRequiresAPIKey(hcMethod) && r.APIKey == "" {
 					p.logger.Printf("health check mode %s requires api key, fallback to head for node %s", hcMethod, r.Name)
 					hcMethod = HealthCheckMethodHEAD
@@ -354,6 +429,10 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 					Failed:            r.Failed,
 					Disabled:          r.Disabled,
 					LastError:         r.LastError,
+					SupportedModels:   r.SupportedModels,
+					ModelMap:          r.ModelMap,
+					HealthProbes:      probes,
+					PriceMultiplier:   r.PriceMultiplier,
 					Metrics: metrics{
 						Requests:          r.Requests,
 						FailCount:         r.FailCount,
@@ -375,18 +454,83 @@ func (p *Server) loadAccountsFromStore(defaultUpstream *url.URL, defaultCfg stor
 				}
 			}
 		}
-		p.registerAccount(acc)
+		out = append(out, acc)
+	}
+	return out, nil
+}
+
+// reloadAccountsFromStore 从存储重新加载账号与节点，用于配置导入后立即生效。
+// 新状态在锁外构建后一次性替换，请求不会看到空表；仍存在的节点沿用原 Node 对象，
+// 保留在途计数、指标、被动评分与失败状态（熔断器按节点 ID 存放，不受影响），活动节点仍可用时保持不变。
+func (p *Server) reloadAccountsFromStore() error {
+	p.mu.RLock()
+	cfg := store.Config{Retries: p.retries, FailLimit: p.failLimit, HealthEvery: p.healthEvery}
+	p.mu.RUnlock()
+	accs, err := p.buildAccountsFromStore(nil, cfg, "")
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	oldNodes, oldAccounts := p.nodeIndex, p.accountByID
+	p.accounts = make(map[string]*Account)
+	p.accountByID = make(map[string]*Account)
+	p.nodeIndex = make(map[string]*Node)
+	p.nodeAccount = make(map[string]*Account)
+	for _, acc := range accs {
+		for id, n := range acc.Nodes {
+			old := oldNodes[id]
+			if old == nil {
+				continue
+			}
+			carryNodeConfig(old, n)
+			acc.Nodes[id] = old
+			if old.Failed {
+				acc.FailedSet[id] = struct{}{}
+			}
+		}
+		if prev := oldAccounts[acc.ID]; prev != nil {
+			if n := acc.Nodes[prev.ActiveID]; n != nil && !n.Disabled {
+				acc.ActiveID = prev.ActiveID
+			}
+		}
+		p.registerAccountLocked(acc)
+	}
+	p.mu.Unlock()
+
+	if p.settingsCache != nil {
+		p.settingsCache.Refresh()
 	}
-	// 如果未找到默认账号，则返回 nil 让上层创建。
 	return nil
 }
 
+// carryNodeConfig 把持久化的节点配置写入仍在使用的 Node，运行时状态保持不变。调用方需持有 p.mu。
+func carryNodeConfig(dst, src *Node) {
+	dst.Name = src.Name
+	dst.URL = src.URL
+	dst.APIKey = src.APIKey
+	dst.HealthCheckMethod = src.HealthCheckMethod
+	dst.HealthCheckModel = src.HealthCheckModel
+	dst.AccountID = src.AccountID
+	dst.Weight = src.Weight
+	dst.Disabled = src.Disabled
+	dst.SupportedModels = src.SupportedModels
+	dst.ModelMap = src.ModelMap
+	dst.HealthProbes = src.HealthProbes
+	dst.PriceMultiplier = src.PriceMultiplier
+}
+
 func (p *Server) registerAccount(acc *Account) {
 	if acc == nil {
 		return
 	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.registerAccountLocked(acc)
+}
+
+// registerAccountLocked 同 registerAccount，调用方需持有 p.mu。
+func (p *Server) registerAccountLocked(acc *Account) {
 	p.accountByID[acc.ID] = acc
 	if acc.ProxyAPIKey != "" {
 		p.accounts[acc.ProxyAPIKey] = acc
@@ -435,7 +579,7 @@ func (p *Server) getAccountByID(id string) *Account {
 	return p.accountByID[id]
 }
 
-func (p *Server) publishTunnelEvent(eventType, title, content string) {
+func (p *Server) publishTunnelEvent(eventType string, data map[string]any) {
 	if p.notifyMgr == nil {
 		return
 	}
@@ -446,8 +590,7 @@ func (p *Server) publishTunnelEvent(eventType, title, content string) {
 	p.notifyMgr.Publish(notify.Event{
 		AccountID:  accID,
 		EventType:  eventType,
-		Title:      title,
-		Content:    content,
+		Data:       data,
 		DedupKey:   "tunnel",
 		OccurredAt: time.Now(),
 	})
@@ -457,7 +600,7 @@ func (p *Server) publishTunnelEvent(eventType, title, content string) {
 func (p *Server) StartTunnel() error {
 	if p.store == nil {
 		err := errors.New("未启用存储，无法读取隧道配置")
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 
@@ -465,7 +608,7 @@ func (p *Server) StartTunnel() error {
 	if p.tunnelMgr != nil {
 		p.tunnelMu.Unlock()
 		err := errors.New("隧道已运行")
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 	p.tunnelMu.Unlock()
@@ -478,12 +621,12 @@ func (p *Server) StartTunnel() error {
 		if errors.Is(err, store.ErrNotFound) {
 			err = errors.New("尚未保存隧道配置")
 		}
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 	if cfg.APIToken == "" || cfg.Subdomain == "" {
 		err := errors.New("api_token 与 subdomain 不能为空")
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 
@@ -495,14 +638,14 @@ func (p *Server) StartTunnel() error {
 	})
 	if err != nil {
 		_ = p.updateTunnelStatus(ctx, cfg, "error", errString(err), cfg.PublicURL, cfg.Enabled)
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 
 	localURL := buildLocalURL(p.listenAddr)
 	if err := mgr.Start(context.Background(), localURL); err != nil {
 		_ = p.updateTunnelStatus(ctx, cfg, "error", errString(err), cfg.PublicURL, cfg.Enabled)
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 
@@ -512,7 +655,7 @@ func (p *Server) StartTunnel() error {
 	cfg.Enabled = true
 	if err := p.store.SaveTunnelConfig(ctx, *cfg); err != nil {
 		_ = mgr.Stop()
-		p.publishTunnelEvent(notify.EventSystemTunnelError, "隧道启动失败", fmt.Sprintf("**错误**: %s", err.Error()))
+		p.publishTunnelEvent(notify.EventSystemTunnelError, map[string]any{"error": err.Error()})
 		return err
 	}
 
@@ -520,7 +663,7 @@ func (p *Server) StartTunnel() error {
 	p.tunnelMgr = mgr
 	p.tunnelMu.Unlock()
 
-	p.publishTunnelEvent(notify.EventSystemTunnelStarted, "隧道已启动", fmt.Sprintf("**子域名**: %s\n**公网地址**: %s", cfg.Subdomain, cfg.PublicURL))
+	p.publishTunnelEvent(notify.EventSystemTunnelStarted, map[string]any{"subdomain": cfg.Subdomain, "public_url": cfg.PublicURL})
 	return nil
 }
 
@@ -553,7 +696,7 @@ func (p *Server) StopTunnel() error {
 		_ = p.store.SaveTunnelConfig(ctx, *cfg)
 	}
 
-	p.publishTunnelEvent(notify.EventSystemTunnelStopped, "隧道已停止", fmt.Sprintf("**状态**: %s", chooseNonEmpty(errString(stopErr), "正常停止")))
+	p.publishTunnelEvent(notify.EventSystemTunnelStopped, map[string]any{"error": errString(stopErr)})
 	return stopErr
 }
 
@@ -1,70 +1,153 @@
 package proxy
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
 	"sync"
 	"time"
+
+	"qcc_plus/internal/store"
 )
 
-// Session 表示一次登录会话。
+// Session 表示一次登录会话。ID 为 token 的 SHA-256 哈希，用于列表展示与吊销，明文 token 仅存在于 Cookie 中。
 type Session struct {
-	Token     string
-	AccountID string
-	IsAdmin   bool
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	ID         string
+	Token      string
+	AccountID  string
+	UserID     string // 成员登录时为成员 ID，账号自身登录时为空
+	Role       Role   // 为空表示账号自身登录，按 owner 处理
+	IsAdmin    bool
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+
+	// renewed 表示本次读取顺延了过期时间，调用方应同步刷新 Cookie。
+	renewed bool
+}
+
+// SessionStore 会话存储抽象。Load 在会话不存在时返回 (nil, nil)；Delete 对不存在的会话返回 store.ErrNotFound。
+type SessionStore interface {
+	Save(ctx context.Context, sess *Session) error
+	Load(ctx context.Context, id string) (*Session, error)
+	Touch(ctx context.Context, id string, expiresAt, lastSeenAt time.Time) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, accountID string, now time.Time) ([]*Session, error)
+	DeleteByAccount(ctx context.Context, accountID string) error
+	DeleteByUser(ctx context.Context, userID string) error
+	DeleteExpired(ctx context.Context, before time.Time) error
 }
 
-// SessionManager 管理用户会话，使用内存同步 Map 存储。
+// SessionManager 管理用户会话，支持滑动过期；存储可为进程内存或数据库（多副本共享）。
 type SessionManager struct {
-	sessions sync.Map
-	ttl      time.Duration
+	backend   SessionStore
+	ttl       time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+	lastPurge time.Time
 }
 
-const defaultSessionTTL = 24 * time.Hour
+const (
+	defaultSessionTTL = 24 * time.Hour
+	// sessionTouchInterval 滑动续期的最小间隔，避免每个请求都写一次存储。
+	sessionTouchInterval = time.Minute
+	// sessionPurgeInterval 清理过期会话的最小间隔。
+	sessionPurgeInterval = 10 * time.Minute
+)
 
-// NewSessionManager 创建会话管理器，ttl<=0 时使用默认 24h。
+// NewSessionManager 创建基于内存的会话管理器，ttl<=0 时使用默认 24h。
 func NewSessionManager(ttl time.Duration) *SessionManager {
+	return NewSessionManagerWithStore(ttl, NewMemorySessionStore())
+}
+
+// NewSessionManagerWithStore 使用指定存储创建会话管理器，backend 为空时退回内存存储。
+func NewSessionManagerWithStore(ttl time.Duration, backend SessionStore) *SessionManager {
 	if ttl <= 0 {
 		ttl = defaultSessionTTL
 	}
-	return &SessionManager{ttl: ttl}
+	if backend == nil {
+		backend = NewMemorySessionStore()
+	}
+	return &SessionManager{backend: backend, ttl: ttl, now: time.Now}
 }
 
-// Create 新建会话并返回会话信息。
+// Create 新建会话并返回会话信息，存储失败时返回 nil。
 func (m *SessionManager) Create(accountID string, isAdmin bool) *Session {
-	if m == nil {
+	sess, err := m.CreateWithMeta(accountID, isAdmin, "", "")
+	if err != nil {
+		log.Printf("create session for account %s failed: %v", accountID, err)
 		return nil
 	}
-	token := randomToken(32)
-	now := time.Now()
-	sess := &Session{
-		Token:     token,
-		AccountID: accountID,
-		IsAdmin:   isAdmin,
-		CreatedAt: now,
-		ExpiresAt: now.Add(m.ttl),
-	}
-	m.sessions.Store(token, sess)
 	return sess
 }
 
-// Get 根据 token 读取会话，过期会自动删除。
+// CreateWithMeta 新建会话并记录 User-Agent 与来源 IP，供审计使用。
+func (m *SessionManager) CreateWithMeta(accountID string, isAdmin bool, userAgent, ip string) (*Session, error) {
+	return m.create(&Session{AccountID: accountID, IsAdmin: isAdmin, UserAgent: userAgent, IP: ip})
+}
+
+// CreateForUser 为账号成员新建会话，权限由 role 决定；成员会话不具备平台管理员权限。
+func (m *SessionManager) CreateForUser(accountID, userID string, role Role, userAgent, ip string) (*Session, error) {
+	return m.create(&Session{AccountID: accountID, UserID: userID, Role: role, UserAgent: userAgent, IP: ip})
+}
+
+func (m *SessionManager) create(sess *Session) (*Session, error) {
+	if m == nil {
+		return nil, errors.New("session manager missing")
+	}
+	token := randomToken(32)
+	now := m.now()
+	sess.ID = sessionID(token)
+	sess.Token = token
+	sess.CreatedAt = now
+	sess.ExpiresAt = now.Add(m.ttl)
+	sess.LastSeenAt = now
+	ctx := context.Background()
+	if err := m.backend.Save(ctx, sess); err != nil {
+		return nil, err
+	}
+	m.purgeExpired(ctx, now)
+	return sess, nil
+}
+
+// Get 根据 token 读取会话：过期会自动删除，距上次活跃超过 sessionTouchInterval 时顺延过期时间。
 func (m *SessionManager) Get(token string) *Session {
 	if m == nil || token == "" {
 		return nil
 	}
-	if v, ok := m.sessions.Load(token); ok {
-		if sess, ok2 := v.(*Session); ok2 {
-			if time.Now().After(sess.ExpiresAt) {
-				m.sessions.Delete(token)
-				return nil
-			}
-			return sess
+	ctx := context.Background()
+	id := sessionID(token)
+	sess, err := m.backend.Load(ctx, id)
+	if err != nil {
+		log.Printf("load session failed: %v", err)
+		return nil
+	}
+	if sess == nil {
+		return nil
+	}
+	now := m.now()
+	if !now.Before(sess.ExpiresAt) {
+		_ = m.backend.Delete(ctx, id)
+		return nil
+	}
+	sess.Token = token
+	if now.Sub(sess.LastSeenAt) >= sessionTouchInterval {
+		expiresAt := now.Add(m.ttl)
+		if err := m.backend.Touch(ctx, id, expiresAt, now); err != nil {
+			log.Printf("touch session failed: %v", err)
+		} else {
+			sess.ExpiresAt = expiresAt
+			sess.LastSeenAt = now
+			sess.renewed = true
 		}
 	}
-	return nil
+	return sess
 }
 
 // Delete 删除指定 token 的会话。
@@ -72,7 +155,39 @@ func (m *SessionManager) Delete(token string) {
 	if m == nil || token == "" {
 		return
 	}
-	m.sessions.Delete(token)
+	_ = m.backend.Delete(context.Background(), sessionID(token))
+}
+
+// Revoke 按会话 ID 吊销会话；不存在时返回 store.ErrNotFound。
+func (m *SessionManager) Revoke(ctx context.Context, id string) error {
+	return m.backend.Delete(ctx, id)
+}
+
+// RevokeAccount 吊销账号的全部会话。
+func (m *SessionManager) RevokeAccount(ctx context.Context, accountID string) error {
+	return m.backend.DeleteByAccount(ctx, accountID)
+}
+
+// RevokeUser 吊销成员的全部会话。
+func (m *SessionManager) RevokeUser(ctx context.Context, userID string) error {
+	return m.backend.DeleteByUser(ctx, userID)
+}
+
+// List 列出账号的有效会话（按最后活跃时间倒序），accountID 为空时返回全部账号。
+func (m *SessionManager) List(ctx context.Context, accountID string) ([]*Session, error) {
+	return m.backend.List(ctx, accountID, m.now())
+}
+
+// Lookup 按会话 ID 读取有效会话，不存在或已过期时返回 nil。
+func (m *SessionManager) Lookup(ctx context.Context, id string) (*Session, error) {
+	sess, err := m.backend.Load(ctx, id)
+	if err != nil || sess == nil {
+		return nil, err
+	}
+	if !m.now().Before(sess.ExpiresAt) {
+		return nil, nil
+	}
+	return sess, nil
 }
 
 // Validate 判断 token 是否仍然有效。
@@ -80,6 +195,26 @@ func (m *SessionManager) Validate(token string) bool {
 	return m.Get(token) != nil
 }
 
+// purgeExpired 按 sessionPurgeInterval 节流清理过期会话。
+func (m *SessionManager) purgeExpired(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	if now.Sub(m.lastPurge) < sessionPurgeInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.lastPurge = now
+	m.mu.Unlock()
+	if err := m.backend.DeleteExpired(ctx, now); err != nil {
+		log.Printf("purge expired sessions failed: %v", err)
+	}
+}
+
+// sessionID 由 token 派生会话 ID。
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func randomToken(n int) string {
 	if n <= 0 {
 		n = 32
@@ -91,3 +226,188 @@ func randomToken(n int) string {
 	}
 	return hex.EncodeToString(b)
 }
+
+// memorySessionStore 进程内会话存储，未配置数据库时使用。
+type memorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore 创建进程内会话存储。
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *memorySessionStore) Save(_ context.Context, sess *Session) error {
+	rec := *sess
+	rec.Token = ""
+	s.mu.Lock()
+	s.sessions[sess.ID] = rec
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memorySessionStore) Load(_ context.Context, id string) (*Session, error) {
+	s.mu.RLock()
+	rec, ok := s.sessions[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *memorySessionStore) Touch(_ context.Context, id string, expiresAt, lastSeenAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.sessions[id]; ok {
+		rec.ExpiresAt = expiresAt
+		rec.LastSeenAt = lastSeenAt
+		s.sessions[id] = rec
+	}
+	return nil
+}
+
+func (s *memorySessionStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *memorySessionStore) List(_ context.Context, accountID string, now time.Time) ([]*Session, error) {
+	s.mu.RLock()
+	out := make([]*Session, 0)
+	for _, rec := range s.sessions {
+		if (accountID == "" || rec.AccountID == accountID) && now.Before(rec.ExpiresAt) {
+			r := rec
+			out = append(out, &r)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt.After(out[j].LastSeenAt) })
+	return out, nil
+}
+
+func (s *memorySessionStore) DeleteByAccount(_ context.Context, accountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.sessions {
+		if rec.AccountID == accountID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *memorySessionStore) DeleteByUser(_ context.Context, userID string) error {
+	if userID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.sessions {
+		if rec.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *memorySessionStore) DeleteExpired(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.sessions {
+		if !before.Before(rec.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+// dbSessionStore 基于数据库的会话存储，多个副本共享同一数据库时登录态与吊销即时生效。
+type dbSessionStore struct {
+	st store.SessionStore
+}
+
+// NewDBSessionStore 创建数据库会话存储。
+func NewDBSessionStore(st store.SessionStore) SessionStore {
+	return &dbSessionStore{st: st}
+}
+
+func (s *dbSessionStore) Save(ctx context.Context, sess *Session) error {
+	return s.st.CreateSession(ctx, store.SessionRecord{
+		ID:         sess.ID,
+		AccountID:  sess.AccountID,
+		UserID:     sess.UserID,
+		Role:       string(sess.Role),
+		IsAdmin:    sess.IsAdmin,
+		UserAgent:  sess.UserAgent,
+		IP:         sess.IP,
+		CreatedAt:  sess.CreatedAt,
+		ExpiresAt:  sess.ExpiresAt,
+		LastSeenAt: sess.LastSeenAt,
+	})
+}
+
+func (s *dbSessionStore) Load(ctx context.Context, id string) (*Session, error) {
+	rec, err := s.st.GetSession(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sessionFromRecord(*rec), nil
+}
+
+func (s *dbSessionStore) Touch(ctx context.Context, id string, expiresAt, lastSeenAt time.Time) error {
+	return s.st.TouchSession(ctx, id, expiresAt, lastSeenAt)
+}
+
+func (s *dbSessionStore) Delete(ctx context.Context, id string) error {
+	return s.st.DeleteSession(ctx, id)
+}
+
+func (s *dbSessionStore) List(ctx context.Context, accountID string, now time.Time) ([]*Session, error) {
+	recs, err := s.st.ListSessions(ctx, accountID, now)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Session, 0, len(recs))
+	for _, rec := range recs {
+		out = append(out, sessionFromRecord(rec))
+	}
+	return out, nil
+}
+
+func (s *dbSessionStore) DeleteByAccount(ctx context.Context, accountID string) error {
+	return s.st.DeleteSessionsByAccount(ctx, accountID)
+}
+
+func (s *dbSessionStore) DeleteByUser(ctx context.Context, userID string) error {
+	return s.st.DeleteSessionsByUser(ctx, userID)
+}
+
+func (s *dbSessionStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := s.st.DeleteExpiredSessions(ctx, before)
+	return err
+}
+
+func sessionFromRecord(rec store.SessionRecord) *Session {
+	return &Session{
+		ID:         rec.ID,
+		AccountID:  rec.AccountID,
+		UserID:     rec.UserID,
+		Role:       Role(rec.Role),
+		IsAdmin:    rec.IsAdmin,
+		UserAgent:  rec.UserAgent,
+		IP:         rec.IP,
+		CreatedAt:  rec.CreatedAt,
+		ExpiresAt:  rec.ExpiresAt,
+		LastSeenAt: rec.LastSeenAt,
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionSlidingExpiry(t *testing.T) {
+	m := NewSessionManager(time.Hour)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	sess, err := m.CreateWithMeta("acc-1", false, "Mozilla/5.0", "203.0.113.5")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if sess.ID == sess.Token || sess.ID != sessionID(sess.Token) {
+		t.Fatalf("session id should be derived from token hash")
+	}
+
+	// 活跃请求间隔不足续期阈值时不续期。
+	now = now.Add(30 * time.Second)
+	if got := m.Get(sess.Token); got == nil || got.renewed {
+		t.Fatalf("unexpected renew: %+v", got)
+	}
+	// 在过期前持续活跃则不断顺延。
+	for i := 0; i < 3; i++ {
+		now = now.Add(50 * time.Minute)
+		got := m.Get(sess.Token)
+		if got == nil || !got.renewed || !got.ExpiresAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("round %d: session should slide, got %+v", i, got)
+		}
+	}
+	now = now.Add(time.Hour)
+	if m.Get(sess.Token) != nil {
+		t.Fatalf("idle session should expire")
+	}
+}
+
+func TestSessionsAPIListAndRevoke(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer up.Close()
+	srv := buildServerNoWarmup(t, NewBuilder().WithUpstream(up.URL))
+	h := srv.Handler()
+	acc := srv.defaultAccount
+
+	current, err := srv.sessionMgr.CreateWithMeta(acc.ID, false, "browser-a", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	other, err := srv.sessionMgr.CreateWithMeta(acc.ID, false, "browser-b", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	call := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/api/sessions"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: current.Token})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(http.MethodGet, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Sessions []struct {
+			ID        string `json:"id"`
+			UserAgent string `json:"user_agent"`
+			IP        string `json:"ip"`
+			Current   bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", resp.Sessions)
+	}
+	for _, s := range resp.Sessions {
+		if (s.ID == current.ID) != s.Current || s.UserAgent == "" || s.IP == "" {
+			t.Fatalf("unexpected session view: %+v", s)
+		}
+	}
+
+	if rec := call(http.MethodGet, "?account_id=other-account"); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-admin listing other account status=%d", rec.Code)
+	}
+	if rec := call(http.MethodDelete, "?id="+other.ID); rec.Code != http.StatusOK {
+		t.Fatalf("revoke status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if srv.sessionMgr.Get(other.Token) != nil {
+		t.Fatalf("revoked session still valid")
+	}
+	if rec := call(http.MethodDelete, "?account_id="+acc.ID); rec.Code != http.StatusOK {
+		t.Fatalf("revoke all status=%d", rec.Code)
+	}
+	if rec := call(http.MethodGet, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("current session should be revoked, status=%d", rec.Code)
+	}
+}
@@ -12,11 +12,12 @@ import (
 type SettingsHandler struct {
 	store store.SettingsStore
 	cache *SettingsCache
+	audit func(r *http.Request, e auditEntry) // 可为空
 }
 
 // ListSettings GET /api/settings?scope=system&category=monitor&account_id=xxx
 func (h *SettingsHandler) ListSettings(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -70,7 +71,7 @@ func (h *SettingsHandler) HandleSetting(w http.ResponseWriter, r *http.Request)
 // GetVersion GET /api/settings/version
 // 返回当前全局版本号，前端轮询比较
 func (h *SettingsHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -84,7 +85,7 @@ func (h *SettingsHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
 
 // GetSetting GET /api/settings/:key
 func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request, key string) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -117,7 +118,7 @@ func (h *SettingsHandler) GetSetting(w http.ResponseWriter, r *http.Request, key
 // 请求体: {"value": any, "scope": "system", "account_id": null, "version": 1}
 // 响应: {"success": true, "new_version": 2} 或 {"error": "version_conflict", "current_version": 3}
 func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request, key string) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -141,6 +142,10 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
 	}
+	if err := validateRetentionSetting(key, req.Value); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
 	scope := req.Scope
 	if scope == "" {
 		scope = "system"
@@ -176,9 +181,10 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
-		if h.cache != nil {
+		if h.cache != nil && setting.Scope == "system" {
 			h.cache.UpdateLocal(key, req.Value, int64(setting.Version))
 		}
+		h.record(r, "setting.create", nil, setting)
 		writeJSON(w, http.StatusOK, map[string]any{"success": true, "new_version": setting.Version})
 		return
 	}
@@ -230,15 +236,17 @@ func (h *SettingsHandler) UpdateSetting(w http.ResponseWriter, r *http.Request,
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
-	if h.cache != nil {
+	// 缓存只保存系统级配置，账号级覆盖项不写入缓存。
+	if h.cache != nil && setting.Scope == "system" {
 		h.cache.UpdateLocal(key, req.Value, int64(setting.Version))
 	}
+	h.record(r, "setting.update", existing, setting)
 	writeJSON(w, http.StatusOK, map[string]any{"success": true, "new_version": setting.Version})
 }
 
 // BatchUpdate POST /api/settings/batch
 func (h *SettingsHandler) BatchUpdate(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -263,6 +271,21 @@ func (h *SettingsHandler) BatchUpdate(w http.ResponseWriter, r *http.Request) {
 		if req.Settings[i].Scope == "" {
 			req.Settings[i].Scope = "system"
 		}
+		if err := validateRetentionSetting(req.Settings[i].Key, req.Settings[i].Value); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	befores := make([]*store.Setting, len(req.Settings))
+	for i, s := range req.Settings {
+		accountID := ""
+		if s.AccountID != nil {
+			accountID = *s.AccountID
+		}
+		if existing, err := h.store.GetSetting(s.Key, s.Scope, accountID); err == nil {
+			befores[i] = existing
+		}
 	}
 
 	if err := h.store.BatchUpdateSettings(req.Settings); err != nil {
@@ -280,12 +303,19 @@ func (h *SettingsHandler) BatchUpdate(w http.ResponseWriter, r *http.Request) {
 	if h.cache != nil {
 		h.cache.Refresh()
 	}
+	for i := range req.Settings {
+		action := "setting.update"
+		if befores[i] == nil {
+			action = "setting.create"
+		}
+		h.record(r, action, befores[i], &req.Settings[i])
+	}
 	writeJSON(w, http.StatusOK, map[string]any{"success": true, "version": h.getGlobalVersion()})
 }
 
 // DeleteSetting DELETE /api/settings/:key
 func (h *SettingsHandler) DeleteSetting(w http.ResponseWriter, r *http.Request, key string) {
-	if !isAdmin(r.Context()) {
+	if !hasPermission(r.Context(), PermSystem) {
 		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 		return
 	}
@@ -296,6 +326,7 @@ func (h *SettingsHandler) DeleteSetting(w http.ResponseWriter, r *http.Request,
 	scope := r.URL.Query().Get("scope")
 	accountID := r.URL.Query().Get("account_id")
 
+	existing, _ := h.store.GetSetting(key, scope, accountID)
 	if err := h.store.DeleteSetting(key, scope, accountID); err != nil {
 		if err == store.ErrNotFound {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
@@ -307,9 +338,39 @@ func (h *SettingsHandler) DeleteSetting(w http.ResponseWriter, r *http.Request,
 	if h.cache != nil {
 		h.cache.Refresh()
 	}
+	if existing != nil {
+		h.record(r, "setting.delete", existing, nil)
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"deleted": key})
 }
 
+// record 记录配置变更审计，secret 配置项的值只记录是否变化。
+func (h *SettingsHandler) record(r *http.Request, action string, before, after *store.Setting) {
+	if h.audit == nil {
+		return
+	}
+	ref := after
+	if ref == nil {
+		ref = before
+	}
+	e := auditEntry{Action: action, TargetType: "setting", TargetID: ref.Key, Secret: ref.IsSecret || (before != nil && before.IsSecret)}
+	if ref.AccountID != nil {
+		e.AccountID = *ref.AccountID
+	}
+	if before != nil {
+		e.Before = settingAuditState(before)
+	}
+	if after != nil {
+		e.After = settingAuditState(after)
+	}
+	h.audit(r, e)
+}
+
+// settingAuditState 配置项的审计快照，只比较值与密钥标记。
+func settingAuditState(s *store.Setting) map[string]any {
+	return map[string]any{"scope": s.Scope, "value": s.Value, "is_secret": s.IsSecret}
+}
+
 func (h *SettingsHandler) getGlobalVersion() int64 {
 	if h.store == nil {
 		return 0
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"qcc_plus/internal/store"
+)
+
+const (
+	// certReloadCheckEvery 检查证书文件是否变更的最小间隔。
+	certReloadCheckEvery = 10 * time.Second
+	// settingClientCertSubject 账号级设置：映射到该账号的客户端证书主题。
+	settingClientCertSubject = "tls.client_cert_subject"
+)
+
+// TLS 客户端证书校验模式。
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional" // 提供证书时校验，未提供时仍可用 x-api-key
+	ClientAuthRequire  = "require"  // 必须提供受信任的客户端证书
+)
+
+// certReloader 按需重新加载证书与私钥文件，证书轮换后无需重启。
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *log.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger *log.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("stat tls cert: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("stat tls key: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls key pair: %w", err)
+	}
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate；文件变更后重新加载，加载失败时继续使用旧证书。
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.checkedAt) >= certReloadCheckEvery {
+		r.checkedAt = now
+		if r.changed() {
+			if err := r.load(); err != nil {
+				r.logger.Printf("reload tls certificate failed, keep previous: %v", err)
+			} else {
+				r.logger.Printf("tls certificate reloaded from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certMod) || !keyInfo.ModTime().Equal(r.keyMod)
+}
+
+// buildTLSConfig 根据证书与客户端 CA 配置生成 tls.Config。
+func buildTLSConfig(certs *certReloader, clientCAFile, clientAuth string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	mode, err := normalizeClientAuth(clientAuth, clientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+	if mode == ClientAuthNone {
+		return cfg, nil
+	}
+	if clientCAFile == "" {
+		return nil, errors.New("tls client auth requires a client CA file")
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read tls client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+	if mode == ClientAuthRequire {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// normalizeClientAuth 解析客户端证书校验模式；配置了 CA 但未指定模式时默认 optional。
+func normalizeClientAuth(mode string, hasCA bool) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "":
+		if hasCA {
+			return ClientAuthOptional, nil
+		}
+		return ClientAuthNone, nil
+	case ClientAuthNone:
+		return ClientAuthNone, nil
+	case ClientAuthOptional:
+		return ClientAuthOptional, nil
+	case ClientAuthRequire:
+		return ClientAuthRequire, nil
+	default:
+		return "", fmt.Errorf("invalid tls client auth mode %q (none|optional|require)", mode)
+	}
+}
+
+// tlsEnabled 返回监听端口是否启用 TLS。
+func (p *Server) tlsEnabled() bool {
+	return p != nil && p.tlsConfig != nil
+}
+
+// clientCertSubjectMatches 判断证书主题是否匹配配置值：含 "=" 时比较完整 DN（如 CN=ci,O=Acme），否则只比较 CN。
+// want 应已经过 normalizeClientCertSubject 规范化。
+func clientCertSubjectMatches(cert *x509.Certificate, want string) bool {
+	if cert == nil || want == "" {
+		return false
+	}
+	if strings.Contains(want, "=") {
+		return cert.Subject.String() == want
+	}
+	return cert.Subject.CommonName == want
+}
+
+// normalizeClientCertSubject 规范化证书主题配置：DN 去掉分隔符两侧空白、属性名转大写，
+// 与 pkix.Name.String() 的输出格式一致；不含 "=" 的值视为 CN，只去掉首尾空白。
+func normalizeClientCertSubject(subject string) (string, error) {
+	subject = strings.TrimSpace(subject)
+	if !strings.Contains(subject, "=") {
+		return subject, nil
+	}
+	parts := splitDN(subject)
+	for i, part := range parts {
+		k, v, ok := strings.Cut(part, "=")
+		k, v = strings.ToUpper(strings.TrimSpace(k)), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return "", fmt.Errorf("invalid client_cert_subject %q: expected TYPE=value pairs", subject)
+		}
+		parts[i] = k + "=" + v
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// splitDN 按未转义的逗号拆分 DN。
+func splitDN(dn string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, dn[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, dn[start:])
+}
+
+// dnCommonName 返回规范化 DN 中（最后一个）CN 的值，已去掉转义。
+func dnCommonName(dn string) string {
+	cn := ""
+	for _, part := range splitDN(dn) {
+		if v, ok := strings.CutPrefix(part, "CN="); ok {
+			var b strings.Builder
+			for i := 0; i < len(v); i++ {
+				if v[i] == '\\' && i+1 < len(v) {
+					i++
+				}
+				b.WriteByte(v[i])
+			}
+			cn = b.String()
+		}
+	}
+	return cn
+}
+
+// clientCertSubjectsOverlap 判断两个规范化的主题配置是否可能匹配同一张证书：
+// 裸 CN 与 CN 相同的 DN 重叠，例如 ci 与 CN=ci、CN=ci,O=Acme。
+func clientCertSubjectsOverlap(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	aDN, bDN := strings.Contains(a, "="), strings.Contains(b, "=")
+	switch {
+	case aDN && bDN:
+		return a == b
+	case aDN:
+		return dnCommonName(a) == b
+	case bDN:
+		return dnCommonName(b) == a
+	}
+	return a == b
+}
+
+// accountForClientCert 根据已校验的客户端证书定位账号，未提供证书或无匹配时返回 nil。
+func (p *Server) accountForClientCert(r *http.Request) *Account {
+	if r == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, acc := range p.accountByID {
+		if clientCertSubjectMatches(leaf, acc.ClientCertSubject) {
+			return acc
+		}
+	}
+	return nil
+}
+
+// checkClientCertSubject 校验账号的客户端证书主题配置（格式与是否和其他账号重叠），返回规范化后的值，不修改任何状态。
+func (p *Server) checkClientCertSubject(accountID, subject string) (string, error) {
+	subject, err := normalizeClientCertSubject(subject)
+	if err != nil {
+		return "", err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return subject, p.clientCertSubjectConflictLocked(accountID, subject)
+}
+
+// clientCertSubjectConflictLocked 检查规范化主题是否与其他账号的映射重叠。调用方需持有 p.mu。
+func (p *Server) clientCertSubjectConflictLocked(accountID, subject string) error {
+	for _, other := range p.accountByID {
+		if other.ID != accountID && clientCertSubjectsOverlap(other.ClientCertSubject, subject) {
+			return fmt.Errorf("client_cert_subject overlaps %q mapped to account %s", other.ClientCertSubject, other.ID)
+		}
+	}
+	return nil
+}
+
+// setAccountClientCertSubject 设置账号的客户端证书主题映射，空字符串表示取消映射。
+func (p *Server) setAccountClientCertSubject(acc *Account, subject string) error {
+	if acc == nil {
+		return nil
+	}
+	subject, err := normalizeClientCertSubject(subject)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if err := p.clientCertSubjectConflictLocked(acc.ID, subject); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	acc.ClientCertSubject = subject
+	p.mu.Unlock()
+
+	if p.store == nil {
+		return nil
+	}
+	if subject == "" {
+		if err := p.store.DeleteSetting(settingClientCertSubject, "account", acc.ID); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	accountID := acc.ID
+	desc := "映射到该账号的 mTLS 客户端证书主题"
+	return p.store.UpsertSetting(&store.Setting{
+		Key:         settingClientCertSubject,
+		Scope:       "account",
+		AccountID:   &accountID,
+		Value:       subject,
+		DataType:    "string",
+		Category:    "security",
+		Description: &desc,
+	})
+}
+
+// loadAccountClientCertSubject 从 settings 读取账号的客户端证书主题映射。
+func (p *Server) loadAccountClientCertSubject(accountID string) string {
+	if p.store == nil {
+		return ""
+	}
+	setting, err := p.store.GetSetting(settingClientCertSubject, "account", accountID)
+	if err != nil || setting == nil {
+		return ""
+	}
+	subject, _ := setting.Value.(string)
+	normalized, err := normalizeClientCertSubject(subject)
+	if err != nil {
+		p.logger.Printf("invalid client_cert_subject for account %s, ignored: %v", accountID, err)
+		return ""
+	}
+	return normalized
+}
@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	keyPEM  []byte
+	key     *ecdsa.PrivateKey
+}
+
+// issueTestCert 签发测试证书；parent 为空时生成自签 CA。
+func issueTestCert(t *testing.T, cn string, parent *testCert, isCA bool, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if !isCA {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		key:     key,
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestCertReloaderPicksUpRotatedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := issueTestCert(t, "first", nil, true, 0)
+	mod := time.Now().Add(-time.Minute)
+	writeTestFile(t, certFile, first.certPEM, mod)
+	writeTestFile(t, keyFile, first.keyPEM, mod)
+
+	r, err := newCertReloader(certFile, keyFile, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+	got, _ := r.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(got.Certificate[0]); leaf.Subject.CommonName != "first" {
+		t.Fatalf("initial cert = %s", leaf.Subject.CommonName)
+	}
+
+	second := issueTestCert(t, "second", nil, true, 0)
+	writeTestFile(t, certFile, second.certPEM, time.Now())
+	writeTestFile(t, keyFile, second.keyPEM, time.Now())
+	r.checkedAt = time.Time{}
+	got, _ = r.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(got.Certificate[0]); leaf.Subject.CommonName != "second" {
+		t.Fatalf("rotated cert = %s", leaf.Subject.CommonName)
+	}
+
+	// 写入损坏的证书时保留上一份可用证书。
+	writeTestFile(t, certFile, []byte("broken"), time.Now().Add(time.Minute))
+	r.checkedAt = time.Time{}
+	got, _ = r.GetCertificate(nil)
+	if leaf, _ := x509.ParseCertificate(got.Certificate[0]); leaf.Subject.CommonName != "second" {
+		t.Fatalf("broken rotation replaced cert with %s", leaf.Subject.CommonName)
+	}
+}
+
+func TestTLSListenerMapsClientCertToAccount(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	ca := issueTestCert(t, "test-ca", nil, true, 0)
+	serverCert := issueTestCert(t, "proxy", ca, false, x509.ExtKeyUsageServerAuth)
+	clientCert := issueTestCert(t, "ci-runner", ca, false, x509.ExtKeyUsageClientAuth)
+	now := time.Now()
+	writeTestFile(t, filepath.Join(dir, "ca.crt"), ca.certPEM, now)
+	writeTestFile(t, filepath.Join(dir, "tls.crt"), serverCert.certPEM, now)
+	writeTestFile(t, filepath.Join(dir, "tls.key"), serverCert.keyPEM, now)
+
+	srv := buildServerNoWarmup(t, NewBuilder().
+		WithUpstream(upstream.URL).
+		WithAPIKey("test-proxy").
+		WithListenAddr("127.0.0.1:0").
+		WithTLS(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")).
+		WithClientCA(filepath.Join(dir, "ca.crt"), ""))
+
+	ci, err := srv.createAccount("ci", "ci-key", "ci-password", false)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if err := srv.setAccountClientCertSubject(ci, "ci-runner"); err != nil {
+		t.Fatalf("map subject: %v", err)
+	}
+	if err := srv.setAccountClientCertSubject(srv.defaultAccount, "ci-runner"); err == nil {
+		t.Fatalf("expected duplicate subject mapping to fail")
+	}
+	// 裸 CN 与同 CN 的 DN 匹配同一张证书，视为重叠。
+	for _, subject := range []string{"CN=ci-runner", " cn = ci-runner , o=Acme"} {
+		if err := srv.setAccountClientCertSubject(srv.defaultAccount, subject); err == nil {
+			t.Fatalf("expected overlapping subject %q to fail", subject)
+		}
+	}
+	if err := srv.setAccountClientCertSubject(srv.defaultAccount, "cn=other, o=Acme"); err != nil {
+		t.Fatalf("map distinct subject: %v", err)
+	}
+	if got := srv.defaultAccount.ClientCertSubject; got != "CN=other,O=Acme" {
+		t.Fatalf("subject not normalized: %q", got)
+	}
+	if err := srv.setAccountClientCertSubject(ci, "other"); err == nil {
+		t.Fatalf("expected bare CN overlapping an existing DN to fail")
+	}
+	if err := srv.setAccountClientCertSubject(srv.defaultAccount, "O=Acme,"); err == nil {
+		t.Fatalf("expected malformed DN to fail")
+	}
+	if err := srv.setAccountClientCertSubject(srv.defaultAccount, ""); err != nil {
+		t.Fatalf("unmap subject: %v", err)
+	}
+
+	// 账号更新接口在校验证书主题失败时不修改任何字段。
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/api/accounts?id="+srv.defaultAccount.ID, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(context.WithValue(req.Context(), accountContextKey{}, srv.defaultAccount), isAdminContextKey{}, true))
+		rec := httptest.NewRecorder()
+		srv.handleAccounts(rec, req)
+		return rec
+	}
+	oldName, oldKey := srv.defaultAccount.Name, srv.defaultAccount.ProxyAPIKey
+	if rec := put(`{"name":"renamed","proxy_api_key":"pk-renamed","client_cert_subject":"CN=ci-runner"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("overlapping update status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if srv.defaultAccount.Name != oldName || srv.defaultAccount.ProxyAPIKey != oldKey || srv.getAccountByProxyKey("pk-renamed") != nil {
+		t.Fatalf("rejected update mutated account: %+v", srv.defaultAccount)
+	}
+	if rec := put(`{"name":"renamed","client_cert_subject":" cn=admin "}`); rec.Code != http.StatusOK {
+		t.Fatalf("update status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if srv.defaultAccount.Name != "renamed" || srv.defaultAccount.ClientCertSubject != "CN=admin" {
+		t.Fatalf("update not applied: %+v", srv.defaultAccount)
+	}
+	if rec := put(`{"name":"` + oldName + `","client_cert_subject":""}`); rec.Code != http.StatusOK {
+		t.Fatalf("restore status=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	// 代理鉴权：证书映射账号，显式 x-api-key 优先。
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{clientCert.cert, ca.cert}}}
+	acc, _, ok := srv.authenticateProxyRequest(httptest.NewRecorder(), req)
+	if !ok || acc.ID != ci.ID {
+		t.Fatalf("client cert resolved to %+v", acc)
+	}
+	req.Header.Set("x-api-key", srv.defaultAccount.ProxyAPIKey)
+	if acc, _, _ := srv.authenticateProxyRequest(httptest.NewRecorder(), req); acc.ID != srv.defaultAccount.ID {
+		t.Fatalf("x-api-key should take precedence, got %s", acc.ID)
+	}
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start() }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		<-startErr
+	}()
+	var addr string
+	deadline := time.Now().Add(5 * time.Second)
+	for addr == "" {
+		srv.serveMu.Lock()
+		if srv.listener != nil {
+			addr = srv.listener.Addr().String()
+		}
+		srv.serveMu.Unlock()
+		if addr == "" {
+			if time.Now().After(deadline) {
+				t.Fatalf("server did not start listening")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	if err != nil {
+		t.Fatalf("client key pair: %v", err)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{pair}}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// 登录 Cookie 带 Secure 标记。
+	form := url.Values{"username": {"default"}, "password": {"default123"}}
+	resp, err := client.PostForm("https://"+addr+"/login", form)
+	if err != nil {
+		t.Fatalf("login over tls: %v", err)
+	}
+	resp.Body.Close()
+	var secure bool
+	for _, c := range resp.Cookies() {
+		if c.Name == "session_token" {
+			secure = c.Secure
+		}
+	}
+	if !secure {
+		t.Fatalf("session cookie missing Secure flag: %v", resp.Header.Values("Set-Cookie"))
+	}
+
+	// 明文 HTTP 请求无法通过 TLS 监听。
+	if resp, err := http.Get("http://" + addr + "/login"); err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), "HTTP request to an HTTPS server") && resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("plain http accepted: %d %s", resp.StatusCode, body)
+		}
+	}
+}
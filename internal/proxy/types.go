@@ -12,7 +12,7 @@ type Node struct {
 	URL               *url.URL
 	APIKey            string
 	HealthCheckMethod string
-	HealthCheckModel  string // CLI 健康检查使用的模型，默认为 claude-haiku-4-5-20251001
+	HealthCheckModel  string // 健康检查使用的模型，默认为 claude-haiku-4-5-20251001
 	AccountID         string
 	CreatedAt         time.Time
 	Metrics           metrics
@@ -20,6 +20,12 @@ type Node struct {
 	Failed            bool
 	Disabled          bool // 用户手动禁用
 	LastError         string
+	InFlight          int64             // 当前在途请求数（原子读写）
+	SupportedModels   []string          // 可服务的模型（支持 * 后缀通配），为空表示不限制
+	ModelMap          map[string]string // 请求模型 → 上游模型名，如 claude-sonnet-4-5-* → relay-sonnet
+	HealthProbes      []ProbeConfig     // 健康检查探针链，为空时使用 HealthCheckMethod
+	PriceMultiplier   float64           // 计费倍率，按模型价格表计算的费用乘以该值，0 视为 1
+	Passive           passiveState      // 基于代理流量的被动健康评分（运行时状态，不持久化）
 }
 
 // metrics 记录节点请求与健康状况统计。
@@ -33,14 +39,18 @@ type metrics struct {
 	LastPingMS        int64
 	LastPingErr       string
 	LastHealthCheckAt time.Time
-	FailCount         int64 // 总失败次数（非200）
-	FailStreak        int64 // 连续失败次数
+	FailCount         int64   // 总失败次数（非200）
+	FailStreak        int64   // 连续失败次数
+	EWMALatencyMS     float64 // 首字节延时的指数加权移动平均（毫秒）
 }
 
 // usage 描述一次请求的 token 统计。
 type usage struct {
-	input  int64
-	output int64
+	input         int64
+	output        int64
+	cacheCreation int64  // cache_creation_input_tokens
+	cacheRead     int64  // cache_read_input_tokens
+	model         string // 上游响应中的模型名
 }
 
 // Config 描述可运行时调整的系统配置。
@@ -61,6 +71,10 @@ type Account struct {
 	ActiveID    string
 	Config      Config
 	FailedSet   map[string]struct{}
+	LBStrategy  LoadBalanceStrategy // 账号级节点选择策略，空表示跟随系统配置
+	Quota       QuotaLimits         // 账号级限流与 token 配额
+	// ClientCertSubject 映射到该账号的 mTLS 客户端证书主题（完整 DN 或 CN），空表示未映射。
+	ClientCertSubject string
 }
 
 // TunnelStatus 返回给前端的隧道状态视图。
@@ -66,5 +66,9 @@ func toRecord(n *Node) store.NodeRecord {
 		LastPingMs:        n.Metrics.LastPingMS,
 		LastPingErr:       n.Metrics.LastPingErr,
 		LastHealthCheckAt: n.Metrics.LastHealthCheckAt,
+		SupportedModels:   n.SupportedModels,
+		ModelMap:          n.ModelMap,
+		HealthProbes:      encodeProbeChain(n.HealthProbes),
+		PriceMultiplier:   n.PriceMultiplier,
 	}
 }
@@ -17,7 +17,7 @@ const (
 // readPump 负责读取客户端消息，仅用于保持连接，不处理业务消息。
 func (c *WSClient) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 		_ = c.conn.Close()
 	}()
 
@@ -45,6 +45,7 @@ func (c *WSClient) writePump() {
 	defer func() {
 		ticker.Stop()
 		_ = c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
 	for {
@@ -52,7 +53,12 @@ func (c *WSClient) writePump() {
 		case message, ok := <-c.send:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMsg := []byte{}
+				if c.hub.closed() {
+					// 服务关闭：告知客户端稍后重连。
+					closeMsg = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 
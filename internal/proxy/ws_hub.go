@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"sync"
 
@@ -12,10 +13,13 @@ import (
 type WSHub struct {
 	clients map[string]map[*WSClient]bool
 
-	register   chan *WSClient
 	unregister chan *WSClient
 	broadcast  chan *WSMessage
 
+	quit      chan struct{} // 关闭后 Run 退出，所有连接收到关闭帧
+	closeOnce sync.Once
+	pumps     sync.WaitGroup // 等待各连接写协程发出关闭帧
+
 	mu sync.RWMutex
 }
 
@@ -39,36 +43,85 @@ type WSMessage struct {
 func NewWSHub() *WSHub {
 	return &WSHub{
 		clients:    make(map[string]map[*WSClient]bool),
-		register:   make(chan *WSClient, 10),
 		unregister: make(chan *WSClient, 10),
 		broadcast:  make(chan *WSMessage, 256),
+		quit:       make(chan struct{}),
 	}
 }
 
-// Run 主循环，串行化注册、注销和广播事件。
+// Run 主循环，串行化注销和广播事件，hub 关闭后退出。
 func (h *WSHub) Run() {
 	for {
 		select {
-		case client := <-h.register:
-			h.addClient(client)
 		case client := <-h.unregister:
 			h.removeClient(client)
 		case message := <-h.broadcast:
 			h.broadcastToAccount(message)
+		case <-h.quit:
+			return
 		}
 	}
 }
 
-func (h *WSHub) addClient(client *WSClient) {
-	if client == nil {
-		return
-	}
+// Register 登记新连接并启动写协程；hub 已关闭时返回 false。
+// 直接在锁内登记，保证与关闭时的 removeAll 串行，不会遗漏连接。
+func (h *WSHub) Register(client *WSClient) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if h.closed() {
+		return false
+	}
 	if h.clients[client.accountID] == nil {
 		h.clients[client.accountID] = make(map[*WSClient]bool)
 	}
 	h.clients[client.accountID][client] = true
+	h.pumps.Add(1)
+	go client.writePump()
+	return true
+}
+
+// Close 停止 hub，向所有连接发送 1001 (going away) 关闭帧，并等待发送完成或 ctx 到期。
+func (h *WSHub) Close(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	h.closeOnce.Do(func() {
+		// 在锁内关闭 quit，之后的 Register 一定看到已关闭，pumps 不会在 Wait 后再 Add。
+		h.mu.Lock()
+		close(h.quit)
+		h.mu.Unlock()
+		h.removeAll()
+	})
+	done := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (h *WSHub) closed() bool {
+	select {
+	case <-h.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeAll 关闭全部连接的发送通道，写协程随后发出关闭帧并断开。
+func (h *WSHub) removeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for accountID, clients := range h.clients {
+		for client := range clients {
+			close(client.send)
+		}
+		delete(h.clients, accountID)
+	}
 }
 
 func (h *WSHub) removeClient(client *WSClient) {
@@ -92,37 +145,57 @@ func (h *WSHub) broadcastToAccount(message *WSMessage) {
 	if message == nil {
 		return
 	}
-	h.mu.RLock()
-	clients := h.clients[message.AccountID]
-	h.mu.RUnlock()
-
-	if len(clients) == 0 {
-		return
-	}
-
 	data, err := json.Marshal(message)
 	if err != nil {
 		return
 	}
 
-	for client := range clients {
+	// 持读锁投递：removeClient/removeAll 在写锁下关闭 send，避免向已关闭通道发送。
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients[message.AccountID] {
 		select {
 		case client.send <- data:
 		default:
 			// 发送缓冲区已满，主动注销释放资源
-			h.unregister <- client
+			go h.unregisterClient(client)
 		}
 	}
 }
 
+// ClientCount 返回当前 WebSocket 连接数。
+func (h *WSHub) ClientCount() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, clients := range h.clients {
+		n += len(clients)
+	}
+	return n
+}
+
 // Broadcast 发送消息到指定账号的所有连接。
 func (h *WSHub) Broadcast(accountID, msgType string, payload interface{}) {
 	if h == nil {
 		return
 	}
-	h.broadcast <- &WSMessage{
+	select {
+	case h.broadcast <- &WSMessage{
 		AccountID: accountID,
 		Type:      msgType,
 		Payload:   payload,
+	}:
+	case <-h.quit:
+	}
+}
+
+// unregisterClient 请求注销连接；hub 已关闭时由 removeAll 统一清理。
+func (h *WSHub) unregisterClient(client *WSClient) {
+	select {
+	case h.unregister <- client:
+	case <-h.quit:
 	}
 }
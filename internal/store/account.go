@@ -8,7 +8,7 @@ import (
 )
 
 // CreateAccount 新建账号。
-func (s *Store) CreateAccount(ctx context.Context, a AccountRecord) error {
+func (s *sqlStore) CreateAccount(ctx context.Context, a AccountRecord) error {
 	if a.ID == "" || a.Name == "" {
 		return errors.New("id and name are required")
 	}
@@ -28,7 +28,7 @@ func (s *Store) CreateAccount(ctx context.Context, a AccountRecord) error {
 }
 
 // GetAccountByProxyKey 根据代理 API Key 获取账号。
-func (s *Store) GetAccountByProxyKey(ctx context.Context, proxyKey string) (*AccountRecord, error) {
+func (s *sqlStore) GetAccountByProxyKey(ctx context.Context, proxyKey string) (*AccountRecord, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	var (
@@ -50,7 +50,7 @@ func (s *Store) GetAccountByProxyKey(ctx context.Context, proxyKey string) (*Acc
 }
 
 // GetAccountByID 按账号 ID 获取账号。
-func (s *Store) GetAccountByID(ctx context.Context, id string) (*AccountRecord, error) {
+func (s *sqlStore) GetAccountByID(ctx context.Context, id string) (*AccountRecord, error) {
 	id = normalizeAccount(id)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
@@ -73,7 +73,7 @@ func (s *Store) GetAccountByID(ctx context.Context, id string) (*AccountRecord,
 }
 
 // ListAccounts 返回所有账号。
-func (s *Store) ListAccounts(ctx context.Context) ([]AccountRecord, error) {
+func (s *sqlStore) ListAccounts(ctx context.Context) ([]AccountRecord, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, `SELECT id,name,password,proxy_api_key,is_admin,created_at,updated_at FROM accounts ORDER BY created_at ASC`)
@@ -99,7 +99,7 @@ func (s *Store) ListAccounts(ctx context.Context) ([]AccountRecord, error) {
 }
 
 // UpdateAccount 更新账号信息。
-func (s *Store) UpdateAccount(ctx context.Context, a AccountRecord) error {
+func (s *sqlStore) UpdateAccount(ctx context.Context, a AccountRecord) error {
 	if a.ID == "" {
 		return errors.New("id required")
 	}
@@ -119,8 +119,8 @@ func (s *Store) UpdateAccount(ctx context.Context, a AccountRecord) error {
 	return err
 }
 
-// DeleteAccount 删除账号（同时清理其节点与配置）。
-func (s *Store) DeleteAccount(ctx context.Context, id string) error {
+// DeleteAccount 删除账号（同时清理其节点、配置、配额用量、API Key 与登录会话）。
+func (s *sqlStore) DeleteAccount(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
@@ -142,6 +142,12 @@ func (s *Store) DeleteAccount(ctx context.Context, id string) error {
 		tx.Rollback()
 		return err
 	}
+	for _, stmt := range []string{`DELETE FROM account_quotas WHERE account_id=?`, `DELETE FROM account_usage WHERE account_id=?`, `DELETE FROM api_keys WHERE account_id=?`, `DELETE FROM sessions WHERE account_id=?`, `DELETE FROM account_users WHERE account_id=?`} {
+		if _, err := tx.ExecContext(ctx, stmt, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 	res, err := tx.ExecContext(ctx, `DELETE FROM accounts WHERE id=?`, id)
 	if err != nil {
 		tx.Rollback()
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIKeyRecord 账号下的代理 API Key，仅保存 SHA-256 哈希与展示用前缀。
+type APIKeyRecord struct {
+	ID            string
+	AccountID     string
+	Name          string
+	KeyHash       string
+	KeyPrefix     string
+	AllowedModels []string // 为空表示不限制模型
+	CreatedAt     time.Time
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	Revoked       bool
+	RevokedAt     *time.Time
+	Requests      int64
+	InputTokens   int64
+	OutputTokens  int64
+}
+
+// APIKeyStore API Key 存储接口。
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, rec APIKeyRecord) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKeyRecord, error)
+	ListAPIKeys(ctx context.Context, accountID string) ([]APIKeyRecord, error)
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error
+	RecordAPIKeyUsage(ctx context.Context, id string, input, output int64, at time.Time) error
+	UpdateAPIKey(ctx context.Context, rec APIKeyRecord) error
+	DeleteAPIKey(ctx context.Context, id string) error
+}
+
+// ensureAPIKeysTable 创建 api_keys 表，DDL 在两种方言下通用。
+func (s *sqlStore) ensureAPIKeysTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS api_keys (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		key_hash CHAR(64) NOT NULL,
+		key_prefix VARCHAR(32) NOT NULL DEFAULT '',
+		allowed_models TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NULL,
+		last_used_at DATETIME NULL,
+		revoked BOOLEAN NOT NULL DEFAULT FALSE,
+		revoked_at DATETIME NULL,
+		requests BIGINT NOT NULL DEFAULT 0,
+		input_tokens BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "api_keys", "uniq_api_key_hash", "key_hash", true); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "api_keys", "idx_api_keys_account", "account_id", false)
+}
+
+const apiKeyColumns = `id, account_id, name, key_hash, key_prefix, allowed_models, created_at, expires_at, last_used_at,
+	revoked, revoked_at, requests, input_tokens, output_tokens`
+
+// CreateAPIKey 新建 API Key。
+func (s *sqlStore) CreateAPIKey(ctx context.Context, rec APIKeyRecord) error {
+	if rec.ID == "" || rec.KeyHash == "" {
+		return errors.New("id and key_hash required")
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (id, account_id, name, key_hash, key_prefix, allowed_models, created_at, expires_at)
+		VALUES (?,?,?,?,?,?,?,?)`,
+		rec.ID, normalizeAccount(rec.AccountID), rec.Name, rec.KeyHash, rec.KeyPrefix,
+		strings.Join(rec.AllowedModels, ","), rec.CreatedAt.UTC(), nullTime(rec.ExpiresAt))
+	return err
+}
+
+// GetAPIKeyByHash 按哈希查询 API Key（含已吊销/过期记录，由调用方判断）；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKeyRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash=?`, hash)
+	rec, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+// ListAPIKeys 列出账号下的 API Key；accountID 为空时返回全部。
+func (s *sqlStore) ListAPIKeys(ctx context.Context, accountID string) ([]APIKeyRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys`
+	var args []any
+	if accountID != "" {
+		query += ` WHERE account_id=?`
+		args = append(args, normalizeAccount(accountID))
+	}
+	query += ` ORDER BY created_at DESC, id`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []APIKeyRecord
+	for rows.Next() {
+		rec, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rec)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey 吊销 API Key；不存在或已吊销时返回 ErrNotFound。
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked=TRUE, revoked_at=? WHERE id=? AND revoked=FALSE`, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateAPIKey 更新 API Key 的配置与吊销状态（用于配置导入），用量计数保持不变；不存在时返回 ErrNotFound。
+func (s *sqlStore) UpdateAPIKey(ctx context.Context, rec APIKeyRecord) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET account_id=?, name=?, key_hash=?, key_prefix=?, allowed_models=?, created_at=?,
+		expires_at=?, revoked=?, revoked_at=? WHERE id=?`,
+		normalizeAccount(rec.AccountID), rec.Name, rec.KeyHash, rec.KeyPrefix, strings.Join(rec.AllowedModels, ","), rec.CreatedAt.UTC(),
+		nullTime(rec.ExpiresAt), rec.Revoked, nullTime(rec.RevokedAt), rec.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAPIKey 删除 API Key；不存在时返回 ErrNotFound。
+func (s *sqlStore) DeleteAPIKey(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RecordAPIKeyUsage 累加 API Key 的请求数与 token 用量，并刷新最后使用时间。
+func (s *sqlStore) RecordAPIKeyUsage(ctx context.Context, id string, input, output int64, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET requests=requests+1, input_tokens=input_tokens+?, output_tokens=output_tokens+?, last_used_at=?
+		WHERE id=?`, input, output, at.UTC(), id)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (*APIKeyRecord, error) {
+	var (
+		rec                              APIKeyRecord
+		models                           sql.NullString
+		expiresAt, lastUsedAt, revokedAt sql.NullTime
+	)
+	if err := row.Scan(&rec.ID, &rec.AccountID, &rec.Name, &rec.KeyHash, &rec.KeyPrefix, &models, &rec.CreatedAt,
+		&expiresAt, &lastUsedAt, &rec.Revoked, &revokedAt, &rec.Requests, &rec.InputTokens, &rec.OutputTokens); err != nil {
+		return nil, err
+	}
+	if models.Valid && models.String != "" {
+		rec.AllowedModels = strings.Split(models.String, ",")
+	}
+	rec.ExpiresAt = timePtr(expiresAt)
+	rec.LastUsedAt = timePtr(lastUsedAt)
+	rec.RevokedAt = timePtr(revokedAt)
+	return &rec, nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// AuditEventRecord 管理操作审计事件。Changes 为脱敏后的 before/after 差异（JSON）。
+type AuditEventRecord struct {
+	ID             int64
+	CreatedAt      time.Time
+	AccountID      string // 被操作对象所属账号，系统级对象为默认账号
+	ActorAccountID string
+	ActorUserID    string // 成员操作时为成员 ID
+	ActorSessionID string // 通过管理密钥操作时为空
+	ActorRole      string
+	Action         string // 如 node.update、setting.update
+	TargetType     string
+	TargetID       string
+	Changes        string
+	IP             string
+	UserAgent      string
+}
+
+// AuditQuery 审计事件查询条件，零值字段不参与过滤。
+type AuditQuery struct {
+	AccountID      string
+	ActorAccountID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
+}
+
+// AuditStore 审计事件存储接口。
+type AuditStore interface {
+	InsertAuditEvent(ctx context.Context, rec AuditEventRecord) error
+	// QueryAuditEvents 按时间倒序分页查询，同时返回满足条件的总数。
+	QueryAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEventRecord, int64, error)
+}
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// ensureAuditEventsTable 创建 audit_events 表，DDL 在两种方言下通用。
+func (s *sqlStore) ensureAuditEventsTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS audit_events (
+		`+s.dialect.autoIncrementPK()+`,
+		created_at DATETIME NOT NULL,
+		account_id VARCHAR(64) NOT NULL,
+		actor_account_id VARCHAR(64) NOT NULL DEFAULT '',
+		actor_user_id VARCHAR(64) NOT NULL DEFAULT '',
+		actor_session_id VARCHAR(64) NOT NULL DEFAULT '',
+		actor_role VARCHAR(32) NOT NULL DEFAULT '',
+		action VARCHAR(64) NOT NULL,
+		target_type VARCHAR(32) NOT NULL DEFAULT '',
+		target_id VARCHAR(255) NOT NULL DEFAULT '',
+		changes MEDIUMTEXT,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT ''
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "audit_events", "idx_audit_events_created", "created_at", false); err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "audit_events", "idx_audit_events_account_created", "account_id, created_at", false); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "audit_events", "idx_audit_events_target", "target_type, target_id", false)
+}
+
+// InsertAuditEvent 写入一条审计事件。
+func (s *sqlStore) InsertAuditEvent(ctx context.Context, rec AuditEventRecord) error {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	if len(rec.UserAgent) > 512 {
+		rec.UserAgent = rec.UserAgent[:512]
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO audit_events (created_at, account_id, actor_account_id, actor_user_id, actor_session_id,
+		actor_role, action, target_type, target_id, changes, ip, user_agent)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.CreatedAt.UTC(), normalizeAccount(rec.AccountID), rec.ActorAccountID, rec.ActorUserID, rec.ActorSessionID,
+		rec.ActorRole, rec.Action, rec.TargetType, rec.TargetID, rec.Changes, rec.IP, rec.UserAgent)
+	return err
+}
+
+// QueryAuditEvents 分页查询审计事件。
+func (s *sqlStore) QueryAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEventRecord, int64, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.AccountID != "" {
+		add("account_id=?", q.AccountID)
+	}
+	if q.ActorAccountID != "" {
+		add("actor_account_id=?", q.ActorAccountID)
+	}
+	if q.Action != "" {
+		add("action=?", q.Action)
+	}
+	if q.TargetType != "" {
+		add("target_type=?", q.TargetType)
+	}
+	if q.TargetID != "" {
+		add("target_id=?", q.TargetID)
+	}
+	if !q.From.IsZero() {
+		add("created_at>=?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		add("created_at<?", q.To.UTC())
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, created_at, account_id, actor_account_id, actor_user_id, actor_session_id, actor_role,
+		action, target_type, target_id, changes, ip, user_agent
+		FROM audit_events`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := make([]AuditEventRecord, 0)
+	for rows.Next() {
+		var rec AuditEventRecord
+		var changes sql.NullString
+		if err := rows.Scan(&rec.ID, &rec.CreatedAt, &rec.AccountID, &rec.ActorAccountID, &rec.ActorUserID, &rec.ActorSessionID, &rec.ActorRole,
+			&rec.Action, &rec.TargetType, &rec.TargetID, &changes, &rec.IP, &rec.UserAgent); err != nil {
+			return nil, 0, err
+		}
+		rec.Changes = changes.String
+		out = append(out, rec)
+	}
+	return out, total, rows.Err()
+}
@@ -2,11 +2,10 @@ package store
 
 import (
 	"context"
-	"database/sql"
 	"time"
 )
 
-func (s *Store) LoadAllByAccount(ctx context.Context, accountID string) (records []NodeRecord, cfg Config, activeID string, err error) {
+func (s *sqlStore) LoadAllByAccount(ctx context.Context, accountID string) (records []NodeRecord, cfg Config, activeID string, err error) {
 	accountID = normalizeAccount(accountID)
 	cfg = Config{Retries: 3, FailLimit: 3, HealthEvery: 30 * time.Second}
 
@@ -25,34 +24,24 @@ func (s *Store) LoadAllByAccount(ctx context.Context, accountID string) (records
 
 	nctx, ncancel := withTimeout(ctx)
 	defer ncancel()
-	rows, err := s.db.QueryContext(nctx, `SELECT id,name,base_url,api_key,health_check_method,health_check_model,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
+	rows, err := s.db.QueryContext(nctx, `SELECT `+nodeColumns+` FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var r NodeRecord
-		var lastHealthAt sql.NullTime
-		err = rows.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.HealthCheckModel, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt)
+		r, err = scanNode(rows)
 		if err != nil {
 			return
 		}
-		if r.HealthCheckMethod == "" {
-			r.HealthCheckMethod = "api"
-		}
-		if r.HealthCheckModel == "" {
-			r.HealthCheckModel = defaultHealthCheckModel
-		}
-		if lastHealthAt.Valid {
-			r.LastHealthCheckAt = lastHealthAt.Time
-		}
 		records = append(records, r)
 	}
 	return
 }
 
 // LoadConfigByAccount 获取账号配置与活跃节点。
-func (s *Store) LoadConfigByAccount(ctx context.Context, accountID string) (Config, string, error) {
+func (s *sqlStore) LoadConfigByAccount(ctx context.Context, accountID string) (Config, string, error) {
 	accountID = normalizeAccount(accountID)
 	var cfg Config
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
@@ -70,7 +59,7 @@ func (s *Store) LoadConfigByAccount(ctx context.Context, accountID string) (Conf
 	return cfg, active, nil
 }
 
-func (s *Store) SetActive(ctx context.Context, accountID, id string) error {
+func (s *sqlStore) SetActive(ctx context.Context, accountID, id string) error {
 	accountID = normalizeAccount(accountID)
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
 		return err
@@ -81,7 +70,7 @@ func (s *Store) SetActive(ctx context.Context, accountID, id string) error {
 	return err
 }
 
-func (s *Store) UpdateConfig(ctx context.Context, accountID string, cfg Config, active string) error {
+func (s *sqlStore) UpdateConfig(ctx context.Context, accountID string, cfg Config, active string) error {
 	accountID = normalizeAccount(accountID)
 	if err := s.ensureConfigRow(ctx, accountID); err != nil {
 		return err
@@ -93,11 +82,11 @@ func (s *Store) UpdateConfig(ctx context.Context, accountID string, cfg Config,
 	return err
 }
 
-func (s *Store) ensureConfigRow(ctx context.Context, accountID string) error {
+func (s *sqlStore) ensureConfigRow(ctx context.Context, accountID string) error {
 	accountID = normalizeAccount(accountID)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, `INSERT IGNORE INTO config (account_id,retries,fail_limit,health_every_ms,active_node) VALUES (?,?,?,?,?)`,
+	_, err := s.db.ExecContext(ctx, s.dialect.insertIgnore()+` config (account_id,retries,fail_limit,health_every_ms,active_node) VALUES (?,?,?,?,?)`,
 		accountID, 3, 3, 30000, "")
 	return err
 }
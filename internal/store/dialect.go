@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	driverMySQL  = "mysql"
+	driverSQLite = "sqlite"
+)
+
+// dialect 屏蔽 MySQL 与 SQLite 之间的 SQL 语法差异。
+type dialect interface {
+	name() string
+	// insertIgnore 返回“主键/唯一键冲突时忽略”的 INSERT 前缀。
+	insertIgnore() string
+	// onConflictUpdate 返回冲突时更新的子句；cols 为直接取新值的列，含 "=" 的项按原样作为赋值表达式。
+	onConflictUpdate(cols ...string) string
+	// excluded 返回冲突更新子句中引用待插入新值的表达式，用于累加型 upsert。
+	excluded(col string) string
+	// nullSafeEq 返回 NULL 安全的等值比较运算符。
+	nullSafeEq() string
+	// bucketExpr 返回将时间列截断到指定粒度起点的表达式。
+	bucketExpr(target MetricsGranularity, col string) string
+	// noLimit 返回“不限行数”的 LIMIT 取值，供单独使用 OFFSET 时占位。
+	noLimit() string
+	// deleteLimit 返回最多删除 limit 行满足 where 条件记录的语句。
+	deleteLimit(table, where string, limit int) string
+	// autoIncrementPK 返回自增主键列定义。
+	autoIncrementPK() string
+	// columnExistsQuery/indexExistsQuery/tableExistsQuery 返回元数据查询语句。
+	columnExistsQuery() string
+	indexExistsQuery() string
+	tableExistsQuery() string
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) name() string { return driverMySQL }
+
+func (mysqlDialect) insertIgnore() string { return "INSERT IGNORE INTO" }
+
+func (mysqlDialect) onConflictUpdate(cols ...string) string {
+	sets := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if strings.Contains(c, "=") {
+			sets = append(sets, c)
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s=VALUES(%s)", c, c))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysqlDialect) excluded(col string) string { return "VALUES(" + col + ")" }
+
+func (mysqlDialect) nullSafeEq() string { return "<=>" }
+
+func (mysqlDialect) bucketExpr(target MetricsGranularity, col string) string {
+	switch target {
+	case MetricsGranularityHourly:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", col)
+	case MetricsGranularityDaily:
+		return fmt.Sprintf("DATE(%s)", col)
+	case MetricsGranularityMonthly:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01 00:00:00')", col)
+	default:
+		return col
+	}
+}
+
+func (mysqlDialect) noLimit() string { return "18446744073709551615" }
+
+func (mysqlDialect) deleteLimit(table, where string, limit int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT %d", table, where, limit)
+}
+
+func (mysqlDialect) autoIncrementPK() string { return "id BIGINT AUTO_INCREMENT PRIMARY KEY" }
+
+func (mysqlDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+}
+
+func (mysqlDialect) indexExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+}
+
+func (mysqlDialect) tableExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string { return driverSQLite }
+
+func (sqliteDialect) insertIgnore() string { return "INSERT OR IGNORE INTO" }
+
+func (sqliteDialect) onConflictUpdate(cols ...string) string {
+	sets := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if strings.Contains(c, "=") {
+			sets = append(sets, c)
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s=excluded.%s", c, c))
+	}
+	// 省略冲突目标时对任意唯一约束生效，与 MySQL ON DUPLICATE KEY 语义一致（需 SQLite 3.35+）。
+	return "ON CONFLICT DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+func (sqliteDialect) excluded(col string) string { return "excluded." + col }
+
+func (sqliteDialect) nullSafeEq() string { return "IS" }
+
+// bucketExpr 输出与驱动写入格式一致的 UTC 文本（带 +00:00），保证字符串比较与时间顺序一致。
+func (sqliteDialect) bucketExpr(target MetricsGranularity, col string) string {
+	switch target {
+	case MetricsGranularityHourly:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00+00:00', %s)", col)
+	case MetricsGranularityDaily:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00+00:00', %s)", col)
+	case MetricsGranularityMonthly:
+		return fmt.Sprintf("strftime('%%Y-%%m-01 00:00:00+00:00', %s)", col)
+	default:
+		return col
+	}
+}
+
+func (sqliteDialect) noLimit() string { return "-1" }
+
+// deleteLimit SQLite 默认未启用 DELETE ... LIMIT，改为按 rowid 子查询限定行数。
+func (sqliteDialect) deleteLimit(table, where string, limit int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE rowid IN (SELECT rowid FROM %s WHERE %s LIMIT %d)", table, table, where, limit)
+}
+
+func (sqliteDialect) autoIncrementPK() string { return "id INTEGER PRIMARY KEY AUTOINCREMENT" }
+
+func (sqliteDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`
+}
+
+func (sqliteDialect) indexExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?`
+}
+
+func (sqliteDialect) tableExistsQuery() string {
+	return `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+// ensureColumn 在列缺失时执行 ALTER TABLE ADD COLUMN；definition 不含列名，两种方言通用。
+func (s *sqlStore) ensureColumn(ctx context.Context, table, column, definition string) error {
+	exists, err := s.columnExists(ctx, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// ensureIndex 在索引缺失时创建；unique 为 true 时创建唯一索引。
+func (s *sqlStore) ensureIndex(ctx context.Context, table, index, columns string, unique bool) error {
+	exists, err := s.indexExists(ctx, table, index)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, index, table, columns))
+	return err
+}
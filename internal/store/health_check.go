@@ -8,10 +8,8 @@ import (
 	"time"
 )
 
-const healthHistoryRetention = 30 * 24 * time.Hour
-
 // InsertHealthCheck 插入健康检查记录。
-func (s *Store) InsertHealthCheck(ctx context.Context, record *HealthCheckRecord) error {
+func (s *sqlStore) InsertHealthCheck(ctx context.Context, record *HealthCheckRecord) error {
 	if s == nil || s.db == nil {
 		return errors.New("store not initialized")
 	}
@@ -53,7 +51,7 @@ func (s *Store) InsertHealthCheck(ctx context.Context, record *HealthCheckRecord
 }
 
 // LatestHealthCheck 返回指定节点最近一条健康检查记录；若不存在返回 nil。
-func (s *Store) LatestHealthCheck(ctx context.Context, accountID, nodeID string) (*HealthCheckRecord, error) {
+func (s *sqlStore) LatestHealthCheck(ctx context.Context, accountID, nodeID string) (*HealthCheckRecord, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("store not initialized")
 	}
@@ -86,12 +84,13 @@ func (s *Store) LatestHealthCheck(ctx context.Context, accountID, nodeID string)
 	}
 }
 
-// QueryHealthChecks 查询健康检查历史，返回最新的 limit 条记录，按时间正序排列（用于显示）。
-func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckParams) ([]HealthCheckRecord, error) {
+// QueryHealthChecks 查询健康检查历史，返回最新的 limit 条记录，按时间正序排列（用于显示）；
+// Forward 模式改为从 AfterID 之后按 id 正序遍历，供导出使用。
+func (s *sqlStore) QueryHealthChecks(ctx context.Context, params QueryHealthCheckParams) ([]HealthCheckRecord, error) {
 	if s == nil || s.db == nil {
 		return nil, errors.New("store not initialized")
 	}
-	if params.NodeID == "" {
+	if params.NodeID == "" && !params.Forward {
 		return nil, errors.New("node_id required")
 	}
 	params.AccountID = normalizeAccount(params.AccountID)
@@ -121,15 +120,23 @@ func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckPa
 
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	// 使用子查询：先用 DESC 取最新的 N 条，再用 ASC 排序返回（正序显示）
-	conds := []string{"account_id=?", "node_id=?", "check_time >= ?", "check_time <= ?"}
-	args := []interface{}{params.AccountID, params.NodeID, params.From, params.To}
+	conds := []string{"account_id=?", "check_time >= ?", "check_time <= ?"}
+	args := []interface{}{params.AccountID, params.From, params.To}
+	if params.NodeID != "" {
+		conds = append(conds, "node_id=?")
+		args = append(args, params.NodeID)
+	}
 	if params.CheckSource != "" {
 		conds = append(conds, "check_source=?")
 		args = append(args, params.CheckSource)
 	}
+	if params.Forward {
+		conds = append(conds, "id > ?")
+		args = append(args, params.AfterID)
+	}
 	where := strings.Join(conds, " AND ")
 
+	// 使用子查询：先用 DESC 取最新的 N 条，再用 ASC 排序返回（正序显示）
 	query := `SELECT id, account_id, node_id, check_time, success, response_time_ms, error_message, check_method, check_source, created_at
 		FROM (
 			SELECT id, account_id, node_id, check_time, success, response_time_ms, error_message, check_method, check_source, created_at
@@ -140,6 +147,14 @@ func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckPa
 		) AS latest
 		ORDER BY check_time ASC`
 	args = append(args, limit, offset)
+	if params.Forward {
+		query = `SELECT id, account_id, node_id, check_time, success, response_time_ms, error_message, check_method, check_source, created_at
+			FROM health_check_history
+			WHERE ` + where + `
+			ORDER BY id ASC
+			LIMIT ?`
+		args = args[:len(args)-1]
+	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -163,7 +178,7 @@ func (s *Store) QueryHealthChecks(ctx context.Context, params QueryHealthCheckPa
 }
 
 // CountHealthChecks 统计指定条件的总记录数。
-func (s *Store) CountHealthChecks(ctx context.Context, params QueryHealthCheckParams) (int64, error) {
+func (s *sqlStore) CountHealthChecks(ctx context.Context, params QueryHealthCheckParams) (int64, error) {
 	if s == nil || s.db == nil {
 		return 0, errors.New("store not initialized")
 	}
@@ -201,14 +216,14 @@ func (s *Store) CountHealthChecks(ctx context.Context, params QueryHealthCheckPa
 	return total, nil
 }
 
-// CleanupHealthChecks 清理早于 before 的记录；未传入时保留 30 天。
-func (s *Store) CleanupHealthChecks(ctx context.Context, before time.Time) error {
+// CleanupHealthChecks 清理早于 before 的记录；未传入时按默认策略保留 30 天。
+func (s *sqlStore) CleanupHealthChecks(ctx context.Context, before time.Time) error {
 	if s == nil || s.db == nil {
 		return errors.New("store not initialized")
 	}
 	cutoff := before
 	if cutoff.IsZero() {
-		cutoff = time.Now().UTC().Add(-healthHistoryRetention)
+		cutoff = time.Now().UTC().AddDate(0, 0, -defaultRetentionHealthHistoryDays)
 	} else {
 		cutoff = cutoff.UTC()
 	}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// latencyHistGrowth 相邻桶上界的倍率，插值后分位数相对误差约 ±12%。
+const latencyHistGrowth = 1.25
+
+// latencyHistBounds 为各桶上界（毫秒）：1ms 起按 1.25 倍增长至约 10 分钟，最后一个桶收纳更大的值。
+var latencyHistBounds = func() []float64 {
+	var bounds []float64
+	for b := 1.0; b < 600000; b *= latencyHistGrowth {
+		bounds = append(bounds, b)
+	}
+	return bounds
+}()
+
+// LatencyHistogram 固定对数分桶的耗时直方图（毫秒），下标 i 为落入第 i 个桶的样本数。
+// 各粒度桶边界相同，合并即逐桶相加；以 JSON 数组存储，去掉末尾的空桶。
+type LatencyHistogram []int64
+
+// latencyBucket 返回 ms 所在桶下标。
+func latencyBucket(ms float64) int {
+	for i, b := range latencyHistBounds {
+		if ms <= b {
+			return i
+		}
+	}
+	return len(latencyHistBounds)
+}
+
+// Observe 记录一个耗时样本，负值按 0 处理。
+func (h *LatencyHistogram) Observe(ms int64) {
+	if ms < 0 {
+		ms = 0
+	}
+	idx := latencyBucket(float64(ms))
+	if len(*h) <= idx {
+		*h = append(*h, make([]int64, idx+1-len(*h))...)
+	}
+	(*h)[idx]++
+}
+
+// Merge 将 o 逐桶累加到 h。
+func (h *LatencyHistogram) Merge(o LatencyHistogram) {
+	if len(*h) < len(o) {
+		*h = append(*h, make([]int64, len(o)-len(*h))...)
+	}
+	for i, c := range o {
+		(*h)[i] += c
+	}
+}
+
+// Count 返回样本总数。
+func (h LatencyHistogram) Count() int64 {
+	var n int64
+	for _, c := range h {
+		n += c
+	}
+	return n
+}
+
+// Quantile 估算 q 分位（0<q<=1）耗时，桶内按对数线性插值；无样本返回 0。
+func (h LatencyHistogram) Quantile(q float64) float64 {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+	if q <= 0 {
+		q = 0
+	}
+	if q > 1 {
+		q = 1
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, c := range h {
+		if c == 0 {
+			continue
+		}
+		if seen+float64(c) < rank && i < len(h)-1 {
+			seen += float64(c)
+			continue
+		}
+		if i == 0 {
+			return latencyHistBounds[0]
+		}
+		if i >= len(latencyHistBounds) {
+			return latencyHistBounds[len(latencyHistBounds)-1]
+		}
+		lo, hi := latencyHistBounds[i-1], latencyHistBounds[i]
+		frac := (rank - seen) / float64(c)
+		if frac < 0 {
+			frac = 0
+		}
+		if frac > 1 {
+			frac = 1
+		}
+		return math.Round(lo*math.Pow(hi/lo, frac)*10) / 10
+	}
+	return 0
+}
+
+// Value 实现 driver.Valuer：空直方图写入 NULL。
+func (h LatencyHistogram) Value() (driver.Value, error) {
+	end := len(h)
+	for end > 0 && h[end-1] == 0 {
+		end--
+	}
+	if end == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal([]int64(h[:end]))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner，NULL 或空串解析为空直方图。
+func (h *LatencyHistogram) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported latency histogram type %T", src)
+	}
+	if len(raw) == 0 {
+		*h = nil
+		return nil
+	}
+	var counts []int64
+	if err := json.Unmarshal(raw, &counts); err != nil {
+		return fmt.Errorf("decode latency histogram: %w", err)
+	}
+	*h = counts
+	return nil
+}
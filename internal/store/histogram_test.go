@@ -0,0 +1,36 @@
+package store
+
+import "testing"
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	var h LatencyHistogram
+	for i := int64(1); i <= 1000; i++ {
+		h.Observe(i)
+	}
+	for _, tc := range []struct{ q, want float64 }{{0.5, 500}, {0.95, 950}, {0.99, 990}} {
+		got := h.Quantile(tc.q)
+		if got < tc.want*0.88 || got > tc.want*1.12 {
+			t.Fatalf("q%.2f=%v, want ~%v", tc.q, got, tc.want)
+		}
+	}
+
+	var a, b LatencyHistogram
+	a.Observe(10)
+	b.Observe(900000)
+	a.Merge(b)
+	if a.Count() != 2 || a.Quantile(1) < 500000 {
+		t.Fatalf("merge with overflow bucket: count=%d max=%v", a.Count(), a.Quantile(1))
+	}
+
+	v, err := a.Value()
+	if err != nil {
+		t.Fatalf("value: %v", err)
+	}
+	var back LatencyHistogram
+	if err := back.Scan(v); err != nil || back.Count() != 2 || back.Quantile(0.5) != a.Quantile(0.5) {
+		t.Fatalf("round trip: %v %v", back, err)
+	}
+	if v, _ := LatencyHistogram(nil).Value(); v != nil {
+		t.Fatalf("empty histogram should be NULL, got %v", v)
+	}
+}
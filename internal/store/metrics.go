@@ -2,19 +2,14 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
 	"time"
 )
 
-const (
-	retentionRaw    = 7 * 24 * time.Hour
-	retentionHourly = 30 * 24 * time.Hour
-	retentionDaily  = 365 * 24 * time.Hour
-)
-
 // InsertMetrics 写入原始监控数据。调用方应保证时间为 UTC，未指定则自动取当前时间。
-func (s *Store) InsertMetrics(ctx context.Context, rec MetricsRecord) error {
+func (s *sqlStore) InsertMetrics(ctx context.Context, rec MetricsRecord) error {
 	rec.AccountID = normalizeAccount(rec.AccountID)
 	if rec.Timestamp.IsZero() {
 		rec.Timestamp = time.Now().UTC()
@@ -32,21 +27,24 @@ func (s *Store) InsertMetrics(ctx context.Context, rec MetricsRecord) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `INSERT INTO node_metrics_raw (
-		account_id, node_id, ts, requests_total, requests_success, requests_failed,
+		account_id, node_id, api_key_id, ts, requests_total, requests_success, requests_failed,
 		retry_attempts_total, retry_success,
 		response_time_sum_ms, response_time_count, bytes_total,
-		input_tokens_total, output_tokens_total, first_byte_time_sum_ms, stream_duration_sum_ms)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
-		rec.AccountID, rec.NodeID, rec.Timestamp, rec.RequestsTotal, rec.RequestsSuccess, rec.RequestsFailed,
+		input_tokens_total, output_tokens_total, first_byte_time_sum_ms, stream_duration_sum_ms,
+		response_time_hist, first_byte_hist)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.AccountID, rec.NodeID, rec.APIKeyID, rec.Timestamp, rec.RequestsTotal, rec.RequestsSuccess, rec.RequestsFailed,
 		rec.RetryAttemptsTotal, rec.RetrySuccess,
 		rec.ResponseTimeSumMs, rec.ResponseTimeCount, rec.BytesTotal,
-		rec.InputTokensTotal, rec.OutputTokensTotal, rec.FirstByteTimeSumMs, rec.StreamDurationSumMs)
+		rec.InputTokensTotal, rec.OutputTokensTotal, rec.FirstByteTimeSumMs, rec.StreamDurationSumMs,
+		rec.ResponseTimeHist, rec.FirstByteHist)
 	return err
 }
 
 // QueryMetrics 按时间范围和粒度获取监控数据，默认返回最近 24 小时的原始数据。
 // Granularity 支持 raw/hour/day/month，对应不同表；Timestamp 字段表示所在桶的起始时间。
-func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsRecord, error) {
+// 结果按 (时间, 节点, ID) 排序，导出等大批量场景通过 After 游标逐页读取。
+func (s *sqlStore) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsRecord, error) {
 	gran := q.Granularity
 	if gran == "" {
 		gran = MetricsGranularityRaw
@@ -55,6 +53,12 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 	if err != nil {
 		return nil, err
 	}
+	apiKeyCol, idCol := "''", "0"
+	if gran == MetricsGranularityRaw {
+		apiKeyCol, idCol = "api_key_id", "id"
+	} else if q.APIKeyID != "" {
+		return nil, fmt.Errorf("api_key_id filter requires %s granularity", MetricsGranularityRaw)
+	}
 	if q.To.IsZero() {
 		q.To = time.Now().UTC()
 	}
@@ -79,16 +83,20 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 	q.AccountID = normalizeAccount(q.AccountID)
 	var args []interface{}
 	b := &strings.Builder{}
-	fmt.Fprintf(b, `SELECT account_id, node_id, %s AS ts, requests_total, requests_success, requests_failed,
+	fmt.Fprintf(b, `SELECT %s AS id, account_id, node_id, %s AS api_key_id, %s AS ts, requests_total, requests_success, requests_failed,
 		retry_attempts_total, retry_success,
 		response_time_sum_ms, response_time_count, bytes_total, input_tokens_total, output_tokens_total,
-		first_byte_time_sum_ms, stream_duration_sum_ms, %s AS created_at
-		FROM %s WHERE account_id=?`, timeCol, createdCol, table)
+		first_byte_time_sum_ms, stream_duration_sum_ms, response_time_hist, first_byte_hist, %s AS created_at
+		FROM %s WHERE account_id=?`, idCol, apiKeyCol, timeCol, createdCol, table)
 	args = append(args, q.AccountID)
 	if q.NodeID != "" {
 		b.WriteString(" AND node_id=?")
 		args = append(args, q.NodeID)
 	}
+	if q.APIKeyID != "" {
+		b.WriteString(" AND api_key_id=?")
+		args = append(args, q.APIKeyID)
+	}
 	if !q.From.IsZero() {
 		fmt.Fprintf(b, " AND %s >= ?", timeCol)
 		args = append(args, q.From.UTC())
@@ -97,7 +105,19 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 		fmt.Fprintf(b, " AND %s < ?", timeCol)
 		args = append(args, q.To.UTC())
 	}
-	b.WriteString(" ORDER BY " + timeCol + " ASC")
+	if c := q.After; c != nil {
+		if gran == MetricsGranularityRaw {
+			fmt.Fprintf(b, " AND (%[1]s > ? OR (%[1]s = ? AND (node_id > ? OR (node_id = ? AND id > ?))))", timeCol)
+			args = append(args, c.Timestamp.UTC(), c.Timestamp.UTC(), c.NodeID, c.NodeID, c.ID)
+		} else {
+			fmt.Fprintf(b, " AND (%[1]s > ? OR (%[1]s = ? AND node_id > ?))", timeCol)
+			args = append(args, c.Timestamp.UTC(), c.Timestamp.UTC(), c.NodeID)
+		}
+	}
+	b.WriteString(" ORDER BY " + timeCol + " ASC, node_id ASC")
+	if gran == MetricsGranularityRaw {
+		b.WriteString(", id ASC")
+	}
 	if limit > 0 {
 		b.WriteString(" LIMIT ?")
 		args = append(args, limit)
@@ -116,13 +136,17 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 	defer rows.Close()
 	var res []MetricsRecord
 	for rows.Next() {
-		var r MetricsRecord
-		if err := rows.Scan(&r.AccountID, &r.NodeID, &r.Timestamp, &r.RequestsTotal, &r.RequestsSuccess, &r.RequestsFailed,
+		var (
+			r         MetricsRecord
+			createdAt sql.NullTime // 聚合表没有 created_at，查询返回 NULL
+		)
+		if err := rows.Scan(&r.ID, &r.AccountID, &r.NodeID, &r.APIKeyID, &r.Timestamp, &r.RequestsTotal, &r.RequestsSuccess, &r.RequestsFailed,
 			&r.RetryAttemptsTotal, &r.RetrySuccess,
 			&r.ResponseTimeSumMs, &r.ResponseTimeCount, &r.BytesTotal, &r.InputTokensTotal, &r.OutputTokensTotal,
-			&r.FirstByteTimeSumMs, &r.StreamDurationSumMs, &r.CreatedAt); err != nil {
+			&r.FirstByteTimeSumMs, &r.StreamDurationSumMs, &r.ResponseTimeHist, &r.FirstByteHist, &createdAt); err != nil {
 			return nil, err
 		}
+		r.CreatedAt = createdAt.Time
 		res = append(res, r)
 	}
 	return res, rows.Err()
@@ -130,7 +154,7 @@ func (s *Store) QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsReco
 
 // GetNode24hTrend 获取指定节点最近 24 小时的小时级聚合数据，按时间升序返回。
 // 该函数会同时查询已聚合的小时数据和当前小时的原始数据，确保数据实时性。
-func (s *Store) GetNode24hTrend(ctx context.Context, accountID, nodeID string) ([]MetricsRecord, error) {
+func (s *sqlStore) GetNode24hTrend(ctx context.Context, accountID, nodeID string) ([]MetricsRecord, error) {
 	accountID = normalizeAccount(accountID)
 	now := time.Now().UTC()
 	from := now.Add(-24 * time.Hour)
@@ -192,7 +216,7 @@ func (s *Store) GetNode24hTrend(ctx context.Context, accountID, nodeID string) (
 
 // GetNodes24hTrend 批量获取多个节点最近 24 小时的趋势数据，结果按 node_id 和时间升序排列。
 // 该函数会同时查询已聚合的小时数据和当前小时的原始数据，确保数据实时性。
-func (s *Store) GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs []string) (map[string][]MetricsRecord, error) {
+func (s *sqlStore) GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs []string) (map[string][]MetricsRecord, error) {
 	result := make(map[string][]MetricsRecord)
 	if len(nodeIDs) == 0 {
 		return result, nil
@@ -291,13 +315,49 @@ func (s *Store) GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs
 	return result, nil
 }
 
+// SummarizeMetrics 按节点汇总 [from, to) 区间内的原始监控数据，用于周期摘要；Timestamp 为 from。
+// 原始数据保留 7 天，超出范围的区间返回空结果。
+func (s *sqlStore) SummarizeMetrics(ctx context.Context, accountID string, from, to time.Time) ([]MetricsRecord, error) {
+	accountID = normalizeAccount(accountID)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT node_id,
+		COALESCE(SUM(requests_total),0), COALESCE(SUM(requests_success),0), COALESCE(SUM(requests_failed),0),
+		COALESCE(SUM(retry_attempts_total),0), COALESCE(SUM(retry_success),0),
+		COALESCE(SUM(response_time_sum_ms),0), COALESCE(SUM(response_time_count),0), COALESCE(SUM(bytes_total),0),
+		COALESCE(SUM(input_tokens_total),0), COALESCE(SUM(output_tokens_total),0),
+		COALESCE(SUM(first_byte_time_sum_ms),0), COALESCE(SUM(stream_duration_sum_ms),0)
+		FROM node_metrics_raw
+		WHERE account_id=? AND ts >= ? AND ts < ?
+		GROUP BY node_id
+		ORDER BY node_id ASC`, accountID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []MetricsRecord
+	for rows.Next() {
+		r := MetricsRecord{AccountID: accountID, Timestamp: from.UTC()}
+		if err := rows.Scan(&r.NodeID, &r.RequestsTotal, &r.RequestsSuccess, &r.RequestsFailed,
+			&r.RetryAttemptsTotal, &r.RetrySuccess,
+			&r.ResponseTimeSumMs, &r.ResponseTimeCount, &r.BytesTotal, &r.InputTokensTotal, &r.OutputTokensTotal,
+			&r.FirstByteTimeSumMs, &r.StreamDurationSumMs); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
 // AggregateMetrics 将低粒度数据聚合到更高粒度。
 // target 取值：hour(原始->小时)、day(小时->天)、month(天->月)。
-func (s *Store) AggregateMetrics(ctx context.Context, accountID string, target MetricsGranularity, from, to time.Time) error {
-	srcTable, srcTimeCol, dstTable, bucketExpr, err := aggregationPlan(target)
+// 计数列在 SQL 中求和；耗时直方图无法用 SUM 合并，随后由 mergeHistograms 逐桶相加写回。
+func (s *sqlStore) AggregateMetrics(ctx context.Context, accountID string, target MetricsGranularity, from, to time.Time) error {
+	srcTable, srcTimeCol, dstTable, err := aggregationPlan(target)
 	if err != nil {
 		return err
 	}
+	bucketExpr := s.dialect.bucketExpr(target, srcTimeCol)
 	if to.IsZero() {
 		to = time.Now().UTC()
 	}
@@ -330,57 +390,110 @@ func (s *Store) AggregateMetrics(ctx context.Context, accountID string, target M
 		b.WriteString(" AND account_id=?")
 		args = append(args, accountID)
 	}
-	b.WriteString(" GROUP BY account_id, node_id, bucket_start ON DUPLICATE KEY UPDATE ")
-	b.WriteString("requests_total=VALUES(requests_total), requests_success=VALUES(requests_success), requests_failed=VALUES(requests_failed), ")
-	b.WriteString("retry_attempts_total=VALUES(retry_attempts_total), retry_success=VALUES(retry_success), ")
-	b.WriteString("response_time_sum_ms=VALUES(response_time_sum_ms), response_time_count=VALUES(response_time_count), ")
-	b.WriteString("bytes_total=VALUES(bytes_total), input_tokens_total=VALUES(input_tokens_total), output_tokens_total=VALUES(output_tokens_total), ")
-	b.WriteString("first_byte_time_sum_ms=VALUES(first_byte_time_sum_ms), stream_duration_sum_ms=VALUES(stream_duration_sum_ms)")
+	// 按表达式而非别名分组：源表（小时/天汇总）自身也有 bucket_start 列，
+	// MySQL 与 SQLite 都会优先按源列解析，导致同一目标桶被拆成多组、后写覆盖先写。
+	fmt.Fprintf(b, " GROUP BY account_id, node_id, %s ", bucketExpr)
+	b.WriteString(s.dialect.onConflictUpdate("requests_total", "requests_success", "requests_failed",
+		"retry_attempts_total", "retry_success", "response_time_sum_ms", "response_time_count",
+		"bytes_total", "input_tokens_total", "output_tokens_total", "first_byte_time_sum_ms", "stream_duration_sum_ms"))
 
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	_, err = s.db.ExecContext(ctx, b.String(), args...)
-	return err
+	if _, err = s.db.ExecContext(ctx, b.String(), args...); err != nil {
+		return err
+	}
+	return s.mergeHistograms(ctx, accountID, target, srcTable, srcTimeCol, dstTable, from, to)
 }
 
-// CleanupMetrics 按保留策略清理数据；accountID 为空时清理全部租户。
-func (s *Store) CleanupMetrics(ctx context.Context, accountID string, now time.Time) error {
-	if now.IsZero() {
-		now = time.Now().UTC()
-	}
-	account := accountID
-	if account != "" {
-		account = normalizeAccount(account)
-	}
-
-	cuts := []struct {
-		table string
-		col   string
-		keep  time.Duration
-	}{
-		{"node_metrics_raw", "ts", retentionRaw},
-		{"node_metrics_hourly", "bucket_start", retentionHourly},
-		{"node_metrics_daily", "bucket_start", retentionDaily},
-	}
-	for _, c := range cuts {
-		cutoff := now.Add(-c.keep)
-		b := &strings.Builder{}
-		fmt.Fprintf(b, "DELETE FROM %s WHERE %s < ?", c.table, c.col)
-		args := []interface{}{cutoff}
-		if account != "" {
-			b.WriteString(" AND account_id=?")
-			args = append(args, account)
+// mergeHistograms 读取源表 [from, to) 内的直方图，按目标桶合并后覆盖写入目标表对应行。
+// 桶起点在 Go 中按 UTC 截断，与方言 bucketExpr 的结果一致。
+func (s *sqlStore) mergeHistograms(ctx context.Context, accountID string, target MetricsGranularity, srcTable, srcTimeCol, dstTable string, from, to time.Time) error {
+	type histKey struct {
+		accountID, nodeID string
+		bucket            time.Time
+	}
+	type histPair struct{ resp, first LatencyHistogram }
+
+	var args []interface{}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `SELECT account_id, node_id, %s, response_time_hist, first_byte_hist FROM %s
+		WHERE %s >= ? AND %s < ? AND (response_time_hist IS NOT NULL OR first_byte_hist IS NOT NULL)`,
+		srcTimeCol, srcTable, srcTimeCol, srcTimeCol)
+	args = append(args, from.UTC(), to.UTC())
+	if accountID != "" {
+		b.WriteString(" AND account_id=?")
+		args = append(args, accountID)
+	}
+	rows, err := s.db.QueryContext(ctx, b.String(), args...)
+	if err != nil {
+		return err
+	}
+	merged := make(map[histKey]*histPair)
+	var order []histKey
+	for rows.Next() {
+		var (
+			k           histKey
+			ts          time.Time
+			resp, first LatencyHistogram
+		)
+		if err := rows.Scan(&k.accountID, &k.nodeID, &ts, &resp, &first); err != nil {
+			rows.Close()
+			return err
 		}
-		ctx, cancel := withTimeout(ctx)
-		if _, err := s.db.ExecContext(ctx, b.String(), args...); err != nil {
-			cancel()
+		k.bucket = truncateBucket(target, ts)
+		cur := merged[k]
+		if cur == nil {
+			cur = &histPair{}
+			merged[k] = cur
+			order = append(order, k)
+		}
+		cur.resp.Merge(resp)
+		cur.first.Merge(first)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt := fmt.Sprintf(`UPDATE %s SET response_time_hist=?, first_byte_hist=?
+		WHERE account_id=? AND node_id=? AND bucket_start=?`, dstTable)
+	for _, k := range order {
+		h := merged[k]
+		if _, err := s.db.ExecContext(ctx, stmt, h.resp, h.first, k.accountID, k.nodeID, k.bucket); err != nil {
 			return err
 		}
-		cancel()
 	}
 	return nil
 }
 
+// truncateBucket 将时间截断到目标粒度起点（UTC）。
+func truncateBucket(target MetricsGranularity, t time.Time) time.Time {
+	t = t.UTC()
+	switch target {
+	case MetricsGranularityHourly:
+		return t.Truncate(time.Hour)
+	case MetricsGranularityDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case MetricsGranularityMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+// CleanupMetrics 按默认保留策略清理监控数据；accountID 为空时清理全部租户。
+// 按账号配置的策略清理请使用 ApplyRetention。
+func (s *sqlStore) CleanupMetrics(ctx context.Context, accountID string, now time.Time) error {
+	def := DefaultRetentionPolicy()
+	_, err := s.ApplyRetention(ctx, accountID, RetentionPolicy{
+		MetricsRawDays:     def.MetricsRawDays,
+		MetricsHourlyDays:  def.MetricsHourlyDays,
+		MetricsDailyDays:   def.MetricsDailyDays,
+		MetricsMonthlyDays: def.MetricsMonthlyDays,
+	}, now)
+	return err
+}
+
 // metricsTableInfo 返回查询用的表、时间列名与 created_at 列（原始表为实际列，其余为 NULL）。
 func metricsTableInfo(gr MetricsGranularity) (table, timeCol, createdCol string, err error) {
 	switch gr {
@@ -397,16 +510,16 @@ func metricsTableInfo(gr MetricsGranularity) (table, timeCol, createdCol string,
 	}
 }
 
-// aggregationPlan 定义从低粒度到目标粒度的聚合路径。
-func aggregationPlan(target MetricsGranularity) (srcTable, srcTimeCol, dstTable, bucketExpr string, err error) {
+// aggregationPlan 定义从低粒度到目标粒度的聚合路径，桶表达式由方言提供。
+func aggregationPlan(target MetricsGranularity) (srcTable, srcTimeCol, dstTable string, err error) {
 	switch target {
 	case MetricsGranularityHourly:
-		return "node_metrics_raw", "ts", "node_metrics_hourly", "DATE_FORMAT(ts, '%Y-%m-%d %H:00:00')", nil
+		return "node_metrics_raw", "ts", "node_metrics_hourly", nil
 	case MetricsGranularityDaily:
-		return "node_metrics_hourly", "bucket_start", "node_metrics_daily", "DATE(bucket_start)", nil
+		return "node_metrics_hourly", "bucket_start", "node_metrics_daily", nil
 	case MetricsGranularityMonthly:
-		return "node_metrics_daily", "bucket_start", "node_metrics_monthly", "DATE_FORMAT(bucket_start, '%Y-%m-01 00:00:00')", nil
+		return "node_metrics_daily", "bucket_start", "node_metrics_monthly", nil
 	default:
-		return "", "", "", "", fmt.Errorf("unsupported target granularity: %s", target)
+		return "", "", "", fmt.Errorf("unsupported target granularity: %s", target)
 	}
 }
@@ -8,7 +8,7 @@ import (
 	"log"
 )
 
-func (s *Store) ensureAccountsTable(ctx context.Context) error {
+func (s *sqlStore) ensureAccountsTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS accounts (
@@ -28,7 +28,7 @@ func (s *Store) ensureAccountsTable(ctx context.Context) error {
 }
 
 // ensureAccountPassword 迁移 accounts 表增加 password 列，并填充默认密码。
-func (s *Store) ensureAccountPassword(ctx context.Context) error {
+func (s *sqlStore) ensureAccountPassword(ctx context.Context) error {
 	hasPwd, err := s.columnExists(context.Background(), "accounts", "password")
 	if err != nil {
 		return err
@@ -53,7 +53,7 @@ func (s *Store) ensureAccountPassword(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureNodesTable(ctx context.Context) error {
+func (s *sqlStore) ensureNodesTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS nodes (
@@ -152,10 +152,23 @@ func (s *Store) ensureNodesTable(ctx context.Context) error {
 			return err
 		}
 	}
-	return nil
+
+	// 模型白名单（逗号分隔）与模型映射（JSON）。
+	if err := s.ensureColumn(context.Background(), "nodes", "supported_models", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(context.Background(), "nodes", "model_map", "TEXT"); err != nil {
+		return err
+	}
+	// 健康检查探针链（JSON 数组）。
+	if err := s.ensureColumn(context.Background(), "nodes", "health_probes", "TEXT"); err != nil {
+		return err
+	}
+	// 中转节点计费倍率。
+	return s.ensureColumn(context.Background(), "nodes", "price_multiplier", "DOUBLE NOT NULL DEFAULT 1")
 }
 
-func (s *Store) ensureMonitorShareTable(ctx context.Context) error {
+func (s *sqlStore) ensureMonitorShareTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS monitor_shares (
@@ -176,7 +189,7 @@ func (s *Store) ensureMonitorShareTable(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureHealthHistoryTable(ctx context.Context) error {
+func (s *sqlStore) ensureHealthHistoryTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS health_check_history (
@@ -225,7 +238,7 @@ func (s *Store) ensureHealthHistoryTable(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureConfigTable(ctx context.Context) error {
+func (s *sqlStore) ensureConfigTable(ctx context.Context) error {
 	hasAccount, err := s.columnExists(context.Background(), "config", "account_id")
 	if err != nil {
 		return err
@@ -241,7 +254,7 @@ func (s *Store) ensureConfigTable(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureTunnelConfigTable(ctx context.Context) error {
+func (s *sqlStore) ensureTunnelConfigTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS tunnel_config (
@@ -259,7 +272,7 @@ func (s *Store) ensureTunnelConfigTable(ctx context.Context) error {
 	return err
 }
 
-func (s *Store) ensureMetricsTables(ctx context.Context) error {
+func (s *sqlStore) ensureMetricsTables(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
@@ -280,6 +293,8 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 		output_tokens_total BIGINT DEFAULT 0,
 		first_byte_time_sum_ms BIGINT DEFAULT 0,
 		stream_duration_sum_ms BIGINT DEFAULT 0,
+		response_time_hist TEXT,
+		first_byte_hist TEXT,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		KEY idx_metrics_raw_account_node_time (account_id, node_id, ts),
 		KEY idx_metrics_raw_time (ts)
@@ -301,6 +316,8 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 		output_tokens_total BIGINT DEFAULT 0,
 		first_byte_time_sum_ms BIGINT DEFAULT 0,
 		stream_duration_sum_ms BIGINT DEFAULT 0,
+		response_time_hist TEXT,
+		first_byte_hist TEXT,
 		PRIMARY KEY (account_id, node_id, bucket_start),
 		KEY idx_metrics_hour_time (bucket_start)
 	)`
@@ -321,6 +338,8 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 		output_tokens_total BIGINT DEFAULT 0,
 		first_byte_time_sum_ms BIGINT DEFAULT 0,
 		stream_duration_sum_ms BIGINT DEFAULT 0,
+		response_time_hist TEXT,
+		first_byte_hist TEXT,
 		PRIMARY KEY (account_id, node_id, bucket_start),
 		KEY idx_metrics_day_time (bucket_start)
 	)`
@@ -341,6 +360,8 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 		output_tokens_total BIGINT DEFAULT 0,
 		first_byte_time_sum_ms BIGINT DEFAULT 0,
 		stream_duration_sum_ms BIGINT DEFAULT 0,
+		response_time_hist TEXT,
+		first_byte_hist TEXT,
 		PRIMARY KEY (account_id, node_id, bucket_start),
 		KEY idx_metrics_month_time (bucket_start)
 	)`
@@ -380,11 +401,24 @@ func (s *Store) ensureMetricsTables(ctx context.Context) error {
 			}
 			cancel()
 		}
+
+		// 耗时分布直方图（JSON 数组），用于分位数统计。
+		if err := s.ensureColumn(context.Background(), tbl, "response_time_hist", "TEXT"); err != nil {
+			return err
+		}
+		if err := s.ensureColumn(context.Background(), tbl, "first_byte_hist", "TEXT"); err != nil {
+			return err
+		}
 	}
-	return nil
+
+	// 按 API Key 归属请求（仅原始表，聚合表仍按账号+节点汇总）。
+	if err := s.ensureColumn(context.Background(), "node_metrics_raw", "api_key_id", "VARCHAR(64) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return s.ensureIndex(context.Background(), "node_metrics_raw", "idx_metrics_raw_api_key_time", "api_key_id, ts", false)
 }
 
-func (s *Store) recreateConfigTable() error {
+func (s *sqlStore) recreateConfigTable() error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
@@ -411,7 +445,7 @@ func (s *Store) recreateConfigTable() error {
 	return nil
 }
 
-func (s *Store) ensureNotificationTables(ctx context.Context) error {
+func (s *sqlStore) ensureNotificationTables(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notification_channels (
@@ -442,6 +476,10 @@ func (s *Store) ensureNotificationTables(ctx context.Context) error {
 	)`); err != nil {
 		return err
 	}
+	// 订阅规则（过滤、静默时段、模板），JSON 文本。
+	if err := s.ensureColumn(ctx, "notification_subscriptions", "rules", "TEXT"); err != nil {
+		return err
+	}
 
 	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notification_history (
 		id VARCHAR(64) PRIMARY KEY,
@@ -462,7 +500,7 @@ func (s *Store) ensureNotificationTables(ctx context.Context) error {
 	return nil
 }
 
-func (s *Store) ensureMonitorSharesTable(ctx context.Context) error {
+func (s *sqlStore) ensureMonitorSharesTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := `CREATE TABLE IF NOT EXISTS monitor_shares (
@@ -482,7 +520,7 @@ func (s *Store) ensureMonitorSharesTable(ctx context.Context) error {
 	return err
 }
 
-func (s *Store) ensureDefaultAccount(ctx context.Context) error {
+func (s *sqlStore) ensureDefaultAccount(ctx context.Context) error {
 	// 默认账号自动创建已禁用，保留函数以兼容旧调用。
 	return nil
 }
@@ -495,7 +533,7 @@ func (s *Store) ensureDefaultAccount(ctx context.Context) error {
 //   - account 级别：为每个账号写入 node.active_node。
 //   - 使用 INSERT IGNORE 保证幂等，不覆盖已存在的 settings。
 //   - 当 config 表不存在或无数据时直接跳过。
-func (s *Store) migrateConfigToSettings(ctx context.Context) error {
+func (s *sqlStore) migrateConfigToSettings(ctx context.Context) error {
 	log.Printf("[migration] start config->settings migration")
 
 	// 1) 检查 config 表是否存在。
@@ -582,29 +620,23 @@ func (s *Store) migrateConfigToSettings(ctx context.Context) error {
 	return nil
 }
 
-// insertSettingIfMissing 使用 INSERT IGNORE 写入 settings，保持幂等。
-func (s *Store) insertSettingIfMissing(ctx context.Context, key, scope string, account interface{}, value any, dataType, category string) error {
+// insertSettingIfMissing 使用 INSERT IGNORE（SQLite 为 INSERT OR IGNORE）写入 settings，保持幂等。
+func (s *sqlStore) insertSettingIfMissing(ctx context.Context, key, scope string, account interface{}, value any, dataType, category string) error {
 	body, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 	ictx, cancel := withTimeout(ctx)
 	defer cancel()
-	_, err = s.db.ExecContext(ictx, "INSERT IGNORE INTO settings (`key`, scope, account_id, value, data_type, category, is_secret, version) VALUES (?,?,?,?,?,?,FALSE,1)",
+	_, err = s.db.ExecContext(ictx, s.dialect.insertIgnore()+" settings (`key`, scope, account_id, value, data_type, category, is_secret, version) VALUES (?,?,?,?,?,?,FALSE,1)",
 		key, scope, account, body, dataType, category)
 	return err
 }
 
-func (s *Store) columnExists(ctx context.Context, table, column string) (bool, error) {
+func (s *sqlStore) columnExists(ctx context.Context, table, column string) (bool, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) > 0
-		FROM information_schema.COLUMNS
-		WHERE TABLE_SCHEMA = DATABASE()
-		  AND TABLE_NAME = ?
-		  AND COLUMN_NAME = ?
-	`, table, column)
+	row := s.db.QueryRowContext(ctx, s.dialect.columnExistsQuery(), table, column)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return false, err
@@ -612,16 +644,10 @@ func (s *Store) columnExists(ctx context.Context, table, column string) (bool, e
 	return exists, nil
 }
 
-func (s *Store) indexExists(ctx context.Context, table, index string) (bool, error) {
+func (s *sqlStore) indexExists(ctx context.Context, table, index string) (bool, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) > 0
-		FROM information_schema.STATISTICS
-		WHERE TABLE_SCHEMA = DATABASE()
-		  AND TABLE_NAME = ?
-		  AND INDEX_NAME = ?
-	`, table, index)
+	row := s.db.QueryRowContext(ctx, s.dialect.indexExistsQuery(), table, index)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return false, err
@@ -629,15 +655,10 @@ func (s *Store) indexExists(ctx context.Context, table, index string) (bool, err
 	return exists, nil
 }
 
-func (s *Store) tableExists(ctx context.Context, table string) (bool, error) {
+func (s *sqlStore) tableExists(ctx context.Context, table string) (bool, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	row := s.db.QueryRowContext(ctx, `
-		SELECT COUNT(*) > 0
-		FROM information_schema.TABLES
-		WHERE TABLE_SCHEMA = DATABASE()
-		  AND TABLE_NAME = ?
-	`, table)
+	row := s.db.QueryRowContext(ctx, s.dialect.tableExistsQuery(), table)
 	var exists bool
 	if err := row.Scan(&exists); err != nil {
 		return false, err
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sqliteSchema 为 SQLite 后端的完整表结构，对应 MySQL 迁移完成后的最终形态。
+// 与 MySQL 的差异：索引独立创建、自增主键使用 INTEGER PRIMARY KEY、无 ON UPDATE（由写入方显式维护 updated_at）。
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS accounts (
+		id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		password VARCHAR(500) DEFAULT '',
+		proxy_api_key VARCHAR(255),
+		is_admin BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS uniq_proxy_api_key ON accounts (proxy_api_key)`,
+
+	`CREATE TABLE IF NOT EXISTS nodes (
+		id VARCHAR(64) PRIMARY KEY,
+		name VARCHAR(255),
+		base_url TEXT NOT NULL,
+		api_key TEXT,
+		health_check_method VARCHAR(10) DEFAULT 'api',
+		health_check_model VARCHAR(128) DEFAULT '` + defaultHealthCheckModel + `',
+		account_id VARCHAR(64) NOT NULL DEFAULT '` + DefaultAccountID + `',
+		weight INT DEFAULT 1,
+		failed BOOLEAN DEFAULT FALSE,
+		disabled BOOLEAN DEFAULT FALSE,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		requests BIGINT DEFAULT 0,
+		fail_count BIGINT DEFAULT 0,
+		fail_streak BIGINT DEFAULT 0,
+		total_bytes BIGINT DEFAULT 0,
+		total_input BIGINT DEFAULT 0,
+		total_output BIGINT DEFAULT 0,
+		stream_dur_ms BIGINT DEFAULT 0,
+		first_byte_ms BIGINT DEFAULT 0,
+		last_ping_ms BIGINT DEFAULT -1,
+		last_ping_err TEXT,
+		last_health_check_at DATETIME DEFAULT NULL,
+		supported_models TEXT,
+		model_map TEXT,
+		health_probes TEXT,
+		price_multiplier DOUBLE NOT NULL DEFAULT 1
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_nodes_account ON nodes (account_id)`,
+
+	`CREATE TABLE IF NOT EXISTS health_check_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id VARCHAR(255) NOT NULL,
+		node_id VARCHAR(255) NOT NULL,
+		check_time DATETIME NOT NULL,
+		success BOOLEAN NOT NULL,
+		response_time_ms INT,
+		error_message TEXT,
+		check_method VARCHAR(20) NOT NULL,
+		check_source VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_node_time ON health_check_history (node_id, check_time)`,
+	`CREATE INDEX IF NOT EXISTS idx_account_node_time ON health_check_history (account_id, node_id, check_time)`,
+	`CREATE INDEX IF NOT EXISTS idx_account_node_source_time ON health_check_history (account_id, node_id, check_source, check_time)`,
+
+	`CREATE TABLE IF NOT EXISTS monitor_shares (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		token VARCHAR(128) NOT NULL,
+		expire_at DATETIME NULL,
+		created_by VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		revoked BOOLEAN NOT NULL DEFAULT FALSE,
+		revoked_at DATETIME NULL
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS uniq_monitor_share_token ON monitor_shares (token)`,
+	`CREATE INDEX IF NOT EXISTS idx_monitor_share_account ON monitor_shares (account_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_monitor_share_created_at ON monitor_shares (created_at)`,
+
+	`CREATE TABLE IF NOT EXISTS config (
+		account_id VARCHAR(64) PRIMARY KEY,
+		retries INT DEFAULT 3,
+		fail_limit INT DEFAULT 3,
+		health_every_ms BIGINT DEFAULT 30000,
+		active_node VARCHAR(64)
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS tunnel_config (
+		id VARCHAR(64) PRIMARY KEY,
+		api_token VARCHAR(512),
+		subdomain VARCHAR(128),
+		zone VARCHAR(256),
+		enabled TINYINT(1) DEFAULT 0,
+		public_url VARCHAR(512),
+		status VARCHAR(32),
+		last_error TEXT,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS notification_channels (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		channel_type VARCHAR(64) NOT NULL,
+		name VARCHAR(255),
+		config JSON,
+		enabled BOOLEAN DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_notification_channels_account ON notification_channels (account_id)`,
+	`CREATE TABLE IF NOT EXISTS notification_subscriptions (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		channel_id VARCHAR(64) NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+		event_type VARCHAR(128) NOT NULL,
+		enabled BOOLEAN DEFAULT TRUE,
+		rules TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS uniq_subscription ON notification_subscriptions (account_id, channel_id, event_type)`,
+	`CREATE INDEX IF NOT EXISTS idx_subscription_account_event ON notification_subscriptions (account_id, event_type)`,
+	`CREATE TABLE IF NOT EXISTS notification_history (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		channel_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(128) NOT NULL,
+		title VARCHAR(255),
+		content TEXT,
+		status VARCHAR(32) NOT NULL,
+		error TEXT,
+		sent_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_history_account_event ON notification_history (account_id, event_type)`,
+	`CREATE INDEX IF NOT EXISTS idx_history_channel ON notification_history (channel_id)`,
+
+	// settings.account_id 为 NULL 表示系统级配置，唯一索引使用 IFNULL 使 NULL 参与去重。
+	"CREATE TABLE IF NOT EXISTS settings (" +
+		"  id INTEGER PRIMARY KEY AUTOINCREMENT," +
+		"  `key` VARCHAR(128) NOT NULL," +
+		"  scope VARCHAR(16) NOT NULL DEFAULT 'system' CHECK (scope IN ('system', 'account', 'user'))," +
+		"  account_id VARCHAR(64) NULL," +
+		"  value JSON NOT NULL," +
+		"  data_type VARCHAR(32) NOT NULL DEFAULT 'string'," +
+		"  category VARCHAR(64) NOT NULL DEFAULT 'general'," +
+		"  description TEXT NULL," +
+		"  is_secret BOOLEAN NOT NULL DEFAULT FALSE," +
+		"  version INT NOT NULL DEFAULT 1," +
+		"  updated_by VARCHAR(64) NULL," +
+		"  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP," +
+		"  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP" +
+		")",
+	"CREATE UNIQUE INDEX IF NOT EXISTS uk_scope_key_account ON settings (scope, `key`, IFNULL(account_id, ''))",
+	`CREATE INDEX IF NOT EXISTS idx_category ON settings (category)`,
+	`CREATE INDEX IF NOT EXISTS idx_updated_at ON settings (updated_at)`,
+}
+
+// sqliteMetricsColumns 为四张监控表共用的计数列。
+const sqliteMetricsColumns = `
+		requests_total BIGINT DEFAULT 0,
+		requests_success BIGINT DEFAULT 0,
+		requests_failed BIGINT DEFAULT 0,
+		retry_attempts_total BIGINT DEFAULT 0,
+		retry_success BIGINT DEFAULT 0,
+		response_time_sum_ms BIGINT DEFAULT 0,
+		response_time_count BIGINT DEFAULT 0,
+		bytes_total BIGINT DEFAULT 0,
+		input_tokens_total BIGINT DEFAULT 0,
+		output_tokens_total BIGINT DEFAULT 0,
+		first_byte_time_sum_ms BIGINT DEFAULT 0,
+		stream_duration_sum_ms BIGINT DEFAULT 0,
+		response_time_hist TEXT,
+		first_byte_hist TEXT`
+
+func sqliteMetricsSchema() []string {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS node_metrics_raw (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id VARCHAR(64) NOT NULL,
+		node_id VARCHAR(64) NOT NULL,
+		ts DATETIME NOT NULL,
+		api_key_id VARCHAR(64) NOT NULL DEFAULT '',` + sqliteMetricsColumns + `,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`,
+		`CREATE INDEX IF NOT EXISTS idx_metrics_raw_account_node_time ON node_metrics_raw (account_id, node_id, ts)`,
+		`CREATE INDEX IF NOT EXISTS idx_metrics_raw_time ON node_metrics_raw (ts)`,
+		`CREATE INDEX IF NOT EXISTS idx_metrics_raw_api_key_time ON node_metrics_raw (api_key_id, ts)`,
+	}
+	rollups := []struct{ table, index string }{
+		{"node_metrics_hourly", "idx_metrics_hour_time"},
+		{"node_metrics_daily", "idx_metrics_day_time"},
+		{"node_metrics_monthly", "idx_metrics_month_time"},
+	}
+	for _, r := range rollups {
+		stmts = append(stmts,
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		account_id VARCHAR(64) NOT NULL,
+		node_id VARCHAR(64) NOT NULL,
+		bucket_start DATETIME NOT NULL,%s,
+		PRIMARY KEY (account_id, node_id, bucket_start)
+	)`, r.table, sqliteMetricsColumns),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (bucket_start)`, r.index, r.table))
+	}
+	return stmts
+}
+
+// migrateSQLite 创建 SQLite 表结构并写入默认配置。
+func (s *sqlStore) migrateSQLite(ctx context.Context) error {
+	stmts := append(append([]string{}, sqliteSchema...), sqliteMetricsSchema()...)
+	for _, stmt := range stmts {
+		ectx, cancel := withTimeout(ctx)
+		_, err := s.db.ExecContext(ectx, stmt)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("sqlite migrate: %w (%s)", err, firstLine(stmt))
+		}
+	}
+	// 兼容旧库：订阅规则、节点探针链、计费倍率与耗时直方图列在后续版本加入。
+	if err := s.ensureColumn(ctx, "notification_subscriptions", "rules", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "nodes", "health_probes", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "nodes", "price_multiplier", "DOUBLE NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	for _, tbl := range []string{"node_metrics_raw", "node_metrics_hourly", "node_metrics_daily", "node_metrics_monthly"} {
+		if err := s.ensureColumn(ctx, tbl, "response_time_hist", "TEXT"); err != nil {
+			return err
+		}
+		if err := s.ensureColumn(ctx, tbl, "first_byte_hist", "TEXT"); err != nil {
+			return err
+		}
+	}
+	if err := s.ensureQuotaTables(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAPIKeysTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureSessionsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureUsersTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAuditEventsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRequestLogsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureNotificationOutboxTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureModelUsageTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRetentionIndexes(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureConfigRow(ctx, DefaultAccountID); err != nil {
+		return err
+	}
+	if err := s.SeedDefaultSettings(); err != nil {
+		return err
+	}
+	return s.migrateConfigToSettings(ctx)
+}
+
+func firstLine(stmt string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(stmt), "\n")
+	return line
+}
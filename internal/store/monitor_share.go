@@ -9,7 +9,7 @@ import (
 )
 
 // CreateMonitorShare 创建分享链接
-func (s *Store) CreateMonitorShare(ctx context.Context, rec MonitorShareRecord) error {
+func (s *sqlStore) CreateMonitorShare(ctx context.Context, rec MonitorShareRecord) error {
 	if rec.ID == "" || rec.Token == "" {
 		return errors.New("id and token are required")
 	}
@@ -46,7 +46,7 @@ func (s *Store) CreateMonitorShare(ctx context.Context, rec MonitorShareRecord)
 }
 
 // GetMonitorShareByToken 根据 token 获取分享链接（验证有效性）
-func (s *Store) GetMonitorShareByToken(ctx context.Context, token string) (*MonitorShareRecord, error) {
+func (s *sqlStore) GetMonitorShareByToken(ctx context.Context, token string) (*MonitorShareRecord, error) {
 	if token == "" {
 		return nil, errors.New("token required")
 	}
@@ -59,8 +59,8 @@ func (s *Store) GetMonitorShareByToken(ctx context.Context, token string) (*Moni
 	)
 	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at
 		FROM monitor_shares
-		WHERE token=? AND revoked=FALSE AND (expire_at IS NULL OR expire_at>UTC_TIMESTAMP())`,
-		token).Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt)
+		WHERE token=? AND revoked=FALSE AND (expire_at IS NULL OR expire_at>?)`,
+		token, time.Now().UTC()).Scan(&rec.ID, &rec.AccountID, &rec.Token, &expire, &rec.CreatedBy, &rec.CreatedAt, &rec.Revoked, &revokedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -82,7 +82,7 @@ func (s *Store) GetMonitorShareByToken(ctx context.Context, token string) (*Moni
 }
 
 // GetMonitorShareByID 获取分享记录（不校验有效性，用于管理操作）
-func (s *Store) GetMonitorShareByID(ctx context.Context, id string) (*MonitorShareRecord, error) {
+func (s *sqlStore) GetMonitorShareByID(ctx context.Context, id string) (*MonitorShareRecord, error) {
 	if id == "" {
 		return nil, errors.New("id required")
 	}
@@ -115,7 +115,7 @@ func (s *Store) GetMonitorShareByID(ctx context.Context, id string) (*MonitorSha
 }
 
 // ListMonitorShares 列出分享链接
-func (s *Store) ListMonitorShares(ctx context.Context, params QueryMonitorSharesParams) ([]MonitorShareRecord, error) {
+func (s *sqlStore) ListMonitorShares(ctx context.Context, params QueryMonitorSharesParams) ([]MonitorShareRecord, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	query := `SELECT id,account_id,token,expire_at,created_by,created_at,revoked,revoked_at FROM monitor_shares`
@@ -140,8 +140,8 @@ func (s *Store) ListMonitorShares(ctx context.Context, params QueryMonitorShares
 			args = append(args, params.Offset)
 		}
 	} else if params.Offset > 0 {
-		// MySQL 需要 LIMIT 才能使用 OFFSET，使用最大值占位。
-		query += " LIMIT 18446744073709551615 OFFSET ?"
+		// MySQL/SQLite 需要 LIMIT 才能使用 OFFSET，使用“不限行数”占位。
+		query += " LIMIT " + s.dialect.noLimit() + " OFFSET ?"
 		args = append(args, params.Offset)
 	}
 
@@ -176,7 +176,7 @@ func (s *Store) ListMonitorShares(ctx context.Context, params QueryMonitorShares
 }
 
 // RevokeMonitorShare 撤销分享链接
-func (s *Store) RevokeMonitorShare(ctx context.Context, id string) error {
+func (s *sqlStore) RevokeMonitorShare(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
@@ -196,7 +196,7 @@ func (s *Store) RevokeMonitorShare(ctx context.Context, id string) error {
 }
 
 // DeleteMonitorShare 删除分享链接（物理删除）
-func (s *Store) DeleteMonitorShare(ctx context.Context, id string) error {
+func (s *sqlStore) DeleteMonitorShare(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
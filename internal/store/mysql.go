@@ -10,7 +10,7 @@ import (
 )
 
 // ensureSettingsTable 创建统一配置表。
-func (s *Store) ensureSettingsTable(ctx context.Context) error {
+func (s *sqlStore) ensureSettingsTable(ctx context.Context) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	stmt := "CREATE TABLE IF NOT EXISTS settings (" +
@@ -36,7 +36,7 @@ func (s *Store) ensureSettingsTable(ctx context.Context) error {
 }
 
 // SeedDefaultSettings 插入默认配置（若不存在）。
-func (s *Store) SeedDefaultSettings() error {
+func (s *sqlStore) SeedDefaultSettings() error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
@@ -48,7 +48,43 @@ func (s *Store) SeedDefaultSettings() error {
 		{Key: "health.check_interval_sec", Scope: "system", Value: 30, DataType: "number", Category: "health", Description: strPtr("健康检查间隔（秒）")},
 		{Key: "health.fail_threshold", Scope: "system", Value: 3, DataType: "number", Category: "health", Description: strPtr("失败阈值")},
 		{Key: "health.skip_disabled_nodes", Scope: "system", Value: true, DataType: "boolean", Category: "health", Description: strPtr("禁用节点不进行健康检查")},
+		{Key: "health.passive_enabled", Scope: "system", Value: true, DataType: "boolean", Category: "health", Description: strPtr("根据代理流量计算节点健康评分，并据此自动降权与摘除")},
+		{Key: "health.passive_min_samples", Scope: "system", Value: 20, DataType: "number", Category: "health", Description: strPtr("5 分钟窗口内至少多少个请求才计算评分")},
+		{Key: "health.passive_demote_score", Scope: "system", Value: 70, DataType: "number", Category: "health", Description: strPtr("评分低于该值时降权")},
+		{Key: "health.passive_promote_score", Scope: "system", Value: 85, DataType: "number", Category: "health", Description: strPtr("降权节点评分回到该值以上时恢复原权重")},
+		{Key: "health.passive_demote_penalty", Scope: "system", Value: 10, DataType: "number", Category: "health", Description: strPtr("降权时叠加到权重值上的惩罚")},
+		{Key: "health.passive_eject_score", Scope: "system", Value: 30, DataType: "number", Category: "health", Description: strPtr("评分低于该值时临时摘除节点")},
+		{Key: "health.passive_eject_sec", Scope: "system", Value: 30, DataType: "number", Category: "health", Description: strPtr("摘除时长（秒），连续摘除时按次数倍增，最多 10 倍")},
+		{Key: "health.passive_max_eject_percent", Scope: "system", Value: 50, DataType: "number", Category: "health", Description: strPtr("同一账号最多同时摘除的可用节点百分比")},
 		{Key: "proxy.retry_max", Scope: "system", Value: 3, DataType: "number", Category: "performance", Description: strPtr("最大重试次数")},
+		{Key: "quota.warn_thresholds", Scope: "system", Value: []int{80, 100}, DataType: "array", Category: "quota", Description: strPtr("账号 token 配额告警阈值（百分比）")},
+		{Key: "security.login_max_failures", Scope: "system", Value: 5, DataType: "number", Category: "security", Description: strPtr("登录连续失败多少次后锁定（按 IP 与账号名分别统计）")},
+		{Key: "security.login_lockout_sec", Scope: "system", Value: 900, DataType: "number", Category: "security", Description: strPtr("登录锁定时长（秒）")},
+		{Key: "request_log.enabled", Scope: "system", Value: false, DataType: "boolean", Category: "request_log", Description: strPtr("记录每个代理请求的审计日志")},
+		{Key: "request_log.capture_bodies", Scope: "system", Value: false, DataType: "boolean", Category: "request_log", Description: strPtr("同时记录截断后的请求/响应体")},
+		{Key: "request_log.body_max_bytes", Scope: "system", Value: 16384, DataType: "number", Category: "request_log", Description: strPtr("请求/响应体最大记录字节数")},
+		{Key: "request_log.redact_system", Scope: "system", Value: true, DataType: "boolean", Category: "request_log", Description: strPtr("记录请求体时隐藏 system 提示词")},
+		{Key: "request_log.redact_tools", Scope: "system", Value: true, DataType: "boolean", Category: "request_log", Description: strPtr("记录请求/响应体时隐藏工具定义、工具调用参数与工具结果")},
+		{Key: "request_log.retention_days", Scope: "system", Value: 7, DataType: "number", Category: "request_log", Description: strPtr("请求日志保留天数")},
+		{Key: "retention.metrics_raw_days", Scope: "system", Value: 7, DataType: "number", Category: "retention", Description: strPtr("原始监控数据保留天数，0 表示永久保留；可按账号（scope=account）覆盖")},
+		{Key: "retention.metrics_hourly_days", Scope: "system", Value: 30, DataType: "number", Category: "retention", Description: strPtr("小时汇总保留天数")},
+		{Key: "retention.metrics_daily_days", Scope: "system", Value: 365, DataType: "number", Category: "retention", Description: strPtr("日汇总保留天数")},
+		{Key: "retention.metrics_monthly_days", Scope: "system", Value: 0, DataType: "number", Category: "retention", Description: strPtr("月汇总保留天数，0 表示永久保留")},
+		{Key: "retention.health_history_days", Scope: "system", Value: 30, DataType: "number", Category: "retention", Description: strPtr("健康检查历史保留天数")},
+		{Key: "retention.notification_history_days", Scope: "system", Value: 90, DataType: "number", Category: "retention", Description: strPtr("通知历史（含已完成的发件箱记录）保留天数")},
+		{Key: "retention.monitor_share_days", Scope: "system", Value: 30, DataType: "number", Category: "retention", Description: strPtr("已过期或已撤销的监控分享链接保留天数")},
+		{Key: "retention.delete_batch_size", Scope: "system", Value: 5000, DataType: "number", Category: "retention", Description: strPtr("清理时单条 DELETE 最多删除的行数")},
+		{Key: "billing.model_prices", Scope: "system", Value: map[string]map[string]float64{
+			"claude-opus-4-5*":   {"input": 5, "output": 25},
+			"claude-opus-4*":     {"input": 15, "output": 75},
+			"claude-sonnet-4*":   {"input": 3, "output": 15},
+			"claude-3-7-sonnet*": {"input": 3, "output": 15},
+			"claude-3-5-sonnet*": {"input": 3, "output": 15},
+			"claude-haiku-4-5*":  {"input": 1, "output": 5},
+			"claude-3-5-haiku*":  {"input": 0.8, "output": 4},
+			"claude-3-haiku*":    {"input": 0.25, "output": 1.25},
+		}, DataType: "object", Category: "billing", Description: strPtr("模型价格表（美元/百万 token）：键为模型名，* 结尾按前缀匹配；cache_write/cache_read 缺省为 input 的 1.25 倍/0.1 倍")},
+		{Key: "proxy.lb_strategy", Scope: "system", Value: "priority", DataType: "string", Category: "performance", Description: strPtr("节点选择策略：priority/weighted_round_robin/least_inflight/ewma_latency")},
 	}
 
 	for _, d := range defaults {
@@ -64,7 +100,7 @@ func (s *Store) SeedDefaultSettings() error {
 		if category == "" {
 			category = "general"
 		}
-		if _, err := s.db.ExecContext(ctx, "INSERT IGNORE INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version) VALUES (?,?,?,?,?,?,?,?,1)",
+		if _, err := s.db.ExecContext(ctx, s.dialect.insertIgnore()+" settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version) VALUES (?,?,?,?,?,?,?,?,1)",
 			d.Key, d.Scope, nil, body, dataType, category, nullOrStringPtr(d.Description), d.IsSecret); err != nil {
 			return err
 		}
@@ -73,7 +109,7 @@ func (s *Store) SeedDefaultSettings() error {
 }
 
 // ListSettings 获取配置列表，支持 scope/category/account_id 过滤。
-func (s *Store) ListSettings(scope, category, accountID string) ([]Setting, error) {
+func (s *sqlStore) ListSettings(scope, category, accountID string) ([]Setting, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
@@ -115,7 +151,7 @@ func (s *Store) ListSettings(scope, category, accountID string) ([]Setting, erro
 }
 
 // GetSetting 获取单个配置。
-func (s *Store) GetSetting(key, scope, accountID string) (*Setting, error) {
+func (s *sqlStore) GetSetting(key, scope, accountID string) (*Setting, error) {
 	if key == "" {
 		return nil, errors.New("key required")
 	}
@@ -123,13 +159,13 @@ func (s *Store) GetSetting(key, scope, accountID string) (*Setting, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
-	row := s.db.QueryRowContext(ctx, "SELECT id,`key`,scope,account_id,value,data_type,category,description,is_secret,version,updated_by,updated_at,created_at FROM settings WHERE `key`=? AND scope=? AND account_id <=> ? LIMIT 1",
+	row := s.db.QueryRowContext(ctx, "SELECT id,`key`,scope,account_id,value,data_type,category,description,is_secret,version,updated_by,updated_at,created_at FROM settings WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ? LIMIT 1",
 		key, scope, accountArg(accountID))
 	return scanSetting(row)
 }
 
 // UpsertSetting 创建或更新配置（不检查版本，自动递增版本号）。
-func (s *Store) UpsertSetting(setting *Setting) error {
+func (s *sqlStore) UpsertSetting(setting *Setting) error {
 	if setting == nil {
 		return errors.New("setting is nil")
 	}
@@ -146,7 +182,7 @@ func (s *Store) UpsertSetting(setting *Setting) error {
 	defer cancel()
 	_, err = s.db.ExecContext(ctx, "INSERT INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version, updated_by) "+
 		"VALUES (?,?,?,?,?,?,?,?,1,?) "+
-		"ON DUPLICATE KEY UPDATE value=VALUES(value), data_type=VALUES(data_type), category=VALUES(category), description=VALUES(description), is_secret=VALUES(is_secret), updated_by=VALUES(updated_by), version=version+1",
+		s.dialect.onConflictUpdate("value", "data_type", "category", "description", "is_secret", "updated_by", "updated_at=CURRENT_TIMESTAMP", "version=version+1"),
 		setting.Key, setting.Scope, accountArgPtr(setting.AccountID), body, setting.DataType, setting.Category, nullOrStringPtr(setting.Description), setting.IsSecret, nullOrStringPtr(setting.UpdatedBy))
 	if err != nil {
 		return err
@@ -161,7 +197,7 @@ func (s *Store) UpsertSetting(setting *Setting) error {
 }
 
 // UpdateSetting 带版本检查的更新，版本不匹配返回 ErrVersionConflict。
-func (s *Store) UpdateSetting(setting *Setting) error {
+func (s *sqlStore) UpdateSetting(setting *Setting) error {
 	if setting == nil {
 		return errors.New("setting is nil")
 	}
@@ -179,8 +215,8 @@ func (s *Store) UpdateSetting(setting *Setting) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, "UPDATE settings SET value=?, data_type=?, category=?, description=?, is_secret=?, updated_by=?, version=version+1 "+
-		"WHERE `key`=? AND scope=? AND account_id <=> ? AND version=?",
+	res, err := s.db.ExecContext(ctx, "UPDATE settings SET value=?, data_type=?, category=?, description=?, is_secret=?, updated_by=?, updated_at=CURRENT_TIMESTAMP, version=version+1 "+
+		"WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ? AND version=?",
 		body, setting.DataType, setting.Category, nullOrStringPtr(setting.Description), setting.IsSecret, nullOrStringPtr(setting.UpdatedBy),
 		setting.Key, setting.Scope, accountArgPtr(setting.AccountID), setting.Version)
 	if err != nil {
@@ -207,14 +243,14 @@ func (s *Store) UpdateSetting(setting *Setting) error {
 }
 
 // DeleteSetting 删除配置。
-func (s *Store) DeleteSetting(key, scope, accountID string) error {
+func (s *sqlStore) DeleteSetting(key, scope, accountID string) error {
 	if key == "" {
 		return errors.New("key required")
 	}
 	scope = normalizeScope(scope)
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, "DELETE FROM settings WHERE `key`=? AND scope=? AND account_id <=> ?", key, scope, accountArg(accountID))
+	res, err := s.db.ExecContext(ctx, "DELETE FROM settings WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ?", key, scope, accountArg(accountID))
 	if err != nil {
 		return err
 	}
@@ -225,7 +261,7 @@ func (s *Store) DeleteSetting(key, scope, accountID string) error {
 }
 
 // BatchUpdateSettings 批量更新（事务）。
-func (s *Store) BatchUpdateSettings(settings []Setting) error {
+func (s *sqlStore) BatchUpdateSettings(settings []Setting) error {
 	if len(settings) == 0 {
 		return nil
 	}
@@ -243,8 +279,8 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 			return fmt.Errorf("marshal setting %s: %w", settings[i].Key, err)
 		}
 		if settings[i].Version > 0 {
-			res, err := tx.ExecContext(ctx, "UPDATE settings SET value=?, data_type=?, category=?, description=?, is_secret=?, updated_by=?, version=version+1 "+
-				"WHERE `key`=? AND scope=? AND account_id <=> ? AND version=?",
+			res, err := tx.ExecContext(ctx, "UPDATE settings SET value=?, data_type=?, category=?, description=?, is_secret=?, updated_by=?, updated_at=CURRENT_TIMESTAMP, version=version+1 "+
+				"WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ? AND version=?",
 				body, settings[i].DataType, settings[i].Category, nullOrStringPtr(settings[i].Description), settings[i].IsSecret, nullOrStringPtr(settings[i].UpdatedBy),
 				settings[i].Key, settings[i].Scope, accountArgPtr(settings[i].AccountID), settings[i].Version)
 			if err != nil {
@@ -267,7 +303,7 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 		} else {
 			if _, err := tx.ExecContext(ctx, "INSERT INTO settings (`key`, scope, account_id, value, data_type, category, description, is_secret, version, updated_by) "+
 				"VALUES (?,?,?,?,?,?,?,?,1,?) "+
-				"ON DUPLICATE KEY UPDATE value=VALUES(value), data_type=VALUES(data_type), category=VALUES(category), description=VALUES(description), is_secret=VALUES(is_secret), updated_by=VALUES(updated_by), version=version+1",
+				s.dialect.onConflictUpdate("value", "data_type", "category", "description", "is_secret", "updated_by", "updated_at=CURRENT_TIMESTAMP", "version=version+1"),
 				settings[i].Key, settings[i].Scope, accountArgPtr(settings[i].AccountID), body, settings[i].DataType, settings[i].Category, nullOrStringPtr(settings[i].Description), settings[i].IsSecret, nullOrStringPtr(settings[i].UpdatedBy)); err != nil {
 				tx.Rollback()
 				return err
@@ -281,7 +317,7 @@ func (s *Store) BatchUpdateSettings(settings []Setting) error {
 }
 
 // GetGlobalVersion 返回全局最大版本号。
-func (s *Store) GetGlobalVersion() (int64, error) {
+func (s *sqlStore) GetGlobalVersion() (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 	var version sql.NullInt64
@@ -395,8 +431,8 @@ func normalizeSetting(s *Setting) {
 	}
 }
 
-func (s *Store) settingExists(ctx context.Context, key, scope string, account interface{}) (bool, error) {
-	row := s.db.QueryRowContext(ctx, "SELECT COUNT(1) > 0 FROM settings WHERE `key`=? AND scope=? AND account_id <=> ?", key, scope, account)
+func (s *sqlStore) settingExists(ctx context.Context, key, scope string, account interface{}) (bool, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT COUNT(1) > 0 FROM settings WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ?", key, scope, account)
 	var ok bool
 	if err := row.Scan(&ok); err != nil {
 		return false, err
@@ -404,8 +440,8 @@ func (s *Store) settingExists(ctx context.Context, key, scope string, account in
 	return ok, nil
 }
 
-func (s *Store) settingExistsTx(ctx context.Context, tx *sql.Tx, key, scope string, account interface{}) (bool, error) {
-	row := tx.QueryRowContext(ctx, "SELECT COUNT(1) > 0 FROM settings WHERE `key`=? AND scope=? AND account_id <=> ?", key, scope, account)
+func (s *sqlStore) settingExistsTx(ctx context.Context, tx *sql.Tx, key, scope string, account interface{}) (bool, error) {
+	row := tx.QueryRowContext(ctx, "SELECT COUNT(1) > 0 FROM settings WHERE `key`=? AND scope=? AND account_id "+s.dialect.nullSafeEq()+" ?", key, scope, account)
 	var ok bool
 	if err := row.Scan(&ok); err != nil {
 		return false, err
@@ -3,10 +3,15 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
 	"time"
 )
 
-func (s *Store) UpsertNode(ctx context.Context, r NodeRecord) error {
+// nodeColumns nodes 表读写列顺序，与 scanNode 保持一致。
+const nodeColumns = `id,name,base_url,api_key,health_check_method,health_check_model,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at,supported_models,model_map,health_probes,price_multiplier`
+
+func (s *sqlStore) UpsertNode(ctx context.Context, r NodeRecord) error {
 	r.AccountID = normalizeAccount(r.AccountID)
 	if r.HealthCheckMethod == "" {
 		r.HealthCheckMethod = "api"
@@ -17,6 +22,9 @@ func (s *Store) UpsertNode(ctx context.Context, r NodeRecord) error {
 	if r.CreatedAt.IsZero() {
 		r.CreatedAt = time.Now()
 	}
+	if r.PriceMultiplier <= 0 {
+		r.PriceMultiplier = 1
+	}
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	healthAt := sql.NullTime{}
@@ -24,67 +32,88 @@ func (s *Store) UpsertNode(ctx context.Context, r NodeRecord) error {
 		healthAt.Valid = true
 		healthAt.Time = r.LastHealthCheckAt
 	}
-	_, err := s.db.ExecContext(ctx, `INSERT INTO nodes (id,name,base_url,api_key,health_check_method,health_check_model,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
-		ON DUPLICATE KEY UPDATE
-			name=VALUES(name),
-			base_url=VALUES(base_url),
-			api_key=VALUES(api_key),
-			health_check_method=VALUES(health_check_method),
-			health_check_model=VALUES(health_check_model),
-			account_id=VALUES(account_id),
-			weight=VALUES(weight),
-			failed=VALUES(failed),
-			disabled=VALUES(disabled),
-			last_error=VALUES(last_error),
-			requests=VALUES(requests),
-			fail_count=VALUES(fail_count),
-			fail_streak=VALUES(fail_streak),
-			total_bytes=VALUES(total_bytes),
-			total_input=VALUES(total_input),
-			total_output=VALUES(total_output),
-			stream_dur_ms=VALUES(stream_dur_ms),
-			first_byte_ms=VALUES(first_byte_ms),
-			last_ping_ms=VALUES(last_ping_ms),
-			last_ping_err=VALUES(last_ping_err),
-			last_health_check_at=VALUES(last_health_check_at)`,
-		r.ID, r.Name, r.BaseURL, r.APIKey, r.HealthCheckMethod, r.HealthCheckModel, r.AccountID, r.Weight, r.Failed, r.Disabled, r.LastError, r.CreatedAt, r.Requests, r.FailCount, r.FailStreak, r.TotalBytes, r.TotalInput, r.TotalOutput, r.StreamDurMs, r.FirstByteMs, r.LastPingMs, r.LastPingErr, healthAt)
+	modelMap, err := encodeModelMap(r.ModelMap)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO nodes (`+nodeColumns+`)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		`+s.dialect.onConflictUpdate("name", "base_url", "api_key", "health_check_method", "health_check_model", "account_id",
+		"weight", "failed", "disabled", "last_error", "requests", "fail_count", "fail_streak", "total_bytes", "total_input",
+		"total_output", "stream_dur_ms", "first_byte_ms", "last_ping_ms", "last_ping_err", "last_health_check_at",
+		"supported_models", "model_map", "health_probes", "price_multiplier"),
+		r.ID, r.Name, r.BaseURL, r.APIKey, r.HealthCheckMethod, r.HealthCheckModel, r.AccountID, r.Weight, r.Failed, r.Disabled, r.LastError, r.CreatedAt, r.Requests, r.FailCount, r.FailStreak, r.TotalBytes, r.TotalInput, r.TotalOutput, r.StreamDurMs, r.FirstByteMs, r.LastPingMs, r.LastPingErr, healthAt,
+		strings.Join(r.SupportedModels, ","), modelMap, nullOrString(string(r.HealthProbes)), r.PriceMultiplier)
 	return err
 }
 
-func (s *Store) GetNodesByAccount(ctx context.Context, accountID string) ([]NodeRecord, error) {
+func (s *sqlStore) GetNodesByAccount(ctx context.Context, accountID string) ([]NodeRecord, error) {
 	accountID = normalizeAccount(accountID)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	rows, err := s.db.QueryContext(ctx, `SELECT id,name,base_url,api_key,health_check_method,health_check_model,account_id,weight,failed,disabled,last_error,created_at,requests,fail_count,fail_streak,total_bytes,total_input,total_output,stream_dur_ms,first_byte_ms,last_ping_ms,last_ping_err,last_health_check_at FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+nodeColumns+` FROM nodes WHERE account_id=? ORDER BY weight ASC, created_at ASC`, accountID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var records []NodeRecord
 	for rows.Next() {
-		var r NodeRecord
-		var lastHealthAt sql.NullTime
-		if err := rows.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.HealthCheckModel, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt); err != nil {
+		r, err := scanNode(rows)
+		if err != nil {
 			return nil, err
 		}
-		if r.HealthCheckMethod == "" {
-			r.HealthCheckMethod = "api"
-		}
-		if r.HealthCheckModel == "" {
-			r.HealthCheckModel = defaultHealthCheckModel
-		}
-		if lastHealthAt.Valid {
-			r.LastHealthCheckAt = lastHealthAt.Time
-		}
 		records = append(records, r)
 	}
 	return records, nil
 }
 
-func (s *Store) DeleteNode(ctx context.Context, id string) error {
+func (s *sqlStore) DeleteNode(ctx context.Context, id string) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	_, err := s.db.ExecContext(ctx, `DELETE FROM nodes WHERE id=?`, id)
 	return err
 }
+
+// scanNode 按 nodeColumns 顺序读取一行节点记录并补齐默认值。
+func scanNode(row rowScanner) (NodeRecord, error) {
+	var r NodeRecord
+	var lastHealthAt sql.NullTime
+	var supported, modelMap, probes sql.NullString
+	if err := row.Scan(&r.ID, &r.Name, &r.BaseURL, &r.APIKey, &r.HealthCheckMethod, &r.HealthCheckModel, &r.AccountID, &r.Weight, &r.Failed, &r.Disabled, &r.LastError, &r.CreatedAt, &r.Requests, &r.FailCount, &r.FailStreak, &r.TotalBytes, &r.TotalInput, &r.TotalOutput, &r.StreamDurMs, &r.FirstByteMs, &r.LastPingMs, &r.LastPingErr, &lastHealthAt, &supported, &modelMap, &probes, &r.PriceMultiplier); err != nil {
+		return r, err
+	}
+	if r.HealthCheckMethod == "" {
+		r.HealthCheckMethod = "api"
+	}
+	if r.HealthCheckModel == "" {
+		r.HealthCheckModel = defaultHealthCheckModel
+	}
+	if lastHealthAt.Valid {
+		r.LastHealthCheckAt = lastHealthAt.Time
+	}
+	if supported.Valid && supported.String != "" {
+		r.SupportedModels = strings.Split(supported.String, ",")
+	}
+	if modelMap.Valid && modelMap.String != "" {
+		if err := json.Unmarshal([]byte(modelMap.String), &r.ModelMap); err != nil {
+			return r, err
+		}
+	}
+	r.HealthProbes = rawJSON(probes)
+	if r.PriceMultiplier <= 0 {
+		r.PriceMultiplier = 1
+	}
+	return r, nil
+}
+
+// encodeModelMap 将模型映射序列化为 JSON，空映射存为空串。
+func encodeModelMap(m map[string]string) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
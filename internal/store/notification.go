@@ -3,12 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 )
 
 // CreateNotificationChannel 新建通知渠道。
-func (s *Store) CreateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error {
+func (s *sqlStore) CreateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error {
 	if rec.ID == "" || rec.AccountID == "" || rec.ChannelType == "" {
 		return errors.New("id, account_id, channel_type are required")
 	}
@@ -28,7 +29,7 @@ func (s *Store) CreateNotificationChannel(ctx context.Context, rec NotificationC
 }
 
 // UpdateNotificationChannel 更新渠道配置。
-func (s *Store) UpdateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error {
+func (s *sqlStore) UpdateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error {
 	if rec.ID == "" {
 		return errors.New("id required")
 	}
@@ -47,7 +48,7 @@ func (s *Store) UpdateNotificationChannel(ctx context.Context, rec NotificationC
 }
 
 // GetNotificationChannel 根据 ID 获取渠道。
-func (s *Store) GetNotificationChannel(ctx context.Context, id string) (*NotificationChannelRecord, error) {
+func (s *sqlStore) GetNotificationChannel(ctx context.Context, id string) (*NotificationChannelRecord, error) {
 	if id == "" {
 		return nil, errors.New("id required")
 	}
@@ -66,7 +67,7 @@ func (s *Store) GetNotificationChannel(ctx context.Context, id string) (*Notific
 }
 
 // ListNotificationChannels 返回账号的所有渠道。
-func (s *Store) ListNotificationChannels(ctx context.Context, accountID string) ([]NotificationChannelRecord, error) {
+func (s *sqlStore) ListNotificationChannels(ctx context.Context, accountID string) ([]NotificationChannelRecord, error) {
 	accountID = normalizeAccount(accountID)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
@@ -87,30 +88,32 @@ func (s *Store) ListNotificationChannels(ctx context.Context, accountID string)
 }
 
 // GetNotificationSubscription 根据 ID 获取订阅记录。
-func (s *Store) GetNotificationSubscription(ctx context.Context, id string) (*NotificationSubscriptionRecord, error) {
+func (s *sqlStore) GetNotificationSubscription(ctx context.Context, id string) (*NotificationSubscriptionRecord, error) {
 	if id == "" {
 		return nil, errors.New("id required")
 	}
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	var rec NotificationSubscriptionRecord
-	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,channel_id,event_type,enabled,created_at,updated_at FROM notification_subscriptions WHERE id=?`, id).
-		Scan(&rec.ID, &rec.AccountID, &rec.ChannelID, &rec.EventType, &rec.Enabled, &rec.CreatedAt, &rec.UpdatedAt)
+	var rules sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT id,account_id,channel_id,event_type,enabled,rules,created_at,updated_at FROM notification_subscriptions WHERE id=?`, id).
+		Scan(&rec.ID, &rec.AccountID, &rec.ChannelID, &rec.EventType, &rec.Enabled, &rules, &rec.CreatedAt, &rec.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	rec.Rules = rawJSON(rules)
 	return &rec, nil
 }
 
 // ListNotificationSubscriptions 返回账号下的订阅列表，可选按 channel 过滤。
-func (s *Store) ListNotificationSubscriptions(ctx context.Context, accountID, channelID string) ([]NotificationSubscriptionRecord, error) {
+func (s *sqlStore) ListNotificationSubscriptions(ctx context.Context, accountID, channelID string) ([]NotificationSubscriptionRecord, error) {
 	accountID = normalizeAccount(accountID)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	query := `SELECT id,account_id,channel_id,event_type,enabled,created_at,updated_at FROM notification_subscriptions WHERE account_id=?`
+	query := `SELECT id,account_id,channel_id,event_type,enabled,rules,created_at,updated_at FROM notification_subscriptions WHERE account_id=?`
 	args := []interface{}{accountID}
 	if channelID != "" {
 		query += " AND channel_id=?"
@@ -125,16 +128,18 @@ func (s *Store) ListNotificationSubscriptions(ctx context.Context, accountID, ch
 	var res []NotificationSubscriptionRecord
 	for rows.Next() {
 		var rec NotificationSubscriptionRecord
-		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.ChannelID, &rec.EventType, &rec.Enabled, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
+		var rules sql.NullString
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.ChannelID, &rec.EventType, &rec.Enabled, &rules, &rec.CreatedAt, &rec.UpdatedAt); err != nil {
 			return nil, err
 		}
+		rec.Rules = rawJSON(rules)
 		res = append(res, rec)
 	}
 	return res, nil
 }
 
 // DeleteNotificationSubscription 删除指定订阅。
-func (s *Store) DeleteNotificationSubscription(ctx context.Context, id string) error {
+func (s *sqlStore) DeleteNotificationSubscription(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
@@ -151,7 +156,7 @@ func (s *Store) DeleteNotificationSubscription(ctx context.Context, id string) e
 }
 
 // DeleteNotificationChannel 删除渠道及其订阅。
-func (s *Store) DeleteNotificationChannel(ctx context.Context, id string) error {
+func (s *sqlStore) DeleteNotificationChannel(ctx context.Context, id string) error {
 	if id == "" {
 		return errors.New("id required")
 	}
@@ -180,7 +185,7 @@ func (s *Store) DeleteNotificationChannel(ctx context.Context, id string) error
 }
 
 // UpsertNotificationSubscription 创建或更新订阅。
-func (s *Store) UpsertNotificationSubscription(ctx context.Context, rec NotificationSubscriptionRecord) error {
+func (s *sqlStore) UpsertNotificationSubscription(ctx context.Context, rec NotificationSubscriptionRecord) error {
 	if rec.ID == "" {
 		return errors.New("id required")
 	}
@@ -194,20 +199,19 @@ func (s *Store) UpsertNotificationSubscription(ctx context.Context, rec Notifica
 	rec.UpdatedAt = now
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_subscriptions (id,account_id,channel_id,event_type,enabled,created_at,updated_at)
-		VALUES (?,?,?,?,?,?,?)
-		ON DUPLICATE KEY UPDATE enabled=VALUES(enabled), updated_at=VALUES(updated_at)`,
-		rec.ID, rec.AccountID, rec.ChannelID, rec.EventType, rec.Enabled, rec.CreatedAt, rec.UpdatedAt)
+	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_subscriptions (id,account_id,channel_id,event_type,enabled,rules,created_at,updated_at)
+		VALUES (?,?,?,?,?,?,?,?) `+s.dialect.onConflictUpdate("enabled", "rules", "updated_at"),
+		rec.ID, rec.AccountID, rec.ChannelID, rec.EventType, rec.Enabled, nullOrString(string(rec.Rules)), rec.CreatedAt, rec.UpdatedAt)
 	return err
 }
 
 // ListEnabledSubscriptionsForEvent 返回账号对指定事件启用的订阅与渠道。
-func (s *Store) ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]SubscriptionWithChannel, error) {
+func (s *sqlStore) ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]SubscriptionWithChannel, error) {
 	accountID = normalizeAccount(accountID)
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 	rows, err := s.db.QueryContext(ctx, `
-SELECT ns.id, ns.account_id, ns.channel_id, ns.event_type, ns.enabled, ns.created_at, ns.updated_at,
+SELECT ns.id, ns.account_id, ns.channel_id, ns.event_type, ns.enabled, ns.rules, ns.created_at, ns.updated_at,
        nc.id, nc.account_id, nc.channel_type, nc.name, nc.config, nc.enabled, nc.created_at, nc.updated_at
 FROM notification_subscriptions ns
 JOIN notification_channels nc ON ns.channel_id = nc.id
@@ -220,19 +224,21 @@ WHERE ns.account_id=? AND ns.event_type=? AND ns.enabled=TRUE AND nc.enabled=TRU
 	for rows.Next() {
 		var sub NotificationSubscriptionRecord
 		var ch NotificationChannelRecord
+		var rules sql.NullString
 		if err := rows.Scan(
-			&sub.ID, &sub.AccountID, &sub.ChannelID, &sub.EventType, &sub.Enabled, &sub.CreatedAt, &sub.UpdatedAt,
+			&sub.ID, &sub.AccountID, &sub.ChannelID, &sub.EventType, &sub.Enabled, &rules, &sub.CreatedAt, &sub.UpdatedAt,
 			&ch.ID, &ch.AccountID, &ch.ChannelType, &ch.Name, &ch.Config, &ch.Enabled, &ch.CreatedAt, &ch.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
+		sub.Rules = rawJSON(rules)
 		res = append(res, SubscriptionWithChannel{Subscription: sub, Channel: ch})
 	}
 	return res, nil
 }
 
 // InsertNotificationHistory 写入通知历史。
-func (s *Store) InsertNotificationHistory(ctx context.Context, rec NotificationHistoryRecord) error {
+func (s *sqlStore) InsertNotificationHistory(ctx context.Context, rec NotificationHistoryRecord) error {
 	if rec.ID == "" {
 		return errors.New("id required")
 	}
@@ -251,3 +257,11 @@ func (s *Store) InsertNotificationHistory(ctx context.Context, rec NotificationH
 		rec.ID, rec.AccountID, rec.ChannelID, rec.EventType, rec.Title, rec.Content, rec.Status, nullOrString(rec.Error), rec.SentAt, rec.CreatedAt)
 	return err
 }
+
+// rawJSON 将可空 JSON 文本列转换为 json.RawMessage，NULL 或空串返回 nil。
+func rawJSON(v sql.NullString) json.RawMessage {
+	if !v.Valid || v.String == "" {
+		return nil
+	}
+	return json.RawMessage(v.String)
+}
@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 通知发件箱状态。
+const (
+	OutboxStatusPending = "pending" // 等待重试
+	OutboxStatusSending = "sending" // 已被某个实例认领、正在投递，locked_until 过期后可被重新认领
+	OutboxStatusSent    = "sent"    // 重试或手动重发成功
+	OutboxStatusDead    = "dead"    // 超过最大重试次数，需人工处理
+)
+
+// NotificationOutboxRecord 发送失败、等待重试的通知。
+type NotificationOutboxRecord struct {
+	ID            string
+	AccountID     string
+	ChannelID     string
+	EventType     string
+	Title         string
+	Content       string
+	Language      string
+	OccurredAt    time.Time
+	Status        string
+	Attempts      int
+	MaxAttempts   int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NotificationOutboxQuery 发件箱查询条件，零值字段不参与过滤。
+type NotificationOutboxQuery struct {
+	AccountID string
+	Status    string
+	Limit     int
+	Offset    int
+}
+
+// NotificationOutboxStore 通知发件箱存储接口。
+type NotificationOutboxStore interface {
+	InsertNotificationOutbox(ctx context.Context, rec NotificationOutboxRecord) error
+	// UpdateNotificationOutbox 更新状态、重试次数、下次重试时间与错误信息。
+	UpdateNotificationOutbox(ctx context.Context, rec NotificationOutboxRecord) error
+	// ClaimNotificationOutbox 原子地把状态仍为 status（或认领已过期的 sending）的记录置为 sending 并加锁到 lockUntil；
+	// 返回 false 表示记录已被其他实例认领或已发送。
+	ClaimNotificationOutbox(ctx context.Context, id, status string, now, lockUntil time.Time) (bool, error)
+	GetNotificationOutbox(ctx context.Context, id string) (*NotificationOutboxRecord, error)
+	// ListDueNotificationOutbox 返回 next_attempt_at 不晚于 now 的 pending 记录及认领已过期的 sending 记录，按到期时间升序。
+	ListDueNotificationOutbox(ctx context.Context, now time.Time, limit int) ([]NotificationOutboxRecord, error)
+	// QueryNotificationOutbox 按创建时间倒序分页查询；同时返回满足条件的总数。
+	QueryNotificationOutbox(ctx context.Context, q NotificationOutboxQuery) ([]NotificationOutboxRecord, int64, error)
+}
+
+const (
+	defaultOutboxLimit = 50
+	maxOutboxLimit     = 500
+)
+
+// ensureNotificationOutboxTable 创建 notification_outbox 表。
+func (s *sqlStore) ensureNotificationOutboxTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS notification_outbox (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		channel_id VARCHAR(64) NOT NULL,
+		event_type VARCHAR(128) NOT NULL,
+		title VARCHAR(255),
+		content TEXT,
+		language VARCHAR(8) NOT NULL DEFAULT '',
+		occurred_at DATETIME NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		max_attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT,
+		locked_until DATETIME NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "notification_outbox", "locked_until", "DATETIME NULL"); err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "notification_outbox", "idx_outbox_status_next", "status, next_attempt_at", false); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "notification_outbox", "idx_outbox_account_created", "account_id, created_at", false)
+}
+
+// InsertNotificationOutbox 写入一条待重试通知。
+func (s *sqlStore) InsertNotificationOutbox(ctx context.Context, rec NotificationOutboxRecord) error {
+	if rec.ID == "" {
+		return errors.New("id required")
+	}
+	if rec.ChannelID == "" || rec.EventType == "" {
+		return errors.New("channel_id, event_type are required")
+	}
+	now := time.Now()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = rec.CreatedAt
+	}
+	if rec.OccurredAt.IsZero() {
+		rec.OccurredAt = rec.CreatedAt
+	}
+	if rec.NextAttemptAt.IsZero() {
+		rec.NextAttemptAt = now
+	}
+	if rec.Status == "" {
+		rec.Status = OutboxStatusPending
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO notification_outbox
+		(id, account_id, channel_id, event_type, title, content, language, occurred_at, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.ID, normalizeAccount(rec.AccountID), rec.ChannelID, rec.EventType, rec.Title, rec.Content, rec.Language, rec.OccurredAt.UTC(),
+		rec.Status, rec.Attempts, rec.MaxAttempts, rec.NextAttemptAt.UTC(), nullOrString(rec.LastError), rec.CreatedAt.UTC(), rec.UpdatedAt.UTC())
+	return err
+}
+
+// UpdateNotificationOutbox 更新发件箱记录的投递状态。
+func (s *sqlStore) UpdateNotificationOutbox(ctx context.Context, rec NotificationOutboxRecord) error {
+	if rec.ID == "" {
+		return errors.New("id required")
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now()
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE notification_outbox SET status=?, attempts=?, max_attempts=?, next_attempt_at=?, last_error=?, locked_until=NULL, updated_at=? WHERE id=?`,
+		rec.Status, rec.Attempts, rec.MaxAttempts, rec.NextAttemptAt.UTC(), nullOrString(rec.LastError), rec.UpdatedAt.UTC(), rec.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimNotificationOutbox 认领一条待投递记录，多实例共享数据库时保证同一记录只被一个实例发送。
+func (s *sqlStore) ClaimNotificationOutbox(ctx context.Context, id, status string, now, lockUntil time.Time) (bool, error) {
+	if id == "" {
+		return false, errors.New("id required")
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE notification_outbox SET status=?, locked_until=?, updated_at=?
+		WHERE id=? AND ((status=? AND status NOT IN (?, ?)) OR (status=? AND (locked_until IS NULL OR locked_until<=?)))`,
+		OutboxStatusSending, lockUntil.UTC(), now.UTC(),
+		id, status, OutboxStatusSending, OutboxStatusSent, OutboxStatusSending, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+const outboxColumns = `id, account_id, channel_id, event_type, title, content, language, occurred_at, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at`
+
+func scanOutbox(row rowScanner) (NotificationOutboxRecord, error) {
+	var rec NotificationOutboxRecord
+	var title, content, lastErr sql.NullString
+	err := row.Scan(&rec.ID, &rec.AccountID, &rec.ChannelID, &rec.EventType, &title, &content, &rec.Language, &rec.OccurredAt,
+		&rec.Status, &rec.Attempts, &rec.MaxAttempts, &rec.NextAttemptAt, &lastErr, &rec.CreatedAt, &rec.UpdatedAt)
+	rec.Title, rec.Content, rec.LastError = title.String, content.String, lastErr.String
+	return rec, err
+}
+
+// GetNotificationOutbox 读取单条发件箱记录；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetNotificationOutbox(ctx context.Context, id string) (*NotificationOutboxRecord, error) {
+	if id == "" {
+		return nil, errors.New("id required")
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rec, err := scanOutbox(s.db.QueryRowContext(ctx, `SELECT `+outboxColumns+` FROM notification_outbox WHERE id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListDueNotificationOutbox 列出已到重试时间的 pending 记录。
+func (s *sqlStore) ListDueNotificationOutbox(ctx context.Context, now time.Time, limit int) ([]NotificationOutboxRecord, error) {
+	if limit <= 0 {
+		limit = defaultOutboxLimit
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT `+outboxColumns+` FROM notification_outbox
+		WHERE (status=? AND next_attempt_at<=?) OR (status=? AND (locked_until IS NULL OR locked_until<=?))
+		ORDER BY next_attempt_at ASC LIMIT ?`, OutboxStatusPending, now.UTC(), OutboxStatusSending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []NotificationOutboxRecord
+	for rows.Next() {
+		rec, err := scanOutbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// QueryNotificationOutbox 分页查询发件箱。
+func (s *sqlStore) QueryNotificationOutbox(ctx context.Context, q NotificationOutboxQuery) ([]NotificationOutboxRecord, int64, error) {
+	var conds []string
+	var args []any
+	if q.AccountID != "" {
+		conds = append(conds, "account_id=?")
+		args = append(args, q.AccountID)
+	}
+	if q.Status != "" {
+		conds = append(conds, "status=?")
+		args = append(args, q.Status)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultOutboxLimit
+	}
+	if limit > maxOutboxLimit {
+		limit = maxOutboxLimit
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notification_outbox`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+outboxColumns+` FROM notification_outbox`+where+
+		` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := make([]NotificationOutboxRecord, 0)
+	for rows.Next() {
+		rec, err := scanOutbox(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, rec)
+	}
+	return out, total, rows.Err()
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配额用量统计周期。
+const (
+	QuotaPeriodDay   = "day"
+	QuotaPeriodMonth = "month"
+)
+
+// AccountQuotaRecord 账号级限流与 token 配额，0 表示不限制。
+type AccountQuotaRecord struct {
+	AccountID      string
+	RPM            int   // 每分钟请求数
+	MaxConcurrency int   // 最大并发请求数
+	DailyTokens    int64 // 每日 input+output token 预算
+	MonthlyTokens  int64 // 每月 input+output token 预算
+	WarnThresholds []int // 告警阈值百分比，为空时使用系统配置 quota.warn_thresholds
+	UpdatedAt      time.Time
+}
+
+// AccountUsageRecord 账号在某个统计周期内的 token 用量。
+type AccountUsageRecord struct {
+	AccountID    string
+	Period       string // day/month
+	PeriodKey    string // 如 2025-01-02 / 2025-01（北京时间）
+	InputTokens  int64
+	OutputTokens int64
+	WarnedPct    int // 本周期已告警的最高阈值
+	UpdatedAt    time.Time
+}
+
+// QuotaStore 账号配额与用量存储接口。
+type QuotaStore interface {
+	GetAccountQuota(ctx context.Context, accountID string) (*AccountQuotaRecord, error)
+	ListAccountQuotas(ctx context.Context) ([]AccountQuotaRecord, error)
+	UpsertAccountQuota(ctx context.Context, rec AccountQuotaRecord) error
+	DeleteAccountQuota(ctx context.Context, accountID string) error
+	AddAccountUsage(ctx context.Context, accountID, period, periodKey string, input, output int64) error
+	GetAccountUsage(ctx context.Context, accountID, period, periodKey string) (*AccountUsageRecord, error)
+	MarkQuotaWarned(ctx context.Context, accountID, period, periodKey string, pct int) error
+}
+
+// ensureQuotaTables 创建配额与用量表，DDL 在两种方言下通用。
+func (s *sqlStore) ensureQuotaTables(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS account_quotas (
+		account_id VARCHAR(64) PRIMARY KEY,
+		rpm_limit INT NOT NULL DEFAULT 0,
+		concurrency_limit INT NOT NULL DEFAULT 0,
+		daily_token_limit BIGINT NOT NULL DEFAULT 0,
+		monthly_token_limit BIGINT NOT NULL DEFAULT 0,
+		warn_thresholds VARCHAR(64) NOT NULL DEFAULT '',
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+		`CREATE TABLE IF NOT EXISTS account_usage (
+		account_id VARCHAR(64) NOT NULL,
+		period VARCHAR(8) NOT NULL,
+		period_key VARCHAR(16) NOT NULL,
+		input_tokens BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		warned_pct INT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (account_id, period, period_key)
+	)`,
+	}
+	for _, stmt := range stmts {
+		ectx, cancel := withTimeout(ctx)
+		_, err := s.db.ExecContext(ectx, stmt)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAccountQuota 读取账号配额；未配置时返回 ErrNotFound。
+func (s *sqlStore) GetAccountQuota(ctx context.Context, accountID string) (*AccountQuotaRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, `SELECT account_id, rpm_limit, concurrency_limit, daily_token_limit, monthly_token_limit, warn_thresholds, updated_at
+		FROM account_quotas WHERE account_id=?`, normalizeAccount(accountID))
+	rec, err := scanAccountQuota(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+// ListAccountQuotas 返回所有已配置配额的账号。
+func (s *sqlStore) ListAccountQuotas(ctx context.Context) ([]AccountQuotaRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT account_id, rpm_limit, concurrency_limit, daily_token_limit, monthly_token_limit, warn_thresholds, updated_at
+		FROM account_quotas ORDER BY account_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AccountQuotaRecord
+	for rows.Next() {
+		rec, err := scanAccountQuota(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rec)
+	}
+	return out, rows.Err()
+}
+
+// UpsertAccountQuota 写入或覆盖账号配额。
+func (s *sqlStore) UpsertAccountQuota(ctx context.Context, rec AccountQuotaRecord) error {
+	if rec.AccountID == "" {
+		return errors.New("account_id required")
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_quotas (account_id, rpm_limit, concurrency_limit, daily_token_limit, monthly_token_limit, warn_thresholds, updated_at)
+		VALUES (?,?,?,?,?,?,?) `+s.dialect.onConflictUpdate("rpm_limit", "concurrency_limit", "daily_token_limit", "monthly_token_limit", "warn_thresholds", "updated_at"),
+		normalizeAccount(rec.AccountID), rec.RPM, rec.MaxConcurrency, rec.DailyTokens, rec.MonthlyTokens, formatThresholds(rec.WarnThresholds), time.Now().UTC())
+	return err
+}
+
+// DeleteAccountQuota 删除账号配额（恢复为不限制），已累计的用量保留。
+func (s *sqlStore) DeleteAccountQuota(ctx context.Context, accountID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM account_quotas WHERE account_id=?`, normalizeAccount(accountID))
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddAccountUsage 累加账号在指定周期内的 token 用量。
+func (s *sqlStore) AddAccountUsage(ctx context.Context, accountID, period, periodKey string, input, output int64) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_usage (account_id, period, period_key, input_tokens, output_tokens, updated_at)
+		VALUES (?,?,?,?,?,?) `+s.dialect.onConflictUpdate(
+		"input_tokens=input_tokens+"+s.dialect.excluded("input_tokens"),
+		"output_tokens=output_tokens+"+s.dialect.excluded("output_tokens"),
+		"updated_at"),
+		normalizeAccount(accountID), period, periodKey, input, output, time.Now().UTC())
+	return err
+}
+
+// GetAccountUsage 读取周期用量；无记录时返回 ErrNotFound。
+func (s *sqlStore) GetAccountUsage(ctx context.Context, accountID, period, periodKey string) (*AccountUsageRecord, error) {
+	accountID = normalizeAccount(accountID)
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rec := &AccountUsageRecord{AccountID: accountID, Period: period, PeriodKey: periodKey}
+	err := s.db.QueryRowContext(ctx, `SELECT input_tokens, output_tokens, warned_pct, updated_at FROM account_usage
+		WHERE account_id=? AND period=? AND period_key=?`, accountID, period, periodKey).
+		Scan(&rec.InputTokens, &rec.OutputTokens, &rec.WarnedPct, &rec.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// MarkQuotaWarned 记录本周期已告警的阈值，避免重启后重复告警。
+func (s *sqlStore) MarkQuotaWarned(ctx context.Context, accountID, period, periodKey string, pct int) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_usage (account_id, period, period_key, warned_pct, updated_at)
+		VALUES (?,?,?,?,?) `+s.dialect.onConflictUpdate("warned_pct", "updated_at"),
+		normalizeAccount(accountID), period, periodKey, pct, time.Now().UTC())
+	return err
+}
+
+func scanAccountQuota(row rowScanner) (*AccountQuotaRecord, error) {
+	var (
+		rec        AccountQuotaRecord
+		thresholds string
+	)
+	if err := row.Scan(&rec.AccountID, &rec.RPM, &rec.MaxConcurrency, &rec.DailyTokens, &rec.MonthlyTokens, &thresholds, &rec.UpdatedAt); err != nil {
+		return nil, err
+	}
+	rec.WarnThresholds = parseThresholds(thresholds)
+	return &rec, nil
+}
+
+// formatThresholds/parseThresholds 以逗号分隔的百分比形式存储告警阈值。
+func formatThresholds(values []int) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, strconv.Itoa(v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseThresholds(raw string) []int {
+	var out []int
+	for _, part := range strings.Split(raw, ",") {
+		if v, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && v > 0 {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// RequestLogRecord 单次代理请求的审计日志。
+type RequestLogRecord struct {
+	ID           int64
+	CreatedAt    time.Time
+	AccountID    string
+	APIKeyID     string
+	NodeID       string
+	Model        string
+	Stream       bool
+	StatusCode   int
+	LatencyMs    int64
+	FirstByteMs  int64
+	InputTokens  int64
+	OutputTokens int64
+	RetryCount   int
+	Error        string
+	RequestBody  string // 截断并脱敏后的请求体，未开启采集时为空
+	ResponseBody string // 截断并脱敏后的响应体，未开启采集时为空
+}
+
+// RequestLogQuery 请求日志查询条件，零值字段不参与过滤。
+type RequestLogQuery struct {
+	AccountID  string
+	APIKeyID   string
+	NodeID     string
+	Model      string
+	StatusCode int
+	ErrorsOnly bool // 仅返回非 200 请求
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+// RequestLogStore 请求日志存储接口。
+type RequestLogStore interface {
+	InsertRequestLog(ctx context.Context, rec RequestLogRecord) error
+	// QueryRequestLogs 按时间倒序分页查询，结果不含请求/响应体；同时返回满足条件的总数。
+	QueryRequestLogs(ctx context.Context, q RequestLogQuery) ([]RequestLogRecord, int64, error)
+	GetRequestLog(ctx context.Context, id int64) (*RequestLogRecord, error)
+	CleanupRequestLogs(ctx context.Context, before time.Time) (int64, error)
+}
+
+const (
+	defaultRequestLogLimit = 50
+	maxRequestLogLimit     = 500
+)
+
+// ensureRequestLogsTable 创建 request_logs 表；MEDIUMTEXT 在 SQLite 中按 TEXT 亲和处理。
+func (s *sqlStore) ensureRequestLogsTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS request_logs (
+		`+s.dialect.autoIncrementPK()+`,
+		created_at DATETIME NOT NULL,
+		account_id VARCHAR(64) NOT NULL,
+		api_key_id VARCHAR(64) NOT NULL DEFAULT '',
+		node_id VARCHAR(64) NOT NULL DEFAULT '',
+		model VARCHAR(128) NOT NULL DEFAULT '',
+		stream BOOLEAN NOT NULL DEFAULT FALSE,
+		status_code INT NOT NULL DEFAULT 0,
+		latency_ms BIGINT NOT NULL DEFAULT 0,
+		first_byte_ms BIGINT NOT NULL DEFAULT 0,
+		input_tokens BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		retry_count INT NOT NULL DEFAULT 0,
+		error_message TEXT,
+		request_body MEDIUMTEXT,
+		response_body MEDIUMTEXT
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "request_logs", "idx_request_logs_created", "created_at", false); err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "request_logs", "idx_request_logs_account_created", "account_id, created_at", false); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "request_logs", "idx_request_logs_node_created", "node_id, created_at", false)
+}
+
+// InsertRequestLog 写入一条请求日志。
+func (s *sqlStore) InsertRequestLog(ctx context.Context, rec RequestLogRecord) error {
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO request_logs (created_at, account_id, api_key_id, node_id, model, stream, status_code,
+		latency_ms, first_byte_ms, input_tokens, output_tokens, retry_count, error_message, request_body, response_body)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		rec.CreatedAt.UTC(), normalizeAccount(rec.AccountID), rec.APIKeyID, rec.NodeID, rec.Model, rec.Stream, rec.StatusCode,
+		rec.LatencyMs, rec.FirstByteMs, rec.InputTokens, rec.OutputTokens, rec.RetryCount, rec.Error, rec.RequestBody, rec.ResponseBody)
+	return err
+}
+
+// QueryRequestLogs 分页查询请求日志。
+func (s *sqlStore) QueryRequestLogs(ctx context.Context, q RequestLogQuery) ([]RequestLogRecord, int64, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if q.AccountID != "" {
+		add("account_id=?", q.AccountID)
+	}
+	if q.APIKeyID != "" {
+		add("api_key_id=?", q.APIKeyID)
+	}
+	if q.NodeID != "" {
+		add("node_id=?", q.NodeID)
+	}
+	if q.Model != "" {
+		add("model=?", q.Model)
+	}
+	if q.StatusCode != 0 {
+		add("status_code=?", q.StatusCode)
+	}
+	if q.ErrorsOnly {
+		add("status_code<>?", 200)
+	}
+	if !q.From.IsZero() {
+		add("created_at>=?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		add("created_at<?", q.To.UTC())
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultRequestLogLimit
+	}
+	if limit > maxRequestLogLimit {
+		limit = maxRequestLogLimit
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM request_logs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, created_at, account_id, api_key_id, node_id, model, stream, status_code,
+		latency_ms, first_byte_ms, input_tokens, output_tokens, retry_count, error_message
+		FROM request_logs`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := make([]RequestLogRecord, 0)
+	for rows.Next() {
+		var rec RequestLogRecord
+		var errMsg sql.NullString
+		if err := rows.Scan(&rec.ID, &rec.CreatedAt, &rec.AccountID, &rec.APIKeyID, &rec.NodeID, &rec.Model, &rec.Stream, &rec.StatusCode,
+			&rec.LatencyMs, &rec.FirstByteMs, &rec.InputTokens, &rec.OutputTokens, &rec.RetryCount, &errMsg); err != nil {
+			return nil, 0, err
+		}
+		rec.Error = errMsg.String
+		out = append(out, rec)
+	}
+	return out, total, rows.Err()
+}
+
+// GetRequestLog 读取单条请求日志（含请求/响应体）；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetRequestLog(ctx context.Context, id int64) (*RequestLogRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var rec RequestLogRecord
+	var errMsg, reqBody, respBody sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT id, created_at, account_id, api_key_id, node_id, model, stream, status_code,
+		latency_ms, first_byte_ms, input_tokens, output_tokens, retry_count, error_message, request_body, response_body
+		FROM request_logs WHERE id=?`, id).Scan(&rec.ID, &rec.CreatedAt, &rec.AccountID, &rec.APIKeyID, &rec.NodeID, &rec.Model, &rec.Stream,
+		&rec.StatusCode, &rec.LatencyMs, &rec.FirstByteMs, &rec.InputTokens, &rec.OutputTokens, &rec.RetryCount, &errMsg, &reqBody, &respBody)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.Error, rec.RequestBody, rec.ResponseBody = errMsg.String, reqBody.String, respBody.String
+	return &rec, nil
+}
+
+// CleanupRequestLogs 删除 before 之前的请求日志，返回删除行数。
+func (s *sqlStore) CleanupRequestLogs(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM request_logs WHERE created_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
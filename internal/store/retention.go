@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 默认保留天数，对应 retention.* 系统设置的初始值；月度汇总默认永久保留。
+const (
+	defaultRetentionMetricsRawDays    = 7
+	defaultRetentionMetricsHourlyDays = 30
+	defaultRetentionMetricsDailyDays  = 365
+	defaultRetentionHealthHistoryDays = 30
+	defaultRetentionNotificationDays  = 90
+	defaultRetentionMonitorShareDays  = 30
+	defaultRetentionDeleteBatchSize   = 5000
+	// retentionMaxBatches 单表单次清理的批次上限，剩余数据留待下一轮。
+	retentionMaxBatches = 10000
+)
+
+// RetentionPolicy 数据保留策略，单位为天，0 表示永久保留。
+type RetentionPolicy struct {
+	MetricsRawDays          int `json:"metrics_raw_days"`
+	MetricsHourlyDays       int `json:"metrics_hourly_days"`
+	MetricsDailyDays        int `json:"metrics_daily_days"`
+	MetricsMonthlyDays      int `json:"metrics_monthly_days"`
+	HealthHistoryDays       int `json:"health_history_days"`
+	NotificationHistoryDays int `json:"notification_history_days"`
+	// MonitorShareDays 已过期或已撤销的分享链接再保留的天数。
+	MonitorShareDays int `json:"monitor_share_days"`
+	// BatchSize 单条 DELETE 最多删除的行数，避免长时间锁表；<=0 使用默认值。
+	BatchSize int `json:"batch_size,omitempty"`
+}
+
+// DefaultRetentionPolicy 返回内置默认保留策略。
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		MetricsRawDays:          defaultRetentionMetricsRawDays,
+		MetricsHourlyDays:       defaultRetentionMetricsHourlyDays,
+		MetricsDailyDays:        defaultRetentionMetricsDailyDays,
+		HealthHistoryDays:       defaultRetentionHealthHistoryDays,
+		NotificationHistoryDays: defaultRetentionNotificationDays,
+		MonitorShareDays:        defaultRetentionMonitorShareDays,
+		BatchSize:               defaultRetentionDeleteBatchSize,
+	}
+}
+
+// RetentionResult 一次清理各类数据删除的行数。
+type RetentionResult struct {
+	MetricsRaw          int64 `json:"metrics_raw"`
+	MetricsHourly       int64 `json:"metrics_hourly"`
+	MetricsDaily        int64 `json:"metrics_daily"`
+	MetricsMonthly      int64 `json:"metrics_monthly"`
+	HealthHistory       int64 `json:"health_history"`
+	NotificationHistory int64 `json:"notification_history"`
+	MonitorShares       int64 `json:"monitor_shares"`
+}
+
+// Total 返回删除总行数。
+func (r RetentionResult) Total() int64 {
+	return r.MetricsRaw + r.MetricsHourly + r.MetricsDaily + r.MetricsMonthly + r.HealthHistory + r.NotificationHistory + r.MonitorShares
+}
+
+// Add 累加另一次清理结果。
+func (r *RetentionResult) Add(o RetentionResult) {
+	r.MetricsRaw += o.MetricsRaw
+	r.MetricsHourly += o.MetricsHourly
+	r.MetricsDaily += o.MetricsDaily
+	r.MetricsMonthly += o.MetricsMonthly
+	r.HealthHistory += o.HealthHistory
+	r.NotificationHistory += o.NotificationHistory
+	r.MonitorShares += o.MonitorShares
+}
+
+// RetentionStore 数据保留清理接口。
+type RetentionStore interface {
+	// ApplyRetention 按策略分批删除过期数据；accountID 为空时作用于全部租户。
+	// 出错时返回已删除的行数与错误。
+	ApplyRetention(ctx context.Context, accountID string, policy RetentionPolicy, now time.Time) (RetentionResult, error)
+	// ApplyOrphanRetention 对 account_id 不在 knownAccountIDs 中的数据（如已删除账号遗留的记录）按策略清理。
+	ApplyOrphanRetention(ctx context.Context, knownAccountIDs []string, policy RetentionPolicy, now time.Time) (RetentionResult, error)
+}
+
+// ensureRetentionIndexes 为按账号与时间清理的表补充索引。
+func (s *sqlStore) ensureRetentionIndexes(ctx context.Context) error {
+	if err := s.ensureIndex(ctx, "health_check_history", "idx_account_check_time", "account_id, check_time", false); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "notification_history", "idx_history_account_created", "account_id, created_at", false)
+}
+
+// ApplyRetention 按策略分批删除过期数据。
+func (s *sqlStore) ApplyRetention(ctx context.Context, accountID string, policy RetentionPolicy, now time.Time) (RetentionResult, error) {
+	if accountID == "" {
+		return s.applyRetention(ctx, "", nil, policy, now)
+	}
+	return s.applyRetention(ctx, " AND account_id=?", []interface{}{normalizeAccount(accountID)}, policy, now)
+}
+
+// ApplyOrphanRetention 按策略清理不属于任何已知账号的过期数据。
+func (s *sqlStore) ApplyOrphanRetention(ctx context.Context, knownAccountIDs []string, policy RetentionPolicy, now time.Time) (RetentionResult, error) {
+	if len(knownAccountIDs) == 0 {
+		return s.applyRetention(ctx, "", nil, policy, now)
+	}
+	args := make([]interface{}, len(knownAccountIDs))
+	for i, id := range knownAccountIDs {
+		args[i] = normalizeAccount(id)
+	}
+	filter := " AND account_id NOT IN (?" + strings.Repeat(",?", len(args)-1) + ")"
+	return s.applyRetention(ctx, filter, args, policy, now)
+}
+
+// applyRetention 执行清理，filter 为追加到每张表删除条件上的账号过滤（以 " AND " 开头），为空表示全部账号。
+func (s *sqlStore) applyRetention(ctx context.Context, filter string, filterArgs []interface{}, policy RetentionPolicy, now time.Time) (RetentionResult, error) {
+	var res RetentionResult
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	now = now.UTC()
+	batch := policy.BatchSize
+	if batch <= 0 {
+		batch = defaultRetentionDeleteBatchSize
+	}
+
+	cuts := []struct {
+		table string
+		where string
+		days  int
+		dst   *int64
+	}{
+		{"node_metrics_raw", "ts < ?", policy.MetricsRawDays, &res.MetricsRaw},
+		{"node_metrics_hourly", "bucket_start < ?", policy.MetricsHourlyDays, &res.MetricsHourly},
+		{"node_metrics_daily", "bucket_start < ?", policy.MetricsDailyDays, &res.MetricsDaily},
+		{"node_metrics_monthly", "bucket_start < ?", policy.MetricsMonthlyDays, &res.MetricsMonthly},
+		{"health_check_history", "check_time < ?", policy.HealthHistoryDays, &res.HealthHistory},
+		{"notification_history", "created_at < ?", policy.NotificationHistoryDays, &res.NotificationHistory},
+		// 发件箱中已送达或已放弃的记录与通知历史同策略清理，pending 与投递中的记录保留。
+		{"notification_outbox", "created_at < ? AND status NOT IN ('" + OutboxStatusPending + "', '" + OutboxStatusSending + "')", policy.NotificationHistoryDays, &res.NotificationHistory},
+		{"monitor_shares", "((revoked AND revoked_at < ?) OR expire_at < ?)", policy.MonitorShareDays, &res.MonitorShares},
+	}
+	for _, c := range cuts {
+		if c.days <= 0 {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -c.days)
+		where := c.where
+		args := []interface{}{cutoff}
+		if c.table == "monitor_shares" {
+			args = append(args, cutoff)
+		}
+		where += filter
+		args = append(args, filterArgs...)
+		n, err := s.deleteInBatches(ctx, c.table, where, args, batch)
+		*c.dst += n
+		if err != nil {
+			return res, fmt.Errorf("cleanup %s: %w", c.table, err)
+		}
+	}
+	return res, nil
+}
+
+// deleteInBatches 重复执行带行数上限的 DELETE，直到不足一批，返回删除总行数。
+// 每批独立提交，大表清理不会长时间持有锁。
+func (s *sqlStore) deleteInBatches(ctx context.Context, table, where string, args []interface{}, batch int) (int64, error) {
+	stmt := s.dialect.deleteLimit(table, where, batch)
+	var total int64
+	for i := 0; i < retentionMaxBatches; i++ {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		ectx, cancel := withTimeout(ctx)
+		r, err := s.db.ExecContext(ectx, stmt, args...)
+		cancel()
+		if err != nil {
+			return total, err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(batch) {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SessionRecord 登录会话持久化模型。ID 为会话 token 的 SHA-256 哈希，明文 token 不落库。
+type SessionRecord struct {
+	ID         string
+	AccountID  string
+	UserID     string // 成员登录时为成员 ID，账号自身登录时为空
+	Role       string
+	IsAdmin    bool
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+}
+
+// SessionStore 登录会话存储接口，多副本共享同一数据库即可共享登录态。
+type SessionStore interface {
+	CreateSession(ctx context.Context, rec SessionRecord) error
+	GetSession(ctx context.Context, id string) (*SessionRecord, error)
+	TouchSession(ctx context.Context, id string, expiresAt, lastSeenAt time.Time) error
+	DeleteSession(ctx context.Context, id string) error
+	ListSessions(ctx context.Context, accountID string, now time.Time) ([]SessionRecord, error)
+	DeleteSessionsByAccount(ctx context.Context, accountID string) error
+	DeleteSessionsByUser(ctx context.Context, userID string) error
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ensureSessionsTable 创建 sessions 表，DDL 在两种方言下通用。
+func (s *sqlStore) ensureSessionsTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS sessions (
+		id CHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "sessions", "user_id", "VARCHAR(64) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "sessions", "role", "VARCHAR(32) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "sessions", "idx_sessions_account", "account_id", false); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "sessions", "idx_sessions_expires", "expires_at", false)
+}
+
+// CreateSession 写入新会话。
+func (s *sqlStore) CreateSession(ctx context.Context, rec SessionRecord) error {
+	if rec.ID == "" || rec.AccountID == "" {
+		return errors.New("id and account_id required")
+	}
+	if len(rec.UserAgent) > 512 {
+		rec.UserAgent = rec.UserAgent[:512]
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions (id, account_id, user_id, role, is_admin, user_agent, ip, created_at, expires_at, last_seen_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		rec.ID, rec.AccountID, rec.UserID, rec.Role, rec.IsAdmin, rec.UserAgent, rec.IP, rec.CreatedAt.UTC(), rec.ExpiresAt.UTC(), rec.LastSeenAt.UTC())
+	return err
+}
+
+// GetSession 读取会话（不判断过期，由调用方处理）；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetSession(ctx context.Context, id string) (*SessionRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var rec SessionRecord
+	err := s.db.QueryRowContext(ctx, `SELECT id, account_id, user_id, role, is_admin, user_agent, ip, created_at, expires_at, last_seen_at
+		FROM sessions WHERE id=?`, id).
+		Scan(&rec.ID, &rec.AccountID, &rec.UserID, &rec.Role, &rec.IsAdmin, &rec.UserAgent, &rec.IP, &rec.CreatedAt, &rec.ExpiresAt, &rec.LastSeenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// TouchSession 刷新会话最后活跃时间并顺延过期时间。
+func (s *sqlStore) TouchSession(ctx context.Context, id string, expiresAt, lastSeenAt time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE sessions SET expires_at=?, last_seen_at=? WHERE id=?`, expiresAt.UTC(), lastSeenAt.UTC(), id)
+	return err
+}
+
+// DeleteSession 删除（吊销）会话；不存在时返回 ErrNotFound。
+func (s *sqlStore) DeleteSession(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListSessions 列出账号在 now 时仍有效的会话，按最后活跃时间倒序；accountID 为空时返回全部账号。
+func (s *sqlStore) ListSessions(ctx context.Context, accountID string, now time.Time) ([]SessionRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	query := `SELECT id, account_id, user_id, role, is_admin, user_agent, ip, created_at, expires_at, last_seen_at FROM sessions WHERE expires_at > ?`
+	args := []any{now.UTC()}
+	if accountID != "" {
+		query += ` AND account_id=?`
+		args = append(args, accountID)
+	}
+	query += ` ORDER BY last_seen_at DESC`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SessionRecord
+	for rows.Next() {
+		var rec SessionRecord
+		if err := rows.Scan(&rec.ID, &rec.AccountID, &rec.UserID, &rec.Role, &rec.IsAdmin, &rec.UserAgent, &rec.IP, &rec.CreatedAt, &rec.ExpiresAt, &rec.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSessionsByAccount 吊销账号的全部会话。
+func (s *sqlStore) DeleteSessionsByAccount(ctx context.Context, accountID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE account_id=?`, accountID)
+	return err
+}
+
+// DeleteSessionsByUser 吊销成员的全部会话，角色变更或移除成员后调用。
+func (s *sqlStore) DeleteSessionsByUser(ctx context.Context, userID string) error {
+	if userID == "" {
+		return nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id=?`, userID)
+	return err
+}
+
+// DeleteExpiredSessions 清理 before 之前已过期的会话，返回删除行数。
+func (s *sqlStore) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/url"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteBusyTimeoutMs = "5000"
+
+// isSQLiteDSN 判断 dsn 是否指向 SQLite：sqlite://、sqlite: 或 file: 前缀。
+func isSQLiteDSN(dsn string) bool {
+	lower := strings.ToLower(strings.TrimSpace(dsn))
+	return strings.HasPrefix(lower, "sqlite:") || strings.HasPrefix(lower, "file:")
+}
+
+// sqliteDriverDSN 将 sqlite://path?x=y 转换为驱动可用的 file: URI，并补齐必需的参数。
+//   - _time_format=sqlite：时间以可排序文本写入，便于范围查询；
+//   - foreign_keys/busy_timeout/journal_mode：启用外键、锁等待与 WAL。
+func sqliteDriverDSN(dsn string) string {
+	dsn = strings.TrimSpace(dsn)
+	switch {
+	case strings.HasPrefix(strings.ToLower(dsn), "sqlite://"):
+		dsn = dsn[len("sqlite://"):]
+	case strings.HasPrefix(strings.ToLower(dsn), "sqlite:"):
+		dsn = dsn[len("sqlite:"):]
+	case strings.HasPrefix(strings.ToLower(dsn), "file:"):
+		dsn = dsn[len("file:"):]
+	}
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	if path == "" {
+		path = "qcc_plus.db"
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		params = url.Values{}
+	}
+	params.Set("_time_format", "sqlite")
+	pragmas := map[string]string{
+		"foreign_keys": "foreign_keys(1)",
+		"busy_timeout": "busy_timeout(" + sqliteBusyTimeoutMs + ")",
+	}
+	if path != ":memory:" {
+		pragmas["journal_mode"] = "journal_mode(WAL)"
+	}
+	for _, existing := range params["_pragma"] {
+		name, _, _ := strings.Cut(existing, "(")
+		delete(pragmas, strings.ToLower(strings.TrimSpace(name)))
+	}
+	for _, name := range []string{"foreign_keys", "busy_timeout", "journal_mode"} {
+		if p, ok := pragmas[name]; ok {
+			params.Add("_pragma", p)
+		}
+	}
+	return "file:" + path + "?" + params.Encode()
+}
+
+func openSQLite(dsn string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite", sqliteDriverDSN(dsn))
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 单写者模型：串行化连接，避免 SQLITE_BUSY，同时保证 :memory: 库在连接间共享。
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	log.Printf("store: sqlite backend enabled (maxOpen=1)")
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &sqlStore{db: db, dialect: sqliteDialect{}}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
@@ -12,10 +12,138 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 )
 
-type Store struct{ db *sql.DB }
+// Store 持久化层接口，MySQL 与 SQLite 后端均实现该接口。
+type Store interface {
+	AccountStore
+	NodeStore
+	ConfigStore
+	MetricsStore
+	HealthCheckStore
+	NotificationStore
+	SettingsStore
+	MonitorShareStore
+	TunnelStore
+	QuotaStore
+	APIKeyStore
+	SessionStore
+	RequestLogStore
+	NotificationOutboxStore
+	UsageStore
+	RetentionStore
+	UserStore
+	AuditStore
 
-// Open initializes a MySQL-backed store (dsn example: user:pass@tcp(host:3306)/dbname?parseTime=true).
-func Open(dsn string) (*Store, error) {
+	// Close 关闭底层数据库连接。
+	Close() error
+	// Stats 返回连接池统计信息。
+	Stats() sql.DBStats
+	// Driver 返回当前使用的后端（mysql/sqlite）。
+	Driver() string
+}
+
+// AccountStore 账号存储接口。
+type AccountStore interface {
+	CreateAccount(ctx context.Context, a AccountRecord) error
+	GetAccountByProxyKey(ctx context.Context, proxyKey string) (*AccountRecord, error)
+	GetAccountByID(ctx context.Context, id string) (*AccountRecord, error)
+	ListAccounts(ctx context.Context) ([]AccountRecord, error)
+	UpdateAccount(ctx context.Context, a AccountRecord) error
+	DeleteAccount(ctx context.Context, id string) error
+}
+
+// NodeStore 节点存储接口。
+type NodeStore interface {
+	UpsertNode(ctx context.Context, r NodeRecord) error
+	GetNodesByAccount(ctx context.Context, accountID string) ([]NodeRecord, error)
+	DeleteNode(ctx context.Context, id string) error
+}
+
+// ConfigStore 账号级运行配置存储接口。
+type ConfigStore interface {
+	LoadAllByAccount(ctx context.Context, accountID string) (records []NodeRecord, cfg Config, activeID string, err error)
+	LoadConfigByAccount(ctx context.Context, accountID string) (Config, string, error)
+	SetActive(ctx context.Context, accountID, id string) error
+	UpdateConfig(ctx context.Context, accountID string, cfg Config, active string) error
+}
+
+// MetricsStore 监控指标存储接口。
+type MetricsStore interface {
+	InsertMetrics(ctx context.Context, rec MetricsRecord) error
+	QueryMetrics(ctx context.Context, q MetricsQuery) ([]MetricsRecord, error)
+	GetNode24hTrend(ctx context.Context, accountID, nodeID string) ([]MetricsRecord, error)
+	GetNodes24hTrend(ctx context.Context, accountID string, nodeIDs []string) (map[string][]MetricsRecord, error)
+	SummarizeMetrics(ctx context.Context, accountID string, from, to time.Time) ([]MetricsRecord, error)
+	AggregateMetrics(ctx context.Context, accountID string, target MetricsGranularity, from, to time.Time) error
+	CleanupMetrics(ctx context.Context, accountID string, now time.Time) error
+}
+
+// HealthCheckStore 健康检查历史存储接口。
+type HealthCheckStore interface {
+	InsertHealthCheck(ctx context.Context, record *HealthCheckRecord) error
+	LatestHealthCheck(ctx context.Context, accountID, nodeID string) (*HealthCheckRecord, error)
+	QueryHealthChecks(ctx context.Context, params QueryHealthCheckParams) ([]HealthCheckRecord, error)
+	CountHealthChecks(ctx context.Context, params QueryHealthCheckParams) (int64, error)
+	CleanupHealthChecks(ctx context.Context, before time.Time) error
+}
+
+// NotificationStore 通知渠道、订阅与历史存储接口。
+type NotificationStore interface {
+	CreateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error
+	UpdateNotificationChannel(ctx context.Context, rec NotificationChannelRecord) error
+	GetNotificationChannel(ctx context.Context, id string) (*NotificationChannelRecord, error)
+	ListNotificationChannels(ctx context.Context, accountID string) ([]NotificationChannelRecord, error)
+	DeleteNotificationChannel(ctx context.Context, id string) error
+	GetNotificationSubscription(ctx context.Context, id string) (*NotificationSubscriptionRecord, error)
+	ListNotificationSubscriptions(ctx context.Context, accountID, channelID string) ([]NotificationSubscriptionRecord, error)
+	DeleteNotificationSubscription(ctx context.Context, id string) error
+	UpsertNotificationSubscription(ctx context.Context, rec NotificationSubscriptionRecord) error
+	ListEnabledSubscriptionsForEvent(ctx context.Context, accountID, eventType string) ([]SubscriptionWithChannel, error)
+	InsertNotificationHistory(ctx context.Context, rec NotificationHistoryRecord) error
+}
+
+// MonitorShareStore 监控分享链接存储接口。
+type MonitorShareStore interface {
+	CreateMonitorShare(ctx context.Context, rec MonitorShareRecord) error
+	GetMonitorShareByToken(ctx context.Context, token string) (*MonitorShareRecord, error)
+	GetMonitorShareByID(ctx context.Context, id string) (*MonitorShareRecord, error)
+	ListMonitorShares(ctx context.Context, params QueryMonitorSharesParams) ([]MonitorShareRecord, error)
+	RevokeMonitorShare(ctx context.Context, id string) error
+	DeleteMonitorShare(ctx context.Context, id string) error
+}
+
+// TunnelStore 隧道配置存储接口。
+type TunnelStore interface {
+	GetTunnelConfig(ctx context.Context) (*TunnelConfig, error)
+	SaveTunnelConfig(ctx context.Context, cfg TunnelConfig) error
+}
+
+// sqlStore 基于 database/sql 的通用实现，SQL 方言差异由 dialect 屏蔽。
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open initializes a store from dsn. The backend is picked by scheme:
+//   - sqlite://path/to/qcc.db, sqlite::memory: or file:qcc.db selects the embedded SQLite backend;
+//   - anything else (optionally prefixed with mysql://) is treated as a MySQL DSN,
+//     e.g. user:pass@tcp(host:3306)/dbname?parseTime=true.
+func Open(dsn string) (Store, error) {
+	var (
+		s   *sqlStore
+		err error
+	)
+	if isSQLiteDSN(dsn) {
+		s, err = openSQLite(dsn)
+	} else {
+		s, err = openMySQL(strings.TrimPrefix(dsn, "mysql://"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func openMySQL(dsn string) (*sqlStore, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
@@ -28,14 +156,17 @@ func Open(dsn string) (*Store, error) {
 	if err := db.PingContext(ctx); err != nil {
 		return nil, err
 	}
-	s := &Store{db: db}
+	s := &sqlStore{db: db, dialect: mysqlDialect{}}
 	if err := s.migrate(ctx); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
-func (s *Store) migrate(ctx context.Context) error {
+func (s *sqlStore) migrate(ctx context.Context) error {
+	if s.dialect.name() == driverSQLite {
+		return s.migrateSQLite(ctx)
+	}
 	if err := s.ensureAccountsTable(ctx); err != nil {
 		return err
 	}
@@ -63,6 +194,30 @@ func (s *Store) migrate(ctx context.Context) error {
 	if err := s.ensureNotificationTables(ctx); err != nil {
 		return err
 	}
+	if err := s.ensureQuotaTables(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAPIKeysTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureSessionsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureUsersTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAuditEventsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRequestLogsTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureNotificationOutboxTable(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureModelUsageTable(ctx); err != nil {
+		return err
+	}
 	if err := s.ensureSettingsTable(ctx); err != nil {
 		return err
 	}
@@ -72,18 +227,26 @@ func (s *Store) migrate(ctx context.Context) error {
 	if err := s.migrateConfigToSettings(ctx); err != nil {
 		return err
 	}
-	return s.ensureMonitorSharesTable(ctx)
+	if err := s.ensureMonitorSharesTable(ctx); err != nil {
+		return err
+	}
+	return s.ensureRetentionIndexes(ctx)
 }
 
-func (s *Store) Close() error {
+func (s *sqlStore) Close() error {
 	if s == nil || s.db == nil {
 		return nil
 	}
 	return s.db.Close()
 }
 
+// Driver 返回当前后端名称。
+func (s *sqlStore) Driver() string {
+	return s.dialect.name()
+}
+
 // Stats returns the current database pool statistics for monitoring or logging.
-func (s *Store) Stats() sql.DBStats {
+func (s *sqlStore) Stats() sql.DBStats {
 	if s == nil || s.db == nil {
 		return sql.DBStats{}
 	}
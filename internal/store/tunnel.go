@@ -28,7 +28,7 @@ const (
 )
 
 // GetTunnelConfig 读取隧道配置；未配置时返回 ErrNotFound。
-func (s *Store) GetTunnelConfig(ctx context.Context) (*TunnelConfig, error) {
+func (s *sqlStore) GetTunnelConfig(ctx context.Context) (*TunnelConfig, error) {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
@@ -57,7 +57,7 @@ func (s *Store) GetTunnelConfig(ctx context.Context) (*TunnelConfig, error) {
 }
 
 // SaveTunnelConfig 保存隧道配置；若未提供 APIToken 则沿用已存储的值。
-func (s *Store) SaveTunnelConfig(ctx context.Context, cfg TunnelConfig) error {
+func (s *sqlStore) SaveTunnelConfig(ctx context.Context, cfg TunnelConfig) error {
 	ctx, cancel := withTimeout(ctx)
 	defer cancel()
 
@@ -77,9 +77,8 @@ func (s *Store) SaveTunnelConfig(ctx context.Context, cfg TunnelConfig) error {
 	encToken := encodeToken(storedToken)
 
 	_, err := s.db.ExecContext(ctx, `INSERT INTO tunnel_config (id, api_token, subdomain, zone, enabled, public_url, status, last_error, updated_at)
-VALUES (?,?,?,?,?,?,?, ?, NOW())
-ON DUPLICATE KEY UPDATE api_token=VALUES(api_token), subdomain=VALUES(subdomain), zone=VALUES(zone), enabled=VALUES(enabled), public_url=VALUES(public_url), status=VALUES(status), last_error=VALUES(last_error), updated_at=NOW()`,
-		cfg.ID, encToken, cfg.Subdomain, cfg.Zone, cfg.Enabled, nullOrString(cfg.PublicURL), cfg.Status, cfg.LastError)
+VALUES (?,?,?,?,?,?,?,?,?) `+s.dialect.onConflictUpdate("api_token", "subdomain", "zone", "enabled", "public_url", "status", "last_error", "updated_at"),
+		cfg.ID, encToken, cfg.Subdomain, cfg.Zone, cfg.Enabled, nullOrString(cfg.PublicURL), cfg.Status, cfg.LastError, time.Now())
 	return err
 }
 
@@ -38,6 +38,10 @@ type NodeRecord struct {
 	LastPingMs        int64
 	LastPingErr       string
 	LastHealthCheckAt time.Time
+	SupportedModels   []string          // 节点可服务的模型（支持 * 后缀通配），为空表示不限制
+	ModelMap          map[string]string // 请求模型 → 上游模型名（键支持 * 后缀通配）
+	HealthProbes      json.RawMessage   // 健康检查探针链（JSON 数组），为空时使用 HealthCheckMethod
+	PriceMultiplier   float64           // 计费倍率，按模型价格表计算的费用乘以该值，默认 1
 }
 
 // HealthCheckRecord 健康检查历史记录
@@ -63,6 +67,9 @@ type QueryHealthCheckParams struct {
 	Limit       int
 	Offset      int
 	CheckSource string
+	// Forward 为 true 时按 id 正序返回 id > AfterID 的最早 Limit 条（游标遍历，忽略 Offset），NodeID 可为空。
+	Forward bool
+	AfterID int64
 }
 
 // MetricsGranularity 描述查询或聚合的时间粒度。
@@ -81,6 +88,7 @@ type MetricsRecord struct {
 	ID                  int64
 	AccountID           string
 	NodeID              string
+	APIKeyID            string // 发起请求的 API Key，仅原始粒度记录；账号主密钥为空
 	Timestamp           time.Time
 	RequestsTotal       int64
 	RequestsSuccess     int64
@@ -92,8 +100,10 @@ type MetricsRecord struct {
 	BytesTotal          int64
 	InputTokensTotal    int64
 	OutputTokensTotal   int64
-	FirstByteTimeSumMs  int64 // 首字节时间总和（毫秒）
-	StreamDurationSumMs int64 // 流式持续时间总和（毫秒）
+	FirstByteTimeSumMs  int64            // 首字节时间总和（毫秒）
+	StreamDurationSumMs int64            // 流式持续时间总和（毫秒）
+	ResponseTimeHist    LatencyHistogram // 响应耗时分布，用于计算 p50/p95/p99
+	FirstByteHist       LatencyHistogram // 首字节耗时分布，仅统计有响应体的请求
 	CreatedAt           time.Time
 }
 
@@ -158,11 +168,25 @@ type MetricsMonthly struct {
 type MetricsQuery struct {
 	AccountID   string
 	NodeID      string
+	APIKeyID    string // 仅支持原始粒度
 	From        time.Time
 	To          time.Time
 	Granularity MetricsGranularity
 	Limit       int
 	Offset      int
+	After       *MetricsCursor // 非空时只返回排序位于游标之后的记录（键集分页）
+}
+
+// MetricsCursor 监控数据键集分页游标，对应排序键 (时间, 节点, ID)；聚合表没有 ID，取 0。
+type MetricsCursor struct {
+	Timestamp time.Time
+	NodeID    string
+	ID        int64
+}
+
+// Cursor 返回指向该记录的分页游标。
+func (r MetricsRecord) Cursor() MetricsCursor {
+	return MetricsCursor{Timestamp: r.Timestamp, NodeID: r.NodeID, ID: r.ID}
 }
 
 // AccountRecord 账号记录。
@@ -207,6 +231,7 @@ type NotificationSubscriptionRecord struct {
 	ChannelID string
 	EventType string
 	Enabled   bool
+	Rules     json.RawMessage // 过滤、静默时段与模板规则，结构见 notify.SubscriptionRules
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ModelUsageRecord 按 天 × 账号 × 节点 × API Key × 模型 累计的用量与费用。
+type ModelUsageRecord struct {
+	Day                 string // 北京时间日期 YYYY-MM-DD
+	AccountID           string
+	NodeID              string
+	APIKeyID            string // 账号主密钥请求为空
+	Model               string
+	Requests            int64
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+	CostUSD             float64 // 按请求发生时的价格表与节点倍率计算
+	UpdatedAt           time.Time
+}
+
+// ModelUsageQuery 用量查询条件，零值字段不参与过滤；FromDay/ToDay 为闭区间。
+type ModelUsageQuery struct {
+	AccountID string
+	NodeID    string
+	APIKeyID  string
+	Model     string
+	FromDay   string
+	ToDay     string
+}
+
+// UsageStore 按模型用量与费用存储接口。
+type UsageStore interface {
+	// AddModelUsage 将 rec 的计数与费用累加到同一天同一维度的记录上。
+	AddModelUsage(ctx context.Context, rec ModelUsageRecord) error
+	// QueryModelUsage 返回满足条件的逐日明细，按日期、账号、节点、Key、模型排序。
+	QueryModelUsage(ctx context.Context, q ModelUsageQuery) ([]ModelUsageRecord, error)
+}
+
+// ensureModelUsageTable 创建 model_usage_daily 表，DDL 在两种方言下通用。
+func (s *sqlStore) ensureModelUsageTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS model_usage_daily (
+		day VARCHAR(10) NOT NULL,
+		account_id VARCHAR(64) NOT NULL,
+		node_id VARCHAR(64) NOT NULL DEFAULT '',
+		api_key_id VARCHAR(64) NOT NULL DEFAULT '',
+		model VARCHAR(128) NOT NULL DEFAULT '',
+		requests BIGINT NOT NULL DEFAULT 0,
+		input_tokens BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		cache_creation_tokens BIGINT NOT NULL DEFAULT 0,
+		cache_read_tokens BIGINT NOT NULL DEFAULT 0,
+		cost_usd DOUBLE NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (day, account_id, node_id, api_key_id, model)
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "model_usage_daily", "idx_model_usage_account_day", "account_id, day", false)
+}
+
+// AddModelUsage 累加用量与费用。
+func (s *sqlStore) AddModelUsage(ctx context.Context, rec ModelUsageRecord) error {
+	inc := func(col string) string { return col + "=" + col + "+" + s.dialect.excluded(col) }
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO model_usage_daily (day, account_id, node_id, api_key_id, model,
+		requests, input_tokens, output_tokens, cache_creation_tokens, cache_read_tokens, cost_usd, updated_at)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?) `+s.dialect.onConflictUpdate(
+		inc("requests"), inc("input_tokens"), inc("output_tokens"),
+		inc("cache_creation_tokens"), inc("cache_read_tokens"), inc("cost_usd"), "updated_at"),
+		rec.Day, normalizeAccount(rec.AccountID), rec.NodeID, rec.APIKeyID, rec.Model,
+		rec.Requests, rec.InputTokens, rec.OutputTokens, rec.CacheCreationTokens, rec.CacheReadTokens, rec.CostUSD,
+		time.Now().UTC())
+	return err
+}
+
+// QueryModelUsage 查询逐日用量明细。
+func (s *sqlStore) QueryModelUsage(ctx context.Context, q ModelUsageQuery) ([]ModelUsageRecord, error) {
+	var (
+		args  []interface{}
+		conds []string
+	)
+	if q.AccountID != "" {
+		conds = append(conds, "account_id=?")
+		args = append(args, normalizeAccount(q.AccountID))
+	}
+	if q.NodeID != "" {
+		conds = append(conds, "node_id=?")
+		args = append(args, q.NodeID)
+	}
+	if q.APIKeyID != "" {
+		conds = append(conds, "api_key_id=?")
+		args = append(args, q.APIKeyID)
+	}
+	if q.Model != "" {
+		conds = append(conds, "model=?")
+		args = append(args, q.Model)
+	}
+	if q.FromDay != "" {
+		conds = append(conds, "day >= ?")
+		args = append(args, q.FromDay)
+	}
+	if q.ToDay != "" {
+		conds = append(conds, "day <= ?")
+		args = append(args, q.ToDay)
+	}
+	query := `SELECT day, account_id, node_id, api_key_id, model, requests, input_tokens, output_tokens,
+		cache_creation_tokens, cache_read_tokens, cost_usd, updated_at FROM model_usage_daily`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY day ASC, account_id ASC, node_id ASC, api_key_id ASC, model ASC"
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ModelUsageRecord
+	for rows.Next() {
+		var r ModelUsageRecord
+		if err := rows.Scan(&r.Day, &r.AccountID, &r.NodeID, &r.APIKeyID, &r.Model, &r.Requests, &r.InputTokens, &r.OutputTokens,
+			&r.CacheCreationTokens, &r.CacheReadTokens, &r.CostUSD, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
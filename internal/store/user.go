@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// UserRecord 账号成员：独立于账号自身登录的用户，按角色授权。Password 为 bcrypt 哈希。
+type UserRecord struct {
+	ID          string
+	AccountID   string
+	Username    string
+	Password    string
+	Role        string
+	Disabled    bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// UserStore 账号成员存储接口。
+type UserStore interface {
+	CreateUser(ctx context.Context, rec UserRecord) error
+	GetUserByID(ctx context.Context, id string) (*UserRecord, error)
+	GetUserByUsername(ctx context.Context, username string) (*UserRecord, error)
+	ListUsers(ctx context.Context, accountID string) ([]UserRecord, error)
+	UpdateUser(ctx context.Context, rec UserRecord) error
+	DeleteUser(ctx context.Context, id string) error
+	TouchUserLogin(ctx context.Context, id string, at time.Time) error
+}
+
+// ensureUsersTable 创建 account_users 表，用户名全局唯一，DDL 在两种方言下通用。
+func (s *sqlStore) ensureUsersTable(ctx context.Context) error {
+	ectx, cancel := withTimeout(ctx)
+	_, err := s.db.ExecContext(ectx, `CREATE TABLE IF NOT EXISTS account_users (
+		id VARCHAR(64) PRIMARY KEY,
+		account_id VARCHAR(64) NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		password VARCHAR(255) NOT NULL DEFAULT '',
+		role VARCHAR(32) NOT NULL,
+		disabled BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		last_login_at DATETIME NULL
+	)`)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := s.ensureIndex(ctx, "account_users", "uniq_account_users_username", "username", true); err != nil {
+		return err
+	}
+	return s.ensureIndex(ctx, "account_users", "idx_account_users_account", "account_id", false)
+}
+
+const userColumns = `id, account_id, username, password, role, disabled, created_at, updated_at, last_login_at`
+
+// CreateUser 新建账号成员。
+func (s *sqlStore) CreateUser(ctx context.Context, rec UserRecord) error {
+	rec.Username = strings.TrimSpace(rec.Username)
+	if rec.ID == "" || rec.AccountID == "" || rec.Username == "" {
+		return errors.New("id, account_id and username required")
+	}
+	now := time.Now().UTC()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = rec.CreatedAt
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO account_users (id, account_id, username, password, role, disabled, created_at, updated_at)
+		VALUES (?,?,?,?,?,?,?,?)`,
+		rec.ID, rec.AccountID, rec.Username, rec.Password, rec.Role, rec.Disabled, rec.CreatedAt.UTC(), rec.UpdatedAt.UTC())
+	return err
+}
+
+// GetUserByID 按 ID 查询成员；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetUserByID(ctx context.Context, id string) (*UserRecord, error) {
+	return s.getUser(ctx, `id=?`, id)
+}
+
+// GetUserByUsername 按用户名查询成员；不存在时返回 ErrNotFound。
+func (s *sqlStore) GetUserByUsername(ctx context.Context, username string) (*UserRecord, error) {
+	return s.getUser(ctx, `username=?`, strings.TrimSpace(username))
+}
+
+func (s *sqlStore) getUser(ctx context.Context, where string, arg any) (*UserRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rec, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM account_users WHERE `+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+// ListUsers 列出账号下的成员，按用户名排序；accountID 为空时返回全部。
+func (s *sqlStore) ListUsers(ctx context.Context, accountID string) ([]UserRecord, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	query := `SELECT ` + userColumns + ` FROM account_users`
+	var args []any
+	if accountID != "" {
+		query += ` WHERE account_id=?`
+		args = append(args, accountID)
+	}
+	query += ` ORDER BY username`
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UserRecord
+	for rows.Next() {
+		rec, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rec)
+	}
+	return out, rows.Err()
+}
+
+// UpdateUser 更新成员的密码哈希、角色与禁用状态；不存在时返回 ErrNotFound。
+func (s *sqlStore) UpdateUser(ctx context.Context, rec UserRecord) error {
+	if rec.UpdatedAt.IsZero() {
+		rec.UpdatedAt = time.Now().UTC()
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `UPDATE account_users SET password=?, role=?, disabled=?, updated_at=? WHERE id=?`,
+		rec.Password, rec.Role, rec.Disabled, rec.UpdatedAt.UTC(), rec.ID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUser 删除成员及其会话；不存在时返回 ErrNotFound。
+func (s *sqlStore) DeleteUser(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id=?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM account_users WHERE id=?`, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchUserLogin 记录成员最近一次登录时间。
+func (s *sqlStore) TouchUserLogin(ctx context.Context, id string, at time.Time) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE account_users SET last_login_at=? WHERE id=?`, at.UTC(), id)
+	return err
+}
+
+func scanUser(row rowScanner) (*UserRecord, error) {
+	var (
+		rec       UserRecord
+		lastLogin sql.NullTime
+	)
+	if err := row.Scan(&rec.ID, &rec.AccountID, &rec.Username, &rec.Password, &rec.Role, &rec.Disabled,
+		&rec.CreatedAt, &rec.UpdatedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	rec.LastLoginAt = timePtr(lastLogin)
+	return &rec, nil
+}
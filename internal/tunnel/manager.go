@@ -186,6 +186,16 @@ func (m *Manager) Start(ctx context.Context, localAddr string) error {
 
 // Stop 停止 cloudflared 并清理远端资源。
 func (m *Manager) Stop() error {
+	return m.stop(false)
+}
+
+// Handover 停止 cloudflared 并删除本进程创建的隧道，但保留 DNS 记录，
+// 用于平滑重启：接管的新进程会创建新隧道并把同一 DNS 记录改指向自己。
+func (m *Manager) Handover() error {
+	return m.stop(true)
+}
+
+func (m *Manager) stop(keepDNS bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -203,8 +213,10 @@ func (m *Manager) Stop() error {
 		m.cmd = nil
 	}
 
-	if err := m.cleanupDNS(); err != nil {
-		errs = append(errs, err.Error())
+	if !keepDNS {
+		if err := m.cleanupDNS(); err != nil {
+			errs = append(errs, err.Error())
+		}
 	}
 	if err := m.cleanupTunnel(); err != nil {
 		errs = append(errs, err.Error())